@@ -4,6 +4,7 @@
 #include "config.h"
 #include "models.h"
 #include "auth_manager.h"
+#include "pricing_engine.h"
 #include <WiFi.h>
 #include <HTTPClient.h>
 #include <ArduinoJson.h>
@@ -13,6 +14,8 @@ private:
     String serverUrl;
     HTTPClient http;
     AuthManager* authManager;
+    String currentTripEtag;             // ETag останньої відповіді /iot/current-trip
+    CurrentTripResult lastCurrentTrip;  // остання відповідь /iot/current-trip
 
     String buildUrl(const char* endpoint) {
         return serverUrl + String(API_BASE_PATH) + String(endpoint);
@@ -32,6 +35,7 @@ public:
     ApiClient() {
         serverUrl = String("http://") + SERVER_HOST + ":" + String(SERVER_PORT);
         authManager = nullptr;
+        lastCurrentTrip.success = false;
     }
 
     void setAuthManager(AuthManager* auth) {
@@ -148,6 +152,13 @@ public:
 
         if (httpCode == 200) {
             Serial.println("[API] Price recommendation sent");
+
+            // Сервер перераховує ціну і позначає рекомендацію, якщо вона розходиться з його розрахунком
+            JsonDocument result;
+            if (!deserializeJson(result, response) && (result["flagged"] | false)) {
+                Serial.printf("[API] Price flagged by server (%s): device=%.2f, server=%.2f\n",
+                    result["reason"] | "unknown", rec.recommendedPrice, result["server_price"] | 0.0f);
+            }
             return true;
         } else if (httpCode == 401) {
             Serial.println("[API] Authentication failed for price recommendation");
@@ -159,8 +170,96 @@ public:
         }
     }
 
-    // Отримання конфігурації рейсу
-    TripConfig getTripConfig(int64_t tripId) {
+    // Розбір параметрів ціноутворення з відповіді сервера
+    void parsePricingParams(JsonObject obj, PricingParams& params) {
+        params.version = obj["version"] | "";
+        params.lowThreshold = obj["low_demand_threshold"] | params.lowThreshold;
+        params.mediumThreshold = obj["medium_demand_threshold"] | params.mediumThreshold;
+        params.highThreshold = obj["high_demand_threshold"] | params.highThreshold;
+
+        JsonObject demand = obj["demand_coefficients"];
+        params.demandLow = demand["low"] | params.demandLow;
+        params.demandMedium = demand["medium"] | params.demandMedium;
+        params.demandHigh = demand["high"] | params.demandHigh;
+        params.demandVeryHigh = demand["very_high"] | params.demandVeryHigh;
+
+        JsonArray peaks = obj["peak_hours"];
+        if (!peaks.isNull()) {
+            params.peakCount = 0;
+            for (JsonObject peak : peaks) {
+                if (params.peakCount >= MAX_PEAK_RANGES) break;
+                params.peakHours[params.peakCount].start = peak["start"];
+                params.peakHours[params.peakCount].end = peak["end"];
+                params.peakCount++;
+            }
+        }
+        params.peakCoeff = obj["peak_hours_coefficient"] | params.peakCoeff;
+
+        JsonObject night = obj["night_hours"];
+        params.nightHours.start = night["start"] | params.nightHours.start;
+        params.nightHours.end = night["end"] | params.nightHours.end;
+        params.nightCoeff = obj["night_coefficient"] | params.nightCoeff;
+        params.weekendCoeff = obj["weekend_coefficient"] | params.weekendCoeff;
+
+        JsonArray seasons = obj["seasons"];
+        params.seasonCount = 0;
+        for (JsonObject season : seasons) {
+            if (params.seasonCount >= MAX_SEASONS) break;
+            SeasonalPeriod& period = params.seasons[params.seasonCount];
+            period.startMonth = season["start_month"];
+            period.startDay = season["start_day"];
+            period.endMonth = season["end_month"];
+            period.endDay = season["end_day"];
+            period.coefficient = season["coefficient"] | 1.0;
+            params.seasonCount++;
+        }
+        params.defaultSeasonCoeff = obj["default_seasonal_coefficient"] | params.defaultSeasonCoeff;
+        params.minCoeff = obj["price_min_coefficient"] | params.minCoeff;
+        params.maxCoeff = obj["price_max_coefficient"] | params.maxCoeff;
+        params.roundStep = obj["rounding_step"] | params.roundStep;
+    }
+
+    // Розбір часу відправлення у форматі RFC 3339. Година та дата беруться
+    // в зміщенні, вказаному сервером, як і при розрахунку ціни на сервері
+    bool parseDepartureTime(const char* value, struct tm& result) {
+        int year, month, day, hour, minute, second;
+        if (!value || sscanf(value, "%d-%d-%dT%d:%d:%d", &year, &month, &day, &hour, &minute, &second) != 6) {
+            return false;
+        }
+
+        memset(&result, 0, sizeof(result));
+        result.tm_year = year - 1900;
+        result.tm_mon = month - 1;
+        result.tm_mday = day;
+        result.tm_hour = hour;
+        result.tm_min = minute;
+        result.tm_sec = second;
+
+        // День тижня за алгоритмом Сакамото (0 = неділя)
+        static const int offsets[] = {0, 3, 2, 5, 0, 3, 5, 1, 4, 6, 2, 4};
+        int y = month < 3 ? year - 1 : year;
+        result.tm_wday = (y + y / 4 - y / 100 + y / 400 + offsets[month - 1] + day) % 7;
+        return true;
+    }
+
+    // Розбір конфігурації рейсу з відповіді сервера
+    void parseTripConfig(JsonObject obj, TripConfig& config) {
+        config.tripId = obj["trip_id"];
+        config.routeId = obj["route_id"];
+        config.busCapacity = obj["bus_capacity"];
+        config.basePrice = obj["base_price"];
+        config.hasDeparture = parseDepartureTime(obj["departure_time"].as<const char*>(), config.departure);
+        config.pricing = PricingEngine::defaultParams();
+        if (obj["pricing"].is<JsonObject>()) {
+            parsePricingParams(obj["pricing"].as<JsonObject>(), config.pricing);
+        }
+        config.etag = "";
+        config.isValid = true;
+    }
+
+    // Отримання конфігурації рейсу. Якщо передано збережену конфігурацію,
+    // сервер може відповісти 304 і тоді вона повертається без змін
+    TripConfig getTripConfig(int64_t tripId, const TripConfig* cached = nullptr) {
         TripConfig config;
         config.isValid = false;
 
@@ -173,27 +272,37 @@ public:
         http.begin(url);
         setHeaders();
 
+        bool useCache = cached && cached->isValid && cached->tripId == tripId && cached->etag.length() > 0;
+        if (useCache) {
+            http.addHeader("If-None-Match", cached->etag);
+        }
+        const char* headerKeys[] = {"ETag"};
+        http.collectHeaders(headerKeys, 1);
+
         Serial.printf("[API] GET /iot/config/%lld\n", tripId);
 
         int httpCode = http.GET();
         String response = http.getString();
+        String etag = http.header("ETag");
         http.end();
 
         Serial.printf("[API] Response code: %d\n", httpCode);
 
+        if (httpCode == 304 && useCache) {
+            Serial.println("[API] Trip configuration not modified");
+            return *cached;
+        }
+
         if (httpCode == 200) {
             JsonDocument doc;
             DeserializationError error = deserializeJson(doc, response);
             
             if (!error) {
-                config.tripId = doc["trip_id"];
-                config.routeId = doc["route_id"];
-                config.busCapacity = doc["bus_capacity"];
-                config.basePrice = doc["base_price"];
-                config.isValid = true;
-
-                Serial.printf("[API] Configuration: capacity=%d, basePrice=%.2f\n", 
-                    config.busCapacity, config.basePrice);
+                parseTripConfig(doc.as<JsonObject>(), config);
+                config.etag = etag;
+
+                Serial.printf("[API] Configuration: capacity=%d, basePrice=%.2f, pricing=%s\n", 
+                    config.busCapacity, config.basePrice, config.pricing.version.c_str());
             }
         } else if (httpCode == 401) {
             Serial.println("[API] Authentication failed for trip config");
@@ -205,6 +314,76 @@ public:
         return config;
     }
 
+    // Визначення поточного рейсу автобуса без ID рейсу. Незмінена відповідь (304)
+    // повертає попередній результат
+    CurrentTripResult getCurrentTrip() {
+        CurrentTripResult result;
+        result.success = false;
+        result.status = "none";
+        result.config.isValid = false;
+        result.pollIntervalMs = CURRENT_TRIP_POLL_INTERVAL_MS;
+
+        if (!authManager || !authManager->isAuthenticated()) {
+            Serial.println("[API] Device not authenticated for current trip");
+            return result;
+        }
+
+        String url = buildUrl("/iot/current-trip");
+        http.begin(url);
+        setHeaders();
+
+        bool useCache = lastCurrentTrip.success && currentTripEtag.length() > 0;
+        if (useCache) {
+            http.addHeader("If-None-Match", currentTripEtag);
+        }
+        const char* headerKeys[] = {"ETag"};
+        http.collectHeaders(headerKeys, 1);
+
+        Serial.println("[API] GET /iot/current-trip");
+
+        int httpCode = http.GET();
+        String response = http.getString();
+        String etag = http.header("ETag");
+        http.end();
+
+        Serial.printf("[API] Response code: %d\n", httpCode);
+
+        if (httpCode == 304 && useCache) {
+            Serial.println("[API] Current trip not modified");
+            return lastCurrentTrip;
+        }
+
+        if (httpCode == 200) {
+            JsonDocument doc;
+            DeserializationError error = deserializeJson(doc, response);
+
+            if (!error) {
+                result.status = doc["status"] | "none";
+                int pollSeconds = doc["poll_interval_seconds"] | 0;
+                if (pollSeconds > 0) {
+                    result.pollIntervalMs = (unsigned long)pollSeconds * 1000UL;
+                }
+                if (doc["config"].is<JsonObject>()) {
+                    parseTripConfig(doc["config"].as<JsonObject>(), result.config);
+                }
+                result.success = true;
+
+                lastCurrentTrip = result;
+                currentTripEtag = etag;
+
+                Serial.printf("[API] Current trip: status=%s, trip=%lld\n",
+                    result.status.c_str(), result.config.isValid ? result.config.tripId : (int64_t)0);
+            }
+        } else if (httpCode == 401) {
+            Serial.println("[API] Authentication failed for current trip");
+            authManager->clearToken();
+        } else {
+            Serial.printf("[API] Failed to get current trip: %d\n", httpCode);
+        }
+
+        return result;
+    }
+
     // Перевірка доступності сервера
     bool checkServerAvailability() {
         return WiFi.status() == WL_CONNECTED && authManager && authManager->isAuthenticated();
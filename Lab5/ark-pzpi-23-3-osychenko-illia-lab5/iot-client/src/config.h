@@ -44,6 +44,7 @@
 
 // Інтервали (мс)
 #define SYNC_INTERVAL_MS 300000        // 5 хвилин
+#define CURRENT_TRIP_POLL_INTERVAL_MS 300000  // 5 хвилин, якщо сервер не вказав інше
 #define PRICE_CALC_INTERVAL_MS 300000  // 5 хвилин
 #define DISPLAY_UPDATE_INTERVAL_MS 1000
 #define SENSOR_DEBOUNCE_MS 500
@@ -84,6 +85,10 @@
 #define NIGHT_START 23
 #define NIGHT_END 6
 
+// Розміри таблиць параметрів ціноутворення, отриманих з сервера
+#define MAX_PEAK_RANGES 4
+#define MAX_SEASONS 8
+
 // Пороги категорій ціни
 #define PRICE_CATEGORY_DISCOUNT 0.80
 #define PRICE_CATEGORY_LOW 0.95
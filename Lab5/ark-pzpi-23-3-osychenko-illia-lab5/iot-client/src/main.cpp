@@ -27,6 +27,7 @@ bool offlineMode = false;  // Прапорець автономного режи
 // Попередні оголошення
 void syncEvents();
 void calculateAndSendPrice();
+bool refreshCurrentTrip();
 
 // Таймери
 unsigned long lastSyncTime = 0;
@@ -34,6 +35,8 @@ unsigned long lastPriceCalcTime = 0;
 unsigned long lastDisplayUpdate = 0;
 unsigned long lastStorageCheck = 0;
 unsigned long lastTokenCheck = 0;
+unsigned long lastTripCheck = 0;
+unsigned long tripPollIntervalMs = CURRENT_TRIP_POLL_INTERVAL_MS;
 unsigned long lastHeartbeat = 0;  // Перевірка доступності сервера
 
 // Таймер: допоміжні змінні
@@ -85,10 +88,8 @@ void checkOfflineMode() {
         display.showDebugInfo("ONLINE MODE", "Loading config...");
         delay(1000);
         
-        // Підтягуємо конфігурацію з сервера
-        TripConfig serverConfig = apiClient.getTripConfig(DEFAULT_TRIP_ID);
-        if (serverConfig.isValid) {
-            tripConfig = serverConfig;
+        // Підтягуємо поточний рейс та його конфігурацію з сервера
+        if (refreshCurrentTrip()) {
             Serial.printf("[System] Config loaded: capacity=%d, basePrice=%.2f\n", 
                 tripConfig.busCapacity, tripConfig.basePrice);
             
@@ -185,6 +186,8 @@ void initDeviceState() {
     tripConfig.tripId = DEFAULT_TRIP_ID;
     tripConfig.busCapacity = DEFAULT_BUS_CAPACITY;
     tripConfig.basePrice = DEFAULT_BASE_PRICE;
+    tripConfig.hasDeparture = false;
+    tripConfig.pricing = PricingEngine::defaultParams();
     tripConfig.isValid = true;
 
     Serial.println("[State] Device state initialized");
@@ -263,16 +266,69 @@ void syncEvents() {
     }
 }
 
+// Запит поточного рейсу автобуса з сервера. Повертає true, якщо отримано конфігурацію рейсу
+bool refreshCurrentTrip() {
+    lastTripCheck = millis();
+
+    CurrentTripResult result = apiClient.getCurrentTrip();
+    if (!result.success) {
+        return false;
+    }
+    tripPollIntervalMs = result.pollIntervalMs;
+
+    if (!result.config.isValid) {
+        Serial.printf("[Trip] No current trip, using trip %lld\n", tripConfig.tripId);
+        return false;
+    }
+
+    if (result.config.tripId != tripConfig.tripId) {
+        // Події в буфері не містять ID рейсу, тому рейс змінюється лише після синхронізації всіх подій.
+        // syncEvents надсилає один пакет, тож повторюємо, поки кількість несинхронізованих зменшується
+        int pending = eventBuffer.getUnsyncedCount();
+        if (pending > 0) {
+            Serial.println("[Trip] Syncing pending events before switching trip");
+        }
+        while (pending > 0) {
+            syncEvents();
+            int remaining = eventBuffer.getUnsyncedCount();
+            if (remaining >= pending) {
+                break;
+            }
+            pending = remaining;
+        }
+
+        if (eventBuffer.getUnsyncedCount() > 0) {
+            // Інакше події старого рейсу були б надіслані з ID нового; спробуємо при наступній перевірці
+            Serial.printf("[Trip] %d events of trip %lld are not synced, keeping it\n",
+                eventBuffer.getUnsyncedCount(), tripConfig.tripId);
+            return false;
+        }
+
+        Serial.printf("[Trip] Switched to trip %lld (%s)\n",
+            result.config.tripId, result.status.c_str());
+    }
+
+    tripConfig = result.config;
+    return true;
+}
+
 // Розрахунок та відправка рекомендації ціни
 void calculateAndSendPrice() {
+    // Як і сервер, рахуємо за запланованим часом відправлення рейсу,
+    // а поточний час використовуємо лише якщо він невідомий
     struct tm timeinfo;
-    getLocalTime(&timeinfo);
+    if (tripConfig.hasDeparture) {
+        timeinfo = tripConfig.departure;
+    } else {
+        getLocalTime(&timeinfo);
+    }
 
     currentPrice = pricingEngine.calculatePrice(
         tripConfig.basePrice,
         deviceState.currentPassengers,
         tripConfig.busCapacity,
-        &timeinfo
+        &timeinfo,
+        tripConfig.pricing
     );
 
     deviceState.lastPriceCalc = millis();
@@ -460,10 +516,8 @@ void setup() {
                 display.showAuthStatus("Success!");
                 delay(2000);
                 
-                // Завантаження конфігурації з сервера
-                TripConfig serverConfig = apiClient.getTripConfig(DEFAULT_TRIP_ID);
-                if (serverConfig.isValid) {
-                    tripConfig = serverConfig;
+                // Визначення поточного рейсу та завантаження його конфігурації
+                if (refreshCurrentTrip()) {
                     Serial.println("[Setup] Trip configuration loaded from server");
                 } else {
                     Serial.println("[Setup] Using default trip configuration");
@@ -543,6 +597,15 @@ void loop() {
         }
     }
 
+    // Періодична перевірка поточного рейсу
+    if (now - lastTripCheck >= tripPollIntervalMs) {
+        if (deviceState.wifiConnected && authManager.isAuthenticated()) {
+            refreshCurrentTrip();
+        } else {
+            lastTripCheck = now;
+        }
+    }
+
     // Періодичний розрахунок ціни
     if (now - lastPriceCalcTime >= PRICE_CALC_INTERVAL_MS) {
         lastPriceCalcTime = now;
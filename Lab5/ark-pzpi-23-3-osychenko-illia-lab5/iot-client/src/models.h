@@ -1,7 +1,9 @@
 #ifndef MODELS_H
 #define MODELS_H
 
+#include "config.h"
 #include <Arduino.h>
+#include <time.h>
 
 // Типи подій пасажирів
 enum EventType {
@@ -31,12 +33,55 @@ struct PriceRecommendation {
     unsigned long calculatedAt; // час розрахунку
 };
 
+// Проміжок годин доби включно (start > end - через північ)
+struct HourRange {
+    int start;
+    int end;
+};
+
+// Сезонний період включно (початок пізніше кінця - через Новий рік)
+struct SeasonalPeriod {
+    int startMonth;
+    int startDay;
+    int endMonth;
+    int endDay;
+    float coefficient;
+};
+
+// Параметри ціноутворення (отримуються з сервера, за замовчуванням - з config.h)
+struct PricingParams {
+    String version;                         // версія параметрів на сервері
+    float lowThreshold;                     // пороги завантаженості (%)
+    float mediumThreshold;
+    float highThreshold;
+    float demandLow;                        // коефіцієнти попиту
+    float demandMedium;
+    float demandHigh;
+    float demandVeryHigh;
+    HourRange peakHours[MAX_PEAK_RANGES];   // пікові години
+    int peakCount;
+    float peakCoeff;
+    HourRange nightHours;                   // нічні години
+    float nightCoeff;
+    float weekendCoeff;
+    SeasonalPeriod seasons[MAX_SEASONS];    // сезони в порядку пріоритету
+    int seasonCount;
+    float defaultSeasonCoeff;
+    float minCoeff;                         // межі ціни відносно базової
+    float maxCoeff;
+    float roundStep;                        // крок округлення ціни
+};
+
 // Конфігурація рейсу (отримується з сервера)
 struct TripConfig {
     int64_t tripId;             // ID рейсу
     int64_t routeId;            // ID маршруту
     int busCapacity;            // місткість автобуса
     float basePrice;            // базова ціна квитка
+    struct tm departure;        // запланований час відправлення
+    bool hasDeparture;          // чи відомий час відправлення
+    PricingParams pricing;      // параметри ціноутворення
+    String etag;                // ETag конфігурації для If-None-Match
     bool isValid;               // чи валідна конфігурація
 };
 
@@ -52,6 +97,14 @@ struct DeviceState {
     uint32_t eventCounter;      // лічильник подій
 };
 
+// Поточний рейс автобуса, визначений сервером
+struct CurrentTripResult {
+    bool success;               // чи отримано відповідь сервера
+    String status;              // active, upcoming або none
+    TripConfig config;          // конфігурація рейсу (крім статусу none)
+    unsigned long pollIntervalMs; // коли запитати поточний рейс знову
+};
+
 // Результат синхронізації
 struct SyncResult {
     bool success;               // успішність
@@ -9,45 +9,104 @@
 class PricingEngine {
 private:
     // Розрахунок коефіцієнта попиту на основі завантаженості
-    float calculateDemandCoefficient(float occupancyRate) {
-        if (occupancyRate < OCCUPANCY_LOW_THRESHOLD) return DEMAND_COEFF_LOW;
-        if (occupancyRate < OCCUPANCY_MEDIUM_THRESHOLD) return DEMAND_COEFF_MEDIUM;
-        if (occupancyRate < OCCUPANCY_HIGH_THRESHOLD) return DEMAND_COEFF_HIGH;
-        return DEMAND_COEFF_VERY_HIGH;
+    float calculateDemandCoefficient(float occupancyRate, const PricingParams& params) {
+        if (occupancyRate < params.lowThreshold) return params.demandLow;
+        if (occupancyRate < params.mediumThreshold) return params.demandMedium;
+        if (occupancyRate < params.highThreshold) return params.demandHigh;
+        return params.demandVeryHigh;
+    }
+
+    // Перевірка входження години в проміжок (може переходити через північ)
+    bool inHourRange(int hour, const HourRange& range) {
+        if (range.start <= range.end) {
+            return hour >= range.start && hour <= range.end;
+        }
+        return hour >= range.start || hour <= range.end;
     }
 
     // Розрахунок коефіцієнта часу
-    float calculateTimeCoefficient(int hour) {
+    float calculateTimeCoefficient(int hour, const PricingParams& params) {
         // Пікові години
-        if ((hour >= PEAK_MORNING_START && hour <= PEAK_MORNING_END) || 
-            (hour >= PEAK_EVENING_START && hour <= PEAK_EVENING_END)) {
-            return TIME_COEFF_PEAK;
+        for (int i = 0; i < params.peakCount; i++) {
+            if (inHourRange(hour, params.peakHours[i])) {
+                return params.peakCoeff;
+            }
         }
         // Нічні години
-        if (hour >= NIGHT_START || hour <= NIGHT_END) {
-            return TIME_COEFF_NIGHT;
+        if (inHourRange(hour, params.nightHours)) {
+            return params.nightCoeff;
         }
         return TIME_COEFF_NORMAL;
     }
 
-    // Розрахунок коефіцієнта дня тижня
-    float calculateDayCoefficient(int dayOfWeek) {
+    // Сезонний коефіцієнт: діє перший сезон, що містить дату
+    float calculateSeasonalCoefficient(int month, int day, const PricingParams& params) {
+        int date = month * 100 + day;
+        for (int i = 0; i < params.seasonCount; i++) {
+            const SeasonalPeriod& season = params.seasons[i];
+            int start = season.startMonth * 100 + season.startDay;
+            int end = season.endMonth * 100 + season.endDay;
+            bool inSeason = (start <= end)
+                ? (date >= start && date <= end)
+                : (date >= start || date <= end);
+            if (inSeason) {
+                return season.coefficient;
+            }
+        }
+        return params.defaultSeasonCoeff;
+    }
+
+    // Розрахунок коефіцієнта дня тижня та сезону
+    float calculateDayCoefficient(struct tm* timeinfo, const PricingParams& params) {
         // 0 = неділя, 6 = субота
-        if (dayOfWeek == 0 || dayOfWeek == 6) {
-            return DAY_COEFF_WEEKEND;
+        int dayOfWeek = timeinfo ? timeinfo->tm_wday : 1;
+        float coeff = (dayOfWeek == 0 || dayOfWeek == 6) ? params.weekendCoeff : DAY_COEFF_WEEKDAY;
+
+        if (timeinfo) {
+            coeff *= calculateSeasonalCoefficient(timeinfo->tm_mon + 1, timeinfo->tm_mday, params);
+        } else {
+            coeff *= params.defaultSeasonCoeff;
         }
-        return DAY_COEFF_WEEKDAY;
+        return coeff;
     }
 
     // Округлення ціни до найближчого кроку
-    float roundPrice(float price) {
-        return round(price / PRICE_ROUND_STEP) * PRICE_ROUND_STEP;
+    float roundPrice(float price, const PricingParams& params) {
+        if (params.roundStep <= 0) return price;
+        return round(price / params.roundStep) * params.roundStep;
     }
 
 public:
+    // Параметри за замовчуванням, поки конфігурацію не отримано з сервера
+    static PricingParams defaultParams() {
+        PricingParams params;
+        params.version = "";
+        params.lowThreshold = OCCUPANCY_LOW_THRESHOLD;
+        params.mediumThreshold = OCCUPANCY_MEDIUM_THRESHOLD;
+        params.highThreshold = OCCUPANCY_HIGH_THRESHOLD;
+        params.demandLow = DEMAND_COEFF_LOW;
+        params.demandMedium = DEMAND_COEFF_MEDIUM;
+        params.demandHigh = DEMAND_COEFF_HIGH;
+        params.demandVeryHigh = DEMAND_COEFF_VERY_HIGH;
+        params.peakHours[0] = {PEAK_MORNING_START, PEAK_MORNING_END};
+        params.peakHours[1] = {PEAK_EVENING_START, PEAK_EVENING_END};
+        params.peakCount = 2;
+        params.peakCoeff = TIME_COEFF_PEAK;
+        params.nightHours = {NIGHT_START, NIGHT_END};
+        params.nightCoeff = TIME_COEFF_NIGHT;
+        params.weekendCoeff = DAY_COEFF_WEEKEND;
+        params.seasonCount = 0;
+        params.defaultSeasonCoeff = 1.0;
+        params.minCoeff = PRICE_MIN_COEFF;
+        params.maxCoeff = PRICE_MAX_COEFF;
+        params.roundStep = PRICE_ROUND_STEP;
+        return params;
+    }
+
     // Розрахунок рекомендованої ціни
-    PriceRecommendation calculatePrice(float basePrice, int currentPassengers, 
-                                        int capacity, struct tm* timeinfo) {
+    PriceRecommendation calculatePrice(float basePrice, int currentPassengers,
+                                        int capacity, struct tm* timeinfo,
+                                        const PricingParams& params) {
         PriceRecommendation rec;
         rec.basePrice = basePrice;
         rec.calculatedAt = millis();
@@ -58,23 +117,24 @@ public:
             : 0.0;
 
         // Розрахунок коефіцієнтів
-        rec.demandCoeff = calculateDemandCoefficient(rec.occupancyRate);
-        rec.timeCoeff = calculateTimeCoefficient(timeinfo ? timeinfo->tm_hour : 12);
-        rec.dayCoeff = calculateDayCoefficient(timeinfo ? timeinfo->tm_wday : 1);
+        rec.demandCoeff = calculateDemandCoefficient(rec.occupancyRate, params);
+        rec.timeCoeff = calculateTimeCoefficient(timeinfo ? timeinfo->tm_hour : 12, params);
+        rec.dayCoeff = calculateDayCoefficient(timeinfo, params);
 
         // Розрахунок рекомендованої ціни
         float rawPrice = basePrice * rec.demandCoeff * rec.timeCoeff * rec.dayCoeff;
 
         // Обмеження діапазону
-        float minPrice = basePrice * PRICE_MIN_COEFF;
-        float maxPrice = basePrice * PRICE_MAX_COEFF;
+        float minPrice = basePrice * params.minCoeff;
+        float maxPrice = basePrice * params.maxCoeff;
         rawPrice = constrain(rawPrice, minPrice, maxPrice);
 
         // Округлення
-        rec.recommendedPrice = roundPrice(rawPrice);
+        rec.recommendedPrice = roundPrice(rawPrice, params);
 
-        Serial.printf("[Pricing] Base=%.2f, Load=%.1f%%, K_demand=%.2f, K_time=%.2f, K_day=%.2f -> Rec=%.2f\n",
-            basePrice, rec.occupancyRate, rec.demandCoeff, rec.timeCoeff, rec.dayCoeff, rec.recommendedPrice);
+        Serial.printf("[Pricing] Base=%.2f, Load=%.1f%%, K_demand=%.2f, K_time=%.2f, K_day=%.2f -> Rec=%.2f (params %s)\n",
+            basePrice, rec.occupancyRate, rec.demandCoeff, rec.timeCoeff, rec.dayCoeff, rec.recommendedPrice,
+            params.version.length() > 0 ? params.version.c_str() : "default");
 
         return rec;
     }
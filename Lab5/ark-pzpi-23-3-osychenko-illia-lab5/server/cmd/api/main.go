@@ -20,16 +20,26 @@
 //	@in							header
 //	@name						Authorization
 //	@description				Заголовок авторизації JWT з використанням схеми Bearer. Приклад: "Authorization: Bearer {token}"
+//
+//	@securityDefinitions.apikey	APIKeyAuth
+//	@in							header
+//	@name						X-API-Key
+//	@description				API ключ інтеграції з обмеженим набором дозволів (створюється через /admin/api-keys)
 package main
 
 import (
+	"context"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/compress"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/gofiber/swagger"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 
@@ -38,6 +48,7 @@ import (
 	_ "busoptima/docs"
 	"busoptima/internal/handler"
 	"busoptima/internal/middleware"
+	"busoptima/internal/mqtt"
 	"busoptima/internal/repository"
 	"busoptima/internal/service"
 )
@@ -45,6 +56,10 @@ import (
 func main() {
 	cfg := config.Load()
 
+	// iat видається і читається з точністю до мілісекунд: відкликання токенів користувача
+	// порівнюється з iat, і секундна точність не розрізняла токени, видані в ту ж секунду
+	jwt.TimePrecision = time.Millisecond
+
 	// Підключення до бази даних
 	db, err := sqlx.Connect("postgres", cfg.DatabaseURL)
 	if err != nil {
@@ -59,22 +74,81 @@ func main() {
 	// Ініціалізація репозиторіїв
 	repos := repository.NewRepositories(db)
 
+	// Список відкликаних токенів кешується в пам'яті та періодично синхронізується з БД
+	tokenRevocations := service.NewTokenRevocationService(repos.TokenRevocation)
+	tokenRevocations.StartSync(context.Background(), time.Minute)
+
+	// Ключі підпису JWT перечитуються з каталогу, щоб ротація не потребувала перезапуску
+	keys, err := service.NewKeyService(cfg.JWTKeysDir, cfg.DevMode)
+	if err != nil {
+		log.Fatal("Failed to load JWT signing keys:", err)
+	}
+	keys.StartAutoReload(context.Background(), 5*time.Minute)
+
+	auditService := service.NewAuditService(repos.Audit)
+	twoFactor := service.NewTwoFactorService(repos.TwoFactor, repos.User, auditService)
+
+	// Дозволи визначаються під час кожного запиту з кешу роль->дозволи
+	permissions := service.NewPermissionService(repos.User, repos.Role, repos.RouteAssignment)
+
+	// Pricing service потребує Settings service і використовується також IoT сервісом
+	settings := service.NewSettingsService(repos.Settings)
+	pricing := service.NewPricingService(settings)
+
 	// Ініціалізація сервісів
 	services := &service.Services{
-		Auth:      service.NewAuthService(repos.User, repos.Device, cfg.JWTSecret),
-		Route:     service.NewRouteService(repos.Route, repos.Audit),
+		Auth:      service.NewAuthService(repos.User, repos.Role, repos.Device, repos.RefreshToken, tokenRevocations, keys, repos.LoginAttempt, auditService, twoFactor, permissions),
+		Route:     service.NewRouteService(repos.Route, repos.Audit, repos.RouteAssignment, permissions),
 		Bus:       service.NewBusService(repos.Bus, repos.Audit),
-		Trip:      service.NewTripService(repos.Trip, repos.Event, repos.Analytics, repos.Audit),
-		IoT:       service.NewIoTService(repos.Device, repos.Event, repos.Trip, repos.PriceRecommendation),
+		Trip:      service.NewTripService(repos.Trip, repos.Event, repos.Analytics, repos.Audit, repos.PriceRecommendation),
+		IoT:       service.NewIoTService(repos.Device, repos.Event, repos.Trip, repos.PriceRecommendation, repos.DeviceHeartbeat, pricing),
 		Analytics: service.NewAnalyticsService(repos.Analytics, repos.Trip),
 		Forecast:  service.NewForecastService(repos.Analytics, repos.Route),
-		Settings:  service.NewSettingsService(repos.Settings),
+		Settings:  settings,
+		Pricing:   pricing,
 		Backup:    service.NewBackupService("/app/backups", cfg.DatabaseURL),
-		Audit:     service.NewAuditService(repos.Audit),
+		Audit:     auditService,
+		Device:    service.NewDeviceService(repos.Device, repos.Bus, repos.DeviceHeartbeat, tokenRevocations),
+		Firmware:  service.NewFirmwareService(repos.Firmware, repos.Device, keys),
+		Tokens:    tokenRevocations,
+		Keys:      keys,
+		TwoFactor: twoFactor,
+		Access:    permissions,
+		Profile:   service.NewProfileService(repos.User, repos.RefreshToken, auditService),
+		Role:      service.NewRoleService(repos.Role, permissions),
+		APIKeys:   service.NewAPIKeyService(repos.APIKey),
+	}
+
+	// Листи відправляються з черги email_outbox у фоні
+	services.Email = service.NewEmailService(repos.EmailOutbox, newMailSender(cfg))
+	services.Email.StartDispatcher(context.Background(), 10*time.Second)
+
+	// Телеметрія пристроїв зберігається 30 днів
+	services.Device.StartHeartbeatRetention(context.Background(), 30*24*time.Hour, time.Hour)
+	services.Password = service.NewPasswordService(repos.User, repos.PasswordReset, repos.RefreshToken, tokenRevocations, auditService, cfg.AppBaseURL)
+
+	// Вхід через OIDC вмикається, якщо задано OIDC_ISSUER
+	roleMapping, err := service.ParseOIDCRoleMapping(cfg.OIDCRoleMapping)
+	if err != nil {
+		log.Fatal("Failed to parse OIDC_ROLE_MAPPING:", err)
 	}
+	services.OIDC = service.NewOIDCService(newOIDCProvider(cfg), repos.OIDC, repos.User, repos.Role, services.Auth, auditService, roleMapping, cfg.OIDCDefaultRole)
 
-	// Pricing service потребує Settings service
-	services.Pricing = service.NewPricingService(services.Settings)
+	// Пристрої можуть надсилати події через MQTT замість POST /iot/events
+	if cfg.MQTTAddr != "" {
+		broker, err := mqtt.NewBroker(services.Auth, services.IoT, tokenRevocations, auditService)
+		if err != nil {
+			log.Fatal("Failed to create MQTT broker:", err)
+		}
+		if err := broker.Listen(cfg.MQTTAddr); err != nil {
+			log.Fatal("Failed to start MQTT listener:", err)
+		}
+		if err := broker.Serve(); err != nil {
+			log.Fatal("Failed to start MQTT broker:", err)
+		}
+		defer broker.Close()
+		log.Printf("MQTT broker listening on %s", cfg.MQTTAddr)
+	}
 
 	// Створення Fiber додатку
 	app := fiber.New(fiber.Config{
@@ -87,12 +161,17 @@ func main() {
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: "*",
 		AllowMethods: "GET,POST,PUT,DELETE,OPTIONS",
-		AllowHeaders: "Origin,Content-Type,Accept,Authorization",
+		AllowHeaders: "Origin,Content-Type,Accept,Authorization,X-API-Key",
 	}))
 
 	// Налаштування маршрутів
 	setupRoutes(app, services, repos, cfg)
 
+	// Каталог дозволів формується з RequirePermission у маршрутах
+	if err := services.Role.SyncPermissions(context.Background(), middleware.RegisteredPermissions()); err != nil {
+		log.Fatal("Failed to sync permissions:", err)
+	}
+
 	// Запуск сервера
 	port := cfg.Port
 	if port == "" {
@@ -106,26 +185,61 @@ func setupRoutes(app *fiber.App, services *service.Services, repos *repository.R
 	// Документація Swagger
 	app.Get("/swagger/*", swagger.HandlerDefault) // за замовчуванням
 
+	// Публічні ключі для перевірки токенів іншими сервісами
+	keysHandler := handler.NewKeysHandler(services.Keys)
+	app.Get("/.well-known/jwks.json", keysHandler.JWKS)
+
 	api := app.Group("/api")
 
 	// Публічні маршрути
 	auth := api.Group("/auth")
-	authHandler := handler.NewAuthHandler(services.Auth)
+	authHandler := handler.NewAuthHandler(services.Auth, services.Password)
 	auth.Post("/login", authHandler.Login)
 	auth.Post("/device", authHandler.DeviceAuth)
 	auth.Post("/refresh", authHandler.RefreshToken)
+	auth.Post("/logout", authHandler.Logout)
+	auth.Post("/password/forgot", authHandler.ForgotPassword)
+	auth.Post("/password/reset", authHandler.ResetPassword)
+	auth.Post("/2fa/verify", authHandler.VerifyTwoFactor)
+	auth.Post("/2fa/enroll", authHandler.EnrollTwoFactor)
+
+	oidcHandler := handler.NewOIDCHandler(services.OIDC)
+	auth.Get("/oidc/authorize", oidcHandler.Authorize)
+	auth.Post("/oidc/callback", oidcHandler.Callback)
 
 	// Захищені маршрути
-	protected := api.Use(middleware.JWTAuth(cfg.JWTSecret))
+	protected := api.Use(middleware.JWTAuth(services.Keys, services.Tokens, services.APIKeys, services.Access))
 	protected.Use(middleware.AuditLog(services.Audit, repos))
 
+	// Обліковий запис поточного користувача
+	me := protected.Group("/me")
+	meHandler := handler.NewMeHandler(services.Profile, services.Password, services.TwoFactor, services.Auth)
+	me.Get("/", meHandler.GetProfile)
+	me.Put("/", meHandler.UpdateProfile)
+	me.Get("/permissions", meHandler.GetPermissions)
+	me.Get("/sessions", meHandler.GetSessions)
+	me.Put("/password", meHandler.ChangePassword)
+	me.Get("/2fa", meHandler.GetTwoFactorStatus)
+	me.Post("/2fa/enroll", meHandler.EnrollTwoFactor)
+	me.Post("/2fa/confirm", meHandler.ConfirmTwoFactor)
+	me.Post("/2fa/disable", meHandler.DisableTwoFactor)
+	me.Post("/2fa/recovery-codes", meHandler.RegenerateRecoveryCodes)
+	me.Get("/oidc/link", oidcHandler.AuthorizeLink)
+	me.Post("/oidc/link", oidcHandler.Link)
+
 	// IoT маршрути
-	iot := protected.Group("/iot")
 	auditHelper := middleware.NewAuditHelper(services.Audit)
+	iot := protected.Group("/iot", middleware.RequireDevice(auditHelper))
 	iotHandler := handler.NewIoTHandler(services.IoT, auditHelper)
-	iot.Post("/events", iotHandler.SyncEvents)
+	iot.Post("/events", compress.New(), iotHandler.SyncEvents)
 	iot.Post("/price", iotHandler.SendPriceRecommendation)
 	iot.Get("/config/:tripId", iotHandler.GetTripConfig)
+	iot.Get("/current-trip", iotHandler.GetCurrentTrip)
+	iot.Post("/heartbeat", iotHandler.Heartbeat)
+
+	firmwareHandler := handler.NewFirmwareHandler(services.Firmware, auditHelper)
+	iot.Get("/firmware", firmwareHandler.GetManifest)
+	iot.Get("/firmware/:id/download", firmwareHandler.Download)
 
 	// Маршрути
 	routes := protected.Group("/routes")
@@ -153,6 +267,10 @@ func setupRoutes(app *fiber.App, services *service.Services, repos *repository.R
 	trips.Post("/", middleware.RequirePermission("routes:write"), tripHandler.Create)
 	trips.Put("/:id", middleware.RequirePermission("routes:write"), tripHandler.Update)
 	trips.Get("/:id/events", middleware.RequirePermission("routes:read"), tripHandler.GetEvents)
+	trips.Get("/:id/quarantine", middleware.RequirePermission("routes:read"), tripHandler.GetQuarantine)
+	trips.Get("/:id/price-recommendations", middleware.RequirePermission("routes:read"), tripHandler.GetPriceRecommendations)
+	trips.Post("/:id/quarantine/:eventId/review", middleware.RequirePermission("routes:write"), tripHandler.ReviewQuarantine)
+	trips.Post("/:id/occupancy/recompute", middleware.RequirePermission("routes:write"), tripHandler.RecomputeOccupancy)
 
 	// Аналітика
 	analytics := protected.Group("/analytics")
@@ -164,7 +282,7 @@ func setupRoutes(app *fiber.App, services *service.Services, repos *repository.R
 
 	// Ціноутворення
 	pricing := protected.Group("/pricing")
-	pricingHandler := handler.NewPricingHandler(services.Pricing)
+	pricingHandler := handler.NewPricingHandler(services.Pricing, services.Route)
 	pricing.Post("/calculate", middleware.RequirePermission("routes:read"), pricingHandler.CalculatePrice)
 
 	// Аналітика рейсів
@@ -178,12 +296,84 @@ func setupRoutes(app *fiber.App, services *service.Services, repos *repository.R
 	admin.Post("/users", middleware.RequirePermission("users:write"), adminHandler.CreateUser)
 	admin.Put("/users/:id", middleware.RequirePermission("users:write"), adminHandler.UpdateUser)
 	admin.Put("/users/:id/role", middleware.RequirePermission("users:write"), adminHandler.UpdateUserRole)
+	admin.Post("/users/:id/unlock", middleware.RequirePermission("users:write"), adminHandler.UnlockUser)
+	admin.Post("/users/:id/deactivate", middleware.RequirePermission("users:write"), adminHandler.DeactivateUser)
+	admin.Post("/users/:id/reactivate", middleware.RequirePermission("users:write"), adminHandler.ReactivateUser)
+	admin.Post("/users/:id/logout", middleware.RequirePermission("users:write"), adminHandler.ForceLogout)
+	admin.Get("/users/:id/routes", middleware.RequirePermission("users:read"), routeHandler.GetUserRoutes)
+	admin.Put("/users/:id/routes", middleware.RequirePermission("users:write"), routeHandler.SetUserRoutes)
 	admin.Get("/settings", middleware.RequirePermission("users:read"), adminHandler.GetSystemSettings)
 	admin.Put("/settings", middleware.RequirePermission("users:write"), adminHandler.UpdateSystemSettings)
 	admin.Get("/settings/export", middleware.RequirePermission("users:read"), adminHandler.ExportSystemSettings)
 	admin.Post("/settings/import", middleware.RequirePermission("users:write"), adminHandler.ImportSystemSettings)
 	admin.Get("/audit-logs", middleware.RequirePermission("audit:read"), adminHandler.GetAuditLogs)
+	admin.Post("/keys/reload", middleware.RequirePermission("system:keys"), keysHandler.Reload)
+
+	// Ролі
+	roleHandler := handler.NewRoleHandler(services.Role)
+	admin.Get("/roles", middleware.RequirePermission("users:read"), roleHandler.GetAll)
+	admin.Get("/roles/:id", middleware.RequirePermission("users:read"), roleHandler.GetByID)
+	admin.Post("/roles", middleware.RequirePermission("users:write"), roleHandler.Create)
+	admin.Put("/roles/:id", middleware.RequirePermission("users:write"), roleHandler.Update)
+	admin.Delete("/roles/:id", middleware.RequirePermission("users:write"), roleHandler.Delete)
+	admin.Put("/roles/:id/permissions", middleware.RequirePermission("users:write"), roleHandler.SetPermissions)
+	admin.Put("/roles/:id/mfa", middleware.RequirePermission("users:write"), roleHandler.UpdateMFARequired)
+	admin.Get("/permissions", middleware.RequirePermission("users:read"), roleHandler.GetPermissions)
+
+	// API ключі інтеграцій
+	apiKeyHandler := handler.NewAPIKeyHandler(services.APIKeys)
+	admin.Get("/api-keys", middleware.RequirePermission("api_keys:read"), apiKeyHandler.GetAll)
+	admin.Get("/api-keys/:id", middleware.RequirePermission("api_keys:read"), apiKeyHandler.GetByID)
+	admin.Post("/api-keys", middleware.RequirePermission("api_keys:write"), apiKeyHandler.Create)
+	admin.Put("/api-keys/:id", middleware.RequirePermission("api_keys:write"), apiKeyHandler.Update)
+	admin.Delete("/api-keys/:id", middleware.RequirePermission("api_keys:write"), apiKeyHandler.Revoke)
+
+	// Адміністрування IoT-пристроїв
+	deviceHandler := handler.NewDeviceHandler(services.Device)
+	admin.Get("/devices", middleware.RequirePermission("devices:read"), deviceHandler.GetAll)
+	admin.Get("/devices/status", middleware.RequirePermission("devices:read"), deviceHandler.GetStatuses)
+	admin.Get("/devices/:id", middleware.RequirePermission("devices:read"), deviceHandler.GetByID)
+	admin.Get("/devices/:id/status", middleware.RequirePermission("devices:read"), deviceHandler.GetStatus)
+	admin.Get("/devices/:id/heartbeats", middleware.RequirePermission("devices:read"), deviceHandler.GetHeartbeats)
+	admin.Post("/devices", middleware.RequirePermission("devices:write"), deviceHandler.Register)
+	admin.Put("/devices/:id/bus", middleware.RequirePermission("devices:write"), deviceHandler.BindBus)
+	admin.Delete("/devices/:id/bus", middleware.RequirePermission("devices:write"), deviceHandler.UnbindBus)
+	admin.Post("/devices/:id/deactivate", middleware.RequirePermission("devices:write"), deviceHandler.Deactivate)
+	admin.Post("/devices/:id/rotate-secret", middleware.RequirePermission("devices:write"), deviceHandler.RotateSecret)
+	admin.Put("/devices/:id/group", middleware.RequirePermission("devices:write"), deviceHandler.SetDeviceGroup)
+
+	// Прошивки IoT-пристроїв
+	admin.Get("/firmware", middleware.RequirePermission("devices:read"), firmwareHandler.GetReleases)
+	admin.Post("/firmware", middleware.RequirePermission("devices:write"), firmwareHandler.UploadRelease)
+	admin.Get("/firmware/rollouts", middleware.RequirePermission("devices:read"), firmwareHandler.GetRollouts)
+	admin.Post("/firmware/rollouts", middleware.RequirePermission("devices:write"), firmwareHandler.CreateRollout)
+	admin.Get("/firmware/rollouts/:id", middleware.RequirePermission("devices:read"), firmwareHandler.GetRollout)
+	admin.Put("/firmware/rollouts/:id", middleware.RequirePermission("devices:write"), firmwareHandler.UpdateRollout)
+	admin.Post("/firmware/rollouts/:id/stop", middleware.RequirePermission("devices:write"), firmwareHandler.StopRollout)
 	// admin.Post("/backup", middleware.RequirePermission("system:backup"), adminHandler.CreateBackup)
 	// admin.Get("/backups", middleware.RequirePermission("system:backup"), adminHandler.ListBackups)
 	// admin.Post("/backups/:backup_id/restore", middleware.RequirePermission("system:backup"), adminHandler.RestoreBackup)
 }
+
+// newMailSender обирає транспорт відправлення листів згідно з MAIL_DRIVER
+func newMailSender(cfg *config.Config) service.MailSender {
+	switch cfg.MailDriver {
+	case "smtp":
+		return service.NewSMTPMailSender(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom)
+	case "file":
+		return service.NewFileMailSender(cfg.MailDir, cfg.MailFrom)
+	case "log":
+		return service.NewLogMailSender()
+	default:
+		log.Printf("WARNING: unknown MAIL_DRIVER %q, emails will be written to the log", cfg.MailDriver)
+		return service.NewLogMailSender()
+	}
+}
+
+// newOIDCProvider створює клієнт провайдера OIDC або повертає nil, якщо вхід через OIDC не налаштовано
+func newOIDCProvider(cfg *config.Config) service.OIDCProvider {
+	if cfg.OIDCIssuer == "" {
+		return nil
+	}
+	return service.NewOIDCProvider(cfg.OIDCIssuer, cfg.OIDCClientID, cfg.OIDCClientSecret, cfg.OIDCRedirectURL, strings.Fields(cfg.OIDCScopes), cfg.OIDCGroupsClaim)
+}
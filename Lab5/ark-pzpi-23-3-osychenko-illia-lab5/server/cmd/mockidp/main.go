@@ -0,0 +1,43 @@
+// Package main локальний провайдер OpenID Connect для розробки та перевірки входу через OIDC.
+//
+// Сторінка входу не показується: /authorize одразу перенаправляє на redirect_uri з кодом авторизації
+// для користувача, заданого змінними оточення або параметрами запиту email, name, sub та groups.
+// Ключ підпису генерується при кожному запуску.
+package main
+
+import (
+	"busoptima/internal/mockidp"
+	"log"
+	"net/http"
+	"os"
+)
+
+func main() {
+	clientID := getEnv("MOCK_IDP_CLIENT_ID", "busoptima")
+
+	p, err := mockidp.New(
+		getEnv("MOCK_IDP_ISSUER", "http://localhost:9000"),
+		clientID,
+		getEnv("MOCK_IDP_CLIENT_SECRET", "busoptima-secret"),
+		mockidp.User{
+			Subject: getEnv("MOCK_IDP_SUBJECT", "mock-user-1"),
+			Email:   getEnv("MOCK_IDP_EMAIL", "oidc.user@busoptima.ua"),
+			Name:    getEnv("MOCK_IDP_NAME", "OIDC User"),
+			Groups:  mockidp.SplitGroups(getEnv("MOCK_IDP_GROUPS", "busoptima-dispatchers")),
+		},
+	)
+	if err != nil {
+		log.Fatal("Failed to generate signing key:", err)
+	}
+
+	addr := getEnv("MOCK_IDP_ADDR", ":9000")
+	log.Printf("Mock OIDC provider %s starting on %s (client_id=%s)", p.Issuer(), addr, clientID)
+	log.Fatal(http.ListenAndServe(addr, p.Handler()))
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
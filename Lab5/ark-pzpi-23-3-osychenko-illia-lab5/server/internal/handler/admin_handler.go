@@ -2,7 +2,10 @@ package handler
 
 import (
 	"busoptima/internal/model"
+	"busoptima/internal/repository"
 	"busoptima/internal/service"
+	"context"
+	"errors"
 	"strconv"
 
 	"github.com/gofiber/fiber/v2"
@@ -129,7 +132,7 @@ type UpdateUserRoleRequest struct {
 // UpdateUserRole оновлює роль користувача
 //
 //	@Summary		Оновити роль користувача
-//	@Description	Оновлює роль користувача за ID
+//	@Description	Оновлює роль користувача за ID. Призначити можна лише роль, усі дозволи якої є у вас; користувач, обмежений маршрутами, призначає лише ролі з route_scoped
 //	@Tags			Admin
 //	@Accept			json
 //	@Produce		json
@@ -137,6 +140,8 @@ type UpdateUserRoleRequest struct {
 //	@Param			role	body		UpdateUserRoleRequest	true	"Нова роль користувача"
 //	@Success		200		{object}	UpdateUserRoleResponse
 //	@Failure 400 {object} ErrorResponse
+//	@Failure 403 {object} ErrorResponse
+//	@Failure 404 {object} ErrorResponse
 //	@Failure 500 {object} ErrorResponse
 //	@Security		BearerAuth
 //	@Router			/admin/users/{id}/role [put]
@@ -152,8 +157,16 @@ func (h *AdminHandler) UpdateUserRole(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
 	}
 
-	if err := h.authService.UpdateUserRole(c.Context(), userID, req.RoleID); err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	err = h.authService.UpdateUserRole(c.Context(), userID, req.RoleID, localPermissions(c), routeScope(c))
+	switch {
+	case errors.Is(err, service.ErrRoleExceedsGrantor):
+		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, repository.ErrNotFound):
+		return c.Status(404).JSON(fiber.Map{"error": "User not found"})
+	case errors.Is(err, service.ErrInvalidRole):
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	case err != nil:
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update user role"})
 	}
 
 	return c.JSON(UpdateUserRoleResponse{
@@ -161,6 +174,140 @@ func (h *AdminHandler) UpdateUserRole(c *fiber.Ctx) error {
 	})
 }
 
+// UnlockUser знімає блокування входу користувача
+//
+//	@Summary		Розблокувати користувача
+//	@Description	Знімає тимчасове блокування після невдалих спроб входу та скидає лічильник спроб
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int	true	"ID користувача"
+//	@Success		200	{object}	MessageResponse
+//	@Failure 400 {object} ErrorResponse
+//	@Failure 404 {object} ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/users/{id}/unlock [post]
+func (h *AdminHandler) UnlockUser(c *fiber.Ctx) error {
+	userID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	if err := h.authService.UnlockUser(c.Context(), userID); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if adminID, ok := c.Locals("user_id").(int64); ok {
+		go h.auditService.LogAction(context.Background(), adminID, "ACCOUNT_UNLOCKED", "users", strconv.FormatInt(userID, 10), map[string]any{}, map[string]any{}, c.IP())
+	}
+
+	return c.JSON(MessageResponse{Message: "User unlocked successfully"})
+}
+
+// DeactivateUser деактивує користувача
+//
+//	@Summary		Деактивувати користувача
+//	@Description	Забороняє вхід користувачу та завершує всі його сесії. Дійсні access токени перестають прийматись одразу
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int	true	"ID користувача"
+//	@Success		200	{object}	MessageResponse
+//	@Failure 400 {object} ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/users/{id}/deactivate [post]
+func (h *AdminHandler) DeactivateUser(c *fiber.Ctx) error {
+	userID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	// Адміністратор не може випадково заблокувати власний доступ
+	adminID, ok := c.Locals("user_id").(int64)
+	if ok && adminID == userID {
+		return c.Status(400).JSON(fiber.Map{"error": "You cannot deactivate your own account"})
+	}
+
+	if err := h.authService.DeactivateUser(c.Context(), userID); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	h.logUserAction(c, "USER_DEACTIVATED", userID, map[string]any{"is_active": true}, map[string]any{"is_active": false})
+
+	return c.JSON(MessageResponse{Message: "User deactivated successfully"})
+}
+
+// ReactivateUser знову активує користувача
+//
+//	@Summary		Активувати користувача
+//	@Description	Знову дозволяє вхід деактивованому користувачу. Завершені сесії не відновлюються
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int	true	"ID користувача"
+//	@Success		200	{object}	MessageResponse
+//	@Failure 400 {object} ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/users/{id}/reactivate [post]
+func (h *AdminHandler) ReactivateUser(c *fiber.Ctx) error {
+	userID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	if err := h.authService.ReactivateUser(c.Context(), userID); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	h.logUserAction(c, "USER_REACTIVATED", userID, map[string]any{"is_active": false}, map[string]any{"is_active": true})
+
+	return c.JSON(MessageResponse{Message: "User reactivated successfully"})
+}
+
+// ForceLogout завершує всі сесії користувача
+//
+//	@Summary		Примусово завершити сесії користувача
+//	@Description	Відкликає всі access та refresh токени користувача. Обліковий запис залишається активним
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int	true	"ID користувача"
+//	@Success		200	{object}	MessageResponse
+//	@Failure 400 {object} ErrorResponse
+//	@Failure 404 {object} ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/users/{id}/logout [post]
+func (h *AdminHandler) ForceLogout(c *fiber.Ctx) error {
+	userID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	if err := h.authService.ForceLogout(c.Context(), userID); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	h.logUserAction(c, "USER_SESSIONS_REVOKED", userID, map[string]any{}, map[string]any{})
+
+	return c.JSON(MessageResponse{Message: "User sessions revoked successfully"})
+}
+
+// logUserAction записує в аудит дію над користувачем. Виконавцем є адміністратор
+// або API-ключ, з яким надіслано запит
+func (h *AdminHandler) logUserAction(c *fiber.Ctx, action string, userID int64, oldValues, newValues map[string]any) {
+	entityID := strconv.FormatInt(userID, 10)
+	ipAddress := c.IP()
+
+	if adminID, ok := c.Locals("user_id").(int64); ok {
+		go h.auditService.LogAction(context.Background(), adminID, action, "users", entityID, oldValues, newValues, ipAddress)
+		return
+	}
+
+	if apiKeyID, ok := c.Locals("api_key_id").(int64); ok {
+		go h.auditService.LogAPIKeyAction(context.Background(), apiKeyID, action, "users", entityID, oldValues, newValues, ipAddress)
+	}
+}
+
 // GetAuditLogs повертає журнал аудиту
 //
 //	@Summary		Отримати журнал аудиту
@@ -170,6 +317,8 @@ func (h *AdminHandler) UpdateUserRole(c *fiber.Ctx) error {
 //	@Produce		json
 //	@Param			page	query		int	false	"Номер сторінки"	default(1)
 //	@Param			limit	query		int	false	"Кількість записів на сторінці"	default(20)
+//	@Param			device_id	query	int	false	"ID IoT-пристрою"
+//	@Param			api_key_id	query	int	false	"ID API-ключа"
 //	@Success		200		{object}	AuditLogsResponse
 //	@Failure 500 {object} ErrorResponse
 //	@Security		BearerAuth
@@ -198,6 +347,14 @@ func (h *AdminHandler) GetAuditLogs(c *fiber.Ctx) error {
 		filters["user_id"] = int64(userID)
 	}
 
+	if deviceID := c.QueryInt("device_id", 0); deviceID > 0 {
+		filters["device_id"] = int64(deviceID)
+	}
+
+	if apiKeyID := c.QueryInt("api_key_id", 0); apiKeyID > 0 {
+		filters["api_key_id"] = int64(apiKeyID)
+	}
+
 	if action := c.Query("action"); action != "" {
 		filters["action"] = action
 	}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"busoptima/internal/service"
+	"errors"
 	"strconv"
 	"time"
 
@@ -23,16 +24,17 @@ func NewAnalyticsHandler(analyticsService service.AnalyticsService, forecastServ
 // GetDashboard повертає дані для дашборду
 //
 //	@Summary		Отримати дані дашборду
-//	@Description	Повертає основні метрики та статистику для інформаційної панелі
+//	@Description	Повертає основні метрики та статистику для інформаційної панелі. Користувач з обмеженим доступом бачить лише призначені маршрути
 //	@Tags			Analytics
 //	@Accept			json
 //	@Produce		json
 //	@Success		200	{object}	service.DashboardData
 //	@Failure		500	{object}	ErrorResponse
 //	@Security		BearerAuth
+//	@Security		APIKeyAuth
 //	@Router			/analytics/dashboard [get]
 func (h *AnalyticsHandler) GetDashboard(c *fiber.Ctx) error {
-	dashboard, err := h.analyticsService.GetDashboard(c.Context())
+	dashboard, err := h.analyticsService.GetDashboard(c.Context(), routeScope(c))
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -50,8 +52,10 @@ func (h *AnalyticsHandler) GetDashboard(c *fiber.Ctx) error {
 //	@Param			date		query		string	false	"Дата прогнозу (YYYY-MM-DD)"
 //	@Success		200			{object}	ForecastResponse
 //	@Failure		400			{object}	ErrorResponse
+//	@Failure		403			{object}	ErrorResponse
 //	@Failure		500			{object}	ErrorResponse
 //	@Security		BearerAuth
+//	@Security		APIKeyAuth
 //	@Router			/analytics/forecast [get]
 func (h *AnalyticsHandler) GetForecast(c *fiber.Ctx) error {
 	routeIDStr := c.Query("route_id")
@@ -74,7 +78,10 @@ func (h *AnalyticsHandler) GetForecast(c *fiber.Ctx) error {
 		targetDate = parsed
 	}
 
-	forecast, err := h.forecastService.ForecastDemand(c.Context(), routeID, targetDate)
+	forecast, err := h.forecastService.ForecastDemand(c.Context(), routeScope(c), routeID, targetDate)
+	if errors.Is(err, service.ErrRouteOutOfScope) {
+		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+	}
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -117,8 +124,10 @@ func (h *AnalyticsHandler) GetForecast(c *fiber.Ctx) error {
 //	@Param			date_to		query		string	true	"Дата кінця (YYYY-MM-DD)"
 //	@Success		200			{object}	service.ForecastsResponse
 //	@Failure		400			{object}	ErrorResponse
+//	@Failure		403			{object}	ErrorResponse
 //	@Failure		500			{object}	ErrorResponse
 //	@Security		BearerAuth
+//	@Security		APIKeyAuth
 //	@Router			/analytics/forecasts [get]
 func (h *AnalyticsHandler) GetForecasts(c *fiber.Ctx) error {
 	routeID, err := strconv.ParseInt(c.Query("route_id"), 10, 64)
@@ -136,7 +145,10 @@ func (h *AnalyticsHandler) GetForecasts(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "invalid date_to"})
 	}
 
-	forecasts, err := h.forecastService.GetForecasts(c.Context(), routeID, from, to)
+	forecasts, err := h.forecastService.GetForecasts(c.Context(), routeScope(c), routeID, from, to)
+	if errors.Is(err, service.ErrRouteOutOfScope) {
+		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+	}
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -156,8 +168,10 @@ func (h *AnalyticsHandler) GetForecasts(c *fiber.Ctx) error {
 //	@Param			route_id	query		int		false	"ID маршруту для фільтрації"
 //	@Success		200			{object}	service.ProfitabilityData
 //	@Failure		400			{object}	ErrorResponse
+//	@Failure		403			{object}	ErrorResponse
 //	@Failure		500			{object}	ErrorResponse
 //	@Security		BearerAuth
+//	@Security		APIKeyAuth
 //	@Router			/analytics/profitability [get]
 func (h *AnalyticsHandler) GetProfitability(c *fiber.Ctx) error {
 	// Парсимо параметри
@@ -190,7 +204,10 @@ func (h *AnalyticsHandler) GetProfitability(c *fiber.Ctx) error {
 		to = parsed
 	}
 
-	profitability, err := h.analyticsService.GetProfitability(c.Context(), routeID, from, to)
+	profitability, err := h.analyticsService.GetProfitability(c.Context(), routeScope(c), routeID, from, to)
+	if errors.Is(err, service.ErrRouteOutOfScope) {
+		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+	}
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -208,8 +225,10 @@ func (h *AnalyticsHandler) GetProfitability(c *fiber.Ctx) error {
 //	@Param			id	path		int	true	"ID рейсу"
 //	@Success		200	{object}	model.TripAnalytics
 //	@Failure		400	{object}	ErrorResponse
+//	@Failure		403	{object}	ErrorResponse
 //	@Failure		500	{object}	ErrorResponse
 //	@Security		BearerAuth
+//	@Security		APIKeyAuth
 //	@Router			/trips/{id}/analytics [get]
 func (h *AnalyticsHandler) GetTripAnalytics(c *fiber.Ctx) error {
 	tripID, err := strconv.ParseInt(c.Params("id"), 10, 64)
@@ -218,10 +237,13 @@ func (h *AnalyticsHandler) GetTripAnalytics(c *fiber.Ctx) error {
 	}
 
 	// Спочатку пробуємо отримати існуючу аналітику
-	analytics, err := h.analyticsService.GetTripAnalytics(c.Context(), tripID)
+	analytics, err := h.analyticsService.GetTripAnalytics(c.Context(), routeScope(c), tripID)
+	if errors.Is(err, service.ErrRouteOutOfScope) {
+		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+	}
 	if err != nil {
 		// Якщо не знайдено - розраховуємо
-		analytics, err = h.analyticsService.CalculateTripAnalytics(c.Context(), tripID)
+		analytics, err = h.analyticsService.CalculateTripAnalytics(c.Context(), routeScope(c), tripID)
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 		}
@@ -240,8 +262,10 @@ func (h *AnalyticsHandler) GetTripAnalytics(c *fiber.Ctx) error {
 //	@Param			id	path		int	true	"ID рейсу"
 //	@Success		200	{object}	model.TripAnalytics
 //	@Failure		400	{object}	ErrorResponse
+//	@Failure		403	{object}	ErrorResponse
 //	@Failure		500	{object}	ErrorResponse
 //	@Security		BearerAuth
+//	@Security		APIKeyAuth
 //	@Router			/trips/{id}/analytics/calculate [post]
 func (h *AnalyticsHandler) CalculateTripAnalytics(c *fiber.Ctx) error {
 	tripID, err := strconv.ParseInt(c.Params("id"), 10, 64)
@@ -249,7 +273,10 @@ func (h *AnalyticsHandler) CalculateTripAnalytics(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "invalid trip ID"})
 	}
 
-	analytics, err := h.analyticsService.CalculateTripAnalytics(c.Context(), tripID)
+	analytics, err := h.analyticsService.CalculateTripAnalytics(c.Context(), routeScope(c), tripID)
+	if errors.Is(err, service.ErrRouteOutOfScope) {
+		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+	}
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
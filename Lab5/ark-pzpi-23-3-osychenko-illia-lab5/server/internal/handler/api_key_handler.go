@@ -0,0 +1,215 @@
+package handler
+
+import (
+	"busoptima/internal/model"
+	"busoptima/internal/repository"
+	"busoptima/internal/service"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// APIKeyHandler обробляє адміністративні запити для API ключів інтеграцій
+type APIKeyHandler struct {
+	apiKeyService service.APIKeyService
+}
+
+// NewAPIKeyHandler створює новий обробник API ключів
+func NewAPIKeyHandler(apiKeyService service.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{apiKeyService: apiKeyService}
+}
+
+// APIKeyRequest структура запиту створення та зміни API ключа
+type APIKeyRequest struct {
+	Name        string     `json:"name" validate:"required" example:"BI export"`
+	Permissions []string   `json:"permissions" validate:"required" example:"analytics:read"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty" example:"2026-01-01T00:00:00Z"`
+}
+
+// APIKeyCredentialsResponse відповідь з новим ключем (показується лише один раз)
+type APIKeyCredentialsResponse struct {
+	APIKey  *model.APIKey `json:"api_key"`
+	Key     string        `json:"key" example:"bo_Zk2q8..."`
+	Message string        `json:"message" example:"Store this key now, it will not be shown again"`
+}
+
+// GetAll повертає список API ключів
+//
+//	@Summary		Отримати список API ключів
+//	@Description	Повертає всі ключі інтеграцій з їх дозволами та часом останнього використання
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{array}		model.APIKey
+//	@Failure		500	{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/api-keys [get]
+func (h *APIKeyHandler) GetAll(c *fiber.Ctx) error {
+	keys, err := h.apiKeyService.GetAll(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(keys)
+}
+
+// GetByID повертає API ключ за ID
+//
+//	@Summary		Отримати API ключ за ID
+//	@Description	Повертає ключ за вказаним ідентифікатором (без самого значення ключа)
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int	true	"ID ключа"
+//	@Success		200	{object}	model.APIKey
+//	@Failure		400	{object}	ErrorResponse
+//	@Failure		404	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/api-keys/{id} [get]
+func (h *APIKeyHandler) GetByID(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid API key ID"})
+	}
+
+	key, err := h.apiKeyService.GetByID(c.Context(), id)
+	if err != nil {
+		return apiKeyErrorResponse(c, err, "Failed to get API key")
+	}
+
+	return c.JSON(key)
+}
+
+// Create створює новий API ключ
+//
+//	@Summary		Створити API ключ
+//	@Description	Створює ключ з явно обраними дозволами. Видати можна лише дозволи, які має поточний користувач; користувачі, обмежені призначеними маршрутами, ключі не створюють. Значення ключа показується лише один раз
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			key	body		APIKeyRequest	true	"Дані ключа"
+//	@Success		201	{object}	APIKeyCredentialsResponse
+//	@Failure		400	{object}	ErrorResponse
+//	@Failure		403	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/api-keys [post]
+func (h *APIKeyHandler) Create(c *fiber.Ctx) error {
+	var req APIKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	key := &model.APIKey{
+		Name:        req.Name,
+		Permissions: req.Permissions,
+		ExpiresAt:   req.ExpiresAt,
+	}
+	if userID, ok := c.Locals("user_id").(int64); ok {
+		key.CreatedBy = &userID
+	}
+
+	credentials, err := h.apiKeyService.Create(c.Context(), key, localPermissions(c), routeScope(c))
+	if err != nil {
+		return apiKeyErrorResponse(c, err, "Failed to create API key")
+	}
+
+	// Ключ показується лише один раз, тому відповідь не повинна кешуватись
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(201).JSON(APIKeyCredentialsResponse{
+		APIKey:  credentials.APIKey,
+		Key:     credentials.Key,
+		Message: "Store this key now, it will not be shown again",
+	})
+}
+
+// Update змінює API ключ
+//
+//	@Summary		Оновити API ключ
+//	@Description	Змінює назву, термін дії та дозволи ключа. Значення ключа не змінюється. Недоступно користувачам, обмеженим призначеними маршрутами
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int				true	"ID ключа"
+//	@Param			key	body		APIKeyRequest	true	"Дані ключа"
+//	@Success		200	{object}	model.APIKey
+//	@Failure		400	{object}	ErrorResponse
+//	@Failure		403	{object}	ErrorResponse
+//	@Failure		404	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/api-keys/{id} [put]
+func (h *APIKeyHandler) Update(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid API key ID"})
+	}
+
+	var req APIKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	key := &model.APIKey{
+		ID:          id,
+		Name:        req.Name,
+		Permissions: req.Permissions,
+		ExpiresAt:   req.ExpiresAt,
+	}
+
+	updated, err := h.apiKeyService.Update(c.Context(), key, localPermissions(c), routeScope(c))
+	if err != nil {
+		return apiKeyErrorResponse(c, err, "Failed to update API key")
+	}
+
+	return c.JSON(updated)
+}
+
+// Revoke відкликає API ключ
+//
+//	@Summary		Відкликати API ключ
+//	@Description	Ключ одразу перестає прийматись. Запис залишається в списку з позначкою revoked_at
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int	true	"ID ключа"
+//	@Success		200	{object}	MessageResponse
+//	@Failure		400	{object}	ErrorResponse
+//	@Failure		404	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/api-keys/{id} [delete]
+func (h *APIKeyHandler) Revoke(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid API key ID"})
+	}
+
+	if err := h.apiKeyService.Revoke(c.Context(), id); err != nil {
+		return apiKeyErrorResponse(c, err, "Failed to revoke API key")
+	}
+
+	return c.JSON(MessageResponse{Message: "API key revoked successfully"})
+}
+
+// apiKeyErrorResponse повертає 403 для користувачів, обмежених маршрутами, 404 для відсутнього або відкликаного ключа,
+// 400 для некоректного запиту та 500 без подробиць для інших помилок
+func apiKeyErrorResponse(c *fiber.Ctx, err error, message string) error {
+	switch {
+	case errors.Is(err, service.ErrAPIKeyRouteScoped):
+		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, repository.ErrNotFound):
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidAPIKeyRequest):
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(500).JSON(fiber.Map{"error": message})
+}
+
+// localPermissions повертає дозволи поточного запиту, встановлені middleware автентифікації
+func localPermissions(c *fiber.Ctx) []string {
+	permissions, _ := c.Locals("permissions").([]string)
+	return permissions
+}
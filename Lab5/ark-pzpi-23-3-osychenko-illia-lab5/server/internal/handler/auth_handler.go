@@ -2,19 +2,25 @@ package handler
 
 import (
 	"busoptima/internal/service"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 // AuthHandler обробляє запити автентифікації
 type AuthHandler struct {
-	authService service.AuthService
+	authService     service.AuthService
+	passwordService service.PasswordService
 }
 
 // NewAuthHandler створює новий обробник автентифікації
-func NewAuthHandler(authService service.AuthService) *AuthHandler {
+func NewAuthHandler(authService service.AuthService, passwordService service.PasswordService) *AuthHandler {
 	return &AuthHandler{
-		authService: authService,
+		authService:     authService,
+		passwordService: passwordService,
 	}
 }
 
@@ -26,8 +32,31 @@ type LoginRequest struct {
 
 // DeviceAuthRequest структура запиту автентифікації пристрою
 type DeviceAuthRequest struct {
-	SerialNumber string `json:"serial_number" validate:"required"`
-	Token        string `json:"token" validate:"required"`
+	SerialNumber    string `json:"serial_number" validate:"required"`
+	Token           string `json:"token" validate:"required"`
+	FirmwareVersion string `json:"firmware_version,omitempty" example:"1.2.0"`
+}
+
+// ForgotPasswordRequest структура запиту відновлення пароля
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email" example:"user@example.com"`
+}
+
+// ResetPasswordRequest структура запиту встановлення нового пароля за токеном
+type ResetPasswordRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,min=8"`
+}
+
+// TwoFactorChallengeRequest структура запиту з challenge токеном
+type TwoFactorChallengeRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+}
+
+// VerifyTwoFactorRequest структура запиту підтвердження входу кодом 2FA
+type VerifyTwoFactorRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required" example:"123456"`
 }
 
 // RefreshTokenRequest структура запиту оновлення токена
@@ -38,7 +67,7 @@ type RefreshTokenRequest struct {
 // Login обробляє вхід користувача
 //
 //	@Summary		Автентифікація користувача
-//	@Description	Автентифікує користувача та повертає JWT токени
+//	@Description	Автентифікує користувача та повертає JWT токени. Якщо потрібна двофакторна автентифікація, повертає mfa_required та challenge_token для /auth/2fa/verify
 //	@Tags			Authentication
 //	@Accept			json
 //	@Produce		json
@@ -46,6 +75,7 @@ type RefreshTokenRequest struct {
 //	@Success		200			{object}	service.LoginResponse
 //	@Failure 400 {object} ErrorResponse
 //	@Failure 401 {object} ErrorResponse
+//	@Failure 429 {object} ErrorResponse
 //	@Router			/auth/login [post]
 func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	var req LoginRequest
@@ -55,16 +85,99 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 		})
 	}
 
-	response, err := h.authService.Login(c.Context(), req.Email, req.Password)
+	response, err := h.authService.Login(c.Context(), req.Email, req.Password, c.IP())
+	if err != nil {
+		var throttled *service.LoginThrottledError
+		if errors.As(err, &throttled) {
+			return throttledResponse(c, throttled)
+		}
+		return c.Status(401).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(response)
+}
+
+// VerifyTwoFactor завершує вхід кодом другого фактора
+//
+//	@Summary		Підтвердження входу кодом 2FA
+//	@Description	Приймає challenge_token з відповіді /auth/login та TOTP код або код відновлення. Повертає JWT токени. Якщо 2FA налаштовувалась під час входу, у відповіді також будуть коди відновлення
+//	@Tags			Authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		VerifyTwoFactorRequest	true	"Challenge токен та код"
+//	@Success		200		{object}	service.LoginResponse
+//	@Failure		400		{object}	ErrorResponse
+//	@Failure		401		{object}	ErrorResponse
+//	@Failure		429		{object}	ErrorResponse
+//	@Router			/auth/2fa/verify [post]
+func (h *AuthHandler) VerifyTwoFactor(c *fiber.Ctx) error {
+	var req VerifyTwoFactorRequest
+	if err := c.BodyParser(&req); err != nil || req.ChallengeToken == "" || req.Code == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	response, err := h.authService.CompleteTwoFactorLogin(c.Context(), req.ChallengeToken, req.Code, c.IP())
 	if err != nil {
+		var throttled *service.LoginThrottledError
+		if errors.As(err, &throttled) {
+			return throttledResponse(c, throttled)
+		}
 		return c.Status(401).JSON(fiber.Map{
 			"error": err.Error(),
 		})
 	}
 
+	if len(response.RecoveryCodes) > 0 {
+		c.Set(fiber.HeaderCacheControl, "no-store")
+	}
 	return c.JSON(response)
 }
 
+// EnrollTwoFactor починає обов'язкове налаштування 2FA під час входу
+//
+//	@Summary		Налаштування 2FA під час входу
+//	@Description	Для ролей з обов'язковою 2FA: повертає секрет та otpauth URI для QR-коду. Після додавання в застосунок вхід завершується через /auth/2fa/verify
+//	@Tags			Authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		TwoFactorChallengeRequest	true	"Challenge токен"
+//	@Success		200		{object}	service.TwoFactorEnrollment
+//	@Failure		400		{object}	ErrorResponse
+//	@Failure		401		{object}	ErrorResponse
+//	@Router			/auth/2fa/enroll [post]
+func (h *AuthHandler) EnrollTwoFactor(c *fiber.Ctx) error {
+	var req TwoFactorChallengeRequest
+	if err := c.BodyParser(&req); err != nil || req.ChallengeToken == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	enrollment, err := h.authService.StartTwoFactorEnrollment(c.Context(), req.ChallengeToken)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(enrollment)
+}
+
+// throttledResponse формує відповідь 429 із заголовком Retry-After
+func throttledResponse(c *fiber.Ctx, throttled *service.LoginThrottledError) error {
+	retryAfter := int(math.Ceil(throttled.RetryAfter.Seconds()))
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+	return c.Status(429).JSON(fiber.Map{
+		"error":       throttled.Error(),
+		"retry_after": retryAfter,
+	})
+}
+
 // DeviceAuth обробляє автентифікацію IoT-пристрою
 //
 //	@Summary		Автентифікація IoT-пристрою
@@ -85,7 +198,7 @@ func (h *AuthHandler) DeviceAuth(c *fiber.Ctx) error {
 		})
 	}
 
-	response, err := h.authService.DeviceAuth(c.Context(), req.SerialNumber, req.Token)
+	response, err := h.authService.DeviceAuth(c.Context(), req.SerialNumber, req.Token, req.FirmwareVersion)
 	if err != nil {
 		return c.Status(401).JSON(fiber.Map{
 			"error": err.Error(),
@@ -124,3 +237,93 @@ func (h *AuthHandler) RefreshToken(c *fiber.Ctx) error {
 
 	return c.JSON(response)
 }
+
+// Logout завершує поточну сесію користувача
+//
+//	@Summary		Вихід із системи
+//	@Description	Відкликає всі refresh токени поточної сесії. Access токен, переданий у заголовку Authorization, відкликається разом з ними
+//	@Tags			Authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			refresh			body		RefreshTokenRequest	true	"Refresh токен поточної сесії"
+//	@Param			Authorization	header		string				false	"Bearer access токен поточної сесії"
+//	@Success		200		{object}	MessageResponse
+//	@Failure		400		{object}	ErrorResponse
+//	@Failure		401		{object}	ErrorResponse
+//	@Router			/auth/logout [post]
+func (h *AuthHandler) Logout(c *fiber.Ctx) error {
+	var req RefreshTokenRequest
+	if err := c.BodyParser(&req); err != nil || req.RefreshToken == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	// Access токен необов'язковий: без нього сесія все одно завершується
+	accessToken := strings.TrimPrefix(c.Get("Authorization"), "Bearer ")
+
+	if err := h.authService.Logout(c.Context(), req.RefreshToken, accessToken); err != nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(MessageResponse{Message: "Logged out successfully"})
+}
+
+// ForgotPassword надсилає лист з посиланням для відновлення пароля
+//
+//	@Summary		Запит відновлення пароля
+//	@Description	Надсилає на email одноразове посилання для встановлення нового пароля. Відповідь однакова незалежно від існування облікового запису
+//	@Tags			Authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		ForgotPasswordRequest	true	"Email користувача"
+//	@Success		202		{object}	MessageResponse
+//	@Failure		400		{object}	ErrorResponse
+//	@Failure		500		{object}	ErrorResponse
+//	@Router			/auth/password/forgot [post]
+func (h *AuthHandler) ForgotPassword(c *fiber.Ctx) error {
+	var req ForgotPasswordRequest
+	if err := c.BodyParser(&req); err != nil || req.Email == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.passwordService.RequestPasswordReset(c.Context(), req.Email, c.IP()); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to process password reset request",
+		})
+	}
+
+	return c.Status(202).JSON(MessageResponse{Message: "If the account exists, a password reset link has been sent"})
+}
+
+// ResetPassword встановлює новий пароль за токеном відновлення
+//
+//	@Summary		Встановлення нового пароля
+//	@Description	Встановлює новий пароль за одноразовим токеном з листа та завершує всі сесії користувача
+//	@Tags			Authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		ResetPasswordRequest	true	"Токен та новий пароль"
+//	@Success		200		{object}	MessageResponse
+//	@Failure		400		{object}	ErrorResponse
+//	@Router			/auth/password/reset [post]
+func (h *AuthHandler) ResetPassword(c *fiber.Ctx) error {
+	var req ResetPasswordRequest
+	if err := c.BodyParser(&req); err != nil || req.Token == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.passwordService.ResetPassword(c.Context(), req.Token, req.NewPassword, c.IP()); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(MessageResponse{Message: "Password has been reset, please log in again"})
+}
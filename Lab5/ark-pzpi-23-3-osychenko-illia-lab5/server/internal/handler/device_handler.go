@@ -0,0 +1,393 @@
+package handler
+
+import (
+	"busoptima/internal/model"
+	"busoptima/internal/service"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// DeviceHandler обробляє адміністративні запити для IoT-пристроїв
+type DeviceHandler struct {
+	deviceService service.DeviceService
+}
+
+// NewDeviceHandler створює новий обробник пристроїв
+func NewDeviceHandler(deviceService service.DeviceService) *DeviceHandler {
+	return &DeviceHandler{deviceService: deviceService}
+}
+
+// RegisterDeviceRequest структура запиту реєстрації пристрою
+type RegisterDeviceRequest struct {
+	SerialNumber    string `json:"serial_number" validate:"required" example:"ESP32-001"`
+	BusID           *int64 `json:"bus_id,omitempty" example:"1"`
+	FirmwareVersion string `json:"firmware_version" example:"1.0.0"`
+}
+
+// BindDeviceBusRequest структура запиту прив'язки пристрою до автобуса
+type BindDeviceBusRequest struct {
+	BusID int64 `json:"bus_id" validate:"required" example:"1"`
+}
+
+// SetDeviceGroupRequest структура запиту зміни групи пристрою
+type SetDeviceGroupRequest struct {
+	DeviceGroup string `json:"device_group" example:"pilot"`
+}
+
+// DeviceCredentialsResponse відповідь з секретом пристрою (показується лише один раз)
+type DeviceCredentialsResponse struct {
+	Device  *model.Device `json:"device"`
+	Secret  string        `json:"secret" example:"q8Zk2..."`
+	Message string        `json:"message" example:"Store this secret now, it will not be shown again"`
+}
+
+// GetAll повертає список пристроїв
+//
+//	@Summary		Отримати список IoT-пристроїв
+//	@Description	Повертає всі зареєстровані пристрої разом з прив'язаними автобусами
+//	@Tags			Devices
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{array}		model.Device
+//	@Failure		500	{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/devices [get]
+func (h *DeviceHandler) GetAll(c *fiber.Ctx) error {
+	devices, err := h.deviceService.GetAll(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(devices)
+}
+
+// GetByID повертає пристрій за ID
+//
+//	@Summary		Отримати IoT-пристрій за ID
+//	@Description	Повертає пристрій за вказаним ідентифікатором
+//	@Tags			Devices
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int	true	"ID пристрою"
+//	@Success		200	{object}	model.Device
+//	@Failure		400	{object}	ErrorResponse
+//	@Failure		404	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/devices/{id} [get]
+func (h *DeviceHandler) GetByID(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid device ID"})
+	}
+
+	device, err := h.deviceService.GetByID(c.Context(), id)
+	if err != nil {
+		return deviceErrorResponse(c, err, "Failed to get device")
+	}
+
+	return c.JSON(device)
+}
+
+// Register реєструє новий пристрій
+//
+//	@Summary		Зареєструвати IoT-пристрій
+//	@Description	Реєструє пристрій та повертає його секрет. Секрет показується лише один раз
+//	@Tags			Devices
+//	@Accept			json
+//	@Produce		json
+//	@Param			device	body		RegisterDeviceRequest	true	"Дані пристрою"
+//	@Success		201		{object}	DeviceCredentialsResponse
+//	@Failure		400		{object}	ErrorResponse
+//	@Failure		409		{object}	ErrorResponse
+//	@Failure		500		{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/devices [post]
+func (h *DeviceHandler) Register(c *fiber.Ctx) error {
+	var req RegisterDeviceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	device := &model.Device{
+		SerialNumber:    req.SerialNumber,
+		BusID:           req.BusID,
+		FirmwareVersion: req.FirmwareVersion,
+	}
+
+	credentials, err := h.deviceService.Register(c.Context(), device)
+	if err != nil {
+		return deviceErrorResponse(c, err, "Failed to register device")
+	}
+
+	// Секрет показується лише один раз, тому відповідь не повинна кешуватись
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(201).JSON(newDeviceCredentialsResponse(credentials))
+}
+
+// BindBus прив'язує пристрій до автобуса
+//
+//	@Summary		Прив'язати пристрій до автобуса
+//	@Description	Прив'язує пристрій до автобуса. Автобус може мати лише один пристрій
+//	@Tags			Devices
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int						true	"ID пристрою"
+//	@Param			bus		body		BindDeviceBusRequest	true	"ID автобуса"
+//	@Success		200		{object}	model.Device
+//	@Failure		400		{object}	ErrorResponse
+//	@Failure		404		{object}	ErrorResponse
+//	@Failure		409		{object}	ErrorResponse
+//	@Failure		500		{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/devices/{id}/bus [put]
+func (h *DeviceHandler) BindBus(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid device ID"})
+	}
+
+	var req BindDeviceBusRequest
+	if err := c.BodyParser(&req); err != nil || req.BusID <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	device, err := h.deviceService.BindBus(c.Context(), id, req.BusID)
+	if err != nil {
+		return deviceErrorResponse(c, err, "Failed to bind device to bus")
+	}
+
+	return c.JSON(device)
+}
+
+// UnbindBus відв'язує пристрій від автобуса
+//
+//	@Summary		Відв'язати пристрій від автобуса
+//	@Description	Знімає прив'язку пристрою до автобуса
+//	@Tags			Devices
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int	true	"ID пристрою"
+//	@Success		200	{object}	model.Device
+//	@Failure		400	{object}	ErrorResponse
+//	@Failure		404	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/devices/{id}/bus [delete]
+func (h *DeviceHandler) UnbindBus(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid device ID"})
+	}
+
+	device, err := h.deviceService.UnbindBus(c.Context(), id)
+	if err != nil {
+		return deviceErrorResponse(c, err, "Failed to unbind device from bus")
+	}
+
+	return c.JSON(device)
+}
+
+// Deactivate деактивує пристрій
+//
+//	@Summary		Деактивувати пристрій
+//	@Description	Деактивує пристрій та звільняє прив'язаний автобус
+//	@Tags			Devices
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int	true	"ID пристрою"
+//	@Success		200	{object}	MessageResponse
+//	@Failure		400	{object}	ErrorResponse
+//	@Failure		404	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/devices/{id}/deactivate [post]
+func (h *DeviceHandler) Deactivate(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid device ID"})
+	}
+
+	if err := h.deviceService.Deactivate(c.Context(), id); err != nil {
+		return deviceErrorResponse(c, err, "Failed to deactivate device")
+	}
+
+	return c.JSON(MessageResponse{Message: "Device deactivated successfully"})
+}
+
+// RotateSecret генерує новий секрет пристрою
+//
+//	@Summary		Ротація секрету пристрою
+//	@Description	Генерує новий секрет пристрою. Попередній секрет перестає діяти, новий показується лише один раз
+//	@Tags			Devices
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int	true	"ID пристрою"
+//	@Success		200	{object}	DeviceCredentialsResponse
+//	@Failure		400	{object}	ErrorResponse
+//	@Failure		404	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/devices/{id}/rotate-secret [post]
+func (h *DeviceHandler) RotateSecret(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid device ID"})
+	}
+
+	credentials, err := h.deviceService.RotateSecret(c.Context(), id)
+	if err != nil {
+		return deviceErrorResponse(c, err, "Failed to rotate device secret")
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(newDeviceCredentialsResponse(credentials))
+}
+
+// SetDeviceGroup змінює групу пристрою
+//
+//	@Summary		Змінити групу пристрою
+//	@Description	Додає пристрій до групи для поетапного розгортання прошивки. Порожня назва прибирає пристрій з групи
+//	@Tags			Devices
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int						true	"ID пристрою"
+//	@Param			group	body		SetDeviceGroupRequest	true	"Група пристрою"
+//	@Success		200		{object}	model.Device
+//	@Failure		400		{object}	ErrorResponse
+//	@Failure		404		{object}	ErrorResponse
+//	@Failure		500		{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/devices/{id}/group [put]
+func (h *DeviceHandler) SetDeviceGroup(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid device ID"})
+	}
+
+	var req SetDeviceGroupRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	device, err := h.deviceService.SetGroup(c.Context(), id, req.DeviceGroup)
+	if err != nil {
+		return deviceErrorResponse(c, err, "Failed to update device group")
+	}
+
+	return c.JSON(device)
+}
+
+// GetStatuses повертає стан усіх пристроїв
+//
+//	@Summary		Стан IoT-пристроїв
+//	@Description	Повертає для кожного пристрою стан зв'язку (online, offline, never_seen, inactive), останні показники heartbeat та попередження (low_battery, weak_signal, low_memory, event_backlog)
+//	@Tags			Devices
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{array}		service.DeviceStatus
+//	@Failure		500	{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/devices/status [get]
+func (h *DeviceHandler) GetStatuses(c *fiber.Ctx) error {
+	statuses, err := h.deviceService.GetStatuses(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(statuses)
+}
+
+// GetStatus повертає стан пристрою
+//
+//	@Summary		Стан IoT-пристрою
+//	@Description	Повертає стан зв'язку пристрою, останні показники heartbeat та попередження
+//	@Tags			Devices
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int	true	"ID пристрою"
+//	@Success		200	{object}	service.DeviceStatus
+//	@Failure		400	{object}	ErrorResponse
+//	@Failure		404	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/devices/{id}/status [get]
+func (h *DeviceHandler) GetStatus(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid device ID"})
+	}
+
+	status, err := h.deviceService.GetStatus(c.Context(), id)
+	if errors.Is(err, service.ErrDeviceNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "Device not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(status)
+}
+
+// GetHeartbeats повертає історію показників пристрою
+//
+//	@Summary		Історія телеметрії IoT-пристрою
+//	@Description	Повертає heartbeat пристрою за останні hours годин (за замовчуванням 24), від найновіших
+//	@Tags			Devices
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int	true	"ID пристрою"
+//	@Param			hours	query		int	false	"Період у годинах (за замовчуванням 24)"
+//	@Param			limit	query		int	false	"Максимальна кількість записів (до 1000)"
+//	@Success		200		{array}		model.DeviceHeartbeat
+//	@Failure		400		{object}	ErrorResponse
+//	@Failure		404		{object}	ErrorResponse
+//	@Failure		500		{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/devices/{id}/heartbeats [get]
+func (h *DeviceHandler) GetHeartbeats(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid device ID"})
+	}
+
+	hours := c.QueryInt("hours", 24)
+	if hours <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "hours must be positive"})
+	}
+
+	since := time.Now().Add(-time.Duration(hours) * time.Hour)
+	heartbeats, err := h.deviceService.GetHeartbeats(c.Context(), id, since, c.QueryInt("limit"))
+	if errors.Is(err, service.ErrDeviceNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "Device not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(heartbeats)
+}
+
+// deviceErrorResponse повертає 404 для відсутнього пристрою, 409 для зайнятого серійного номера чи автобуса,
+// 400 для некоректного запиту та 500 без подробиць для інших помилок
+func deviceErrorResponse(c *fiber.Ctx, err error, message string) error {
+	switch {
+	case errors.Is(err, service.ErrDeviceNotFound):
+		return c.Status(404).JSON(fiber.Map{"error": "Device not found"})
+	case errors.Is(err, service.ErrDeviceConflict):
+		return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidDevice):
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(500).JSON(fiber.Map{"error": message})
+}
+
+// newDeviceCredentialsResponse формує відповідь з секретом пристрою
+func newDeviceCredentialsResponse(credentials *service.DeviceCredentials) DeviceCredentialsResponse {
+	return DeviceCredentialsResponse{
+		Device:  credentials.Device,
+		Secret:  credentials.Secret,
+		Message: "Store this secret now, it will not be shown again",
+	}
+}
@@ -0,0 +1,317 @@
+package handler
+
+import (
+	"busoptima/internal/middleware"
+	"busoptima/internal/model"
+	"busoptima/internal/service"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// FirmwareHandler обробляє запити розгортання прошивок IoT-пристроїв
+type FirmwareHandler struct {
+	firmwareService service.FirmwareService
+	auditHelper     *middleware.AuditHelper
+}
+
+// NewFirmwareHandler створює новий обробник прошивок
+func NewFirmwareHandler(firmwareService service.FirmwareService, auditHelper *middleware.AuditHelper) *FirmwareHandler {
+	return &FirmwareHandler{
+		firmwareService: firmwareService,
+		auditHelper:     auditHelper,
+	}
+}
+
+// CreateRolloutRequest структура запиту призначення цільової версії.
+// Без device_id та device_group версія призначається всім пристроям
+type CreateRolloutRequest struct {
+	FirmwareID     int64   `json:"firmware_id" validate:"required" example:"1"`
+	DeviceID       *int64  `json:"device_id,omitempty" example:"1"`
+	DeviceGroup    *string `json:"device_group,omitempty" example:"pilot"`
+	RolloutPercent *int    `json:"rollout_percent,omitempty" example:"10"`
+}
+
+// UpdateRolloutRequest структура запиту зміни частки пристроїв розгортання
+type UpdateRolloutRequest struct {
+	RolloutPercent int `json:"rollout_percent" example:"50"`
+}
+
+// UploadRelease завантажує нову прошивку
+//
+//	@Summary		Завантажити прошивку
+//	@Description	Приймає файл прошивки (multipart/form-data) з версією та SHA-256. Контрольна сума перевіряється за отриманим файлом
+//	@Tags			Firmware
+//	@Accept			multipart/form-data
+//	@Produce		json
+//	@Param			file			formData	file	true	"Файл прошивки"
+//	@Param			version			formData	string	true	"Версія прошивки"
+//	@Param			checksum_sha256	formData	string	true	"SHA-256 файлу (hex)"
+//	@Param			notes			formData	string	false	"Опис змін"
+//	@Success		201				{object}	model.FirmwareRelease
+//	@Failure		400				{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/firmware [post]
+func (h *FirmwareHandler) UploadRelease(c *fiber.Ctx) error {
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Firmware file is required"})
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Failed to read firmware file"})
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Failed to read firmware file"})
+	}
+
+	release := &model.FirmwareRelease{
+		Version:        c.FormValue("version"),
+		ChecksumSHA256: c.FormValue("checksum_sha256"),
+	}
+	if notes := c.FormValue("notes"); notes != "" {
+		release.Notes = &notes
+	}
+	if userID, ok := c.Locals("user_id").(int64); ok {
+		release.UploadedBy = &userID
+	}
+
+	created, err := h.firmwareService.UploadRelease(c.Context(), release, data)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(201).JSON(created)
+}
+
+// GetReleases повертає список прошивок
+//
+//	@Summary		Список прошивок
+//	@Description	Повертає завантажені прошивки від найновіших
+//	@Tags			Firmware
+//	@Produce		json
+//	@Success		200	{array}		model.FirmwareRelease
+//	@Failure		500	{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/firmware [get]
+func (h *FirmwareHandler) GetReleases(c *fiber.Ctx) error {
+	releases, err := h.firmwareService.GetReleases(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(releases)
+}
+
+// CreateRollout призначає цільову версію прошивки
+//
+//	@Summary		Створити розгортання прошивки
+//	@Description	Призначає версію пристрою, групі пристроїв або всім пристроям. Оновлення отримує rollout_percent пристроїв цілі (за замовчуванням 100). Попереднє активне розгортання для тієї ж цілі завершується
+//	@Tags			Firmware
+//	@Accept			json
+//	@Produce		json
+//	@Param			rollout	body		CreateRolloutRequest	true	"Ціль розгортання"
+//	@Success		201		{object}	service.RolloutProgress
+//	@Failure		400		{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/firmware/rollouts [post]
+func (h *FirmwareHandler) CreateRollout(c *fiber.Ctx) error {
+	var req CreateRolloutRequest
+	if err := c.BodyParser(&req); err != nil || req.FirmwareID <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	rollout := &model.FirmwareRollout{
+		FirmwareID:     req.FirmwareID,
+		DeviceID:       req.DeviceID,
+		DeviceGroup:    req.DeviceGroup,
+		RolloutPercent: 100,
+	}
+	if req.RolloutPercent != nil {
+		rollout.RolloutPercent = *req.RolloutPercent
+	}
+	if userID, ok := c.Locals("user_id").(int64); ok {
+		rollout.CreatedBy = &userID
+	}
+
+	progress, err := h.firmwareService.CreateRollout(c.Context(), rollout)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(201).JSON(progress)
+}
+
+// GetRollouts повертає розгортання з прогресом
+//
+//	@Summary		Список розгортань прошивки
+//	@Description	Повертає розгортання з кількістю цільових, відібраних, оновлених та очікуючих пристроїв. Оновленим вважається пристрій, що повідомив цільову версію через /auth/device або heartbeat
+//	@Tags			Firmware
+//	@Produce		json
+//	@Success		200	{array}		service.RolloutProgress
+//	@Failure		500	{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/firmware/rollouts [get]
+func (h *FirmwareHandler) GetRollouts(c *fiber.Ctx) error {
+	rollouts, err := h.firmwareService.GetRollouts(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(rollouts)
+}
+
+// GetRollout повертає розгортання з прогресом
+//
+//	@Summary		Прогрес розгортання прошивки
+//	@Description	Повертає розгортання з кількістю цільових, відібраних, оновлених та очікуючих пристроїв
+//	@Tags			Firmware
+//	@Produce		json
+//	@Param			id	path		int	true	"ID розгортання"
+//	@Success		200	{object}	service.RolloutProgress
+//	@Failure		400	{object}	ErrorResponse
+//	@Failure		404	{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/firmware/rollouts/{id} [get]
+func (h *FirmwareHandler) GetRollout(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid rollout ID"})
+	}
+
+	progress, err := h.firmwareService.GetRollout(c.Context(), id)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Rollout not found"})
+	}
+
+	return c.JSON(progress)
+}
+
+// UpdateRollout змінює частку пристроїв розгортання
+//
+//	@Summary		Змінити частку розгортання
+//	@Description	Змінює rollout_percent активного розгортання. Пристрої, що вже отримали оновлення, залишаються в розгортанні при збільшенні частки
+//	@Tags			Firmware
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int						true	"ID розгортання"
+//	@Param			rollout	body		UpdateRolloutRequest	true	"Нова частка"
+//	@Success		200		{object}	service.RolloutProgress
+//	@Failure		400		{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/firmware/rollouts/{id} [put]
+func (h *FirmwareHandler) UpdateRollout(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid rollout ID"})
+	}
+
+	var req UpdateRolloutRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	progress, err := h.firmwareService.UpdateRolloutPercent(c.Context(), id, req.RolloutPercent)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(progress)
+}
+
+// StopRollout зупиняє розгортання
+//
+//	@Summary		Зупинити розгортання прошивки
+//	@Description	Зупиняє розгортання. Пристрої, що вже оновились, залишаються на новій версії
+//	@Tags			Firmware
+//	@Produce		json
+//	@Param			id	path		int	true	"ID розгортання"
+//	@Success		200	{object}	MessageResponse
+//	@Failure		400	{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/firmware/rollouts/{id}/stop [post]
+func (h *FirmwareHandler) StopRollout(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid rollout ID"})
+	}
+
+	if err := h.firmwareService.StopRollout(c.Context(), id); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(MessageResponse{Message: "Rollout stopped successfully"})
+}
+
+// GetManifest повертає маніфест оновлення для IoT-пристрою
+//
+//	@Summary		Перевірити оновлення прошивки
+//	@Description	Повертає підписаний маніфест (JWT у полі manifest, ключі - /.well-known/jwks.json), якщо пристрою призначено іншу версію прошивки. Пристрій має перевіряти оновлення з періодом poll_interval_seconds
+//	@Tags			IoT
+//	@Produce		json
+//	@Success		200	{object}	service.FirmwareManifest
+//	@Failure		403	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/iot/firmware [get]
+func (h *FirmwareHandler) GetManifest(c *fiber.Ctx) error {
+	deviceID, _ := c.Locals("device_id").(int64)
+	manifest, err := h.firmwareService.GetManifest(c.Context(), deviceID)
+	if err != nil {
+		if errors.Is(err, service.ErrDeviceAccessDenied) {
+			return c.Status(403).JSON(fiber.Map{"error": "Device is not allowed to receive firmware"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(manifest)
+}
+
+// Download повертає файл прошивки IoT-пристрою
+//
+//	@Summary		Завантажити файл прошивки
+//	@Description	Повертає файл прошивки, призначеної пристрою. SHA-256 передається в заголовку X-Checksum-SHA256
+//	@Tags			IoT
+//	@Produce		octet-stream
+//	@Param			id	path		int	true	"ID прошивки"
+//	@Success		200	{file}		binary
+//	@Failure		400	{object}	ErrorResponse
+//	@Failure		403	{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/iot/firmware/{id}/download [get]
+func (h *FirmwareHandler) Download(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid firmware ID"})
+	}
+
+	deviceID, _ := c.Locals("device_id").(int64)
+	release, data, err := h.firmwareService.GetDownload(c.Context(), deviceID, id)
+	if err != nil {
+		if errors.Is(err, service.ErrDeviceAccessDenied) || errors.Is(err, service.ErrFirmwareNotAssigned) {
+			if h.auditHelper != nil {
+				h.auditHelper.LogAccessDenied(c, "firmware", strconv.FormatInt(id, 10), err.Error())
+			}
+			return c.Status(403).JSON(fiber.Map{"error": "Firmware is not assigned to this device"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Логування аудиту для IoT пристрою
+	if h.auditHelper != nil {
+		h.auditHelper.LogDeviceAction(c, "DOWNLOAD", "firmware", strconv.FormatInt(id, 10), map[string]any{
+			"version":    release.Version,
+			"size_bytes": release.SizeBytes,
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMEOctetStream)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="busoptima-%s.bin"`, release.Version))
+	c.Set("X-Checksum-SHA256", release.ChecksumSHA256)
+	return c.Send(data)
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"busoptima/internal/service"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTripConfigs повертає конфігурацію рейсу з поточною версією параметрів ціноутворення
+type fakeTripConfigs struct {
+	service.IoTService
+	pricingVersion string
+}
+
+func (f *fakeTripConfigs) GetTripConfig(ctx context.Context, deviceID, tripID int64) (*service.TripConfig, error) {
+	return &service.TripConfig{
+		TripID:      tripID,
+		RouteID:     3,
+		BusCapacity: 50,
+		BasePrice:   500,
+		Pricing:     &service.PricingParameters{Version: f.pricingVersion, PeakHoursCoefficient: 1.2},
+	}, nil
+}
+
+// getTripConfig запитує конфігурацію рейсу 42 від імені пристрою 7
+func getTripConfig(t *testing.T, app *fiber.App, ifNoneMatch string) *http.Response {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/iot/config/42", nil)
+	if ifNoneMatch != "" {
+		req.Header.Set(fiber.HeaderIfNoneMatch, ifNoneMatch)
+	}
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestTripConfigETag(t *testing.T) {
+	iot := &fakeTripConfigs{pricingVersion: "3f2a9c0d1b7e4a65"}
+	app := fiber.New()
+	app.Get("/iot/config/:tripId", func(c *fiber.Ctx) error {
+		c.Locals("device_id", int64(7))
+		return c.Next()
+	}, NewIoTHandler(iot, nil).GetTripConfig)
+
+	first := getTripConfig(t, app, "")
+	defer first.Body.Close()
+	require.Equal(t, http.StatusOK, first.StatusCode)
+	etag := first.Header.Get(fiber.HeaderETag)
+	require.NotEmpty(t, etag)
+	assert.Equal(t, "no-cache", first.Header.Get(fiber.HeaderCacheControl))
+
+	var config service.TripConfig
+	require.NoError(t, json.NewDecoder(first.Body).Decode(&config))
+	assert.Equal(t, "3f2a9c0d1b7e4a65", config.Pricing.Version)
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		wantStatus  int
+	}{
+		{name: "current etag", ifNoneMatch: etag, wantStatus: http.StatusNotModified},
+		{name: "weak current etag", ifNoneMatch: "W/" + etag, wantStatus: http.StatusNotModified},
+		{name: "etag in a list", ifNoneMatch: `"stale", ` + etag, wantStatus: http.StatusNotModified},
+		{name: "any version", ifNoneMatch: "*", wantStatus: http.StatusNotModified},
+		{name: "stale etag", ifNoneMatch: `"stale"`, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := getTripConfig(t, app, tt.ifNoneMatch)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			assert.Equal(t, etag, resp.Header.Get(fiber.HeaderETag))
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			if tt.wantStatus == http.StatusNotModified {
+				assert.Empty(t, body)
+			} else {
+				assert.NotEmpty(t, body)
+			}
+		})
+	}
+
+	// Після зміни параметрів ціноутворення пристрій з попереднім ETag отримує нову конфігурацію
+	iot.pricingVersion = "8b1c5e2f0a9d7c34"
+	changed := getTripConfig(t, app, etag)
+	defer changed.Body.Close()
+	assert.Equal(t, http.StatusOK, changed.StatusCode)
+	assert.NotEqual(t, etag, changed.Header.Get(fiber.HeaderETag))
+}
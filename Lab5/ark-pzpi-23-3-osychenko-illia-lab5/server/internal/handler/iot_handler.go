@@ -4,9 +4,17 @@ import (
 	"busoptima/internal/middleware"
 	"busoptima/internal/model"
 	"busoptima/internal/service"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
 	"strconv"
-	"time"
+	"strings"
 
+	"github.com/fxamacker/cbor/v2"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -22,58 +30,71 @@ func NewIoTHandler(iotService service.IoTService, auditHelper *middleware.AuditH
 	}
 }
 
+// maxEventsBodyBytes максимальний розмір розпакованого тіла пакета подій. BodyLimit Fiber обмежує
+// лише стиснене тіло, а кілька кілобайт gzip можуть розпакуватися в гігабайти
+const maxEventsBodyBytes = 4 * 1024 * 1024
+
+var (
+	errEventsBodyTooLarge       = errors.New("request body too large")
+	errUnsupportedEventEncoding = errors.New("unsupported content encoding")
+)
+
 type SyncEventsRequest struct {
-	TripID int64 `json:"trip_id"`
-	Events []struct {
-		LocalID             int     `json:"local_id"`
-		EventType           string  `json:"event_type"`
-		Timestamp           string  `json:"timestamp"`
-		Latitude            float64 `json:"latitude"`
-		Longitude           float64 `json:"longitude"`
-		PassengerCountAfter int     `json:"passenger_count_after"`
-	} `json:"events"`
+	TripID int64                    `json:"trip_id"`
+	Events []service.SyncEventInput `json:"events"`
 }
 
 // SyncEvents синхронізує події пасажирів від IoT-пристрою
 //
 //	@Summary		Синхронізація подій пасажирів
-//	@Description	Отримує та зберігає події входу/виходу пасажирів від IoT-пристрою
+//	@Description	Отримує та зберігає події входу/виходу пасажирів від IoT-пристрою. Повторно надіслані події (той самий local_id для рейсу) не дублюються. Для кожної події повертається статус accepted, duplicate, quarantined або rejected з причиною; усі статуси остаточні. З Content-Type application/cbor приймається компактний пакет (service.CompactEventBatch), і відповідь також кодується в CBOR. Тіло може бути стиснене gzip (Content-Encoding: gzip), відповідь стискається за Accept-Encoding
 //	@Tags			IoT
-//	@Accept			json
-//	@Produce		json
+//	@Accept			json,application/cbor
+//	@Produce		json,application/cbor
 //	@Param			events	body		SyncEventsRequest	true	"Події пасажирів"
 //	@Success		201		{object}	service.SyncEventsResponse
 //	@Failure		400		{object}	ErrorResponse
+//	@Failure		403		{object}	ErrorResponse
+//	@Failure		404		{object}	ErrorResponse
+//	@Failure		413		{object}	ErrorResponse
+//	@Failure		415		{object}	ErrorResponse
 //	@Failure		500		{object}	ErrorResponse
 //	@Security		BearerAuth
 //	@Router			/iot/events [post]
 func (h *IoTHandler) SyncEvents(c *fiber.Ctx) error {
-	var req SyncEventsRequest
-	if err := c.BodyParser(&req); err != nil {
+	body, err := eventsBody(c)
+	switch {
+	case errors.Is(err, errEventsBodyTooLarge):
+		return c.Status(413).JSON(fiber.Map{"error": "Request body too large"})
+	case errors.Is(err, errUnsupportedEventEncoding):
+		return c.Status(415).JSON(fiber.Map{"error": "Unsupported Content-Encoding, use gzip"})
+	case err != nil:
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
 	}
 
-	// Конвертуємо в модель
-	events := make([]model.PassengerEvent, len(req.Events))
-	for i, e := range req.Events {
-		timestamp, err := time.Parse(time.RFC3339, e.Timestamp)
+	var req SyncEventsRequest
+	compact := isCBOR(c)
+	if compact {
+		tripID, inputs, err := service.DecodeCompactEvents(body)
 		if err != nil {
-			return c.Status(400).JSON(fiber.Map{"error": "Invalid timestamp format"})
-		}
-
-		events[i] = model.PassengerEvent{
-			TripID:              req.TripID,
-			EventType:           e.EventType,
-			Timestamp:           timestamp,
-			Latitude:            &e.Latitude,
-			Longitude:           &e.Longitude,
-			PassengerCountAfter: e.PassengerCountAfter,
-			DeviceLocalID:       &e.LocalID,
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
 		}
+		req = SyncEventsRequest{TripID: tripID, Events: inputs}
+	} else if err := json.Unmarshal(body, &req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
 	}
 
-	response, err := h.iotService.SyncEvents(c.Context(), req.TripID, events)
+	events := service.ToPassengerEvents(req.TripID, req.Events)
+
+	deviceID, _ := c.Locals("device_id").(int64)
+	response, err := h.iotService.SyncEvents(c.Context(), deviceID, req.TripID, events)
 	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrDeviceAccessDenied):
+			return h.denyAccess(c, "passenger_events", req.TripID, err)
+		case errors.Is(err, service.ErrTripNotFound):
+			return c.Status(404).JSON(fiber.Map{"error": "Trip not found"})
+		}
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
@@ -83,12 +104,64 @@ func (h *IoTHandler) SyncEvents(c *fiber.Ctx) error {
 			"trip_id":      req.TripID,
 			"events_count": len(events),
 			"synced_count": response.SyncedCount,
+			"accepted":     response.AcceptedCount,
+			"duplicates":   response.DuplicateCount,
+			"quarantined":  response.QuarantinedCount,
+			"rejected":     response.RejectedCount,
+			"compact":      compact,
 		})
 	}
 
+	if compact {
+		return sendCBOR(c.Status(201), response)
+	}
 	return c.Status(201).JSON(response)
 }
 
+// eventsBody повертає тіло пакета подій. Тіло з Content-Encoding: gzip розпаковується не більше
+// ніж до maxEventsBodyBytes, тому c.Body(), що розпаковує без обмеження, тут не використовується
+func eventsBody(c *fiber.Ctx) ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(c.Get(fiber.HeaderContentEncoding))) {
+	case "", "identity":
+		return c.Request().Body(), nil
+	case "gzip":
+	default:
+		return nil, errUnsupportedEventEncoding
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(c.Request().Body()))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	body, err := io.ReadAll(io.LimitReader(reader, maxEventsBodyBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxEventsBodyBytes {
+		return nil, errEventsBodyTooLarge
+	}
+	return body, nil
+}
+
+// isCBOR перевіряє, чи надіслано тіло запиту в CBOR
+func isCBOR(c *fiber.Ctx) bool {
+	mediaType, _, _ := strings.Cut(c.Get(fiber.HeaderContentType), ";")
+	return strings.EqualFold(strings.TrimSpace(mediaType), service.MIMEApplicationCBOR)
+}
+
+// sendCBOR відправляє відповідь у CBOR з тими самими ключами, що й у JSON
+func sendCBOR(c *fiber.Ctx, body any) error {
+	data, err := cbor.Marshal(body)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to encode response"})
+	}
+
+	c.Set(fiber.HeaderContentType, service.MIMEApplicationCBOR)
+	return c.Send(data)
+}
+
 type PriceRecommendationRequest struct {
 	TripID            int64   `json:"trip_id" example:"1"`
 	BasePrice         float64 `json:"base_price" example:"500.00"`
@@ -102,13 +175,15 @@ type PriceRecommendationRequest struct {
 // SendPriceRecommendation отримує рекомендацію ціни від IoT-пристрою
 //
 //	@Summary		Отримати рекомендацію ціни
-//	@Description	Отримує рекомендацію ціни від IoT-пристрою
+//	@Description	Отримує рекомендацію ціни від IoT-пристрою. Сервер перераховує ціну за фактичною завантаженістю та часом відправлення рейсу; якщо пристрій рахував від іншої базової ціни, його завантаженість відрізняється більше ніж на occupancy_tolerance_points або ціна - більше ніж на price_tolerance_percent базової ціни (параметри ціноутворення з /iot/config), рекомендація зберігається позначеною (flagged) з причиною, а в аналітиці використовується ціна сервера
 //	@Tags			IoT
 //	@Accept			json
 //	@Produce		json
 //	@Param			recommendation	body		PriceRecommendationRequest	true	"Рекомендація ціни"
-//	@Success		200				{object}	MessageResponse
+//	@Success		200				{object}	service.PriceVerification
 //	@Failure		400				{object}	ErrorResponse
+//	@Failure		403				{object}	ErrorResponse
+//	@Failure		404				{object}	ErrorResponse
 //	@Failure		500				{object}	ErrorResponse
 //	@Security		BearerAuth
 //	@Router			/iot/price [post]
@@ -128,7 +203,15 @@ func (h *IoTHandler) SendPriceRecommendation(c *fiber.Ctx) error {
 		DayCoeff:         req.DayCoefficient,
 	}
 
-	if err := h.iotService.SendPriceRecommendation(c.Context(), recommendation); err != nil {
+	deviceID, _ := c.Locals("device_id").(int64)
+	verification, err := h.iotService.SendPriceRecommendation(c.Context(), deviceID, recommendation)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrDeviceAccessDenied):
+			return h.denyAccess(c, "price_recommendation", req.TripID, err)
+		case errors.Is(err, service.ErrTripNotFound):
+			return c.Status(404).JSON(fiber.Map{"error": "Trip not found"})
+		}
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
@@ -142,23 +225,30 @@ func (h *IoTHandler) SendPriceRecommendation(c *fiber.Ctx) error {
 			"demand_coeff":      req.DemandCoefficient,
 			"time_coeff":        req.TimeCoefficient,
 			"day_coeff":         req.DayCoefficient,
+			"server_price":      verification.ServerPrice,
+			"flagged":           verification.Flagged,
+			"reason":            verification.Reason,
 		})
 	}
 
-	return c.JSON(MessageResponse{Message: "Price recommendation received"})
+	return c.JSON(verification)
 }
 
 // GetTripConfig повертає конфігурацію рейсу для IoT-пристрою
 //
 //	@Summary		Отримати конфігурацію рейсу
-//	@Description	Повертає конфігурацію рейсу для IoT-пристрою
+//	@Description	Повертає конфігурацію рейсу разом з повним набором параметрів ціноутворення (pricing), за якими рахує ціну сервер. Відповідь має ETag; з If-None-Match незмінена конфігурація повертає 304
 //	@Tags			IoT
 //	@Accept			json
 //	@Produce		json
-//	@Param			tripId	path		int	true	"ID рейсу"
-//	@Success		200		{object}	service.TripConfig
-//	@Failure		400		{object}	ErrorResponse
-//	@Failure		404		{object}	ErrorResponse
+//	@Param			tripId			path		int		true	"ID рейсу"
+//	@Param			If-None-Match	header		string	false	"ETag попередньо отриманої конфігурації"
+//	@Success		200				{object}	service.TripConfig
+//	@Success		304				"Not Modified"
+//	@Failure		400				{object}	ErrorResponse
+//	@Failure		403				{object}	ErrorResponse
+//	@Failure		404				{object}	ErrorResponse
+//	@Failure		500				{object}	ErrorResponse
 //	@Security		BearerAuth
 //	@Router			/iot/config/{tripId} [get]
 func (h *IoTHandler) GetTripConfig(c *fiber.Ctx) error {
@@ -167,19 +257,151 @@ func (h *IoTHandler) GetTripConfig(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid trip ID"})
 	}
 
-	config, err := h.iotService.GetTripConfig(c.Context(), tripID)
+	deviceID, _ := c.Locals("device_id").(int64)
+	config, err := h.iotService.GetTripConfig(c.Context(), deviceID, tripID)
 	if err != nil {
-		return c.Status(404).JSON(fiber.Map{"error": "Trip not found"})
+		switch {
+		case errors.Is(err, service.ErrDeviceAccessDenied):
+			return h.denyAccess(c, "trip_config", tripID, err)
+		case errors.Is(err, service.ErrTripNotFound):
+			return c.Status(404).JSON(fiber.Map{"error": "Trip not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
 	// Логування аудиту для IoT пристрою
 	if h.auditHelper != nil {
 		h.auditHelper.LogDeviceAction(c, "READ", "trip_config", strconv.FormatInt(tripID, 10), map[string]any{
-			"trip_id":      tripID,
-			"bus_capacity": config.BusCapacity,
-			"base_price":   config.BasePrice,
+			"trip_id":         tripID,
+			"bus_capacity":    config.BusCapacity,
+			"base_price":      config.BasePrice,
+			"pricing_version": config.Pricing.Version,
+		})
+	}
+
+	return sendWithETag(c, config)
+}
+
+// GetCurrentTrip повертає поточний або наступний рейс автобуса пристрою
+//
+//	@Summary		Поточний рейс пристрою
+//	@Description	Визначає рейс автобуса, до якого прив'язаний пристрій: рейс зі статусом boarding або in_progress, інакше найближчий запланований (до 12 годин наперед, або такий, що запізнюється з початком не більше години). Повертає статус active або upcoming з конфігурацією рейсу, або none без конфігурації. poll_interval_seconds - коли запитати знову. Відповідь має ETag; з If-None-Match незмінена відповідь повертає 304
+//	@Tags			IoT
+//	@Accept			json
+//	@Produce		json
+//	@Param			If-None-Match	header		string	false	"ETag попередньо отриманої відповіді"
+//	@Success		200				{object}	service.CurrentTripResponse
+//	@Success		304				"Not Modified"
+//	@Failure		403				{object}	ErrorResponse
+//	@Failure		500				{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/iot/current-trip [get]
+func (h *IoTHandler) GetCurrentTrip(c *fiber.Ctx) error {
+	deviceID, _ := c.Locals("device_id").(int64)
+	response, err := h.iotService.GetCurrentTrip(c.Context(), deviceID)
+	if err != nil {
+		if errors.Is(err, service.ErrDeviceAccessDenied) {
+			return c.Status(403).JSON(fiber.Map{"error": "Device is not allowed to access trips"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Логування аудиту лише коли рейс знайдено, порожні опитування не журналюються
+	if h.auditHelper != nil && response.Config != nil {
+		h.auditHelper.LogDeviceAction(c, "READ", "trip_config", strconv.FormatInt(response.Config.TripID, 10), map[string]any{
+			"trip_id":         response.Config.TripID,
+			"status":          response.Status,
+			"pricing_version": response.Config.Pricing.Version,
 		})
 	}
 
-	return c.JSON(config)
+	return sendWithETag(c, response)
+}
+
+// sendWithETag відправляє JSON з ETag за вмістом або 304, якщо клієнт уже має цю версію
+func sendWithETag(c *fiber.Ctx, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to encode response"})
+	}
+
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+
+	for _, candidate := range strings.Split(c.Get(fiber.HeaderIfNoneMatch), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return c.SendStatus(fiber.StatusNotModified)
+		}
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Send(data)
+}
+
+// HeartbeatRequest показники стану, які пристрій надсилає періодично
+type HeartbeatRequest struct {
+	FirmwareVersion string `json:"firmware_version" example:"1.2.0"`
+	UptimeSeconds   int64  `json:"uptime_seconds" example:"86400"`
+	FreeHeapBytes   *int   `json:"free_heap_bytes,omitempty" example:"142000"`
+	BufferedEvents  int    `json:"buffered_events" example:"0"`
+	RSSI            *int   `json:"rssi,omitempty" example:"-67"`
+	BatteryPercent  *int   `json:"battery_percent,omitempty" example:"87"`
+}
+
+// Heartbeat зберігає показники стану IoT-пристрою
+//
+//	@Summary		Heartbeat пристрою
+//	@Description	Зберігає версію прошивки, час роботи, вільну пам'ять, кількість подій у буфері, рівень сигналу та заряд батареї. Пристрій має надсилати heartbeat з періодом heartbeat_interval_seconds
+//	@Tags			IoT
+//	@Accept			json
+//	@Produce		json
+//	@Param			heartbeat	body		HeartbeatRequest	true	"Показники пристрою"
+//	@Success		200			{object}	service.HeartbeatResponse
+//	@Failure		400			{object}	ErrorResponse
+//	@Failure		403			{object}	ErrorResponse
+//	@Failure		500			{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/iot/heartbeat [post]
+func (h *IoTHandler) Heartbeat(c *fiber.Ctx) error {
+	var req HeartbeatRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	heartbeat := &model.DeviceHeartbeat{
+		UptimeSeconds:  req.UptimeSeconds,
+		FreeHeapBytes:  req.FreeHeapBytes,
+		BufferedEvents: req.BufferedEvents,
+		RSSI:           req.RSSI,
+		BatteryPercent: req.BatteryPercent,
+	}
+	if req.FirmwareVersion != "" {
+		heartbeat.FirmwareVersion = &req.FirmwareVersion
+	}
+
+	// Heartbeat надходять кожні пів хвилини, тому в журнал аудиту вони не пишуться
+	deviceID, _ := c.Locals("device_id").(int64)
+	response, err := h.iotService.RecordHeartbeat(c.Context(), deviceID, heartbeat)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidHeartbeat):
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, service.ErrDeviceAccessDenied):
+			return c.Status(403).JSON(fiber.Map{"error": "Device is not allowed to send heartbeats"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(response)
+}
+
+// denyAccess журналює спробу доступу пристрою до чужого рейсу та повертає 403
+func (h *IoTHandler) denyAccess(c *fiber.Ctx, entityType string, tripID int64, err error) error {
+	if h.auditHelper != nil {
+		h.auditHelper.LogAccessDenied(c, entityType, strconv.FormatInt(tripID, 10), err.Error())
+	}
+	return c.Status(403).JSON(fiber.Map{"error": "Access to this trip is denied"})
 }
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"busoptima/internal/model"
+	"busoptima/internal/service"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeIoTService зберігає останній отриманий пакет подій
+type fakeIoTService struct {
+	service.IoTService
+
+	deviceID int64
+	tripID   int64
+	events   []model.PassengerEvent
+}
+
+func (f *fakeIoTService) SyncEvents(ctx context.Context, deviceID, tripID int64, events []model.PassengerEvent) (*service.SyncEventsResponse, error) {
+	f.deviceID, f.tripID, f.events = deviceID, tripID, events
+	return &service.SyncEventsResponse{SyncedCount: len(events), AcceptedCount: len(events), TripCurrentPassengers: 1}, nil
+}
+
+// newIoTTestApp додаток з маршрутом подій від імені пристрою 7
+func newIoTTestApp(iot service.IoTService) *fiber.App {
+	app := fiber.New()
+	app.Post("/iot/events", func(c *fiber.Ctx) error {
+		c.Locals("device_id", int64(7))
+		return c.Next()
+	}, NewIoTHandler(iot, nil).SyncEvents)
+	return app
+}
+
+func gzipBody(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	_, err := writer.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+func TestSyncEventsAcceptsGzippedCBOR(t *testing.T) {
+	iot := &fakeIoTService{}
+	app := newIoTTestApp(iot)
+
+	data, err := service.EncodeCompactEvents(42, []service.SyncEventInput{
+		{LocalID: 1, EventType: "entry", Timestamp: "2024-05-01T08:00:00.250+03:00", Latitude: 49.9935, Longitude: 36.2304, PassengerCountAfter: 1},
+		{LocalID: 2, EventType: "exit", Timestamp: "2024-05-01T08:00:00.250+03:00", Latitude: 49.9935, Longitude: 36.2304, PassengerCountAfter: 0},
+	})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/iot/events", bytes.NewReader(gzipBody(t, data)))
+	req.Header.Set(fiber.HeaderContentType, service.MIMEApplicationCBOR)
+	req.Header.Set(fiber.HeaderContentEncoding, "gzip")
+
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, service.MIMEApplicationCBOR, resp.Header.Get(fiber.HeaderContentType))
+
+	raw, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	var response service.SyncEventsResponse
+	require.NoError(t, cbor.Unmarshal(raw, &response))
+	assert.Equal(t, 2, response.AcceptedCount)
+
+	assert.Equal(t, int64(7), iot.deviceID)
+	assert.Equal(t, int64(42), iot.tripID)
+	require.Len(t, iot.events, 2)
+	assert.Equal(t, "exit", iot.events[1].EventType)
+	assert.Equal(t, int64(1714539600250), iot.events[1].Timestamp.UnixMilli())
+}
+
+func TestSyncEventsLimitsDecompressedBody(t *testing.T) {
+	iot := &fakeIoTService{}
+	app := newIoTTestApp(iot)
+
+	// Кілька кілобайт gzip, що розпаковуються в тіло, більше за допустиме
+	req := httptest.NewRequest(http.MethodPost, "/iot/events", bytes.NewReader(gzipBody(t, make([]byte, maxEventsBodyBytes+1))))
+	req.Header.Set(fiber.HeaderContentType, service.MIMEApplicationCBOR)
+	req.Header.Set(fiber.HeaderContentEncoding, "gzip")
+
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	assert.Nil(t, iot.events)
+}
+
+func TestSyncEventsRejectsUnsupportedEncoding(t *testing.T) {
+	app := newIoTTestApp(&fakeIoTService{})
+
+	req := httptest.NewRequest(http.MethodPost, "/iot/events", bytes.NewReader([]byte{0x01}))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	req.Header.Set(fiber.HeaderContentEncoding, "br")
+
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+}
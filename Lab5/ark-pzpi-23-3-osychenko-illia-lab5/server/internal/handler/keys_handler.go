@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"busoptima/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// KeysHandler обробляє запити, пов'язані з ключами підпису JWT
+type KeysHandler struct {
+	keyService service.KeyService
+}
+
+// NewKeysHandler створює новий обробник ключів
+func NewKeysHandler(keyService service.KeyService) *KeysHandler {
+	return &KeysHandler{keyService: keyService}
+}
+
+// KeysReloadResponse відповідь на перезавантаження ключів
+type KeysReloadResponse struct {
+	ActiveKID string        `json:"active_kid" example:"20250101000000"`
+	Keys      []service.JWK `json:"keys"`
+}
+
+// JWKS повертає публічні ключі для перевірки токенів
+//
+//	@Summary		Публічні ключі JWT (JWKS)
+//	@Description	Повертає набір публічних ключів, якими можна перевірити підпис access токенів
+//	@Tags			Auth
+//	@Produce		json
+//	@Success		200	{object}	service.JWKSet
+//	@Router			/.well-known/jwks.json [get]
+func (h *KeysHandler) JWKS(c *fiber.Ctx) error {
+	// Клієнти можуть кешувати набір ключів, але мають підхоплювати ротацію
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(h.keyService.JWKS())
+}
+
+// Reload перечитує ключі підпису з каталогу
+//
+//	@Summary		Перезавантажити ключі підпису
+//	@Description	Перечитує каталог ключів без перезапуску сервера. Новими токенами підписує ключ з найбільшим kid
+//	@Tags			Admin
+//	@Produce		json
+//	@Success		200	{object}	KeysReloadResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/keys/reload [post]
+func (h *KeysHandler) Reload(c *fiber.Ctx) error {
+	if err := h.keyService.Reload(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(KeysReloadResponse{
+		ActiveKID: h.keyService.ActiveKID(),
+		Keys:      h.keyService.JWKS().Keys,
+	})
+}
@@ -0,0 +1,390 @@
+package handler
+
+import (
+	"busoptima/internal/service"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// MeHandler обробляє запити поточного користувача до власного облікового запису
+type MeHandler struct {
+	profileService   service.ProfileService
+	passwordService  service.PasswordService
+	twoFactorService service.TwoFactorService
+	authService      service.AuthService
+}
+
+// NewMeHandler створює новий обробник облікового запису поточного користувача
+func NewMeHandler(profileService service.ProfileService, passwordService service.PasswordService, twoFactorService service.TwoFactorService, authService service.AuthService) *MeHandler {
+	return &MeHandler{
+		profileService:   profileService,
+		passwordService:  passwordService,
+		twoFactorService: twoFactorService,
+		authService:      authService,
+	}
+}
+
+// UpdateProfileRequest структура запиту зміни власного профілю
+type UpdateProfileRequest struct {
+	FullName        *string `json:"full_name,omitempty" example:"Іван Іванов"`
+	Email           *string `json:"email,omitempty" example:"user@example.com"`
+	CurrentPassword string  `json:"current_password,omitempty"`
+}
+
+// MyPermissionsResponse дозволи поточного користувача
+type MyPermissionsResponse struct {
+	Role        string   `json:"role" example:"dispatcher"`
+	Permissions []string `json:"permissions" example:"routes:read,analytics:read"`
+	RouteScoped bool     `json:"route_scoped" example:"true"`
+	RouteIDs    []int64  `json:"route_ids,omitempty" example:"1,2"`
+}
+
+// GetProfile повертає профіль поточного користувача
+//
+//	@Summary		Мій профіль
+//	@Description	Повертає профіль поточного користувача разом з роллю
+//	@Tags			Me
+//	@Produce		json
+//	@Success		200	{object}	model.User
+//	@Failure		401	{object}	ErrorResponse
+//	@Failure		404	{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/me [get]
+func (h *MeHandler) GetProfile(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(int64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+
+	user, err := h.profileService.GetProfile(c.Context(), userID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	return c.JSON(user)
+}
+
+// UpdateProfile змінює профіль поточного користувача
+//
+//	@Summary		Змінити мій профіль
+//	@Description	Змінює ім'я та email. Для зміни email потрібно вказати поточний пароль. Роль та стан облікового запису змінює лише адміністратор
+//	@Tags			Me
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		UpdateProfileRequest	true	"Нові дані профілю"
+//	@Success		200		{object}	model.User
+//	@Failure		400		{object}	ErrorResponse
+//	@Failure		401		{object}	ErrorResponse
+//	@Failure		403		{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/me [put]
+func (h *MeHandler) UpdateProfile(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(int64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+
+	var req UpdateProfileRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	user, err := h.profileService.UpdateProfile(c.Context(), userID, service.ProfileUpdate{
+		FullName:        req.FullName,
+		Email:           req.Email,
+		CurrentPassword: req.CurrentPassword,
+	}, c.IP())
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCurrentPassword) {
+			return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(user)
+}
+
+// GetPermissions повертає дозволи поточного користувача
+//
+//	@Summary		Мої дозволи
+//	@Description	Повертає роль, дозволи та доступні маршрути, що діють для поточного запиту
+//	@Tags			Me
+//	@Produce		json
+//	@Success		200	{object}	MyPermissionsResponse
+//	@Failure		401	{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/me/permissions [get]
+func (h *MeHandler) GetPermissions(c *fiber.Ctx) error {
+	if _, ok := c.Locals("user_id").(int64); !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+
+	role, _ := c.Locals("role").(string)
+	response := MyPermissionsResponse{
+		Role:        role,
+		Permissions: localPermissions(c),
+	}
+	if response.Permissions == nil {
+		response.Permissions = []string{}
+	}
+
+	if scope := routeScope(c); scope != nil {
+		response.RouteScoped = true
+		response.RouteIDs = scope.RouteIDs()
+	}
+
+	return c.JSON(response)
+}
+
+// GetSessions повертає активні сесії поточного користувача
+//
+//	@Summary		Мої сесії
+//	@Description	Повертає сесії (входи), refresh токени яких ще дійсні. Завершити всі сесії можна зміною пароля
+//	@Tags			Me
+//	@Produce		json
+//	@Success		200	{array}		model.Session
+//	@Failure		401	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/me/sessions [get]
+func (h *MeHandler) GetSessions(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(int64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+
+	sessions, err := h.profileService.GetSessions(c.Context(), userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(sessions)
+}
+
+// ChangePasswordRequest структура запиту зміни пароля
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,min=8"`
+}
+
+// TwoFactorCodeRequest структура запиту з кодом 2FA
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required" example:"123456"`
+}
+
+// RecoveryCodesResponse відповідь з кодами відновлення (показуються лише один раз)
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes" example:"7KQ2M-XH4PA,..."`
+	Message       string   `json:"message" example:"Store these recovery codes now, they will not be shown again"`
+}
+
+// ChangePassword змінює пароль поточного користувача
+//
+//	@Summary		Змінити пароль
+//	@Description	Змінює пароль поточного користувача. Після зміни всі сесії завершуються і потрібно увійти знову
+//	@Tags			Me
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		ChangePasswordRequest	true	"Поточний та новий пароль"
+//	@Success		200		{object}	MessageResponse
+//	@Failure		400		{object}	ErrorResponse
+//	@Failure		401		{object}	ErrorResponse
+//	@Failure		403		{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/me/password [put]
+func (h *MeHandler) ChangePassword(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(int64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+
+	var req ChangePasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if err := h.passwordService.ChangePassword(c.Context(), userID, req.CurrentPassword, req.NewPassword, c.IP()); err != nil {
+		if errors.Is(err, service.ErrInvalidCurrentPassword) || errors.Is(err, service.ErrNoLocalPassword) {
+			return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(MessageResponse{Message: "Password changed successfully, please log in again"})
+}
+
+// GetTwoFactorStatus повертає стан 2FA поточного користувача
+//
+//	@Summary		Стан двофакторної автентифікації
+//	@Description	Показує, чи увімкнена 2FA, чи обов'язкова вона для ролі та скільки лишилось кодів відновлення
+//	@Tags			Me
+//	@Produce		json
+//	@Success		200	{object}	service.TwoFactorStatus
+//	@Failure		401	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/me/2fa [get]
+func (h *MeHandler) GetTwoFactorStatus(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(int64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+
+	status, err := h.twoFactorService.Status(c.Context(), userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(status)
+}
+
+// EnrollTwoFactor починає налаштування 2FA
+//
+//	@Summary		Почати налаштування 2FA
+//	@Description	Генерує TOTP секрет та otpauth URI для QR-коду. 2FA вмикається лише після підтвердження кодом через /me/2fa/confirm
+//	@Tags			Me
+//	@Produce		json
+//	@Success		200	{object}	service.TwoFactorEnrollment
+//	@Failure		400	{object}	ErrorResponse
+//	@Failure		401	{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/me/2fa/enroll [post]
+func (h *MeHandler) EnrollTwoFactor(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(int64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+
+	enrollment, err := h.twoFactorService.Enroll(c.Context(), userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(enrollment)
+}
+
+// ConfirmTwoFactor вмикає 2FA після перевірки першого коду
+//
+//	@Summary		Підтвердити налаштування 2FA
+//	@Description	Перевіряє код з застосунку-автентифікатора, вмикає 2FA та повертає коди відновлення. Коди показуються лише один раз
+//	@Tags			Me
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		TwoFactorCodeRequest	true	"TOTP код"
+//	@Success		200		{object}	RecoveryCodesResponse
+//	@Failure		400		{object}	ErrorResponse
+//	@Failure		401		{object}	ErrorResponse
+//	@Failure		403		{object}	ErrorResponse
+//	@Failure		429		{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/me/2fa/confirm [post]
+func (h *MeHandler) ConfirmTwoFactor(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(int64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.BodyParser(&req); err != nil || req.Code == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	codes, err := h.authService.ConfirmTwoFactor(c.Context(), userID, req.Code, c.IP())
+	if err != nil {
+		return twoFactorErrorResponse(c, err)
+	}
+
+	return recoveryCodesResponse(c, codes)
+}
+
+// DisableTwoFactor вимикає 2FA
+//
+//	@Summary		Вимкнути 2FA
+//	@Description	Вимикає двофакторну автентифікацію після перевірки TOTP коду або коду відновлення. Недоступно, якщо 2FA обов'язкова для ролі
+//	@Tags			Me
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		TwoFactorCodeRequest	true	"TOTP код або код відновлення"
+//	@Success		200		{object}	MessageResponse
+//	@Failure		400		{object}	ErrorResponse
+//	@Failure		401		{object}	ErrorResponse
+//	@Failure		403		{object}	ErrorResponse
+//	@Failure		429		{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/me/2fa/disable [post]
+func (h *MeHandler) DisableTwoFactor(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(int64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.BodyParser(&req); err != nil || req.Code == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if err := h.authService.DisableTwoFactor(c.Context(), userID, req.Code, c.IP()); err != nil {
+		return twoFactorErrorResponse(c, err)
+	}
+
+	return c.JSON(MessageResponse{Message: "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes видає новий набір кодів відновлення
+//
+//	@Summary		Нові коди відновлення
+//	@Description	Після перевірки коду видає новий набір кодів відновлення, попередні перестають діяти
+//	@Tags			Me
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		TwoFactorCodeRequest	true	"TOTP код або код відновлення"
+//	@Success		200		{object}	RecoveryCodesResponse
+//	@Failure		400		{object}	ErrorResponse
+//	@Failure		401		{object}	ErrorResponse
+//	@Failure		403		{object}	ErrorResponse
+//	@Failure		429		{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/me/2fa/recovery-codes [post]
+func (h *MeHandler) RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(int64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.BodyParser(&req); err != nil || req.Code == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	codes, err := h.authService.RegenerateRecoveryCodes(c.Context(), userID, req.Code, c.IP())
+	if err != nil {
+		return twoFactorErrorResponse(c, err)
+	}
+
+	return recoveryCodesResponse(c, codes)
+}
+
+// twoFactorErrorResponse повертає 429 при перевищенні ліміту спроб, 403 для невірного коду
+// та заборонених дій, 400 для інших помилок
+func twoFactorErrorResponse(c *fiber.Ctx, err error) error {
+	var throttled *service.LoginThrottledError
+	if errors.As(err, &throttled) {
+		return throttledResponse(c, throttled)
+	}
+	if errors.Is(err, service.ErrInvalidTwoFactorCode) || errors.Is(err, service.ErrTwoFactorRequired) {
+		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+}
+
+// recoveryCodesResponse формує відповідь з кодами відновлення
+func recoveryCodesResponse(c *fiber.Ctx, codes []string) error {
+	// Коди показуються лише один раз, тому відповідь не повинна кешуватись
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(RecoveryCodesResponse{
+		RecoveryCodes: codes,
+		Message:       "Store these recovery codes now, they will not be shown again",
+	})
+}
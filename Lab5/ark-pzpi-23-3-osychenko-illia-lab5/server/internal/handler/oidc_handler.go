@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"busoptima/internal/service"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// OIDCHandler обробляє вхід через OpenID Connect
+type OIDCHandler struct {
+	oidcService service.OIDCService
+}
+
+// NewOIDCHandler створює новий обробник входу через OIDC
+func NewOIDCHandler(oidcService service.OIDCService) *OIDCHandler {
+	return &OIDCHandler{
+		oidcService: oidcService,
+	}
+}
+
+// OIDCCallbackRequest структура запиту завершення входу або прив'язки через OIDC
+type OIDCCallbackRequest struct {
+	Code         string `json:"code" validate:"required"`
+	State        string `json:"state" validate:"required"`
+	CodeVerifier string `json:"code_verifier" validate:"required"`
+}
+
+// Authorize починає вхід через OIDC
+//
+//	@Summary		Початок входу через OIDC
+//	@Description	Повертає адресу сторінки входу провайдера ідентичності (authorization code + PKCE). Клієнт генерує code_verifier, передає його S256 хеш у code_challenge, перенаправляє користувача за authorization_url, а після повернення передає code, state та code_verifier у /auth/oidc/callback
+//	@Tags			Authentication
+//	@Produce		json
+//	@Param			code_challenge	query		string	true	"PKCE code_challenge (S256, base64url)"
+//	@Success		200	{object}	service.OIDCAuthorization
+//	@Failure		400	{object}	ErrorResponse
+//	@Failure		404	{object}	ErrorResponse
+//	@Failure		502	{object}	ErrorResponse
+//	@Router			/auth/oidc/authorize [get]
+func (h *OIDCHandler) Authorize(c *fiber.Ctx) error {
+	authorization, err := h.oidcService.StartLogin(c.Context(), c.Query("code_challenge"))
+	if err != nil {
+		return oidcErrorResponse(c, err, 502)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(authorization)
+}
+
+// Callback завершує вхід через OIDC
+//
+//	@Summary		Завершення входу через OIDC
+//	@Description	Обмінює код авторизації на ID токен провайдера та повертає JWT токени BusOptima або challenge_token, якщо потрібна 2FA. При першому вході обліковий запис створюється автоматично з роллю за групами провайдера. Наявний обліковий запис з тим самим email потрібно спершу прив'язати через /me/oidc/link
+//	@Tags			Authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		OIDCCallbackRequest	true	"Код авторизації, state та code_verifier"
+//	@Success		200		{object}	service.LoginResponse
+//	@Failure		400		{object}	ErrorResponse
+//	@Failure		401		{object}	ErrorResponse
+//	@Failure		403		{object}	ErrorResponse
+//	@Failure		404		{object}	ErrorResponse
+//	@Failure		409		{object}	ErrorResponse
+//	@Router			/auth/oidc/callback [post]
+func (h *OIDCHandler) Callback(c *fiber.Ctx) error {
+	var req OIDCCallbackRequest
+	if err := c.BodyParser(&req); err != nil || req.Code == "" || req.State == "" || req.CodeVerifier == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	response, err := h.oidcService.CompleteLogin(c.Context(), req.Code, req.State, req.CodeVerifier, c.IP())
+	if err != nil {
+		return oidcErrorResponse(c, err, 401)
+	}
+
+	return c.JSON(response)
+}
+
+// AuthorizeLink починає прив'язку облікового запису провайдера
+//
+//	@Summary		Початок прив'язки облікового запису OIDC
+//	@Description	Повертає адресу сторінки входу провайдера для прив'язки його облікового запису до поточного користувача. Після повернення клієнт передає code, state та code_verifier у POST /me/oidc/link
+//	@Tags			Me
+//	@Produce		json
+//	@Param			code_challenge	query		string	true	"PKCE code_challenge (S256, base64url)"
+//	@Success		200	{object}	service.OIDCAuthorization
+//	@Failure		400	{object}	ErrorResponse
+//	@Failure		401	{object}	ErrorResponse
+//	@Failure		404	{object}	ErrorResponse
+//	@Failure		502	{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/me/oidc/link [get]
+func (h *OIDCHandler) AuthorizeLink(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(int64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+
+	authorization, err := h.oidcService.StartLink(c.Context(), userID, c.Query("code_challenge"))
+	if err != nil {
+		return oidcErrorResponse(c, err, 502)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(authorization)
+}
+
+// Link завершує прив'язку облікового запису провайдера
+//
+//	@Summary		Прив'язка облікового запису OIDC
+//	@Description	Обмінює код авторизації на ID токен провайдера та прив'язує його обліковий запис до поточного користувача. Після цього користувач може входити через /auth/oidc/callback
+//	@Tags			Me
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		OIDCCallbackRequest	true	"Код авторизації, state та code_verifier"
+//	@Success		200		{object}	MessageResponse
+//	@Failure		400		{object}	ErrorResponse
+//	@Failure		401		{object}	ErrorResponse
+//	@Failure		404		{object}	ErrorResponse
+//	@Failure		409		{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/me/oidc/link [post]
+func (h *OIDCHandler) Link(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(int64)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "User not authenticated"})
+	}
+
+	var req OIDCCallbackRequest
+	if err := c.BodyParser(&req); err != nil || req.Code == "" || req.State == "" || req.CodeVerifier == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if err := h.oidcService.CompleteLink(c.Context(), userID, req.Code, req.State, req.CodeVerifier, c.IP()); err != nil {
+		return oidcErrorResponse(c, err, 401)
+	}
+
+	return c.JSON(MessageResponse{Message: "Identity provider account linked successfully"})
+}
+
+// oidcErrorResponse перетворює помилку входу через OIDC на HTTP відповідь.
+// Інші помилки повертаються зі статусом fallback
+func oidcErrorResponse(c *fiber.Ctx, err error, fallback int) error {
+	status := fallback
+	switch {
+	case errors.Is(err, service.ErrOIDCDisabled):
+		status = 404
+	case errors.Is(err, service.ErrInvalidCodeChallenge):
+		status = 400
+	case errors.Is(err, service.ErrOIDCNoRole), errors.Is(err, service.ErrAccountDeactivated):
+		status = 403
+	case errors.Is(err, service.ErrOIDCAccountNotLinked), errors.Is(err, service.ErrOIDCIdentityInUse):
+		status = 409
+	}
+
+	return c.Status(status).JSON(fiber.Map{
+		"error": err.Error(),
+	})
+}
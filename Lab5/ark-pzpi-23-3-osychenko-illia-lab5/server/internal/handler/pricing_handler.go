@@ -2,6 +2,7 @@ package handler
 
 import (
 	"busoptima/internal/service"
+	"errors"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -9,10 +10,14 @@ import (
 
 type PricingHandler struct {
 	pricingService service.PricingService
+	routeService   service.RouteService
 }
 
-func NewPricingHandler(pricingService service.PricingService) *PricingHandler {
-	return &PricingHandler{pricingService: pricingService}
+func NewPricingHandler(pricingService service.PricingService, routeService service.RouteService) *PricingHandler {
+	return &PricingHandler{
+		pricingService: pricingService,
+		routeService:   routeService,
+	}
 }
 
 // CalculatePriceRequest структура запиту розрахунку ціни
@@ -21,18 +26,23 @@ type CalculatePriceRequest struct {
 	CurrentPassengers int       `json:"current_passengers" validate:"min=0" example:"25"`
 	Capacity          int       `json:"capacity" validate:"required,min=1" example:"50"`
 	DepartureTime     time.Time `json:"departure_time" validate:"required" example:"2025-12-15T08:00:00Z"`
+	// RouteID маршрут, базова ціна якого використовується замість base_price.
+	// Обов'язковий для користувачів, обмежених призначеними маршрутами
+	RouteID int64 `json:"route_id,omitempty" example:"1"`
 }
 
 // CalculatePrice розраховує рекомендовану ціну
 //
 //	@Summary		Розрахувати рекомендовану ціну
-//	@Description	Розраховує динамічну ціну на основі завантаженості та часу відправлення
+//	@Description	Розраховує динамічну ціну на основі завантаженості та часу відправлення. Якщо вказано route_id, береться базова ціна маршруту; користувач з обмеженим доступом може рахувати лише для призначених маршрутів
 //	@Tags			Pricing
 //	@Accept			json
 //	@Produce		json
 //	@Param			request	body		CalculatePriceRequest	true	"Параметри для розрахунку ціни"
 //	@Success		200		{object}	service.PriceRecommendation
 //	@Failure		400		{object}	ErrorResponse
+//	@Failure		403		{object}	ErrorResponse
+//	@Failure		404		{object}	ErrorResponse
 //	@Security		BearerAuth
 //	@Router			/pricing/calculate [post]
 func (h *PricingHandler) CalculatePrice(c *fiber.Ctx) error {
@@ -41,9 +51,26 @@ func (h *PricingHandler) CalculatePrice(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
 	}
 
+	scope := routeScope(c)
+	if req.RouteID == 0 && scope != nil {
+		return c.Status(403).JSON(fiber.Map{"error": "route_id is required for users limited to assigned routes"})
+	}
+
+	basePrice := req.BasePrice
+	if req.RouteID != 0 {
+		route, err := h.routeService.GetByID(c.Context(), scope, req.RouteID)
+		if errors.Is(err, service.ErrRouteOutOfScope) {
+			return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err != nil {
+			return c.Status(404).JSON(fiber.Map{"error": "Route not found"})
+		}
+		basePrice = route.BasePrice
+	}
+
 	recommendation, err := h.pricingService.CalculatePrice(
 		c.Context(),
-		req.BasePrice,
+		basePrice,
 		req.CurrentPassengers,
 		req.Capacity,
 		req.DepartureTime,
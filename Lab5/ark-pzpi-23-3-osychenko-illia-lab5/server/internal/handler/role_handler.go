@@ -0,0 +1,307 @@
+package handler
+
+import (
+	"busoptima/internal/model"
+	"busoptima/internal/service"
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RoleHandler обробляє адміністративні запити для ролей
+type RoleHandler struct {
+	roleService service.RoleService
+}
+
+// NewRoleHandler створює новий обробник ролей
+func NewRoleHandler(roleService service.RoleService) *RoleHandler {
+	return &RoleHandler{roleService: roleService}
+}
+
+// CreateRoleRequest структура запиту створення ролі
+type CreateRoleRequest struct {
+	Name        string   `json:"name" validate:"required" example:"senior_dispatcher"`
+	Description string   `json:"description" example:"Старший диспетчер"`
+	MFARequired bool     `json:"mfa_required" example:"false"`
+	RouteScoped bool     `json:"route_scoped" example:"true"`
+	Permissions []string `json:"permissions" example:"routes:read,analytics:read"`
+}
+
+// UpdateRoleRequest структура запиту оновлення ролі. Не передані mfa_required та route_scoped не змінюються
+type UpdateRoleRequest struct {
+	Name        string `json:"name" validate:"required" example:"senior_dispatcher"`
+	Description string `json:"description" example:"Старший диспетчер"`
+	MFARequired *bool  `json:"mfa_required,omitempty" example:"false"`
+	RouteScoped *bool  `json:"route_scoped,omitempty" example:"true"`
+}
+
+// RolePermissionsRequest структура запиту призначення дозволів ролі
+type RolePermissionsRequest struct {
+	Permissions []string `json:"permissions" example:"routes:read,analytics:read"`
+}
+
+// UpdateRoleMFARequest структура запиту зміни обов'язковості 2FA для ролі
+type UpdateRoleMFARequest struct {
+	MFARequired bool `json:"mfa_required" example:"true"`
+}
+
+// GetAll повертає список ролей
+//
+//	@Summary		Отримати список ролей
+//	@Description	Повертає всі ролі разом з дозволами та налаштуванням обов'язкової двофакторної автентифікації
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{array}		model.Role
+//	@Failure		500	{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/roles [get]
+func (h *RoleHandler) GetAll(c *fiber.Ctx) error {
+	roles, err := h.roleService.GetAll(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(roles)
+}
+
+// GetByID повертає роль за ID
+//
+//	@Summary		Отримати роль за ID
+//	@Description	Повертає роль разом з її дозволами
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int	true	"ID ролі"
+//	@Success		200	{object}	model.Role
+//	@Failure		400	{object}	ErrorResponse
+//	@Failure		404	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/roles/{id} [get]
+func (h *RoleHandler) GetByID(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid role ID"})
+	}
+
+	role, err := h.roleService.GetByID(c.Context(), id)
+	if err != nil {
+		return roleErrorResponse(c, err, "Failed to get role")
+	}
+
+	return c.JSON(role)
+}
+
+// Create створює нову роль
+//
+//	@Summary		Створити роль
+//	@Description	Створює роль з дозволами з каталогу (/admin/permissions). Можна призначити лише дозволи, які є у вас, а користувач, обмежений маршрутами, створює лише ролі з route_scoped
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			role	body		CreateRoleRequest	true	"Дані ролі"
+//	@Success		201		{object}	model.Role
+//	@Failure		400		{object}	ErrorResponse
+//	@Failure		403		{object}	ErrorResponse
+//	@Failure		409		{object}	ErrorResponse
+//	@Failure		500		{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/roles [post]
+func (h *RoleHandler) Create(c *fiber.Ctx) error {
+	var req CreateRoleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	role := &model.Role{
+		Name:        req.Name,
+		Description: req.Description,
+		MFARequired: req.MFARequired,
+		RouteScoped: req.RouteScoped,
+	}
+
+	created, err := h.roleService.Create(c.Context(), role, req.Permissions, localPermissions(c), routeScope(c))
+	if err != nil {
+		return roleErrorResponse(c, err, "Failed to create role")
+	}
+
+	return c.Status(201).JSON(created)
+}
+
+// Update оновлює роль
+//
+//	@Summary		Оновити роль
+//	@Description	Змінює назву та опис, а також обов'язковість 2FA та обмеження призначеними маршрутами, якщо їх передано. Користувач, обмежений маршрутами, не може зняти route_scoped. Дозволи змінюються через /admin/roles/{id}/permissions
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int					true	"ID ролі"
+//	@Param			role	body		UpdateRoleRequest	true	"Дані ролі"
+//	@Success		200		{object}	model.Role
+//	@Failure		400		{object}	ErrorResponse
+//	@Failure		403		{object}	ErrorResponse
+//	@Failure		404		{object}	ErrorResponse
+//	@Failure		409		{object}	ErrorResponse
+//	@Failure		500		{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/roles/{id} [put]
+func (h *RoleHandler) Update(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid role ID"})
+	}
+
+	var req UpdateRoleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	update := service.RoleUpdate{
+		Name:        req.Name,
+		Description: req.Description,
+		MFARequired: req.MFARequired,
+		RouteScoped: req.RouteScoped,
+	}
+
+	updated, err := h.roleService.Update(c.Context(), id, update, routeScope(c))
+	if err != nil {
+		return roleErrorResponse(c, err, "Failed to update role")
+	}
+
+	return c.JSON(updated)
+}
+
+// Delete видаляє роль
+//
+//	@Summary		Видалити роль
+//	@Description	Видаляє роль, якщо вона не призначена жодному користувачу
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int	true	"ID ролі"
+//	@Success		200	{object}	MessageResponse
+//	@Failure		400	{object}	ErrorResponse
+//	@Failure		403	{object}	ErrorResponse
+//	@Failure		404	{object}	ErrorResponse
+//	@Failure		409	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/roles/{id} [delete]
+func (h *RoleHandler) Delete(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid role ID"})
+	}
+
+	if err := h.roleService.Delete(c.Context(), id); err != nil {
+		return roleErrorResponse(c, err, "Failed to delete role")
+	}
+
+	return c.JSON(MessageResponse{Message: "Role deleted successfully"})
+}
+
+// SetPermissions призначає дозволи ролі
+//
+//	@Summary		Призначити дозволи ролі
+//	@Description	Замінює набір дозволів ролі. Допускаються лише дозволи з каталогу, які є у вас. Вбудовану роль admin змінити не можна
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			path		int						true	"ID ролі"
+//	@Param			permissions	body		RolePermissionsRequest	true	"Назви дозволів"
+//	@Success		200			{object}	model.Role
+//	@Failure		400			{object}	ErrorResponse
+//	@Failure		403			{object}	ErrorResponse
+//	@Failure		404			{object}	ErrorResponse
+//	@Failure		500			{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/roles/{id}/permissions [put]
+func (h *RoleHandler) SetPermissions(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid role ID"})
+	}
+
+	var req RolePermissionsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	role, err := h.roleService.SetPermissions(c.Context(), id, req.Permissions, localPermissions(c))
+	if err != nil {
+		return roleErrorResponse(c, err, "Failed to update role permissions")
+	}
+
+	return c.JSON(role)
+}
+
+// GetPermissions повертає каталог дозволів
+//
+//	@Summary		Каталог дозволів
+//	@Description	Повертає дозволи, які перевіряються маршрутами API. Лише їх можна призначати ролям
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{array}		model.Permission
+//	@Failure		500	{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/permissions [get]
+func (h *RoleHandler) GetPermissions(c *fiber.Ctx) error {
+	permissions, err := h.roleService.GetPermissions(c.Context())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(permissions)
+}
+
+// UpdateMFARequired змінює обов'язковість 2FA для ролі
+//
+//	@Summary		Обов'язкова 2FA для ролі
+//	@Description	Вмикає або вимикає обов'язкову двофакторну автентифікацію. Користувачі ролі без 2FA налаштують її під час наступного входу. Вбудовану роль admin змінити не можна
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int						true	"ID ролі"
+//	@Param			request	body		UpdateRoleMFARequest	true	"Налаштування 2FA"
+//	@Success		200		{object}	model.Role
+//	@Failure		400		{object}	ErrorResponse
+//	@Failure		403		{object}	ErrorResponse
+//	@Failure		404		{object}	ErrorResponse
+//	@Failure		500		{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/roles/{id}/mfa [put]
+func (h *RoleHandler) UpdateMFARequired(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid role ID"})
+	}
+
+	var req UpdateRoleMFARequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	role, err := h.roleService.SetMFARequired(c.Context(), id, req.MFARequired)
+	if err != nil {
+		return roleErrorResponse(c, err, "Failed to update role")
+	}
+
+	return c.JSON(role)
+}
+
+// roleErrorResponse повертає 403 для вбудованої ролі адміністратора та прав понад власні, 404 для відсутньої ролі,
+// 409 для зайнятої назви чи ролі з користувачами, 400 для некоректного запиту та 500 без подробиць для інших помилок
+func roleErrorResponse(c *fiber.Ctx, err error, message string) error {
+	switch {
+	case errors.Is(err, service.ErrBuiltInRole), errors.Is(err, service.ErrRoleExceedsGrantor):
+		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrRoleNotFound):
+		return c.Status(404).JSON(fiber.Map{"error": "Role not found"})
+	case errors.Is(err, service.ErrRoleConflict):
+		return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidRole):
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(500).JSON(fiber.Map{"error": message})
+}
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"busoptima/internal/service"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoleErrorResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "built-in admin role", err: service.ErrBuiltInRole, wantStatus: http.StatusForbidden},
+		{name: "permission beyond grantor", err: fmt.Errorf("%w: permission %q is not granted to you", service.ErrRoleExceedsGrantor, "users:write"), wantStatus: http.StatusForbidden},
+		{name: "missing role", err: service.ErrRoleNotFound, wantStatus: http.StatusNotFound},
+		{name: "role with users", err: fmt.Errorf("%w: role is assigned to 2 users", service.ErrRoleConflict), wantStatus: http.StatusConflict},
+		{name: "invalid role", err: fmt.Errorf("%w: role name is required", service.ErrInvalidRole), wantStatus: http.StatusBadRequest},
+		// Подробиці помилок БД не повертаються клієнту
+		{name: "database failure", err: errors.New("failed to get role: connection refused"), wantStatus: http.StatusInternalServerError, wantBody: `{"error":"Failed to update role"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Get("/", func(c *fiber.Ctx) error {
+				return roleErrorResponse(c, tt.err, "Failed to update role")
+			})
+
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil))
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			if tt.wantBody != "" {
+				body, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				assert.JSONEq(t, tt.wantBody, string(body))
+			}
+		})
+	}
+}
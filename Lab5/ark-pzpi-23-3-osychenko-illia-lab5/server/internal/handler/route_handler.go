@@ -3,6 +3,7 @@ package handler
 import (
 	"busoptima/internal/model"
 	"busoptima/internal/service"
+	"errors"
 	"strconv"
 
 	"github.com/gofiber/fiber/v2"
@@ -18,10 +19,21 @@ func NewRouteHandler(routeService service.RouteService) *RouteHandler {
 	return &RouteHandler{routeService: routeService}
 }
 
+// RouteAssignmentsRequest структура запиту призначення маршрутів користувачу
+type RouteAssignmentsRequest struct {
+	RouteIDs []int64 `json:"route_ids" example:"1,2"`
+}
+
+// RouteAssignmentsResponse маршрути, призначені користувачу
+type RouteAssignmentsResponse struct {
+	UserID   int64   `json:"user_id" example:"5"`
+	RouteIDs []int64 `json:"route_ids" example:"1,2"`
+}
+
 // GetAll повертає список маршрутів
 //
 //	@Summary		Отримати список маршрутів
-//	@Description	Повертає список всіх маршрутів з можливістю фільтрації
+//	@Description	Повертає список маршрутів з можливістю фільтрації. Користувачі ролі з обмеженням бачать лише призначені маршрути
 //	@Tags			Routes
 //	@Accept			json
 //	@Produce		json
@@ -33,7 +45,7 @@ func NewRouteHandler(routeService service.RouteService) *RouteHandler {
 func (h *RouteHandler) GetAll(c *fiber.Ctx) error {
 	activeOnly := c.QueryBool("active_only", true)
 
-	routes, err := h.routeService.GetAll(c.Context(), activeOnly)
+	routes, err := h.routeService.GetAll(c.Context(), routeScope(c), activeOnly)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -51,6 +63,7 @@ func (h *RouteHandler) GetAll(c *fiber.Ctx) error {
 //	@Param			id	path		int	true	"ID маршруту"
 //	@Success		200	{object}	model.Route
 //	@Failure 400 {object} ErrorResponse
+//	@Failure 403 {object} ErrorResponse
 //	@Failure 404 {object} ErrorResponse
 //	@Security		BearerAuth
 //	@Router			/routes/{id} [get]
@@ -60,7 +73,10 @@ func (h *RouteHandler) GetByID(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid route ID"})
 	}
 
-	route, err := h.routeService.GetByID(c.Context(), id)
+	route, err := h.routeService.GetByID(c.Context(), routeScope(c), id)
+	if errors.Is(err, service.ErrRouteOutOfScope) {
+		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+	}
 	if err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "Route not found"})
 	}
@@ -78,6 +94,7 @@ func (h *RouteHandler) GetByID(c *fiber.Ctx) error {
 //	@Param			route	body		model.Route	true	"Дані маршруту"
 //	@Success		201		{object}	model.Route
 //	@Failure 400 {object} ErrorResponse
+//	@Failure 403 {object} ErrorResponse
 //	@Failure 500 {object} ErrorResponse
 //	@Security		BearerAuth
 //	@Router			/routes [post]
@@ -89,7 +106,10 @@ func (h *RouteHandler) Create(c *fiber.Ctx) error {
 
 	route.IsActive = true
 
-	if err := h.routeService.Create(c.Context(), &route); err != nil {
+	if err := h.routeService.Create(c.Context(), routeScope(c), &route); err != nil {
+		if errors.Is(err, service.ErrRouteOutOfScope) {
+			return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+		}
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
@@ -107,6 +127,7 @@ func (h *RouteHandler) Create(c *fiber.Ctx) error {
 //	@Param			route	body		model.Route	true	"Оновлені дані маршруту"
 //	@Success		200		{object}	model.Route
 //	@Failure 400 {object} ErrorResponse
+//	@Failure 403 {object} ErrorResponse
 //	@Failure 500 {object} ErrorResponse
 //	@Security		BearerAuth
 //	@Router			/routes/{id} [put]
@@ -123,7 +144,10 @@ func (h *RouteHandler) Update(c *fiber.Ctx) error {
 
 	route.ID = id
 
-	if err := h.routeService.Update(c.Context(), &route); err != nil {
+	if err := h.routeService.Update(c.Context(), routeScope(c), &route); err != nil {
+		if errors.Is(err, service.ErrRouteOutOfScope) {
+			return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+		}
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
@@ -140,6 +164,7 @@ func (h *RouteHandler) Update(c *fiber.Ctx) error {
 //	@Param			id	path	int	true	"ID маршруту"
 //	@Success		204	"No Content"
 //	@Failure 400 {object} ErrorResponse
+//	@Failure 403 {object} ErrorResponse
 //	@Failure 500 {object} ErrorResponse
 //	@Security		BearerAuth
 //	@Router			/routes/{id} [delete]
@@ -149,9 +174,78 @@ func (h *RouteHandler) Delete(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid route ID"})
 	}
 
-	if err := h.routeService.Delete(c.Context(), id); err != nil {
+	if err := h.routeService.Delete(c.Context(), routeScope(c), id); err != nil {
+		if errors.Is(err, service.ErrRouteOutOfScope) {
+			return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+		}
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
 	return c.Status(204).Send(nil)
 }
+
+// GetUserRoutes повертає маршрути, призначені користувачу
+//
+//	@Summary		Отримати маршрути користувача
+//	@Description	Повертає маршрути, якими обмежено доступ користувача, якщо його роль має route_scoped
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			id	path		int	true	"ID користувача"
+//	@Success		200	{object}	RouteAssignmentsResponse
+//	@Failure		400	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/users/{id}/routes [get]
+func (h *RouteHandler) GetUserRoutes(c *fiber.Ctx) error {
+	userID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	routeIDs, err := h.routeService.GetAssignments(c.Context(), userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(RouteAssignmentsResponse{UserID: userID, RouteIDs: routeIDs})
+}
+
+// SetUserRoutes замінює маршрути, призначені користувачу
+//
+//	@Summary		Призначити маршрути користувачу
+//	@Description	Замінює набір маршрутів користувача. Зміни діють з наступного запиту без повторного входу
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int						true	"ID користувача"
+//	@Param			routes	body		RouteAssignmentsRequest	true	"ID маршрутів"
+//	@Success		200		{object}	RouteAssignmentsResponse
+//	@Failure		400		{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/admin/users/{id}/routes [put]
+func (h *RouteHandler) SetUserRoutes(c *fiber.Ctx) error {
+	userID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	var req RouteAssignmentsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	adminID, _ := c.Locals("user_id").(int64)
+
+	routeIDs, err := h.routeService.SetAssignments(c.Context(), userID, req.RouteIDs, adminID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(RouteAssignmentsResponse{UserID: userID, RouteIDs: routeIDs})
+}
+
+// routeScope повертає обмеження маршрутами поточного користувача (nil - без обмежень)
+func routeScope(c *fiber.Ctx) *service.RouteScope {
+	scope, _ := c.Locals("route_scope").(*service.RouteScope)
+	return scope
+}
@@ -2,7 +2,9 @@ package handler
 
 import (
 	"busoptima/internal/model"
+	"busoptima/internal/repository"
 	"busoptima/internal/service"
+	"errors"
 	"strconv"
 	"time"
 
@@ -20,7 +22,7 @@ func NewTripHandler(tripService service.TripService) *TripHandler {
 // GetAll повертає список рейсів з фільтрами
 //
 //	@Summary		Отримати список рейсів
-//	@Description	Повертає список всіх рейсів з можливістю фільтрації
+//	@Description	Повертає список рейсів з можливістю фільтрації. Користувачі ролі з обмеженням бачать лише рейси призначених маршрутів
 //	@Tags			Trips
 //	@Accept			json
 //	@Produce		json
@@ -51,7 +53,7 @@ func (h *TripHandler) GetAll(c *fiber.Ctx) error {
 		filters["date_to"] = dateTo
 	}
 
-	trips, err := h.tripService.GetAll(c.Context(), filters)
+	trips, err := h.tripService.GetAll(c.Context(), routeScope(c), filters)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -69,6 +71,7 @@ func (h *TripHandler) GetAll(c *fiber.Ctx) error {
 //	@Param			id	path		int	true	"ID рейсу"
 //	@Success		200	{object}	model.Trip
 //	@Failure 400 {object} ErrorResponse
+//	@Failure 403 {object} ErrorResponse
 //	@Failure 404 {object} ErrorResponse
 //	@Security		BearerAuth
 //	@Router			/trips/{id} [get]
@@ -78,7 +81,10 @@ func (h *TripHandler) GetByID(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid trip ID"})
 	}
 
-	trip, err := h.tripService.GetByID(c.Context(), id)
+	trip, err := h.tripService.GetByID(c.Context(), routeScope(c), id)
+	if errors.Is(err, service.ErrRouteOutOfScope) {
+		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+	}
 	if err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "Trip not found"})
 	}
@@ -104,6 +110,7 @@ type CreateTripRequest struct {
 //	@Param			trip	body		CreateTripRequest	true	"Дані рейсу"
 //	@Success		201		{object}	model.Trip
 //	@Failure 400 {object} ErrorResponse
+//	@Failure 403 {object} ErrorResponse
 //	@Failure 500 {object} ErrorResponse
 //	@Security		BearerAuth
 //	@Router			/trips [post]
@@ -122,7 +129,10 @@ func (h *TripHandler) Create(c *fiber.Ctx) error {
 		CurrentPassengers:  0,
 	}
 
-	if err := h.tripService.Create(c.Context(), trip); err != nil {
+	if err := h.tripService.Create(c.Context(), routeScope(c), trip); err != nil {
+		if errors.Is(err, service.ErrRouteOutOfScope) {
+			return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+		}
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
@@ -152,6 +162,7 @@ type UpdateTripRequest struct {
 //	@Param			trip	body		UpdateTripRequest	true	"Оновлені дані рейсу"
 //	@Success		200		{object}	model.Trip
 //	@Failure 400 {object} ErrorResponse
+//	@Failure 403 {object} ErrorResponse
 //	@Failure 500 {object} ErrorResponse
 //	@Security		BearerAuth
 //	@Router			/trips/{id} [put]
@@ -167,7 +178,10 @@ func (h *TripHandler) Update(c *fiber.Ctx) error {
 	}
 
 	// Get existing trip first
-	existingTrip, err := h.tripService.GetByID(c.Context(), id)
+	existingTrip, err := h.tripService.GetByID(c.Context(), routeScope(c), id)
+	if errors.Is(err, service.ErrRouteOutOfScope) {
+		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+	}
 	if err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "Trip not found"})
 	}
@@ -198,7 +212,10 @@ func (h *TripHandler) Update(c *fiber.Ctx) error {
 		existingTrip.DriverName = *req.DriverName
 	}
 
-	if err := h.tripService.Update(c.Context(), existingTrip); err != nil {
+	if err := h.tripService.Update(c.Context(), routeScope(c), existingTrip); err != nil {
+		if errors.Is(err, service.ErrRouteOutOfScope) {
+			return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+		}
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
@@ -215,6 +232,7 @@ func (h *TripHandler) Update(c *fiber.Ctx) error {
 //	@Param			id	path		int	true	"ID рейсу"
 //	@Success		200	{array}		model.PassengerEvent
 //	@Failure 400 {object} ErrorResponse
+//	@Failure 403 {object} ErrorResponse
 //	@Failure 500 {object} ErrorResponse
 //	@Security		BearerAuth
 //	@Router			/trips/{id}/events [get]
@@ -224,7 +242,40 @@ func (h *TripHandler) GetEvents(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid trip ID"})
 	}
 
-	events, err := h.tripService.GetEvents(c.Context(), id)
+	events, err := h.tripService.GetEvents(c.Context(), routeScope(c), id)
+	if errors.Is(err, service.ErrRouteOutOfScope) {
+		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(events)
+}
+
+// GetQuarantine повертає події рейсу, відкладені для перевірки
+//
+//	@Summary		Отримати відкладені події рейсу
+//	@Description	Повертає події пристрою, які не враховано в кількості пасажирів: після них кількість стала б від'ємною (count_below_zero) або перевищила б місткість автобуса (over_capacity)
+//	@Tags			Trips
+//	@Produce		json
+//	@Param			id	path		int	true	"ID рейсу"
+//	@Success		200	{array}		model.QuarantinedEvent
+//	@Failure		400	{object}	ErrorResponse
+//	@Failure		403	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/trips/{id}/quarantine [get]
+func (h *TripHandler) GetQuarantine(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid trip ID"})
+	}
+
+	events, err := h.tripService.GetQuarantinedEvents(c.Context(), routeScope(c), id)
+	if errors.Is(err, service.ErrRouteOutOfScope) {
+		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+	}
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -232,6 +283,126 @@ func (h *TripHandler) GetEvents(c *fiber.Ctx) error {
 	return c.JSON(events)
 }
 
+// GetPriceRecommendations повертає рекомендації цін від пристроїв для рейсу
+//
+//	@Summary		Отримати рекомендації цін рейсу
+//	@Description	Повертає рекомендації цін від IoT-пристроїв разом з ціною, перерахованою сервером. Рекомендації, що розходяться з розрахунком сервера, мають is_flagged та divergence_reason: base_price_mismatch, occupancy_mismatch або price_mismatch
+//	@Tags			Trips
+//	@Produce		json
+//	@Param			id		path		int		true	"ID рейсу"
+//	@Param			flagged	query		bool	false	"Лише позначені рекомендації"
+//	@Success		200		{array}		model.PriceRecommendation
+//	@Failure		400		{object}	ErrorResponse
+//	@Failure		403		{object}	ErrorResponse
+//	@Failure		500		{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/trips/{id}/price-recommendations [get]
+func (h *TripHandler) GetPriceRecommendations(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid trip ID"})
+	}
+
+	recommendations, err := h.tripService.GetPriceRecommendations(c.Context(), routeScope(c), id, c.QueryBool("flagged"))
+	if errors.Is(err, service.ErrRouteOutOfScope) {
+		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(recommendations)
+}
+
+// ReviewQuarantineRequest структура запиту перегляду відкладеної події
+type ReviewQuarantineRequest struct {
+	Note string `json:"note" example:"Датчик дверей спрацював двічі"`
+}
+
+// ReviewQuarantine позначає відкладену подію переглянутою
+//
+//	@Summary		Позначити відкладену подію переглянутою
+//	@Description	Фіксує, хто і коли переглянув подію, з необов'язковою приміткою. Кількість пасажирів рейсу не змінюється
+//	@Tags			Trips
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int							true	"ID рейсу"
+//	@Param			eventId	path		int							true	"ID відкладеної події"
+//	@Param			request	body		ReviewQuarantineRequest	false	"Примітка"
+//	@Success		200		{object}	MessageResponse
+//	@Failure		400		{object}	ErrorResponse
+//	@Failure		403		{object}	ErrorResponse
+//	@Failure		404		{object}	ErrorResponse
+//	@Failure		500		{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/trips/{id}/quarantine/{eventId}/review [post]
+func (h *TripHandler) ReviewQuarantine(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid trip ID"})
+	}
+
+	eventID, err := strconv.ParseInt(c.Params("eventId"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid event ID"})
+	}
+
+	var req ReviewQuarantineRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+	}
+
+	reviewerID, _ := c.Locals("user_id").(int64)
+	err = h.tripService.ReviewQuarantinedEvent(c.Context(), routeScope(c), id, eventID, reviewerID, req.Note)
+	if errors.Is(err, service.ErrRouteOutOfScope) {
+		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+	}
+	if errors.Is(err, service.ErrTripNotFound) || errors.Is(err, repository.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to review event"})
+	}
+
+	return c.JSON(MessageResponse{Message: "Event marked as reviewed"})
+}
+
+// RecomputeOccupancy перераховує кількість пасажирів рейсу
+//
+//	@Summary		Перерахувати кількість пасажирів рейсу
+//	@Description	Повторно звіряє неопрацьовані події карантину і переносить можливі до подій рейсу, потім перераховує passenger_count_after усіх подій рейсу в порядку часу та оновлює current_passengers. Виходи, на яких кількість залишено нульовою, повертаються в clamped_event_ids
+//	@Tags			Trips
+//	@Produce		json
+//	@Param			id	path		int	true	"ID рейсу"
+//	@Success		200	{object}	model.OccupancyRecompute
+//	@Failure		400	{object}	ErrorResponse
+//	@Failure		403	{object}	ErrorResponse
+//	@Failure		404	{object}	ErrorResponse
+//	@Failure		500	{object}	ErrorResponse
+//	@Security		BearerAuth
+//	@Router			/trips/{id}/occupancy/recompute [post]
+func (h *TripHandler) RecomputeOccupancy(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid trip ID"})
+	}
+
+	result, err := h.tripService.RecomputeOccupancy(c.Context(), routeScope(c), id)
+	if errors.Is(err, service.ErrRouteOutOfScope) {
+		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+	}
+	if errors.Is(err, service.ErrTripNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "Trip not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(result)
+}
+
 // GetAnalytics повертає аналітику рейсу
 //
 //	@Summary		Отримати аналітику рейсу
@@ -242,6 +413,7 @@ func (h *TripHandler) GetEvents(c *fiber.Ctx) error {
 //	@Param			id	path		int	true	"ID рейсу"
 //	@Success		200	{object}	model.TripAnalytics
 //	@Failure 400 {object} ErrorResponse
+//	@Failure 403 {object} ErrorResponse
 //	@Failure 500 {object} ErrorResponse
 //	@Security		BearerAuth
 //	@Router			/trips/{id}/analytics [get]
@@ -251,7 +423,10 @@ func (h *TripHandler) GetAnalytics(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid trip ID"})
 	}
 
-	analytics, err := h.tripService.GetAnalytics(c.Context(), id)
+	analytics, err := h.tripService.GetAnalytics(c.Context(), routeScope(c), id)
+	if errors.Is(err, service.ErrRouteOutOfScope) {
+		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+	}
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
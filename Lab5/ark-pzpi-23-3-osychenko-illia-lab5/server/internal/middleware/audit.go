@@ -63,6 +63,7 @@ func AuditLog(auditService service.AuditService, repos *repository.Repositories)
 					}
 				}
 				// For DELETE: old values fetched above, new values remain empty
+				redactSensitiveValues(newValues)
 
 				// Now start goroutine with captured data
 				go func() {
@@ -78,6 +79,16 @@ func AuditLog(auditService service.AuditService, repos *repository.Repositories)
 	}
 }
 
+// redactSensitiveValues приховує паролі, токени, секрети та коди 2FA перед записом у журнал аудиту
+func redactSensitiveValues(values map[string]any) {
+	for key := range values {
+		lower := strings.ToLower(key)
+		if strings.Contains(lower, "password") || strings.Contains(lower, "token") || strings.Contains(lower, "secret") || lower == "code" {
+			values[key] = "[REDACTED]"
+		}
+	}
+}
+
 // shouldAudit визначає, чи потрібно логувати цю дію
 func shouldAudit(method, path string) bool {
 	// Тільки модифікуючі операції
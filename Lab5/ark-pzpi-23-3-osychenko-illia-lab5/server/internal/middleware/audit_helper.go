@@ -48,15 +48,29 @@ func (h *AuditHelper) LogDeviceAction(c *fiber.Ctx, action, entityType, entityID
 	newValues["device_id"] = deviceID
 	newValues["device_serial"] = serialNumber
 
-	// Використовуємо негативний ID для пристроїв (щоб відрізнити від користувачів)
-	// або можна створити окрему таблицю для device audit logs
 	go func() {
-		if err := h.auditService.LogAction(context.Background(), -deviceID, action, entityType, entityID, make(map[string]any), newValues, ipAddress); err != nil {
+		if err := h.auditService.LogDeviceAction(context.Background(), deviceID, action, entityType, entityID, newValues, ipAddress); err != nil {
 			_ = err
 		}
 	}()
 }
 
+// LogAccessDenied logs a rejected access attempt from either a device or a user
+func (h *AuditHelper) LogAccessDenied(c *fiber.Ctx, entityType, entityID, reason string) {
+	details := map[string]any{
+		"reason": reason,
+		"method": c.Method(),
+		"path":   c.Path(),
+	}
+
+	if _, ok := c.Locals("device_id").(int64); ok {
+		h.LogDeviceAction(c, "ACCESS_DENIED", entityType, entityID, details)
+		return
+	}
+
+	h.logAction(c, "ACCESS_DENIED", entityType, entityID, make(map[string]any), details)
+}
+
 // logAction is the internal method that performs the actual logging
 func (h *AuditHelper) logAction(c *fiber.Ctx, action, entityType, entityID string, oldValues, newValues map[string]any) {
 	userID, ok := c.Locals("user_id").(int64)
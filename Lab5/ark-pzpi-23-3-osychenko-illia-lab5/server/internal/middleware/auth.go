@@ -1,17 +1,28 @@
 package middleware
 
 import (
+	"busoptima/internal/service"
+	"errors"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// JWTAuth middleware для перевірки JWT токенів
-func JWTAuth(secret string) fiber.Handler {
+// APIKeyHeader заголовок, в якому інтеграції передають API ключ
+const APIKeyHeader = "X-API-Key"
+
+// JWTAuth middleware для перевірки JWT токенів та списку відкликаних токенів.
+// Дозволи користувача не беруться з токена, а визначаються для кожного запиту за його поточною роллю.
+// Інтеграції замість JWT можуть передати API ключ у заголовку X-API-Key
+func JWTAuth(keys service.KeyService, revocations service.TokenRevocationService, apiKeys service.APIKeyService, permissions service.PermissionService) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		authHeader := c.Get("Authorization")
 		if authHeader == "" {
+			if apiKey := c.Get(APIKeyHeader); apiKey != "" {
+				return authenticateAPIKey(c, apiKeys, apiKey)
+			}
 			return c.Status(401).JSON(fiber.Map{
 				"error": "Missing authorization header",
 			})
@@ -24,12 +35,9 @@ func JWTAuth(secret string) fiber.Handler {
 			})
 		}
 
-		token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fiber.NewError(401, "Invalid signing method")
-			}
-			return []byte(secret), nil
-		})
+		// Ключ перевірки обирається за kid, алгоритм обмежений асиметричними методами.
+		// Токени без exp не приймаються, як і у VerifyDeviceToken: інакше токен пристрою діяв би безстроково
+		token, err := jwt.Parse(tokenString, keys.Keyfunc, jwt.WithValidMethods(keys.ValidMethods()), jwt.WithExpirationRequired())
 
 		if err != nil || !token.Valid {
 			return c.Status(401).JSON(fiber.Map{
@@ -44,9 +52,21 @@ func JWTAuth(secret string) fiber.Handler {
 			})
 		}
 
-		// Перевіряємо тип токена
+		jti, _ := claims["jti"].(string)
+		var issuedAt time.Time
+		if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+			issuedAt = iat.Time
+		}
+
+		// Перевіряємо тип токена. Challenge токени 2FA та інші службові токени не дають доступу до API
 		tokenType, hasType := claims["type"].(string)
-		if hasType && tokenType == "device" {
+		if hasType && tokenType != "device" {
+			return c.Status(401).JSON(fiber.Map{
+				"error": "Invalid token type",
+			})
+		}
+
+		if tokenType == "device" {
 			// Це токен пристрою
 			deviceID, ok := claims["device_id"].(float64)
 			if !ok {
@@ -61,6 +81,12 @@ func JWTAuth(secret string) fiber.Handler {
 				})
 			}
 
+			if revocations.IsDeviceRevoked(jti, int64(deviceID), issuedAt) {
+				return c.Status(401).JSON(fiber.Map{
+					"error": "Token has been revoked",
+				})
+			}
+
 			c.Locals("device_id", int64(deviceID))
 			c.Locals("serial_number", serialNumber)
 			c.Locals("token_type", "device")
@@ -72,16 +98,38 @@ func JWTAuth(secret string) fiber.Handler {
 					"error": "Invalid user token claims",
 				})
 			}
-			role, ok := claims["role"].(string)
-			if !ok {
+
+			// Токени без jti неможливо відкликати, тому не приймаємо їх
+			if jti == "" || revocations.IsRevoked(jti, int64(userID), issuedAt) {
 				return c.Status(401).JSON(fiber.Map{
-					"error": "Invalid user token claims",
+					"error": "Token has been revoked",
+				})
+			}
+
+			access, err := permissions.Resolve(c.Context(), int64(userID))
+			if errors.Is(err, service.ErrUserNotFound) {
+				return c.Status(401).JSON(fiber.Map{
+					"error": "User not found",
+				})
+			}
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{
+					"error": "Failed to resolve user permissions",
+				})
+			}
+
+			// Деактивація діє одразу, навіть якщо токен ще не потрапив до відкликаних
+			if !access.Active {
+				return c.Status(401).JSON(fiber.Map{
+					"error": "Account is deactivated",
 				})
 			}
 
+			c.Locals("jti", jti)
 			c.Locals("user_id", int64(userID))
-			c.Locals("role", role)
-			c.Locals("permissions", claims["permissions"])
+			c.Locals("role", access.Role)
+			c.Locals("permissions", access.Permissions)
+			c.Locals("route_scope", access.Routes)
 			c.Locals("token_type", "user")
 		}
 
@@ -89,10 +137,28 @@ func JWTAuth(secret string) fiber.Handler {
 	}
 }
 
-// RequirePermission middleware для перевірки дозволів
+// authenticateAPIKey перевіряє API ключ. Ключ не пов'язаний з користувачем і має лише явно видані йому дозволи
+func authenticateAPIKey(c *fiber.Ctx, apiKeys service.APIKeyService, rawKey string) error {
+	key, err := apiKeys.Authenticate(c.Context(), rawKey, c.IP())
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Invalid API key",
+		})
+	}
+
+	c.Locals("api_key_id", key.ID)
+	c.Locals("permissions", key.Permissions)
+	c.Locals("token_type", "api_key")
+
+	return c.Next()
+}
+
+// RequirePermission middleware для перевірки дозволів (з JWT користувача або API ключа)
 func RequirePermission(permission string) fiber.Handler {
+	registerPermission(permission)
+
 	return func(c *fiber.Ctx) error {
-		permissions, ok := c.Locals("permissions").([]interface{})
+		permissions, ok := c.Locals("permissions").([]string)
 		if !ok {
 			return c.Status(403).JSON(fiber.Map{
 				"error":               "Access denied",
@@ -102,7 +168,7 @@ func RequirePermission(permission string) fiber.Handler {
 
 		// Перевіряємо наявність необхідного дозволу
 		for _, p := range permissions {
-			if p.(string) == permission {
+			if p == permission {
 				return c.Next()
 			}
 		}
@@ -113,3 +179,19 @@ func RequirePermission(permission string) fiber.Handler {
 		})
 	}
 }
+
+// RequireDevice middleware дозволяє доступ лише з токенами IoT-пристроїв
+func RequireDevice(auditHelper *AuditHelper) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if tokenType, _ := c.Locals("token_type").(string); tokenType != "device" {
+			if auditHelper != nil {
+				auditHelper.LogAccessDenied(c, "iot", "", "device token required")
+			}
+			return c.Status(403).JSON(fiber.Map{
+				"error": "Device token required",
+			})
+		}
+
+		return c.Next()
+	}
+}
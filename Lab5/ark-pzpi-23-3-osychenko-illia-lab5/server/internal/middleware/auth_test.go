@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"busoptima/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// noRevocations вважає всі токени чинними
+type noRevocations struct {
+	service.TokenRevocationService
+}
+
+func (noRevocations) IsDeviceRevoked(jti string, deviceID int64, issuedAt time.Time) bool {
+	return false
+}
+
+func TestJWTAuthRequiresDeviceTokenExpiry(t *testing.T) {
+	keys, err := service.NewKeyService("", true)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		exp        interface{}
+		wantStatus int
+	}{
+		{name: "token with expiry", exp: time.Now().Add(time.Hour).Unix(), wantStatus: http.StatusOK},
+		{name: "expired token", exp: time.Now().Add(-time.Minute).Unix(), wantStatus: http.StatusUnauthorized},
+		{name: "token without expiry", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := jwt.MapClaims{
+				"jti":           "device-jti",
+				"device_id":     7,
+				"serial_number": "BO-0007",
+				"type":          "device",
+				"iat":           jwt.NewNumericDate(time.Now()),
+			}
+			if tt.exp != nil {
+				claims["exp"] = tt.exp
+			}
+			token, err := keys.Sign(claims)
+			require.NoError(t, err)
+
+			app := fiber.New()
+			app.Get("/", JWTAuth(keys, noRevocations{}, nil, nil), func(c *fiber.Ctx) error {
+				return c.SendStatus(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"sort"
+	"sync"
+)
+
+// permissionRegistry назви дозволів, що перевіряються в маршрутах через RequirePermission.
+// Це і є каталог дозволів: роль не може посилатись на дозвіл, який ніде не перевіряється
+var permissionRegistry = struct {
+	sync.Mutex
+	names map[string]struct{}
+}{names: make(map[string]struct{})}
+
+// registerPermission додає дозвіл до каталогу
+func registerPermission(name string) {
+	permissionRegistry.Lock()
+	defer permissionRegistry.Unlock()
+	permissionRegistry.names[name] = struct{}{}
+}
+
+// RegisteredPermissions повертає відсортований каталог дозволів, зібраний під час налаштування маршрутів
+func RegisteredPermissions() []string {
+	permissionRegistry.Lock()
+	defer permissionRegistry.Unlock()
+
+	names := make([]string, 0, len(permissionRegistry.names))
+	for name := range permissionRegistry.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
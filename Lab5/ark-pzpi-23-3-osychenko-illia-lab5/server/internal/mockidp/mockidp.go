@@ -0,0 +1,315 @@
+// Package mockidp мок-провайдер OpenID Connect для розробки та тестів входу через OIDC.
+//
+// Сторінка входу не показується: /authorize одразу перенаправляє на redirect_uri з кодом авторизації
+// для користувача за замовчуванням або заданого параметрами запиту email, name, sub та groups.
+// Ключ підпису генерується для кожного екземпляра. Провайдер запускається як окремий сервер
+// (cmd/mockidp) або в тестах через NewServer.
+package mockidp
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// codeTTL час дії коду авторизації
+	codeTTL = time.Minute
+	// idTokenTTL час дії ID токена
+	idTokenTTL = 5 * time.Minute
+	// keyID ідентифікатор ключа підпису в JWKS
+	keyID = "mockidp"
+)
+
+// User користувач, від імені якого видається ID токен
+type User struct {
+	Subject string
+	Email   string
+	Name    string
+	Groups  []string
+}
+
+// authorizationCode виданий код авторизації
+type authorizationCode struct {
+	ClientID      string
+	RedirectURI   string
+	CodeChallenge string
+	Nonce         string
+	User          User
+	ExpiresAt     time.Time
+}
+
+// Provider стан мок-провайдера
+type Provider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	defaultUser  User
+	key          *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]*authorizationCode
+}
+
+// New створює мок-провайдер з ідентифікатором issuer та новим ключем підпису
+func New(issuer, clientID, clientSecret string, defaultUser User) (*Provider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Provider{
+		issuer:       strings.TrimRight(issuer, "/"),
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		defaultUser:  defaultUser,
+		key:          key,
+		codes:        make(map[string]*authorizationCode),
+	}, nil
+}
+
+// NewServer запускає мок-провайдер на випадковому локальному порту. Issuer дорівнює адресі сервера.
+// Сервер потрібно зупинити через Close
+func NewServer(clientID, clientSecret string, defaultUser User) (*httptest.Server, error) {
+	server := httptest.NewUnstartedServer(nil)
+
+	p, err := New("http://"+server.Listener.Addr().String(), clientID, clientSecret, defaultUser)
+	if err != nil {
+		server.Listener.Close()
+		return nil, err
+	}
+
+	server.Config.Handler = p.Handler()
+	server.Start()
+	return server, nil
+}
+
+// Issuer повертає ідентифікатор провайдера
+func (p *Provider) Issuer() string {
+	return p.issuer
+}
+
+// Handler повертає HTTP обробник ендпоінтів провайдера
+func (p *Provider) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	mux.HandleFunc("/jwks", p.jwks)
+	return mux
+}
+
+// discovery повертає метадані провайдера
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                p.issuer,
+		"authorization_endpoint":                p.issuer + "/authorize",
+		"token_endpoint":                        p.issuer + "/token",
+		"jwks_uri":                              p.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post"},
+	})
+}
+
+// authorize одразу видає код авторизації та перенаправляє на redirect_uri
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	redirectURI := query.Get("redirect_uri")
+	if query.Get("client_id") != p.clientID || redirectURI == "" {
+		http.Error(w, "unknown client_id or missing redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if query.Get("response_type") != "code" {
+		http.Error(w, "only response_type=code is supported", http.StatusBadRequest)
+		return
+	}
+	if query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256" {
+		http.Error(w, "PKCE with code_challenge_method=S256 is required", http.StatusBadRequest)
+		return
+	}
+
+	user := p.defaultUser
+	if value := query.Get("sub"); value != "" {
+		user.Subject = value
+	}
+	if value := query.Get("email"); value != "" {
+		user.Email = value
+	}
+	if value := query.Get("name"); value != "" {
+		user.Name = value
+	}
+	if query.Has("groups") {
+		user.Groups = SplitGroups(query.Get("groups"))
+	}
+
+	code := randomString()
+	p.mu.Lock()
+	p.codes[code] = &authorizationCode{
+		ClientID:      p.clientID,
+		RedirectURI:   redirectURI,
+		CodeChallenge: query.Get("code_challenge"),
+		Nonce:         query.Get("nonce"),
+		User:          user,
+		ExpiresAt:     time.Now().Add(codeTTL),
+	}
+	p.mu.Unlock()
+
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	params := target.Query()
+	params.Set("code", code)
+	params.Set("state", query.Get("state"))
+	target.RawQuery = params.Encode()
+
+	log.Printf("Issued authorization code for %s (%s)", user.Email, user.Subject)
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// token обмінює код авторизації на ID токен
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		tokenError(w, http.StatusMethodNotAllowed, "invalid_request", "POST is required")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, http.StatusBadRequest, "invalid_request", "invalid form body")
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != p.clientID || clientSecret != p.clientSecret {
+		tokenError(w, http.StatusUnauthorized, "invalid_client", "invalid client credentials")
+		return
+	}
+
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, http.StatusBadRequest, "unsupported_grant_type", "only authorization_code is supported")
+		return
+	}
+
+	// Код одноразовий
+	p.mu.Lock()
+	code, found := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	if !found || time.Now().After(code.ExpiresAt) || code.ClientID != clientID {
+		tokenError(w, http.StatusBadRequest, "invalid_grant", "unknown or expired code")
+		return
+	}
+	if r.PostForm.Get("redirect_uri") != code.RedirectURI {
+		tokenError(w, http.StatusBadRequest, "invalid_grant", "redirect_uri mismatch")
+		return
+	}
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != code.CodeChallenge {
+		tokenError(w, http.StatusBadRequest, "invalid_grant", "code_verifier does not match code_challenge")
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            p.issuer,
+		"sub":            code.User.Subject,
+		"aud":            clientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(idTokenTTL).Unix(),
+		"email":          code.User.Email,
+		"email_verified": true,
+		"name":           code.User.Name,
+		"groups":         code.User.Groups,
+	}
+	if code.Nonce != "" {
+		claims["nonce"] = code.Nonce
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = keyID
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		tokenError(w, http.StatusInternalServerError, "server_error", "failed to sign id_token")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   int(idTokenTTL.Seconds()),
+		"id_token":     idToken,
+	})
+}
+
+// jwks повертає публічний ключ підпису
+func (p *Provider) jwks(w http.ResponseWriter, r *http.Request) {
+	publicKey := p.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+		}},
+	})
+}
+
+// tokenError повертає помилку у форматі RFC 6749
+func tokenError(w http.ResponseWriter, status int, code, description string) {
+	writeJSON(w, status, map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func randomString() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// SplitGroups розбирає список груп, розділених комами
+func SplitGroups(value string) []string {
+	groups := []string{}
+	for _, group := range strings.Split(value, ",") {
+		if group = strings.TrimSpace(group); group != "" {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
@@ -6,15 +6,18 @@ import (
 
 // User представляє користувача системи
 type User struct {
-	ID           int64     `json:"id" db:"id" example:"1"`
-	Email        string    `json:"email" db:"email" example:"user@example.com"`
-	PasswordHash string    `json:"-" db:"password_hash"`
-	FullName     string    `json:"full_name" db:"full_name" example:"Іван Іванов"`
-	RoleID       int64     `json:"role_id" db:"role_id" example:"2"`
-	Role         *Role     `json:"role,omitempty"`
-	IsActive     bool      `json:"is_active" db:"is_active" example:"true"`
-	CreatedAt    time.Time `json:"created_at" db:"created_at" example:"2023-01-01T00:00:00Z"`
-	UpdatedAt    time.Time `json:"updated_at" db:"updated_at" example:"2023-01-01T00:00:00Z"`
+	ID                int64      `json:"id" db:"id" example:"1"`
+	Email             string     `json:"email" db:"email" example:"user@example.com"`
+	PasswordHash      string     `json:"-" db:"password_hash"`
+	FullName          string     `json:"full_name" db:"full_name" example:"Іван Іванов"`
+	RoleID            int64      `json:"role_id" db:"role_id" example:"2"`
+	Role              *Role      `json:"role,omitempty"`
+	IsActive          bool       `json:"is_active" db:"is_active" example:"true"`
+	CreatedAt         time.Time  `json:"created_at" db:"created_at" example:"2023-01-01T00:00:00Z"`
+	UpdatedAt         time.Time  `json:"updated_at" db:"updated_at" example:"2023-01-01T00:00:00Z"`
+	FailedLoginCount  int        `json:"failed_login_count" db:"failed_login_count" example:"0"`
+	LastFailedLoginAt *time.Time `json:"last_failed_login_at,omitempty" db:"last_failed_login_at"`
+	LockedUntil       *time.Time `json:"locked_until,omitempty" db:"locked_until"`
 }
 
 // Role представляє роль користувача
@@ -22,6 +25,8 @@ type Role struct {
 	ID          int64        `json:"id" db:"id"`
 	Name        string       `json:"name" db:"name"`
 	Description string       `json:"description" db:"description"`
+	MFARequired bool         `json:"mfa_required" db:"mfa_required"`
+	RouteScoped bool         `json:"route_scoped" db:"route_scoped"`
 	Permissions []Permission `json:"permissions,omitempty"`
 }
 
@@ -32,6 +37,133 @@ type Permission struct {
 	Description string `json:"description" db:"description"`
 }
 
+// RefreshToken представляє збережений refresh токен сесії користувача
+type RefreshToken struct {
+	ID           int64      `json:"id" db:"id"`
+	UserID       int64      `json:"user_id" db:"user_id"`
+	TokenHash    string     `json:"-" db:"token_hash"`
+	FamilyID     string     `json:"family_id" db:"family_id"`
+	ExpiresAt    time.Time  `json:"expires_at" db:"expires_at"`
+	UsedAt       *time.Time `json:"used_at" db:"used_at"`
+	RevokedAt    *time.Time `json:"revoked_at" db:"revoked_at"`
+	RevokeReason *string    `json:"revoke_reason" db:"revoke_reason"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+}
+
+// Session сесія користувача - ланцюжок refresh токенів, що ротуються, від одного входу
+type Session struct {
+	ID              string    `json:"id" db:"family_id" example:"9f3c1a..."`
+	StartedAt       time.Time `json:"started_at" db:"started_at"`
+	LastRefreshedAt time.Time `json:"last_refreshed_at" db:"last_refreshed_at"`
+	ExpiresAt       time.Time `json:"expires_at" db:"expires_at"`
+}
+
+// UserIdentity обліковий запис користувача у провайдері OIDC
+type UserIdentity struct {
+	Issuer      string     `json:"issuer" db:"issuer"`
+	Subject     string     `json:"subject" db:"subject"`
+	UserID      int64      `json:"user_id" db:"user_id"`
+	Email       *string    `json:"email,omitempty" db:"email"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty" db:"last_login_at"`
+}
+
+// OIDCLoginState незавершений вхід через OIDC
+type OIDCLoginState struct {
+	ID            int64     `db:"id"`
+	StateHash     string    `db:"state_hash"`
+	Nonce         string    `db:"nonce"`
+	CodeChallenge string    `db:"code_challenge"`
+	LinkUserID    *int64    `db:"link_user_id"`
+	ExpiresAt     time.Time `db:"expires_at"`
+	CreatedAt     time.Time `db:"created_at"`
+}
+
+// LoginAttempt представляє спробу входу користувача
+type LoginAttempt struct {
+	ID        int64     `json:"id" db:"id"`
+	Email     string    `json:"email" db:"email"`
+	UserID    *int64    `json:"user_id" db:"user_id"`
+	IPAddress string    `json:"ip_address" db:"ip_address"`
+	Success   bool      `json:"success" db:"success"`
+	Reason    *string   `json:"reason" db:"reason"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// PasswordResetToken представляє одноразовий токен відновлення пароля
+type PasswordResetToken struct {
+	ID          int64      `json:"id" db:"id"`
+	UserID      int64      `json:"user_id" db:"user_id"`
+	TokenHash   string     `json:"-" db:"token_hash"`
+	ExpiresAt   time.Time  `json:"expires_at" db:"expires_at"`
+	UsedAt      *time.Time `json:"used_at" db:"used_at"`
+	RequestedIP *string    `json:"requested_ip" db:"requested_ip"`
+	EmailID     *int64     `json:"email_id" db:"email_id"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+}
+
+// OutboxEmail представляє лист у черзі відправлення
+type OutboxEmail struct {
+	ID            int64      `json:"id" db:"id"`
+	Recipient     string     `json:"recipient" db:"recipient"`
+	Subject       string     `json:"subject" db:"subject"`
+	Body          string     `json:"body" db:"body"`
+	Sensitive     bool       `json:"sensitive" db:"sensitive"`
+	Status        string     `json:"status" db:"status" enums:"pending,sent,failed"`
+	Attempts      int        `json:"attempts" db:"attempts"`
+	LastError     *string    `json:"last_error" db:"last_error"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" db:"next_attempt_at"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	SentAt        *time.Time `json:"sent_at" db:"sent_at"`
+}
+
+// UserTOTP представляє TOTP секрет користувача для двофакторної автентифікації
+type UserTOTP struct {
+	UserID       int64      `json:"user_id" db:"user_id"`
+	Secret       string     `json:"-" db:"secret"`
+	ConfirmedAt  *time.Time `json:"confirmed_at" db:"confirmed_at"`
+	LastUsedStep *int64     `json:"-" db:"last_used_step"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+}
+
+// APIKey представляє довгостроковий ключ доступу для інтеграцій
+type APIKey struct {
+	ID          int64      `json:"id" db:"id"`
+	Name        string     `json:"name" db:"name"`
+	KeyPrefix   string     `json:"key_prefix" db:"key_prefix"`
+	KeyHash     string     `json:"-" db:"key_hash"`
+	Permissions []string   `json:"permissions"`
+	CreatedBy   *int64     `json:"created_by" db:"created_by"`
+	ExpiresAt   *time.Time `json:"expires_at" db:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at" db:"last_used_at"`
+	LastUsedIP  *string    `json:"last_used_ip" db:"last_used_ip"`
+	RevokedAt   *time.Time `json:"revoked_at" db:"revoked_at"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+}
+
+// RevokedToken представляє відкликаний access токен
+type RevokedToken struct {
+	JTI       string    `json:"jti" db:"jti"`
+	UserID    *int64    `json:"user_id" db:"user_id"`
+	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
+	Reason    *string   `json:"reason" db:"reason"`
+	RevokedAt time.Time `json:"revoked_at" db:"revoked_at"`
+}
+
+// UserTokenRevocation представляє відкликання всіх токенів користувача, виданих до певного часу
+type UserTokenRevocation struct {
+	UserID        int64     `json:"user_id" db:"user_id"`
+	RevokedBefore time.Time `json:"revoked_before" db:"revoked_before"`
+	Reason        *string   `json:"reason" db:"reason"`
+}
+
+// DeviceTokenRevocation представляє відкликання всіх токенів пристрою, виданих до певного часу
+type DeviceTokenRevocation struct {
+	DeviceID      int64     `json:"device_id" db:"device_id"`
+	RevokedBefore time.Time `json:"revoked_before" db:"revoked_before"`
+	Reason        *string   `json:"reason" db:"reason"`
+}
+
 // Route представляє маршрут
 type Route struct {
 	ID                   int64     `json:"id" db:"id" example:"1"`
@@ -66,9 +198,49 @@ type Device struct {
 	Bus             *Bus       `json:"bus,omitempty"`
 	FirmwareVersion string     `json:"firmware_version" db:"firmware_version"`
 	LastSyncAt      *time.Time `json:"last_sync_at" db:"last_sync_at"`
+	LastHeartbeatAt *time.Time `json:"last_heartbeat_at" db:"last_heartbeat_at"`
+	DeviceGroup     *string    `json:"device_group" db:"device_group"`
 	IsActive        bool       `json:"is_active" db:"is_active"`
 }
 
+// DeviceHeartbeat показники стану IoT-пристрою, надіслані разом з heartbeat
+type DeviceHeartbeat struct {
+	ID              int64     `json:"id" db:"id" example:"1"`
+	DeviceID        int64     `json:"device_id" db:"device_id" example:"1"`
+	FirmwareVersion *string   `json:"firmware_version" db:"firmware_version" example:"1.2.0"`
+	UptimeSeconds   int64     `json:"uptime_seconds" db:"uptime_seconds" example:"86400"`
+	FreeHeapBytes   *int      `json:"free_heap_bytes" db:"free_heap_bytes" example:"142000"`
+	BufferedEvents  int       `json:"buffered_events" db:"buffered_events" example:"0"`
+	RSSI            *int      `json:"rssi" db:"rssi" example:"-67"`
+	BatteryPercent  *int      `json:"battery_percent" db:"battery_percent" example:"87"`
+	ReceivedAt      time.Time `json:"received_at" db:"received_at"`
+}
+
+// FirmwareRelease прошивка IoT-пристрою, доступна для розгортання. Сам файл зберігається окремо
+type FirmwareRelease struct {
+	ID             int64     `json:"id" db:"id" example:"1"`
+	Version        string    `json:"version" db:"version" example:"1.3.0"`
+	ChecksumSHA256 string    `json:"checksum_sha256" db:"checksum_sha256" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+	SizeBytes      int64     `json:"size_bytes" db:"size_bytes" example:"1048576"`
+	Notes          *string   `json:"notes" db:"notes"`
+	UploadedBy     *int64    `json:"uploaded_by" db:"uploaded_by"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
+
+// FirmwareRollout призначення цільової версії прошивки пристрою, групі пристроїв або всім пристроям
+type FirmwareRollout struct {
+	ID              int64     `json:"id" db:"id" example:"1"`
+	FirmwareID      int64     `json:"firmware_id" db:"firmware_id" example:"1"`
+	FirmwareVersion string    `json:"firmware_version" db:"firmware_version" example:"1.3.0"`
+	DeviceID        *int64    `json:"device_id" db:"device_id"`
+	DeviceGroup     *string   `json:"device_group" db:"device_group" example:"pilot"`
+	RolloutPercent  int       `json:"rollout_percent" db:"rollout_percent" example:"25"`
+	IsActive        bool      `json:"is_active" db:"is_active" example:"true"`
+	CreatedBy       *int64    `json:"created_by" db:"created_by"`
+	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at" db:"updated_at"`
+}
+
 // Trip представляє рейс
 type Trip struct {
 	ID                 int64      `json:"id" db:"id" example:"1"`
@@ -88,15 +260,48 @@ type Trip struct {
 type PassengerEvent struct {
 	ID                  int64     `json:"id" db:"id" example:"1"`
 	TripID              int64     `json:"trip_id" db:"trip_id" example:"1"`
-	EventType           string    `json:"event_type" db:"event_type" example:"board" enums:"board,alight"`
+	EventType           string    `json:"event_type" db:"event_type" example:"entry" enums:"entry,exit"`
 	Timestamp           time.Time `json:"timestamp" db:"timestamp" example:"2023-12-15T08:15:00Z"`
 	Latitude            *float64  `json:"latitude" db:"latitude" example:"49.9935"`
 	Longitude           *float64  `json:"longitude" db:"longitude" example:"36.2304"`
 	PassengerCountAfter int       `json:"passenger_count_after" db:"passenger_count_after" example:"25"`
+	ReportedCount       *int      `json:"reported_count,omitempty" db:"reported_count" example:"27"`
 	DeviceLocalID       *int      `json:"device_local_id" db:"device_local_id" example:"123"`
 	IsSynced            bool      `json:"is_synced" db:"is_synced" example:"true"`
 }
 
+// OccupancyRecompute результат перерахунку кількості пасажирів рейсу за подіями
+type OccupancyRecompute struct {
+	TripID             int64 `json:"trip_id" example:"1"`
+	PreviousPassengers int   `json:"previous_passengers" example:"31"`
+	CurrentPassengers  int   `json:"current_passengers" example:"27"`
+	EventsProcessed    int   `json:"events_processed" example:"84"`
+	EventsUpdated      int   `json:"events_updated" example:"6"`
+	// ClampedEventIDs виходи, після яких кількість опустилася б нижче нуля і була залишена нульовою
+	ClampedEventIDs []int64 `json:"clamped_event_ids"`
+	// ReleasedEventIDs відкладені події, які після перерахунку стали можливими і перенесені до подій рейсу
+	ReleasedEventIDs []int64 `json:"released_event_ids"`
+}
+
+// QuarantinedEvent подія пасажира, відкладена для перевірки
+type QuarantinedEvent struct {
+	ID                  int64      `json:"id" db:"id" example:"1"`
+	DeviceID            int64      `json:"device_id" db:"device_id" example:"1"`
+	TripID              int64      `json:"trip_id" db:"trip_id" example:"1"`
+	EventType           string     `json:"event_type" db:"event_type" example:"exit" enums:"entry,exit"`
+	Timestamp           time.Time  `json:"timestamp" db:"timestamp" example:"2023-12-15T08:15:00Z"`
+	Latitude            *float64   `json:"latitude" db:"latitude" example:"49.9935"`
+	Longitude           *float64   `json:"longitude" db:"longitude" example:"36.2304"`
+	PassengerCountAfter int        `json:"passenger_count_after" db:"passenger_count_after" example:"-1"`
+	RunningCount        int        `json:"running_count" db:"running_count" example:"0"`
+	DeviceLocalID       int        `json:"device_local_id" db:"device_local_id" example:"123"`
+	Reason              string     `json:"reason" db:"reason" example:"count_below_zero" enums:"count_below_zero,over_capacity"`
+	ReviewedBy          *int64     `json:"reviewed_by" db:"reviewed_by"`
+	ReviewedAt          *time.Time `json:"reviewed_at" db:"reviewed_at"`
+	ReviewNote          *string    `json:"review_note" db:"review_note"`
+	CreatedAt           time.Time  `json:"created_at" db:"created_at"`
+}
+
 // PriceRecommendation представляє рекомендацію ціни
 type PriceRecommendation struct {
 	ID               int64     `json:"id" db:"id"`
@@ -108,6 +313,13 @@ type PriceRecommendation struct {
 	TimeCoeff        float64   `json:"time_coefficient" db:"time_coefficient"`
 	DayCoeff         float64   `json:"day_coefficient" db:"day_coefficient"`
 	CreatedAt        time.Time `json:"created_at" db:"created_at"`
+	// Результат перевірки сервером: ціна, розрахована за фактичною завантаженістю та часом
+	// відправлення рейсу, та причина, якщо ціна пристрою розходиться з нею більше допустимого
+	DeviceID            *int64   `json:"device_id" db:"device_id" example:"1"`
+	ServerPrice         *float64 `json:"server_price" db:"server_price" example:"550.00"`
+	ServerOccupancyRate *float64 `json:"server_occupancy_rate" db:"server_occupancy_rate" example:"56.00"`
+	IsFlagged           bool     `json:"is_flagged" db:"is_flagged"`
+	DivergenceReason    *string  `json:"divergence_reason" db:"divergence_reason" example:"price_mismatch" enums:"base_price_mismatch,occupancy_mismatch,price_mismatch"`
 }
 
 // TripAnalytics представляє аналітику рейсу
@@ -126,6 +338,14 @@ type TripAnalytics struct {
 	CalculatedAt         time.Time `json:"calculated_at" db:"calculated_at" example:"2023-12-15T20:00:00Z"`
 }
 
+// RouteTripAnalytics аналітика рейсу разом з маршрутом, до якого він належить
+type RouteTripAnalytics struct {
+	TripAnalytics
+	RouteID         int64   `json:"route_id" db:"route_id"`
+	OriginCity      *string `json:"origin_city" db:"origin_city"`
+	DestinationCity *string `json:"destination_city" db:"destination_city"`
+}
+
 // DemandForecast представляє прогноз попиту
 type DemandForecast struct {
 	ID                  int64     `json:"id" db:"id"`
@@ -158,6 +378,8 @@ type AuditLog struct {
 	ID         int64          `json:"id" db:"id"`
 	UserID     *int64         `json:"user_id" db:"user_id"`
 	User       *User          `json:"user,omitempty"`
+	DeviceID   *int64         `json:"device_id,omitempty" db:"device_id"`
+	APIKeyID   *int64         `json:"api_key_id,omitempty" db:"api_key_id"`
 	Action     string         `json:"action" db:"action"`
 	EntityType string         `json:"entity_type" db:"entity_type"`
 	EntityID   *int64         `json:"entity_id" db:"entity_id"`
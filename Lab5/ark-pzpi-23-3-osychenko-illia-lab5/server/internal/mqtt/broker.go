@@ -0,0 +1,280 @@
+// Package mqtt вбудований MQTT брокер для прийому подій пасажирів від IoT-пристроїв.
+//
+// Пристрій підключається з серійним номером як username та токеном з POST /auth/device як password
+// і може публікувати лише в busoptima/devices/{serial_number}/events та підписуватись лише на .../events/ack.
+// Пакети подій обробляються тим самим IoTService.SyncEvents, що й POST /iot/events.
+package mqtt
+
+import (
+	"busoptima/internal/service"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+const (
+	// TopicPrefix спільний префікс топіків пристроїв: busoptima/devices/{serial_number}/...
+	TopicPrefix = "busoptima/devices/"
+	// EventsTopicSuffix топік, у який пристрій публікує пакети подій
+	EventsTopicSuffix = "/events"
+	// AckTopicSuffix топік, у який сервер публікує результат обробки пакета
+	AckTopicSuffix = "/events/ack"
+
+	// syncTimeout максимальний час обробки одного пакета подій
+	syncTimeout = 30 * time.Second
+)
+
+// EventsMessage пакет подій, опублікований пристроєм. Формат збігається з тілом POST /iot/events,
+// request_id повертається у відповіді, щоб пристрій зіставив її з пакетом
+type EventsMessage struct {
+	RequestID string                   `json:"request_id,omitempty"`
+	TripID    int64                    `json:"trip_id"`
+	Events    []service.SyncEventInput `json:"events"`
+}
+
+// AckMessage результат обробки пакета подій: відповідь SyncEvents або помилка
+type AckMessage struct {
+	RequestID string `json:"request_id,omitempty"`
+	Error     string `json:"error,omitempty"`
+	*service.SyncEventsResponse
+}
+
+// EventsTopic повертає топік подій пристрою
+func EventsTopic(serialNumber string) string {
+	return TopicPrefix + serialNumber + EventsTopicSuffix
+}
+
+// AckTopic повертає топік відповідей пристрою
+func AckTopic(serialNumber string) string {
+	return TopicPrefix + serialNumber + AckTopicSuffix
+}
+
+// Broker вбудований MQTT брокер
+type Broker struct {
+	server *mochi.Server
+}
+
+// NewBroker створює брокер, що приймає лише автентифіковані пристрої.
+// Відкликання токена пристрою (ротація секрету, деактивація) діє і на вже відкриті з'єднання
+func NewBroker(auth service.AuthService, iot service.IoTService, tokens service.TokenRevocationService, audit service.AuditService) (*Broker, error) {
+	server := mochi.New(&mochi.Options{
+		// Вбудований клієнт публікує відповіді пристроям
+		InlineClient: true,
+	})
+
+	hook := &deviceHook{
+		auth:     auth,
+		iot:      iot,
+		tokens:   tokens,
+		audit:    audit,
+		server:   server,
+		sessions: make(map[*mochi.Client]*service.DeviceIdentity),
+	}
+	if err := server.AddHook(hook, nil); err != nil {
+		return nil, fmt.Errorf("failed to add MQTT hook: %w", err)
+	}
+
+	return &Broker{server: server}, nil
+}
+
+// Listen додає TCP слухача на вказаній адресі
+func (b *Broker) Listen(address string) error {
+	return b.AddListener(listeners.NewTCP(listeners.Config{ID: "tcp", Address: address}))
+}
+
+// AddListener додає довільного слухача, наприклад listeners.NewNet для перевірки в межах процесу
+func (b *Broker) AddListener(listener listeners.Listener) error {
+	if err := b.server.AddListener(listener); err != nil {
+		return fmt.Errorf("failed to add MQTT listener: %w", err)
+	}
+	return nil
+}
+
+// Serve запускає прийом підключень у фоні
+func (b *Broker) Serve() error {
+	return b.server.Serve()
+}
+
+// Close закриває всі підключення та слухачів
+func (b *Broker) Close() error {
+	return b.server.Close()
+}
+
+// deviceHook автентифікує пристрої, обмежує їх власними топіками та обробляє пакети подій
+type deviceHook struct {
+	mochi.HookBase
+
+	auth   service.AuthService
+	iot    service.IoTService
+	tokens service.TokenRevocationService
+	audit  service.AuditService
+	server *mochi.Server
+
+	mu       sync.RWMutex
+	sessions map[*mochi.Client]*service.DeviceIdentity
+}
+
+// ID повертає ідентифікатор хука
+func (h *deviceHook) ID() string {
+	return "busoptima-devices"
+}
+
+// Provides повідомляє брокеру, які події обробляє хук
+func (h *deviceHook) Provides(b byte) bool {
+	return bytes.Contains([]byte{
+		mochi.OnConnectAuthenticate,
+		mochi.OnACLCheck,
+		mochi.OnDisconnect,
+		mochi.OnPublish,
+	}, []byte{b})
+}
+
+// OnConnectAuthenticate перевіряє токен пристрою. Серійний номер у username має збігатися з токеном
+func (h *deviceHook) OnConnectAuthenticate(cl *mochi.Client, pk packets.Packet) bool {
+	identity, err := h.auth.VerifyDeviceToken(string(pk.Connect.Password))
+	if err != nil {
+		log.Printf("MQTT: rejected connection from %s: %v", cl.Net.Remote, err)
+		return false
+	}
+	if identity.SerialNumber != string(pk.Connect.Username) {
+		log.Printf("MQTT: rejected connection from %s: username does not match device token", cl.Net.Remote)
+		return false
+	}
+
+	h.mu.Lock()
+	h.sessions[cl] = identity
+	h.mu.Unlock()
+
+	return true
+}
+
+// OnACLCheck дозволяє пристрою публікувати лише власні події та підписуватись лише на власні відповіді.
+// Підписатись на топік подій не може ніхто, тож пакети подій далі брокера не пересилаються
+func (h *deviceHook) OnACLCheck(cl *mochi.Client, topic string, write bool) bool {
+	identity, ok := h.session(cl)
+	if !ok {
+		return false
+	}
+
+	if write {
+		return topic == EventsTopic(identity.SerialNumber)
+	}
+	return topic == AckTopic(identity.SerialNumber)
+}
+
+// OnDisconnect забуває сесію пристрою
+func (h *deviceHook) OnDisconnect(cl *mochi.Client, err error, expire bool) {
+	h.mu.Lock()
+	delete(h.sessions, cl)
+	h.mu.Unlock()
+}
+
+// OnPublish обробляє пакет подій до відправлення PUBACK. Якщо події не вдалося зберегти через
+// тимчасову помилку, пакет відхиляється без PUBACK, і пристрій з QoS 1 повторить публікацію.
+// Остаточні помилки (невірний формат, чужий рейс) підтверджуються і повертаються в топік відповідей
+func (h *deviceHook) OnPublish(cl *mochi.Client, pk packets.Packet) (packets.Packet, error) {
+	if cl.Net.Inline {
+		return pk, nil
+	}
+
+	identity, ok := h.session(cl)
+	if !ok {
+		return pk, packets.ErrRejectPacket
+	}
+
+	var msg EventsMessage
+	if err := json.Unmarshal(pk.Payload, &msg); err != nil {
+		h.reply(identity, &AckMessage{Error: "Invalid message body"})
+		return pk, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), syncTimeout)
+	defer cancel()
+
+	tripID := strconv.FormatInt(msg.TripID, 10)
+	response, err := h.iot.SyncEvents(ctx, identity.DeviceID, msg.TripID, service.ToPassengerEvents(msg.TripID, msg.Events))
+	if err != nil {
+		if errors.Is(err, service.ErrDeviceAccessDenied) {
+			h.logAction(identity, "ACCESS_DENIED", tripID, map[string]any{"reason": err.Error(), "channel": "mqtt"}, cl.Net.Remote)
+			h.reply(identity, &AckMessage{RequestID: msg.RequestID, Error: err.Error()})
+			return pk, nil
+		}
+		if errors.Is(err, service.ErrTripNotFound) {
+			h.reply(identity, &AckMessage{RequestID: msg.RequestID, Error: err.Error()})
+			return pk, nil
+		}
+
+		log.Printf("MQTT: failed to sync events from device %d: %v", identity.DeviceID, err)
+		return pk, packets.ErrRejectPacket
+	}
+
+	h.logAction(identity, "SYNC", tripID, map[string]any{
+		"trip_id":      msg.TripID,
+		"events_count": len(msg.Events),
+		"synced_count": response.SyncedCount,
+		"accepted":     response.AcceptedCount,
+		"duplicates":   response.DuplicateCount,
+		"quarantined":  response.QuarantinedCount,
+		"rejected":     response.RejectedCount,
+		"channel":      "mqtt",
+	}, cl.Net.Remote)
+
+	h.reply(identity, &AckMessage{RequestID: msg.RequestID, SyncEventsResponse: response})
+	return pk, nil
+}
+
+// session повертає пристрій підключення, якщо його токен ще дійсний і не відкликаний
+func (h *deviceHook) session(cl *mochi.Client) (*service.DeviceIdentity, bool) {
+	h.mu.RLock()
+	identity, ok := h.sessions[cl]
+	h.mu.RUnlock()
+
+	if !ok || time.Now().After(identity.ExpiresAt) {
+		return nil, false
+	}
+	if h.tokens.IsDeviceRevoked(identity.JTI, identity.DeviceID, identity.IssuedAt) {
+		return nil, false
+	}
+	return identity, true
+}
+
+// reply публікує відповідь у топік пристрою з QoS 1
+func (h *deviceHook) reply(identity *service.DeviceIdentity, msg *AckMessage) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("MQTT: failed to encode reply: %v", err)
+		return
+	}
+
+	if err := h.server.Publish(AckTopic(identity.SerialNumber), payload, false, 1); err != nil {
+		log.Printf("MQTT: failed to publish reply to device %d: %v", identity.DeviceID, err)
+	}
+}
+
+// logAction записує дію пристрою в журнал аудиту у фоні
+func (h *deviceHook) logAction(identity *service.DeviceIdentity, action, tripID string, values map[string]any, remote string) {
+	values["device_id"] = identity.DeviceID
+	values["device_serial"] = identity.SerialNumber
+
+	ipAddress := remote
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		ipAddress = host
+	}
+
+	go func() {
+		if err := h.audit.LogDeviceAction(context.Background(), identity.DeviceID, action, "passenger_events", tripID, values, ipAddress); err != nil {
+			log.Printf("Failed to write audit log: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,362 @@
+package mqtt
+
+import (
+	"bufio"
+	"busoptima/internal/model"
+	"busoptima/internal/service"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testSerial      = "BUS-001"
+	testOtherSerial = "BUS-002"
+	testToken       = "device-token"
+	testTokenJTI    = "device-token-jti"
+)
+
+// fakeDeviceAuth приймає лише testToken пристрою testSerial
+type fakeDeviceAuth struct {
+	service.AuthService
+}
+
+func (fakeDeviceAuth) VerifyDeviceToken(token string) (*service.DeviceIdentity, error) {
+	if token != testToken {
+		return nil, errors.New("invalid device token")
+	}
+	return &service.DeviceIdentity{DeviceID: 1, SerialNumber: testSerial, JTI: testTokenJTI, IssuedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)}, nil
+}
+
+// fakeDeviceRevocations відкликає токени пристроїв за jti
+type fakeDeviceRevocations struct {
+	service.TokenRevocationService
+
+	mu      sync.Mutex
+	revoked map[string]bool
+}
+
+func (f *fakeDeviceRevocations) IsDeviceRevoked(jti string, deviceID int64, issuedAt time.Time) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.revoked[jti]
+}
+
+func (f *fakeDeviceRevocations) revoke(jti string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.revoked[jti] = true
+}
+
+// fakeEventSync фіксує пакети подій і відповідає, що одну подію відкладено в карантин
+type fakeEventSync struct {
+	service.IoTService
+
+	mu    sync.Mutex
+	calls []int64
+}
+
+func (f *fakeEventSync) SyncEvents(ctx context.Context, deviceID, tripID int64, events []model.PassengerEvent) (*service.SyncEventsResponse, error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, tripID)
+	f.mu.Unlock()
+
+	return &service.SyncEventsResponse{
+		SyncedCount:      len(events),
+		AcceptedCount:    len(events) - 1,
+		QuarantinedCount: 1,
+	}, nil
+}
+
+func (f *fakeEventSync) syncedTrips() []int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]int64(nil), f.calls...)
+}
+
+// fakeDeviceAudit передає записи аудиту в канал, бо брокер пише їх у фоні
+type fakeDeviceAudit struct {
+	service.AuditService
+	entries chan map[string]any
+}
+
+func (f *fakeDeviceAudit) LogDeviceAction(ctx context.Context, deviceID int64, action, entityType, entityID string, newValues map[string]any, ipAddress string) error {
+	f.entries <- newValues
+	return nil
+}
+
+// brokerTestEnv брокер на локальному порту з підробленими сервісами
+type brokerTestEnv struct {
+	address string
+	iot     *fakeEventSync
+	tokens  *fakeDeviceRevocations
+	audit   *fakeDeviceAudit
+}
+
+func newBrokerTestEnv(t *testing.T) *brokerTestEnv {
+	t.Helper()
+
+	env := &brokerTestEnv{
+		iot:    &fakeEventSync{},
+		tokens: &fakeDeviceRevocations{revoked: make(map[string]bool)},
+		audit:  &fakeDeviceAudit{entries: make(chan map[string]any, 10)},
+	}
+
+	broker, err := NewBroker(fakeDeviceAuth{}, env.iot, env.tokens, env.audit)
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	env.address = listener.Addr().String()
+
+	require.NoError(t, broker.AddListener(listeners.NewNet("test", listener)))
+	require.NoError(t, broker.Serve())
+	t.Cleanup(func() { broker.Close() })
+
+	return env
+}
+
+// testClient мінімальний клієнт MQTT 3.1.1
+type testClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func (env *brokerTestEnv) dial(t *testing.T) *testClient {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", env.address)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+
+	return &testClient{t: t, conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// connect надсилає CONNECT і повертає код відповіді CONNACK
+func (c *testClient) connect(username, password string) byte {
+	c.t.Helper()
+
+	pk := packets.Packet{
+		FixedHeader:     packets.FixedHeader{Type: packets.Connect},
+		ProtocolVersion: 4,
+		Connect: packets.ConnectParams{
+			ProtocolName:     []byte("MQTT"),
+			Clean:            true,
+			Keepalive:        30,
+			ClientIdentifier: username,
+			UsernameFlag:     true,
+			Username:         []byte(username),
+			PasswordFlag:     true,
+			Password:         []byte(password),
+		},
+	}
+	c.write(pk.ConnectEncode)
+
+	connack := c.read()
+	require.Equal(c.t, packets.Connack, connack.FixedHeader.Type)
+	return connack.ReasonCode
+}
+
+// subscribe підписується на топік з QoS 1 і повертає код SUBACK
+func (c *testClient) subscribe(topic string) byte {
+	c.t.Helper()
+
+	pk := packets.Packet{
+		FixedHeader:     packets.FixedHeader{Type: packets.Subscribe, Qos: 1},
+		ProtocolVersion: 4,
+		PacketID:        1,
+		Filters:         packets.Subscriptions{{Filter: topic, Qos: 1}},
+	}
+	c.write(pk.SubscribeEncode)
+
+	suback := c.read()
+	require.Equal(c.t, packets.Suback, suback.FixedHeader.Type)
+	require.Len(c.t, suback.ReasonCodes, 1)
+	return suback.ReasonCodes[0]
+}
+
+// publish публікує повідомлення з QoS 1
+func (c *testClient) publish(topic string, packetID uint16, payload any) {
+	c.t.Helper()
+
+	body, err := json.Marshal(payload)
+	require.NoError(c.t, err)
+
+	pk := packets.Packet{
+		FixedHeader:     packets.FixedHeader{Type: packets.Publish, Qos: 1},
+		ProtocolVersion: 4,
+		TopicName:       topic,
+		PacketID:        packetID,
+		Payload:         body,
+	}
+	c.write(pk.PublishEncode)
+}
+
+func (c *testClient) write(encode func(*bytes.Buffer) error) {
+	c.t.Helper()
+
+	var buf bytes.Buffer
+	require.NoError(c.t, encode(&buf))
+	_, err := c.conn.Write(buf.Bytes())
+	require.NoError(c.t, err)
+}
+
+// readPacket читає і розкодовує наступний пакет від брокера
+func (c *testClient) readPacket() (packets.Packet, error) {
+	header, err := c.reader.ReadByte()
+	if err != nil {
+		return packets.Packet{}, err
+	}
+
+	pk := packets.Packet{ProtocolVersion: 4}
+	if err := pk.FixedHeader.Decode(header); err != nil {
+		return pk, err
+	}
+	length, _, err := packets.DecodeLength(c.reader)
+	if err != nil {
+		return pk, err
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, body); err != nil {
+		return pk, err
+	}
+
+	switch pk.FixedHeader.Type {
+	case packets.Connack:
+		err = pk.ConnackDecode(body)
+	case packets.Suback:
+		err = pk.SubackDecode(body)
+	case packets.Puback:
+		err = pk.PubackDecode(body)
+	case packets.Publish:
+		err = pk.PublishDecode(body)
+	}
+	return pk, err
+}
+
+func (c *testClient) read() packets.Packet {
+	c.t.Helper()
+
+	pk, err := c.readPacket()
+	require.NoError(c.t, err)
+	return pk
+}
+
+func TestBrokerAcknowledgesEventsAndReplies(t *testing.T) {
+	env := newBrokerTestEnv(t)
+	client := env.dial(t)
+
+	require.Equal(t, packets.CodeSuccess.Code, client.connect(testSerial, testToken))
+	require.Equal(t, byte(1), client.subscribe(AckTopic(testSerial)))
+
+	client.publish(EventsTopic(testSerial), 7, EventsMessage{
+		RequestID: "batch-1",
+		TripID:    42,
+		Events: []service.SyncEventInput{
+			{LocalID: 1, EventType: "entry", Timestamp: "2024-05-01T08:00:00Z", PassengerCountAfter: 1},
+			{LocalID: 2, EventType: "exit", Timestamp: "2024-05-01T08:05:00Z", PassengerCountAfter: 0},
+		},
+	})
+
+	// Відповідь публікується ще до PUBACK, тож пакети можуть прийти в будь-якому порядку
+	var puback, reply *packets.Packet
+	for puback == nil || reply == nil {
+		pk := client.read()
+		switch pk.FixedHeader.Type {
+		case packets.Puback:
+			puback = &pk
+		case packets.Publish:
+			reply = &pk
+		default:
+			t.Fatalf("unexpected packet type %d", pk.FixedHeader.Type)
+		}
+	}
+
+	assert.Equal(t, uint16(7), puback.PacketID)
+	assert.Equal(t, AckTopic(testSerial), reply.TopicName)
+
+	var ack AckMessage
+	require.NoError(t, json.Unmarshal(reply.Payload, &ack))
+	assert.Equal(t, "batch-1", ack.RequestID)
+	assert.Empty(t, ack.Error)
+	require.NotNil(t, ack.SyncEventsResponse)
+	assert.Equal(t, 1, ack.QuarantinedCount)
+	assert.Equal(t, []int64{42}, env.iot.syncedTrips())
+
+	select {
+	case entry := <-env.audit.entries:
+		assert.Equal(t, 1, entry["quarantined"])
+		assert.Equal(t, 1, entry["accepted"])
+		assert.Equal(t, "mqtt", entry["channel"])
+	case <-time.After(5 * time.Second):
+		t.Fatal("audit entry was not written")
+	}
+}
+
+func TestBrokerDeniesTopicsOfOtherDevices(t *testing.T) {
+	env := newBrokerTestEnv(t)
+	client := env.dial(t)
+
+	require.Equal(t, packets.CodeSuccess.Code, client.connect(testSerial, testToken))
+
+	// Підписка на відповіді іншого пристрою відхиляється кодом 0x80
+	assert.Equal(t, packets.ErrUnspecifiedError.Code, client.subscribe(AckTopic(testOtherSerial)))
+
+	// Публікація з QoS 1 у топік іншого пристрою в MQTT 3.1.1 розриває з'єднання без PUBACK
+	client.publish(EventsTopic(testOtherSerial), 1, EventsMessage{TripID: 42})
+	for {
+		pk, err := client.readPacket()
+		if err != nil {
+			break
+		}
+		assert.NotEqual(t, packets.Puback, pk.FixedHeader.Type)
+	}
+	assert.Empty(t, env.iot.syncedTrips())
+}
+
+func TestBrokerRefusesInvalidDeviceToken(t *testing.T) {
+	env := newBrokerTestEnv(t)
+
+	client := env.dial(t)
+	assert.Equal(t, packets.Err3NotAuthorized.Code, client.connect(testSerial, "forged-token"))
+
+	// Дійсний токен з чужим серійним номером теж не підходить
+	client = env.dial(t)
+	assert.Equal(t, packets.Err3NotAuthorized.Code, client.connect(testOtherSerial, testToken))
+}
+
+func TestBrokerStopsServingRevokedDeviceToken(t *testing.T) {
+	env := newBrokerTestEnv(t)
+	client := env.dial(t)
+
+	require.Equal(t, packets.CodeSuccess.Code, client.connect(testSerial, testToken))
+	require.Equal(t, byte(1), client.subscribe(AckTopic(testSerial)))
+
+	// Секрет пристрою змінено вже після підключення: з'єднання лишається, але токен більше не діє
+	env.tokens.revoke(testTokenJTI)
+
+	assert.Equal(t, packets.ErrUnspecifiedError.Code, client.subscribe(AckTopic(testSerial)))
+
+	client.publish(EventsTopic(testSerial), 1, EventsMessage{TripID: 42})
+	for {
+		pk, err := client.readPacket()
+		if err != nil {
+			break
+		}
+		assert.NotEqual(t, packets.Puback, pk.FixedHeader.Type)
+	}
+	assert.Empty(t, env.iot.syncedTrips())
+}
@@ -8,13 +8,14 @@ import (
 	"busoptima/internal/model"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 // AnalyticsRepository інтерфейс для роботи з аналітикою
 type AnalyticsRepository interface {
 	CalculateTripAnalytics(ctx context.Context, tripID int64) (*model.TripAnalytics, error)
 	GetTripAnalytics(ctx context.Context, tripID int64) (*model.TripAnalytics, error)
-	GetProfitabilityByRoute(ctx context.Context, routeID int64, from, to time.Time) ([]model.TripAnalytics, error)
+	GetProfitabilityByRoute(ctx context.Context, routeIDs []int64, from, to time.Time) ([]model.RouteTripAnalytics, error)
 	GetAllAnalytics(ctx context.Context, from, to time.Time) ([]model.TripAnalytics, error)
 	GetHistoricalPassengers(ctx context.Context, routeID int64, dayOfWeek int, weeks int) ([]int, error)
 	SaveDemandForecast(ctx context.Context, forecast *model.DemandForecast) error
@@ -67,7 +68,7 @@ func (r *analyticsRepository) CalculateTripAnalytics(ctx context.Context, tripID
 				 WHERE pe.trip_id = t.id), 0
 			) as max_passengers,
 			COALESCE(
-				(SELECT SUM(pr.recommended_price)
+				(SELECT SUM(CASE WHEN pr.is_flagged THEN pr.server_price ELSE pr.recommended_price END)
 				 FROM price_recommendations pr
 				 WHERE pr.trip_id = t.id), 
 				r.base_price * COALESCE(
@@ -172,34 +173,20 @@ func (r *analyticsRepository) GetTripAnalytics(ctx context.Context, tripID int64
 	return &analytics, nil
 }
 
-// GetProfitabilityByRoute повертає аналітику рентабельності за маршрутом
-func (r *analyticsRepository) GetProfitabilityByRoute(ctx context.Context, routeID int64, from, to time.Time) ([]model.TripAnalytics, error) {
-	var analytics []model.TripAnalytics
-	var query string
-	var err error
-
-	if routeID == 0 {
-		// Всі маршрути
-		query = `
-			SELECT ta.* 
-			FROM trip_analytics ta
-			JOIN trips t ON ta.trip_id = t.id
-			WHERE t.scheduled_departure BETWEEN $1 AND $2
-			ORDER BY t.scheduled_departure DESC`
-		err = r.db.SelectContext(ctx, &analytics, query, from, to)
-	} else {
-		// Конкретний маршрут
-		query = `
-			SELECT ta.* 
-			FROM trip_analytics ta
-			JOIN trips t ON ta.trip_id = t.id
-			WHERE t.route_id = $1 
-			AND t.scheduled_departure BETWEEN $2 AND $3
-			ORDER BY t.scheduled_departure DESC`
-		err = r.db.SelectContext(ctx, &analytics, query, routeID, from, to)
-	}
+// GetProfitabilityByRoute повертає аналітику рейсів за період разом з їх маршрутами.
+// routeIDs обмежує вибірку вказаними маршрутами, nil - всі маршрути
+func (r *analyticsRepository) GetProfitabilityByRoute(ctx context.Context, routeIDs []int64, from, to time.Time) ([]model.RouteTripAnalytics, error) {
+	var analytics []model.RouteTripAnalytics
+	query := `
+		SELECT ta.*, t.route_id, r.origin_city, r.destination_city
+		FROM trip_analytics ta
+		JOIN trips t ON ta.trip_id = t.id
+		LEFT JOIN routes r ON t.route_id = r.id
+		WHERE t.scheduled_departure BETWEEN $1 AND $2
+		AND ($3::BIGINT[] IS NULL OR t.route_id = ANY($3))
+		ORDER BY t.scheduled_departure DESC`
 
-	if err != nil {
+	if err := r.db.SelectContext(ctx, &analytics, query, from, to, pq.Array(routeIDs)); err != nil {
 		return nil, fmt.Errorf("failed to get profitability data: %w", err)
 	}
 
@@ -0,0 +1,227 @@
+package repository
+
+import (
+	"busoptima/internal/model"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// APIKeyRepository інтерфейс для роботи з API ключами
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *model.APIKey) error
+	GetByID(ctx context.Context, id int64) (*model.APIKey, error)
+	GetByHash(ctx context.Context, keyHash string) (*model.APIKey, error)
+	GetAll(ctx context.Context) ([]model.APIKey, error)
+	Update(ctx context.Context, key *model.APIKey) error
+	Revoke(ctx context.Context, id int64) error
+	TouchLastUsed(ctx context.Context, id int64, ipAddress string, minInterval time.Duration) error
+}
+
+// apiKeyRepository реалізація APIKeyRepository
+type apiKeyRepository struct {
+	db *sqlx.DB
+}
+
+// NewAPIKeyRepository створює новий екземпляр репозиторію API ключів
+func NewAPIKeyRepository(db *sqlx.DB) APIKeyRepository {
+	return &apiKeyRepository{db: db}
+}
+
+// selectAPIKeyQuery базовий запит ключа разом з назвами його дозволів
+const selectAPIKeyQuery = `
+		SELECT k.id, k.name, k.key_prefix, k.key_hash, k.created_by, k.expires_at,
+			k.last_used_at, k.last_used_ip, k.revoked_at, k.created_at,
+			COALESCE(array_agg(p.name ORDER BY p.name) FILTER (WHERE p.name IS NOT NULL), '{}') AS permissions
+		FROM api_keys k
+		LEFT JOIN api_key_permissions kp ON kp.api_key_id = k.id
+		LEFT JOIN permissions p ON p.id = kp.permission_id`
+
+// Create зберігає новий ключ та його дозволи
+func (r *apiKeyRepository) Create(ctx context.Context, key *model.APIKey) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO api_keys (name, key_prefix, key_hash, created_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+
+	err = tx.QueryRowContext(ctx, query,
+		key.Name, key.KeyPrefix, key.KeyHash, key.CreatedBy, key.ExpiresAt,
+	).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	if err := setAPIKeyPermissions(ctx, tx, key.ID, key.Permissions); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetByID повертає ключ за ідентифікатором (включно з відкликаними)
+func (r *apiKeyRepository) GetByID(ctx context.Context, id int64) (*model.APIKey, error) {
+	key, err := scanAPIKey(r.db.QueryRowContext(ctx, selectAPIKeyQuery+` WHERE k.id = $1 GROUP BY k.id`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("API key with id %d %w", id, ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+
+	return key, nil
+}
+
+// GetByHash повертає ключ за хешем
+func (r *apiKeyRepository) GetByHash(ctx context.Context, keyHash string) (*model.APIKey, error) {
+	key, err := scanAPIKey(r.db.QueryRowContext(ctx, selectAPIKeyQuery+` WHERE k.key_hash = $1 GROUP BY k.id`, keyHash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("API key %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+
+	return key, nil
+}
+
+// GetAll повертає всі ключі
+func (r *apiKeyRepository) GetAll(ctx context.Context) ([]model.APIKey, error) {
+	rows, err := r.db.QueryContext(ctx, selectAPIKeyQuery+` GROUP BY k.id ORDER BY k.id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []model.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %w", err)
+		}
+		keys = append(keys, *key)
+	}
+
+	return keys, rows.Err()
+}
+
+// Update змінює назву, термін дії та дозволи ключа
+func (r *apiKeyRepository) Update(ctx context.Context, key *model.APIKey) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE api_keys SET name = $2, expires_at = $3 WHERE id = $1 AND revoked_at IS NULL`
+
+	result, err := tx.ExecContext(ctx, query, key.ID, key.Name, key.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to update API key: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("API key with id %d %w or revoked", key.ID, ErrNotFound)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM api_key_permissions WHERE api_key_id = $1`, key.ID); err != nil {
+		return fmt.Errorf("failed to update API key permissions: %w", err)
+	}
+
+	if err := setAPIKeyPermissions(ctx, tx, key.ID, key.Permissions); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Revoke відкликає ключ. Запис залишається для журналу аудиту
+func (r *apiKeyRepository) Revoke(ctx context.Context, id int64) error {
+	query := `UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND revoked_at IS NULL`
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("API key with id %d %w or already revoked", id, ErrNotFound)
+	}
+
+	return nil
+}
+
+// TouchLastUsed оновлює час та адресу останнього використання.
+// Щоб не писати в БД на кожен запит, оновлення відбувається не частіше ніж раз на minInterval
+func (r *apiKeyRepository) TouchLastUsed(ctx context.Context, id int64, ipAddress string, minInterval time.Duration) error {
+	query := `
+		UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP, last_used_ip = $2
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < $3)`
+
+	if _, err := r.db.ExecContext(ctx, query, id, ipAddress, time.Now().Add(-minInterval)); err != nil {
+		return fmt.Errorf("failed to update API key usage: %w", err)
+	}
+
+	return nil
+}
+
+// setAPIKeyPermissions прив'язує дозволи до ключа. Невідомі назви дозволів повертають помилку
+func setAPIKeyPermissions(ctx context.Context, tx *sqlx.Tx, keyID int64, permissions []string) error {
+	query := `
+		INSERT INTO api_key_permissions (api_key_id, permission_id)
+		SELECT $1, id FROM permissions WHERE name = ANY($2)`
+
+	result, err := tx.ExecContext(ctx, query, keyID, pq.Array(permissions))
+	if err != nil {
+		return fmt.Errorf("failed to set API key permissions: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if int(rowsAffected) != len(permissions) {
+		return fmt.Errorf("unknown permission in %v", permissions)
+	}
+
+	return nil
+}
+
+// scanAPIKey зчитує ключ разом з агрегованими дозволами
+func scanAPIKey(row rowScanner) (*model.APIKey, error) {
+	var key model.APIKey
+	var permissions pq.StringArray
+
+	err := row.Scan(
+		&key.ID, &key.Name, &key.KeyPrefix, &key.KeyHash, &key.CreatedBy, &key.ExpiresAt,
+		&key.LastUsedAt, &key.LastUsedIP, &key.RevokedAt, &key.CreatedAt,
+		&permissions,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	key.Permissions = []string(permissions)
+	return &key, nil
+}
@@ -29,9 +29,9 @@ func NewAuditLogRepository(db *sqlx.DB) AuditLogRepository {
 // Create створює новий запис в журналі аудиту
 func (r *auditLogRepository) Create(ctx context.Context, log *model.AuditLog) error {
 	query := `
-		INSERT INTO audit_logs (user_id, action, entity_type, entity_id, 
+		INSERT INTO audit_logs (user_id, device_id, api_key_id, action, entity_type, entity_id, 
 			old_values, new_values, ip_address)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 		RETURNING id, created_at`
 
 	// Маршалінг JSON значень
@@ -46,7 +46,7 @@ func (r *auditLogRepository) Create(ctx context.Context, log *model.AuditLog) er
 	}
 
 	return r.db.QueryRowContext(ctx, query,
-		log.UserID, log.Action, log.EntityType, log.EntityID,
+		log.UserID, log.DeviceID, log.APIKeyID, log.Action, log.EntityType, log.EntityID,
 		oldValuesJSON, newValuesJSON, log.IPAddress,
 	).Scan(&log.ID, &log.CreatedAt)
 }
@@ -55,7 +55,7 @@ func (r *auditLogRepository) Create(ctx context.Context, log *model.AuditLog) er
 func (r *auditLogRepository) GetAll(ctx context.Context, filters map[string]any) ([]model.AuditLog, error) {
 	var logs []model.AuditLog
 	query := `
-		SELECT al.id, al.user_id, al.action, al.entity_type, al.entity_id,
+		SELECT al.id, al.user_id, al.device_id, al.api_key_id, al.action, al.entity_type, al.entity_id,
 			al.old_values, al.new_values, al.ip_address, al.created_at,
 			u.email, u.full_name
 		FROM audit_logs al
@@ -72,6 +72,18 @@ func (r *auditLogRepository) GetAll(ctx context.Context, filters map[string]any)
 		argIndex++
 	}
 
+	if deviceID, ok := filters["device_id"]; ok {
+		query += fmt.Sprintf(" AND al.device_id = $%d", argIndex)
+		args = append(args, deviceID)
+		argIndex++
+	}
+
+	if apiKeyID, ok := filters["api_key_id"]; ok {
+		query += fmt.Sprintf(" AND al.api_key_id = $%d", argIndex)
+		args = append(args, apiKeyID)
+		argIndex++
+	}
+
 	if action, ok := filters["action"]; ok {
 		query += fmt.Sprintf(" AND al.action = $%d", argIndex)
 		args = append(args, action)
@@ -127,7 +139,7 @@ func (r *auditLogRepository) GetAll(ctx context.Context, filters map[string]any)
 		var oldValuesBytes, newValuesBytes []byte
 
 		err := rows.Scan(
-			&log.ID, &log.UserID, &log.Action, &log.EntityType, &log.EntityID,
+			&log.ID, &log.UserID, &log.DeviceID, &log.APIKeyID, &log.Action, &log.EntityType, &log.EntityID,
 			&oldValuesBytes, &newValuesBytes, &log.IPAddress, &log.CreatedAt,
 			&userEmail, &userFullName,
 		)
@@ -186,6 +198,18 @@ func (r *auditLogRepository) GetCount(ctx context.Context, filters map[string]an
 		argIndex++
 	}
 
+	if deviceID, ok := filters["device_id"]; ok {
+		query += fmt.Sprintf(" AND al.device_id = $%d", argIndex)
+		args = append(args, deviceID)
+		argIndex++
+	}
+
+	if apiKeyID, ok := filters["api_key_id"]; ok {
+		query += fmt.Sprintf(" AND al.api_key_id = $%d", argIndex)
+		args = append(args, apiKeyID)
+		argIndex++
+	}
+
 	if action, ok := filters["action"]; ok {
 		query += fmt.Sprintf(" AND al.action = $%d", argIndex)
 		args = append(args, action)
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"busoptima/internal/model"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DeviceHeartbeatRepository інтерфейс для роботи з телеметрією IoT-пристроїв
+type DeviceHeartbeatRepository interface {
+	Create(ctx context.Context, heartbeat *model.DeviceHeartbeat) error
+	GetLatest(ctx context.Context, deviceID int64) (*model.DeviceHeartbeat, error)
+	GetLatestForAll(ctx context.Context) (map[int64]model.DeviceHeartbeat, error)
+	GetByDevice(ctx context.Context, deviceID int64, since time.Time, limit int) ([]model.DeviceHeartbeat, error)
+	DeleteOlderThan(ctx context.Context, before time.Time) (int64, error)
+}
+
+// deviceHeartbeatRepository реалізація DeviceHeartbeatRepository
+type deviceHeartbeatRepository struct {
+	db *sqlx.DB
+}
+
+// NewDeviceHeartbeatRepository створює новий екземпляр репозиторію телеметрії
+func NewDeviceHeartbeatRepository(db *sqlx.DB) DeviceHeartbeatRepository {
+	return &deviceHeartbeatRepository{db: db}
+}
+
+const selectHeartbeatColumns = `
+		id, device_id, firmware_version, uptime_seconds, free_heap_bytes,
+		buffered_events, rssi, battery_percent, received_at`
+
+// Create зберігає показники та оновлює час останнього heartbeat і версію прошивки пристрою
+func (r *deviceHeartbeatRepository) Create(ctx context.Context, heartbeat *model.DeviceHeartbeat) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO device_heartbeats (device_id, firmware_version, uptime_seconds, free_heap_bytes,
+			buffered_events, rssi, battery_percent)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, received_at`
+
+	err = tx.QueryRowContext(ctx, query,
+		heartbeat.DeviceID, heartbeat.FirmwareVersion, heartbeat.UptimeSeconds, heartbeat.FreeHeapBytes,
+		heartbeat.BufferedEvents, heartbeat.RSSI, heartbeat.BatteryPercent,
+	).Scan(&heartbeat.ID, &heartbeat.ReceivedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save heartbeat: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE devices
+		SET last_heartbeat_at = $2, firmware_version = COALESCE($3, firmware_version)
+		WHERE id = $1`,
+		heartbeat.DeviceID, heartbeat.ReceivedAt, heartbeat.FirmwareVersion,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update device heartbeat: %w", err)
+	}
+
+	if err := checkDeviceRowsAffected(result, heartbeat.DeviceID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetLatest повертає останній heartbeat пристрою або nil, якщо пристрій їх ще не надсилав
+func (r *deviceHeartbeatRepository) GetLatest(ctx context.Context, deviceID int64) (*model.DeviceHeartbeat, error) {
+	var heartbeat model.DeviceHeartbeat
+	query := `SELECT` + selectHeartbeatColumns + `
+		FROM device_heartbeats
+		WHERE device_id = $1
+		ORDER BY received_at DESC
+		LIMIT 1`
+
+	err := r.db.GetContext(ctx, &heartbeat, query, deviceID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get latest heartbeat: %w", err)
+	}
+
+	return &heartbeat, nil
+}
+
+// GetLatestForAll повертає останній heartbeat кожного пристрою за його ID
+func (r *deviceHeartbeatRepository) GetLatestForAll(ctx context.Context) (map[int64]model.DeviceHeartbeat, error) {
+	var heartbeats []model.DeviceHeartbeat
+	query := `SELECT DISTINCT ON (device_id)` + selectHeartbeatColumns + `
+		FROM device_heartbeats
+		ORDER BY device_id, received_at DESC`
+
+	if err := r.db.SelectContext(ctx, &heartbeats, query); err != nil {
+		return nil, fmt.Errorf("failed to get latest heartbeats: %w", err)
+	}
+
+	latest := make(map[int64]model.DeviceHeartbeat, len(heartbeats))
+	for _, heartbeat := range heartbeats {
+		latest[heartbeat.DeviceID] = heartbeat
+	}
+
+	return latest, nil
+}
+
+// GetByDevice повертає heartbeat пристрою, отримані після since, від найновіших
+func (r *deviceHeartbeatRepository) GetByDevice(ctx context.Context, deviceID int64, since time.Time, limit int) ([]model.DeviceHeartbeat, error) {
+	heartbeats := []model.DeviceHeartbeat{}
+	query := `SELECT` + selectHeartbeatColumns + `
+		FROM device_heartbeats
+		WHERE device_id = $1 AND received_at >= $2
+		ORDER BY received_at DESC
+		LIMIT $3`
+
+	if err := r.db.SelectContext(ctx, &heartbeats, query, deviceID, since, limit); err != nil {
+		return nil, fmt.Errorf("failed to get heartbeats: %w", err)
+	}
+
+	return heartbeats, nil
+}
+
+// DeleteOlderThan видаляє показники, отримані до вказаного часу, та повертає кількість видалених
+func (r *deviceHeartbeatRepository) DeleteOlderThan(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM device_heartbeats WHERE received_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete old heartbeats: %w", err)
+	}
+
+	return result.RowsAffected()
+}
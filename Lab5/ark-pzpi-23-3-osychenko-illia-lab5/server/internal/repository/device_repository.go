@@ -3,15 +3,35 @@ package repository
 import (
 	"busoptima/internal/model"
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// Порушення унікальності пристроїв
+var (
+	// ErrDeviceSerialExists повертається, якщо пристрій з таким серійним номером вже зареєстровано
+	ErrDeviceSerialExists = errors.New("device with this serial number already exists")
+	// ErrBusAlreadyBound повертається, якщо до автобуса вже прив'язано інший пристрій
+	ErrBusAlreadyBound = errors.New("bus already has a bound device")
 )
 
 // DeviceRepository інтерфейс для роботи з IoT-пристроями
 type DeviceRepository interface {
+	Create(ctx context.Context, device *model.Device) error
+	GetByID(ctx context.Context, id int64) (*model.Device, error)
 	GetBySerialNumber(ctx context.Context, serialNumber string) (*model.Device, error)
+	GetByBusID(ctx context.Context, busID int64) (*model.Device, error)
+	GetAll(ctx context.Context) ([]model.Device, error)
+	UpdateBus(ctx context.Context, deviceID int64, busID *int64) error
+	UpdateAuthTokenHash(ctx context.Context, deviceID int64, authTokenHash string) error
+	Deactivate(ctx context.Context, deviceID int64) error
 	UpdateLastSync(ctx context.Context, deviceID int64) error
+	UpdateFirmwareVersion(ctx context.Context, deviceID int64, version string) error
+	UpdateGroup(ctx context.Context, deviceID int64, group *string) error
 }
 
 // deviceRepository реалізація DeviceRepository
@@ -24,32 +44,190 @@ func NewDeviceRepository(db *sqlx.DB) DeviceRepository {
 	return &deviceRepository{db: db}
 }
 
-// GetBySerialNumber повертає пристрій за серійним номером
-func (r *deviceRepository) GetBySerialNumber(ctx context.Context, serialNumber string) (*model.Device, error) {
-	var device model.Device
-	query := `
-		SELECT d.id, d.serial_number, d.auth_token_hash, d.bus_id, 
-			d.firmware_version, d.last_sync_at, d.is_active,
+// selectDeviceQuery базовий запит пристрою разом з даними прив'язаного автобуса
+const selectDeviceQuery = `
+		SELECT d.id, d.serial_number, d.auth_token_hash, d.bus_id,
+			d.firmware_version, d.last_sync_at, d.last_heartbeat_at, d.device_group, d.is_active,
 			b.registration_number, b.capacity, b.model, b.fuel_consumption_per_100km
 		FROM devices d
-		LEFT JOIN buses b ON d.bus_id = b.id
-		WHERE d.serial_number = $1 AND d.is_active = true`
+		LEFT JOIN buses b ON d.bus_id = b.id`
+
+// Create реєструє новий пристрій
+func (r *deviceRepository) Create(ctx context.Context, device *model.Device) error {
+	query := `
+		INSERT INTO devices (serial_number, auth_token_hash, bus_id, firmware_version, is_active)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`
+
+	err := r.db.QueryRowContext(ctx, query,
+		device.SerialNumber, device.AuthTokenHash, device.BusID, device.FirmwareVersion, device.IsActive,
+	).Scan(&device.ID)
+
+	if err != nil {
+		return mapDeviceConstraintError(err, "failed to create device")
+	}
+
+	return nil
+}
+
+// GetByID повертає пристрій за ідентифікатором (включно з неактивними)
+func (r *deviceRepository) GetByID(ctx context.Context, id int64) (*model.Device, error) {
+	device, err := scanDevice(r.db.QueryRowContext(ctx, selectDeviceQuery+` WHERE d.id = $1`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("device with id %d %w", id, ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get device: %w", err)
+	}
+
+	return device, nil
+}
+
+// GetBySerialNumber повертає пристрій за серійним номером
+func (r *deviceRepository) GetBySerialNumber(ctx context.Context, serialNumber string) (*model.Device, error) {
+	device, err := scanDevice(r.db.QueryRowContext(ctx, selectDeviceQuery+` WHERE d.serial_number = $1 AND d.is_active = true`, serialNumber))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device: %w", err)
+	}
 
-	row := r.db.QueryRowContext(ctx, query, serialNumber)
+	return device, nil
+}
+
+// GetByBusID повертає пристрій, прив'язаний до автобуса
+func (r *deviceRepository) GetByBusID(ctx context.Context, busID int64) (*model.Device, error) {
+	device, err := scanDevice(r.db.QueryRowContext(ctx, selectDeviceQuery+` WHERE d.bus_id = $1`, busID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get device by bus: %w", err)
+	}
+
+	return device, nil
+}
+
+// GetAll повертає список всіх пристроїв
+func (r *deviceRepository) GetAll(ctx context.Context) ([]model.Device, error) {
+	rows, err := r.db.QueryContext(ctx, selectDeviceQuery+` ORDER BY d.serial_number`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get devices: %w", err)
+	}
+	defer rows.Close()
+
+	var devices []model.Device
+	for rows.Next() {
+		device, err := scanDevice(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan device: %w", err)
+		}
+		devices = append(devices, *device)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate devices: %w", err)
+	}
+
+	return devices, nil
+}
+
+// UpdateBus прив'язує пристрій до автобуса або відв'язує його (busID = nil)
+func (r *deviceRepository) UpdateBus(ctx context.Context, deviceID int64, busID *int64) error {
+	query := `UPDATE devices SET bus_id = $1 WHERE id = $2`
+
+	result, err := r.db.ExecContext(ctx, query, busID, deviceID)
+	if err != nil {
+		return mapDeviceConstraintError(err, "failed to update device bus")
+	}
+
+	return checkDeviceRowsAffected(result, deviceID)
+}
+
+// UpdateAuthTokenHash замінює хеш секрету пристрою
+func (r *deviceRepository) UpdateAuthTokenHash(ctx context.Context, deviceID int64, authTokenHash string) error {
+	query := `UPDATE devices SET auth_token_hash = $1 WHERE id = $2`
+
+	result, err := r.db.ExecContext(ctx, query, authTokenHash, deviceID)
+	if err != nil {
+		return fmt.Errorf("failed to update device secret: %w", err)
+	}
+
+	return checkDeviceRowsAffected(result, deviceID)
+}
+
+// Deactivate деактивує пристрій та звільняє автобус для іншого пристрою
+func (r *deviceRepository) Deactivate(ctx context.Context, deviceID int64) error {
+	query := `UPDATE devices SET is_active = false, bus_id = NULL WHERE id = $1`
+
+	result, err := r.db.ExecContext(ctx, query, deviceID)
+	if err != nil {
+		return fmt.Errorf("failed to deactivate device: %w", err)
+	}
+
+	return checkDeviceRowsAffected(result, deviceID)
+}
+
+// UpdateLastSync оновлює час останньої синхронізації пристрою
+func (r *deviceRepository) UpdateLastSync(ctx context.Context, deviceID int64) error {
+	query := `UPDATE devices SET last_sync_at = CURRENT_TIMESTAMP WHERE id = $1`
+
+	result, err := r.db.ExecContext(ctx, query, deviceID)
+	if err != nil {
+		return fmt.Errorf("failed to update last sync: %w", err)
+	}
+
+	return checkDeviceRowsAffected(result, deviceID)
+}
+
+// UpdateFirmwareVersion зберігає версію прошивки, про яку повідомив пристрій
+func (r *deviceRepository) UpdateFirmwareVersion(ctx context.Context, deviceID int64, version string) error {
+	query := `UPDATE devices SET firmware_version = $1 WHERE id = $2`
+
+	result, err := r.db.ExecContext(ctx, query, version, deviceID)
+	if err != nil {
+		return fmt.Errorf("failed to update firmware version: %w", err)
+	}
+
+	return checkDeviceRowsAffected(result, deviceID)
+}
+
+// UpdateGroup змінює групу пристрою (group = nil прибирає пристрій з групи)
+func (r *deviceRepository) UpdateGroup(ctx context.Context, deviceID int64, group *string) error {
+	query := `UPDATE devices SET device_group = $1 WHERE id = $2`
+
+	result, err := r.db.ExecContext(ctx, query, group, deviceID)
+	if err != nil {
+		return fmt.Errorf("failed to update device group: %w", err)
+	}
+
+	return checkDeviceRowsAffected(result, deviceID)
+}
+
+// rowScanner спільний інтерфейс для *sql.Row та *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanDevice зчитує пристрій разом з даними автобуса з LEFT JOIN
+func scanDevice(row rowScanner) (*model.Device, error) {
+	var device model.Device
 
 	// Use nullable types for LEFT JOIN fields
+	var firmwareVersion *string
 	var busRegistrationNumber, busModel *string
 	var busCapacity *int
 	var busFuelConsumption *float64
 
 	err := row.Scan(
 		&device.ID, &device.SerialNumber, &device.AuthTokenHash, &device.BusID,
-		&device.FirmwareVersion, &device.LastSyncAt, &device.IsActive,
+		&firmwareVersion, &device.LastSyncAt, &device.LastHeartbeatAt, &device.DeviceGroup, &device.IsActive,
 		&busRegistrationNumber, &busCapacity, &busModel, &busFuelConsumption,
 	)
-
 	if err != nil {
-		return nil, fmt.Errorf("failed to get device: %w", err)
+		return nil, err
+	}
+
+	if firmwareVersion != nil {
+		device.FirmwareVersion = *firmwareVersion
 	}
 
 	// Only set bus if we have bus data
@@ -58,32 +236,41 @@ func (r *deviceRepository) GetBySerialNumber(ctx context.Context, serialNumber s
 			ID:                      *device.BusID,
 			RegistrationNumber:      *busRegistrationNumber,
 			Capacity:                *busCapacity,
-			Model:                   *busModel,
 			FuelConsumptionPer100km: *busFuelConsumption,
 		}
+		if busModel != nil {
+			bus.Model = *busModel
+		}
 		device.Bus = &bus
 	}
 
 	return &device, nil
 }
 
-// UpdateLastSync оновлює час останньої синхронізації пристрою
-func (r *deviceRepository) UpdateLastSync(ctx context.Context, deviceID int64) error {
-	query := `UPDATE devices SET last_sync_at = CURRENT_TIMESTAMP WHERE id = $1`
-
-	result, err := r.db.ExecContext(ctx, query, deviceID)
-	if err != nil {
-		return fmt.Errorf("failed to update last sync: %w", err)
-	}
-
+// checkDeviceRowsAffected повертає помилку, якщо пристрій не знайдено
+func checkDeviceRowsAffected(result sql.Result, deviceID int64) error {
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return fmt.Errorf("failed to get rows affected: %w", err)
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("device with id %d not found", deviceID)
+		return fmt.Errorf("device with id %d %w", deviceID, ErrNotFound)
 	}
 
 	return nil
 }
+
+// mapDeviceConstraintError перетворює порушення унікальності на ErrBusAlreadyBound або ErrDeviceSerialExists
+func mapDeviceConstraintError(err error, message string) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		switch pqErr.Constraint {
+		case "devices_bus_id_key":
+			return ErrBusAlreadyBound
+		case "devices_serial_number_key":
+			return ErrDeviceSerialExists
+		}
+	}
+	return fmt.Errorf("%s: %w", message, err)
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"busoptima/internal/model"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// redactedEmailBody замінює текст листа з одноразовим токеном, коли лист більше не потрібен
+const redactedEmailBody = "[вміст видалено: лист містив одноразовий токен]"
+
+// EmailOutboxRepository інтерфейс для роботи з чергою вихідних листів
+type EmailOutboxRepository interface {
+	Enqueue(ctx context.Context, email *model.OutboxEmail) error
+	ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]model.OutboxEmail, error)
+	MarkSent(ctx context.Context, id int64) error
+	MarkFailed(ctx context.Context, id int64, lastError string, nextAttemptAt *time.Time) error
+}
+
+// emailOutboxRepository реалізація EmailOutboxRepository
+type emailOutboxRepository struct {
+	db *sqlx.DB
+}
+
+// NewEmailOutboxRepository створює новий екземпляр репозиторію черги листів
+func NewEmailOutboxRepository(db *sqlx.DB) EmailOutboxRepository {
+	return &emailOutboxRepository{db: db}
+}
+
+// Enqueue додає лист до черги відправлення
+func (r *emailOutboxRepository) Enqueue(ctx context.Context, email *model.OutboxEmail) error {
+	return enqueueEmail(ctx, r.db, email)
+}
+
+// enqueueEmail додає лист до черги. Приймає і транзакцію, щоб лист потрапив у чергу
+// лише разом зі змінами, яких він стосується
+func enqueueEmail(ctx context.Context, q sqlx.QueryerContext, email *model.OutboxEmail) error {
+	query := `
+		INSERT INTO email_outbox (recipient, subject, body, sensitive)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, status, next_attempt_at, created_at`
+
+	err := q.QueryRowxContext(ctx, query, email.Recipient, email.Subject, email.Body, email.Sensitive).
+		Scan(&email.ID, &email.Status, &email.NextAttemptAt, &email.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to enqueue email: %w", err)
+	}
+
+	return nil
+}
+
+// ClaimPending забирає листи, готові до відправлення, та відкладає їх на час lease,
+// щоб інші інстанси не відправили ті самі листи одночасно
+func (r *emailOutboxRepository) ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]model.OutboxEmail, error) {
+	var emails []model.OutboxEmail
+	query := `
+		UPDATE email_outbox SET
+			attempts = attempts + 1,
+			next_attempt_at = CURRENT_TIMESTAMP + $2 * INTERVAL '1 second'
+		WHERE id IN (
+			SELECT id FROM email_outbox
+			WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, recipient, subject, body, sensitive, status, attempts, last_error,
+			next_attempt_at, created_at, sent_at`
+
+	if err := r.db.SelectContext(ctx, &emails, query, limit, lease.Seconds()); err != nil {
+		return nil, fmt.Errorf("failed to claim pending emails: %w", err)
+	}
+
+	return emails, nil
+}
+
+// MarkSent позначає лист як відправлений. Текст листа з одноразовим токеном після відправлення видаляється
+func (r *emailOutboxRepository) MarkSent(ctx context.Context, id int64) error {
+	query := `
+		UPDATE email_outbox SET
+			status = 'sent',
+			sent_at = CURRENT_TIMESTAMP,
+			last_error = NULL,
+			body = CASE WHEN sensitive THEN $2 ELSE body END
+		WHERE id = $1`
+
+	if _, err := r.db.ExecContext(ctx, query, id, redactedEmailBody); err != nil {
+		return fmt.Errorf("failed to mark email as sent: %w", err)
+	}
+
+	return nil
+}
+
+// MarkFailed фіксує помилку відправлення. Якщо nextAttemptAt = nil, лист більше не відправляється,
+// і текст листа з одноразовим токеном видаляється
+func (r *emailOutboxRepository) MarkFailed(ctx context.Context, id int64, lastError string, nextAttemptAt *time.Time) error {
+	query := `
+		UPDATE email_outbox SET
+			status = CASE WHEN $3::timestamptz IS NULL THEN 'failed' ELSE 'pending' END,
+			next_attempt_at = COALESCE($3, next_attempt_at),
+			last_error = $2,
+			body = CASE WHEN sensitive AND $3::timestamptz IS NULL THEN $4 ELSE body END
+		WHERE id = $1`
+
+	if _, err := r.db.ExecContext(ctx, query, id, lastError, nextAttemptAt, redactedEmailBody); err != nil {
+		return fmt.Errorf("failed to mark email as failed: %w", err)
+	}
+
+	return nil
+}
+
+// discardResetEmails видаляє з черги невідправлені листи з токенами відновлення пароля користувача
+// та прибирає текст вже оброблених. Викликається, коли ці токени втрачають силу
+func discardResetEmails(ctx context.Context, tx *sqlx.Tx, userID int64) error {
+	resetEmails := `SELECT email_id FROM password_reset_tokens WHERE user_id = $1 AND email_id IS NOT NULL`
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM email_outbox WHERE status = 'pending' AND id IN (`+resetEmails+`)`, userID); err != nil {
+		return fmt.Errorf("failed to discard password reset emails: %w", err)
+	}
+
+	redact := `UPDATE email_outbox SET body = $2 WHERE sensitive AND body <> $2 AND id IN (` + resetEmails + `)`
+	if _, err := tx.ExecContext(ctx, redact, userID, redactedEmailBody); err != nil {
+		return fmt.Errorf("failed to redact password reset emails: %w", err)
+	}
+
+	return nil
+}
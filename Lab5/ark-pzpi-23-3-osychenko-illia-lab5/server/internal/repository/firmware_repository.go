@@ -0,0 +1,214 @@
+package repository
+
+import (
+	"busoptima/internal/model"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// FirmwareRepository інтерфейс для роботи з прошивками та їх розгортанням
+type FirmwareRepository interface {
+	CreateRelease(ctx context.Context, release *model.FirmwareRelease, data []byte) error
+	GetReleases(ctx context.Context) ([]model.FirmwareRelease, error)
+	GetRelease(ctx context.Context, id int64) (*model.FirmwareRelease, error)
+	GetReleaseData(ctx context.Context, id int64) ([]byte, error)
+	CreateRollout(ctx context.Context, rollout *model.FirmwareRollout) error
+	GetRollout(ctx context.Context, id int64) (*model.FirmwareRollout, error)
+	GetRollouts(ctx context.Context, activeOnly bool) ([]model.FirmwareRollout, error)
+	UpdateRolloutPercent(ctx context.Context, id int64, percent int) error
+	StopRollout(ctx context.Context, id int64) error
+}
+
+// firmwareRepository реалізація FirmwareRepository
+type firmwareRepository struct {
+	db *sqlx.DB
+}
+
+// NewFirmwareRepository створює новий екземпляр репозиторію прошивок
+func NewFirmwareRepository(db *sqlx.DB) FirmwareRepository {
+	return &firmwareRepository{db: db}
+}
+
+const selectReleaseQuery = `
+		SELECT id, version, checksum_sha256, size_bytes, notes, uploaded_by, created_at
+		FROM firmware_releases`
+
+const selectRolloutQuery = `
+		SELECT r.id, r.firmware_id, f.version AS firmware_version, r.device_id, r.device_group,
+			r.rollout_percent, r.is_active, r.created_by, r.created_at, r.updated_at
+		FROM firmware_rollouts r
+		JOIN firmware_releases f ON r.firmware_id = f.id`
+
+// CreateRelease зберігає прошивку разом з файлом
+func (r *firmwareRepository) CreateRelease(ctx context.Context, release *model.FirmwareRelease, data []byte) error {
+	query := `
+		INSERT INTO firmware_releases (version, checksum_sha256, size_bytes, data, notes, uploaded_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`
+
+	err := r.db.QueryRowContext(ctx, query,
+		release.Version, release.ChecksumSHA256, release.SizeBytes, data, release.Notes, release.UploadedBy,
+	).Scan(&release.ID, &release.CreatedAt)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return fmt.Errorf("firmware version %s already exists", release.Version)
+		}
+		return fmt.Errorf("failed to create firmware release: %w", err)
+	}
+
+	return nil
+}
+
+// GetReleases повертає всі прошивки без файлів, від найновіших
+func (r *firmwareRepository) GetReleases(ctx context.Context) ([]model.FirmwareRelease, error) {
+	releases := []model.FirmwareRelease{}
+	if err := r.db.SelectContext(ctx, &releases, selectReleaseQuery+` ORDER BY created_at DESC`); err != nil {
+		return nil, fmt.Errorf("failed to get firmware releases: %w", err)
+	}
+
+	return releases, nil
+}
+
+// GetRelease повертає прошивку за ідентифікатором без файлу
+func (r *firmwareRepository) GetRelease(ctx context.Context, id int64) (*model.FirmwareRelease, error) {
+	var release model.FirmwareRelease
+	err := r.db.GetContext(ctx, &release, selectReleaseQuery+` WHERE id = $1`, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("firmware release with id %d not found", id)
+		}
+		return nil, fmt.Errorf("failed to get firmware release: %w", err)
+	}
+
+	return &release, nil
+}
+
+// GetReleaseData повертає файл прошивки
+func (r *firmwareRepository) GetReleaseData(ctx context.Context, id int64) ([]byte, error) {
+	var data []byte
+	err := r.db.QueryRowContext(ctx, `SELECT data FROM firmware_releases WHERE id = $1`, id).Scan(&data)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("firmware release with id %d not found", id)
+		}
+		return nil, fmt.Errorf("failed to get firmware data: %w", err)
+	}
+
+	return data, nil
+}
+
+// CreateRollout створює розгортання. Активне розгортання для тієї ж цілі завершується,
+// тож кожен пристрій, група або весь парк мають не більше однієї цільової версії
+func (r *firmwareRepository) CreateRollout(ctx context.Context, rollout *model.FirmwareRollout) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE firmware_rollouts
+		SET is_active = false, updated_at = CURRENT_TIMESTAMP
+		WHERE is_active
+			AND device_id IS NOT DISTINCT FROM $1
+			AND device_group IS NOT DISTINCT FROM $2`,
+		rollout.DeviceID, rollout.DeviceGroup,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to supersede firmware rollout: %w", err)
+	}
+
+	query := `
+		INSERT INTO firmware_rollouts (firmware_id, device_id, device_group, rollout_percent, created_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, is_active, created_at, updated_at`
+
+	err = tx.QueryRowContext(ctx, query,
+		rollout.FirmwareID, rollout.DeviceID, rollout.DeviceGroup, rollout.RolloutPercent, rollout.CreatedBy,
+	).Scan(&rollout.ID, &rollout.IsActive, &rollout.CreatedAt, &rollout.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create firmware rollout: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// GetRollout повертає розгортання за ідентифікатором
+func (r *firmwareRepository) GetRollout(ctx context.Context, id int64) (*model.FirmwareRollout, error) {
+	var rollout model.FirmwareRollout
+	err := r.db.GetContext(ctx, &rollout, selectRolloutQuery+` WHERE r.id = $1`, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("firmware rollout with id %d not found", id)
+		}
+		return nil, fmt.Errorf("failed to get firmware rollout: %w", err)
+	}
+
+	return &rollout, nil
+}
+
+// GetRollouts повертає розгортання від найновіших
+func (r *firmwareRepository) GetRollouts(ctx context.Context, activeOnly bool) ([]model.FirmwareRollout, error) {
+	query := selectRolloutQuery
+	if activeOnly {
+		query += ` WHERE r.is_active`
+	}
+	query += ` ORDER BY r.created_at DESC, r.id DESC`
+
+	rollouts := []model.FirmwareRollout{}
+	if err := r.db.SelectContext(ctx, &rollouts, query); err != nil {
+		return nil, fmt.Errorf("failed to get firmware rollouts: %w", err)
+	}
+
+	return rollouts, nil
+}
+
+// UpdateRolloutPercent змінює частку пристроїв активного розгортання
+func (r *firmwareRepository) UpdateRolloutPercent(ctx context.Context, id int64, percent int) error {
+	query := `
+		UPDATE firmware_rollouts
+		SET rollout_percent = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND is_active`
+
+	result, err := r.db.ExecContext(ctx, query, id, percent)
+	if err != nil {
+		return fmt.Errorf("failed to update firmware rollout: %w", err)
+	}
+
+	return checkRolloutRowsAffected(result, id)
+}
+
+// StopRollout завершує розгортання. Пристрої, що вже оновились, залишаються на новій версії
+func (r *firmwareRepository) StopRollout(ctx context.Context, id int64) error {
+	query := `
+		UPDATE firmware_rollouts
+		SET is_active = false, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND is_active`
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to stop firmware rollout: %w", err)
+	}
+
+	return checkRolloutRowsAffected(result, id)
+}
+
+// checkRolloutRowsAffected повертає помилку, якщо активне розгортання не знайдено
+func checkRolloutRowsAffected(result sql.Result, id int64) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("active firmware rollout with id %d not found", id)
+	}
+
+	return nil
+}
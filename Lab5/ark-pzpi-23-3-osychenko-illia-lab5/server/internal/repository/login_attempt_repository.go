@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"busoptima/internal/model"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// LoginAttemptRepository інтерфейс для роботи з журналом спроб входу
+type LoginAttemptRepository interface {
+	Create(ctx context.Context, attempt *model.LoginAttempt) error
+	GetIPFailures(ctx context.Context, ipAddress string, since time.Time, reasons []string) (int, *time.Time, error)
+}
+
+// loginAttemptRepository реалізація LoginAttemptRepository
+type loginAttemptRepository struct {
+	db *sqlx.DB
+}
+
+// NewLoginAttemptRepository створює новий екземпляр репозиторію спроб входу
+func NewLoginAttemptRepository(db *sqlx.DB) LoginAttemptRepository {
+	return &loginAttemptRepository{db: db}
+}
+
+// Create записує спробу входу
+func (r *loginAttemptRepository) Create(ctx context.Context, attempt *model.LoginAttempt) error {
+	query := `
+		INSERT INTO login_attempts (email, user_id, ip_address, success, reason)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+
+	err := r.db.QueryRowContext(ctx, query,
+		attempt.Email, attempt.UserID, attempt.IPAddress, attempt.Success, attempt.Reason,
+	).Scan(&attempt.ID, &attempt.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to record login attempt: %w", err)
+	}
+
+	return nil
+}
+
+// GetIPFailures повертає кількість невдалих спроб з IP-адреси з однією з вказаних причин
+// після вказаного моменту та час останньої з них
+func (r *loginAttemptRepository) GetIPFailures(ctx context.Context, ipAddress string, since time.Time, reasons []string) (int, *time.Time, error) {
+	query := `
+		SELECT COUNT(*), MAX(created_at)
+		FROM login_attempts
+		WHERE ip_address = $1 AND success = false AND created_at > $2 AND reason = ANY($3)`
+
+	var count int
+	var lastFailure *time.Time
+	if err := r.db.QueryRowContext(ctx, query, ipAddress, since, pq.Array(reasons)).Scan(&count, &lastFailure); err != nil {
+		return 0, nil, fmt.Errorf("failed to get login failures: %w", err)
+	}
+
+	return count, lastFailure, nil
+}
@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"busoptima/internal/model"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// ErrIdentityLinked повертається, якщо обліковий запис провайдера вже прив'язано до користувача
+var ErrIdentityLinked = errors.New("identity is already linked to a user")
+
+// OIDCRepository інтерфейс для роботи зі станами входу OIDC та прив'язаними обліковими записами
+type OIDCRepository interface {
+	CreateLoginState(ctx context.Context, state *model.OIDCLoginState) error
+	ConsumeLoginState(ctx context.Context, stateHash, codeChallenge string) (*model.OIDCLoginState, error)
+	GetIdentity(ctx context.Context, issuer, subject string) (*model.UserIdentity, error)
+	CreateIdentity(ctx context.Context, identity *model.UserIdentity) error
+	CreateUserWithIdentity(ctx context.Context, user *model.User, identity *model.UserIdentity) error
+	TouchIdentity(ctx context.Context, issuer, subject string, email *string) error
+}
+
+// oidcRepository реалізація OIDCRepository
+type oidcRepository struct {
+	db *sqlx.DB
+}
+
+// NewOIDCRepository створює новий екземпляр репозиторію OIDC
+func NewOIDCRepository(db *sqlx.DB) OIDCRepository {
+	return &oidcRepository{db: db}
+}
+
+// CreateLoginState зберігає стан нового входу та видаляє прострочені
+func (r *oidcRepository) CreateLoginState(ctx context.Context, state *model.OIDCLoginState) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM oidc_login_states WHERE expires_at < CURRENT_TIMESTAMP`); err != nil {
+		return fmt.Errorf("failed to delete expired login states: %w", err)
+	}
+
+	query := `
+		INSERT INTO oidc_login_states (state_hash, nonce, code_challenge, link_user_id, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+
+	err := r.db.QueryRowContext(ctx, query,
+		state.StateHash, state.Nonce, state.CodeChallenge, state.LinkUserID, state.ExpiresAt,
+	).Scan(&state.ID, &state.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create login state: %w", err)
+	}
+
+	return nil
+}
+
+// ConsumeLoginState атомарно видаляє та повертає дійсний стан входу.
+// Стан знаходиться лише разом з code_challenge клієнта, що почав вхід, тож чужий запит його не витратить.
+// Повторний виклик з тим самим state поверне помилку
+func (r *oidcRepository) ConsumeLoginState(ctx context.Context, stateHash, codeChallenge string) (*model.OIDCLoginState, error) {
+	var state model.OIDCLoginState
+	query := `
+		DELETE FROM oidc_login_states
+		WHERE state_hash = $1 AND code_challenge = $2 AND expires_at > CURRENT_TIMESTAMP
+		RETURNING id, state_hash, nonce, code_challenge, link_user_id, expires_at, created_at`
+
+	err := r.db.GetContext(ctx, &state, query, stateHash, codeChallenge)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("login state not found")
+		}
+		return nil, fmt.Errorf("failed to consume login state: %w", err)
+	}
+
+	return &state, nil
+}
+
+// GetIdentity повертає прив'язаний обліковий запис або nil, якщо його немає
+func (r *oidcRepository) GetIdentity(ctx context.Context, issuer, subject string) (*model.UserIdentity, error) {
+	var identity model.UserIdentity
+	query := `
+		SELECT issuer, subject, user_id, email, created_at, last_login_at
+		FROM user_identities
+		WHERE issuer = $1 AND subject = $2`
+
+	err := r.db.GetContext(ctx, &identity, query, issuer, subject)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get identity: %w", err)
+	}
+
+	return &identity, nil
+}
+
+// CreateIdentity прив'язує обліковий запис провайдера до користувача
+func (r *oidcRepository) CreateIdentity(ctx context.Context, identity *model.UserIdentity) error {
+	query := `
+		INSERT INTO user_identities (issuer, subject, user_id, email, last_login_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+		RETURNING created_at, last_login_at`
+
+	err := r.db.QueryRowContext(ctx, query,
+		identity.Issuer, identity.Subject, identity.UserID, identity.Email,
+	).Scan(&identity.CreatedAt, &identity.LastLoginAt)
+
+	if err != nil {
+		return mapIdentityError(err)
+	}
+
+	return nil
+}
+
+// CreateUserWithIdentity створює користувача без локального пароля та прив'язує до нього обліковий запис провайдера.
+// Обидва записи створюються в одній транзакції, тож користувач не залишиться без прив'язки
+func (r *oidcRepository) CreateUserWithIdentity(ctx context.Context, user *model.User, identity *model.UserIdentity) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO users (email, password_hash, full_name, role_id, is_active)
+		VALUES ($1, '', $2, $3, true)
+		RETURNING id, is_active, created_at, updated_at`,
+		user.Email, user.FullName, user.RoleID,
+	).Scan(&user.ID, &user.IsActive, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+	user.PasswordHash = ""
+
+	identity.UserID = user.ID
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO user_identities (issuer, subject, user_id, email, last_login_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+		RETURNING created_at, last_login_at`,
+		identity.Issuer, identity.Subject, identity.UserID, identity.Email,
+	).Scan(&identity.CreatedAt, &identity.LastLoginAt)
+	if err != nil {
+		return mapIdentityError(err)
+	}
+
+	return tx.Commit()
+}
+
+// TouchIdentity оновлює час останнього входу та email з провайдера
+func (r *oidcRepository) TouchIdentity(ctx context.Context, issuer, subject string, email *string) error {
+	query := `
+		UPDATE user_identities SET last_login_at = CURRENT_TIMESTAMP, email = $3
+		WHERE issuer = $1 AND subject = $2`
+
+	if _, err := r.db.ExecContext(ctx, query, issuer, subject, email); err != nil {
+		return fmt.Errorf("failed to update identity: %w", err)
+	}
+
+	return nil
+}
+
+// mapIdentityError перетворює порушення унікальності (issuer, subject) на ErrIdentityLinked
+func mapIdentityError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "user_identities_pkey" {
+		return ErrIdentityLinked
+	}
+	return fmt.Errorf("failed to create identity: %w", err)
+}
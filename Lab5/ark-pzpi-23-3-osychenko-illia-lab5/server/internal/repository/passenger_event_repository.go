@@ -2,15 +2,31 @@ package repository
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"busoptima/internal/model"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 // PassengerEventRepository інтерфейс для роботи з подіями пасажирів
 type PassengerEventRepository interface {
-	BatchCreate(ctx context.Context, events []model.PassengerEvent) error
+	LockTrip(ctx context.Context, tripID int64, fn func(events TripEvents) error) error
 	GetByTripID(ctx context.Context, tripID int64) ([]model.PassengerEvent, error)
+	GetQuarantined(ctx context.Context, tripID int64) ([]model.QuarantinedEvent, error)
+	ReviewQuarantined(ctx context.Context, tripID, id, reviewerID int64, note string) error
+}
+
+// TripEvents операції з подіями рейсу в транзакції, що тримає блокування рейсу.
+// Синхронізації та перерахунки одного рейсу виконуються по черзі, а їх зміни зберігаються разом
+type TripEvents interface {
+	GetEvents(ctx context.Context) ([]model.PassengerEvent, error)
+	GetReceivedLocalIDs(ctx context.Context, deviceID int64, localIDs []int) (map[int]bool, error)
+	Quarantine(ctx context.Context, events []model.QuarantinedEvent) ([]bool, error)
+	Create(ctx context.Context, deviceID int64, events []model.PassengerEvent) ([]bool, error)
+	GetPendingQuarantined(ctx context.Context) ([]model.QuarantinedEvent, error)
+	ReleaseQuarantined(ctx context.Context, id int64, event *model.PassengerEvent) error
+	RecomputeOccupancy(ctx context.Context) (*model.OccupancyRecompute, error)
 }
 
 // passengerEventRepository реалізація PassengerEventRepository
@@ -23,44 +39,34 @@ func NewPassengerEventRepository(db *sqlx.DB) PassengerEventRepository {
 	return &passengerEventRepository{db: db}
 }
 
-// BatchCreate створює пакет подій через транзакцію
-func (r *passengerEventRepository) BatchCreate(ctx context.Context, events []model.PassengerEvent) error {
-	if len(events) == 0 {
-		return nil
-	}
-	
+// LockTrip блокує рейс (SELECT ... FOR UPDATE) і виконує fn в одній транзакції з ним.
+// Якщо fn повертає помилку, жодна зміна не зберігається
+func (r *passengerEventRepository) LockTrip(ctx context.Context, tripID int64, fn func(events TripEvents) error) error {
 	tx, err := r.db.BeginTxx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 	
-	query := `
-		INSERT INTO passenger_events (trip_id, event_type, timestamp, latitude, 
-			longitude, passenger_count_after, device_local_id, is_synced)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	events := &tripEvents{tx: tx, tripID: tripID}
 	
-	for _, event := range events {
-		_, err := tx.ExecContext(ctx, query,
-			event.TripID, event.EventType, event.Timestamp, event.Latitude,
-			event.Longitude, event.PassengerCountAfter, event.DeviceLocalID, true,
-		)
-		if err != nil {
-			return fmt.Errorf("failed to insert event: %w", err)
+	query := `SELECT current_passengers FROM trips WHERE id = $1 FOR UPDATE`
+	if err := tx.GetContext(ctx, &events.currentPassengers, query, tripID); err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("trip with id %d %w", tripID, ErrNotFound)
 		}
+		return fmt.Errorf("failed to lock trip: %w", err)
 	}
 	
-	// Оновлюємо поточну кількість пасажирів у рейсі
-	if len(events) > 0 {
-		lastEvent := events[len(events)-1]
-		updateQuery := `UPDATE trips SET current_passengers = $1 WHERE id = $2`
-		_, err := tx.ExecContext(ctx, updateQuery, lastEvent.PassengerCountAfter, lastEvent.TripID)
-		if err != nil {
-			return fmt.Errorf("failed to update trip passenger count: %w", err)
-		}
+	if err := fn(events); err != nil {
+		return err
+	}
+	
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit trip events: %w", err)
 	}
 	
-	return tx.Commit()
+	return nil
 }
 
 // GetByTripID повертає всі події для конкретного рейсу
@@ -77,4 +83,293 @@ func (r *passengerEventRepository) GetByTripID(ctx context.Context, tripID int64
 	}
 	
 	return events, nil
-}
\ No newline at end of file
+}
+
+// GetQuarantined повертає відкладені події рейсу
+func (r *passengerEventRepository) GetQuarantined(ctx context.Context, tripID int64) ([]model.QuarantinedEvent, error) {
+	events := []model.QuarantinedEvent{}
+	query := `
+		SELECT * FROM passenger_event_quarantine
+		WHERE trip_id = $1
+		ORDER BY timestamp ASC, id ASC`
+	
+	if err := r.db.SelectContext(ctx, &events, query, tripID); err != nil {
+		return nil, fmt.Errorf("failed to get quarantined events: %w", err)
+	}
+	
+	return events, nil
+}
+
+// ReviewQuarantined позначає відкладену подію рейсу переглянутою (reviewerID 0 - запит з API ключем)
+func (r *passengerEventRepository) ReviewQuarantined(ctx context.Context, tripID, id, reviewerID int64, note string) error {
+	query := `
+		UPDATE passenger_event_quarantine
+		SET reviewed_by = NULLIF($3, 0), reviewed_at = NOW(), review_note = NULLIF($4, '')
+		WHERE id = $1 AND trip_id = $2`
+	
+	result, err := r.db.ExecContext(ctx, query, id, tripID, reviewerID, note)
+	if err != nil {
+		return fmt.Errorf("failed to review quarantined event: %w", err)
+	}
+	
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("quarantined event with id %d %w", id, ErrNotFound)
+	}
+	
+	return nil
+}
+
+// tripEvents реалізація TripEvents
+type tripEvents struct {
+	tx                *sqlx.Tx
+	tripID            int64
+	currentPassengers int
+}
+
+// GetEvents повертає збережені події рейсу в порядку часу
+func (t *tripEvents) GetEvents(ctx context.Context) ([]model.PassengerEvent, error) {
+	var events []model.PassengerEvent
+	query := `
+		SELECT * FROM passenger_events
+		WHERE trip_id = $1
+		ORDER BY timestamp ASC, id ASC`
+	
+	if err := t.tx.SelectContext(ctx, &events, query, t.tripID); err != nil {
+		return nil, fmt.Errorf("failed to get passenger events: %w", err)
+	}
+	
+	return events, nil
+}
+
+// GetReceivedLocalIDs повертає local_id, які пристрій вже надсилав для рейсу
+func (t *tripEvents) GetReceivedLocalIDs(ctx context.Context, deviceID int64, localIDs []int) (map[int]bool, error) {
+	received := make(map[int]bool)
+	if len(localIDs) == 0 {
+		return received, nil
+	}
+	
+	ids := make([]int64, len(localIDs))
+	for i, id := range localIDs {
+		ids[i] = int64(id)
+	}
+	
+	var found []int
+	query := `
+		SELECT device_local_id FROM passenger_event_receipts
+		WHERE device_id = $1 AND trip_id = $2 AND device_local_id = ANY($3)`
+	
+	if err := t.tx.SelectContext(ctx, &found, query, deviceID, t.tripID, pq.Array(ids)); err != nil {
+		return nil, fmt.Errorf("failed to get event receipts: %w", err)
+	}
+	
+	for _, id := range found {
+		received[id] = true
+	}
+	return received, nil
+}
+
+// Create зберігає пакет подій пристрою.
+// Події, які пристрій вже надсилав для рейсу з тим самим device_local_id, повторно не зберігаються.
+// Повертає для кожної події ознаку, чи її збережено
+func (t *tripEvents) Create(ctx context.Context, deviceID int64, events []model.PassengerEvent) ([]bool, error) {
+	inserted := make([]bool, len(events))
+	if len(events) == 0 {
+		return inserted, nil
+	}
+	
+	receiptQuery := `
+		INSERT INTO passenger_event_receipts (device_id, trip_id, device_local_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING`
+	
+	query := `
+		INSERT INTO passenger_events (trip_id, event_type, timestamp, latitude, 
+			longitude, passenger_count_after, reported_count, device_local_id, is_synced)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	
+	stored := false
+	for i, event := range events {
+		// Квитанція фіксує local_id; якщо вона вже є, подію отримано раніше
+		result, err := t.tx.ExecContext(ctx, receiptQuery, deviceID, t.tripID, event.DeviceLocalID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record event receipt: %w", err)
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			continue
+		}
+		
+		_, err = t.tx.ExecContext(ctx, query,
+			t.tripID, event.EventType, event.Timestamp, event.Latitude,
+			event.Longitude, event.PassengerCountAfter, event.ReportedCount, event.DeviceLocalID, true,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert event: %w", err)
+		}
+		
+		inserted[i] = true
+		stored = true
+	}
+	
+	// Поточна кількість пасажирів береться з найпізнішої за часом події рейсу, а не з останньої в пакеті,
+	// щоб затриманий пакет не перезаписав новіший стан
+	if stored {
+		if err := updateTripOccupancy(ctx, t.tx, t.tripID); err != nil {
+			return nil, err
+		}
+	}
+	
+	return inserted, nil
+}
+
+// Quarantine зберігає події, відкладені для перевірки. Як і Create, пропускає повторно надіслані
+// події та повертає для кожної ознаку, чи її збережено
+func (t *tripEvents) Quarantine(ctx context.Context, events []model.QuarantinedEvent) ([]bool, error) {
+	inserted := make([]bool, len(events))
+	if len(events) == 0 {
+		return inserted, nil
+	}
+	
+	receiptQuery := `
+		INSERT INTO passenger_event_receipts (device_id, trip_id, device_local_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING`
+	
+	query := `
+		INSERT INTO passenger_event_quarantine (device_id, trip_id, event_type, timestamp,
+			latitude, longitude, passenger_count_after, running_count, device_local_id, reason)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+	
+	for i, event := range events {
+		result, err := t.tx.ExecContext(ctx, receiptQuery, event.DeviceID, t.tripID, event.DeviceLocalID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record event receipt: %w", err)
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			continue
+		}
+		
+		_, err = t.tx.ExecContext(ctx, query,
+			event.DeviceID, t.tripID, event.EventType, event.Timestamp, event.Latitude,
+			event.Longitude, event.PassengerCountAfter, event.RunningCount, event.DeviceLocalID, event.Reason,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to quarantine event: %w", err)
+		}
+		
+		inserted[i] = true
+	}
+	
+	return inserted, nil
+}
+
+// GetPendingQuarantined повертає відкладені події рейсу, які ще не переглянуто, в порядку часу
+func (t *tripEvents) GetPendingQuarantined(ctx context.Context) ([]model.QuarantinedEvent, error) {
+	events := []model.QuarantinedEvent{}
+	query := `
+		SELECT * FROM passenger_event_quarantine
+		WHERE trip_id = $1 AND reviewed_at IS NULL
+		ORDER BY timestamp ASC, id ASC`
+	
+	if err := t.tx.SelectContext(ctx, &events, query, t.tripID); err != nil {
+		return nil, fmt.Errorf("failed to get quarantined events: %w", err)
+	}
+	
+	return events, nil
+}
+
+// ReleaseQuarantined переносить відкладену подію до подій рейсу. Квитанція local_id вже збережена
+// при карантині, тому повторне надсилання події пристроєм і далі вважається дублікатом
+func (t *tripEvents) ReleaseQuarantined(ctx context.Context, id int64, event *model.PassengerEvent) error {
+	result, err := t.tx.ExecContext(ctx, `DELETE FROM passenger_event_quarantine WHERE id = $1 AND trip_id = $2`, id, t.tripID)
+	if err != nil {
+		return fmt.Errorf("failed to release quarantined event: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("quarantined event %d %w", id, ErrNotFound)
+	}
+	
+	query := `
+		INSERT INTO passenger_events (trip_id, event_type, timestamp, latitude, 
+			longitude, passenger_count_after, reported_count, device_local_id, is_synced)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	
+	_, err = t.tx.ExecContext(ctx, query,
+		t.tripID, event.EventType, event.Timestamp, event.Latitude,
+		event.Longitude, event.PassengerCountAfter, event.ReportedCount, event.DeviceLocalID, true,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert released event: %w", err)
+	}
+	
+	return nil
+}
+
+// RecomputeOccupancy перераховує passenger_count_after усіх подій рейсу в порядку часу
+// та оновлює поточну кількість пасажирів. Кількість не опускається нижче нуля; виходи, на яких
+// її довелося обмежити, повертаються в ClampedEventIDs. Початкове значення від пристрою зберігається в reported_count
+func (t *tripEvents) RecomputeOccupancy(ctx context.Context) (*model.OccupancyRecompute, error) {
+	recompute := &model.OccupancyRecompute{TripID: t.tripID, PreviousPassengers: t.currentPassengers, ClampedEventIDs: []int64{}}
+	
+	events, err := t.GetEvents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	updateQuery := `
+		UPDATE passenger_events
+		SET passenger_count_after = $3, reported_count = COALESCE(reported_count, passenger_count_after)
+		WHERE id = $1 AND timestamp = $2`
+	
+	count := 0
+	for _, event := range events {
+		if event.EventType == "exit" {
+			if count > 0 {
+				count--
+			} else {
+				recompute.ClampedEventIDs = append(recompute.ClampedEventIDs, event.ID)
+			}
+		} else {
+			count++
+		}
+		
+		if event.PassengerCountAfter == count {
+			continue
+		}
+		
+		if _, err := t.tx.ExecContext(ctx, updateQuery, event.ID, event.Timestamp, count); err != nil {
+			return nil, fmt.Errorf("failed to update event count: %w", err)
+		}
+		recompute.EventsUpdated++
+	}
+	
+	recompute.EventsProcessed = len(events)
+	recompute.CurrentPassengers = count
+	t.currentPassengers = count
+	
+	if _, err := t.tx.ExecContext(ctx, `UPDATE trips SET current_passengers = $1 WHERE id = $2`, count, t.tripID); err != nil {
+		return nil, fmt.Errorf("failed to update trip passenger count: %w", err)
+	}
+	
+	return recompute, nil
+}
+
+// updateTripOccupancy встановлює кількість пасажирів рейсу з найпізнішої за часом події
+func updateTripOccupancy(ctx context.Context, tx *sqlx.Tx, tripID int64) error {
+	query := `
+		UPDATE trips SET current_passengers = COALESCE((
+			SELECT passenger_count_after FROM passenger_events
+			WHERE trip_id = $1
+			ORDER BY timestamp DESC, id DESC
+			LIMIT 1
+		), 0)
+		WHERE id = $1`
+	
+	if _, err := tx.ExecContext(ctx, query, tripID); err != nil {
+		return fmt.Errorf("failed to update trip passenger count: %w", err)
+	}
+	return nil
+}
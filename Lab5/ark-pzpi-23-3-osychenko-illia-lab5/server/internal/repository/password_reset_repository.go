@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"busoptima/internal/model"
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// PasswordResetRepository інтерфейс для роботи з токенами відновлення пароля
+type PasswordResetRepository interface {
+	Create(ctx context.Context, token *model.PasswordResetToken, email *model.OutboxEmail) error
+	GetByHash(ctx context.Context, tokenHash string) (*model.PasswordResetToken, error)
+	Consume(ctx context.Context, token *model.PasswordResetToken, passwordHash string) (bool, error)
+	CountRecentForUser(ctx context.Context, userID int64, since time.Time) (int, error)
+}
+
+// passwordResetRepository реалізація PasswordResetRepository
+type passwordResetRepository struct {
+	db *sqlx.DB
+}
+
+// NewPasswordResetRepository створює новий екземпляр репозиторію токенів відновлення пароля
+func NewPasswordResetRepository(db *sqlx.DB) PasswordResetRepository {
+	return &passwordResetRepository{db: db}
+}
+
+// Create зберігає новий токен відновлення пароля та ставить лист з ним у чергу в одній транзакції.
+// Попередні невикористані токени користувача стають недійсними, а листи з ними видаляються з черги
+func (r *passwordResetRepository) Create(ctx context.Context, token *model.PasswordResetToken, email *model.OutboxEmail) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	invalidate := `
+		UPDATE password_reset_tokens SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND used_at IS NULL`
+
+	if _, err := tx.ExecContext(ctx, invalidate, token.UserID); err != nil {
+		return fmt.Errorf("failed to invalidate password reset tokens: %w", err)
+	}
+
+	if err := discardResetEmails(ctx, tx, token.UserID); err != nil {
+		return err
+	}
+
+	if err := enqueueEmail(ctx, tx, email); err != nil {
+		return err
+	}
+	token.EmailID = &email.ID
+
+	query := `
+		INSERT INTO password_reset_tokens (user_id, token_hash, expires_at, requested_ip, email_id)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+
+	err = tx.QueryRowContext(ctx, query,
+		token.UserID, token.TokenHash, token.ExpiresAt, token.RequestedIP, token.EmailID,
+	).Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create password reset token: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// GetByHash повертає токен відновлення пароля за його хешем
+func (r *passwordResetRepository) GetByHash(ctx context.Context, tokenHash string) (*model.PasswordResetToken, error) {
+	var token model.PasswordResetToken
+	query := `
+		SELECT id, user_id, token_hash, expires_at, used_at, requested_ip, email_id, created_at
+		FROM password_reset_tokens
+		WHERE token_hash = $1`
+
+	err := r.db.GetContext(ctx, &token, query, tokenHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("password reset token not found")
+		}
+		return nil, fmt.Errorf("failed to get password reset token: %w", err)
+	}
+
+	return &token, nil
+}
+
+// Consume атомарно позначає токен використаним і встановлює новий пароль в одній транзакції.
+// Блокування входу при цьому знімається, а листи з токенами користувача видаляються з черги. Повертає false, якщо токен вже використаний або прострочений
+func (r *passwordResetRepository) Consume(ctx context.Context, token *model.PasswordResetToken, passwordHash string) (bool, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE password_reset_tokens SET used_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP`
+
+	result, err := tx.ExecContext(ctx, query, token.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark password reset token as used: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return false, nil
+	}
+
+	update := `
+		UPDATE users SET password_hash = $1, failed_login_count = 0, last_failed_login_at = NULL,
+			locked_until = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2`
+
+	result, err = tx.ExecContext(ctx, update, passwordHash, token.UserID)
+	if err != nil {
+		return false, fmt.Errorf("failed to update password: %w", err)
+	}
+
+	rowsAffected, err = result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return false, fmt.Errorf("user with id %d not found", token.UserID)
+	}
+
+	if err := discardResetEmails(ctx, tx, token.UserID); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// CountRecentForUser повертає кількість запитів відновлення пароля користувача після вказаного моменту
+func (r *passwordResetRepository) CountRecentForUser(ctx context.Context, userID int64, since time.Time) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM password_reset_tokens WHERE user_id = $1 AND created_at > $2`
+
+	if err := r.db.GetContext(ctx, &count, query, userID, since); err != nil {
+		return 0, fmt.Errorf("failed to count password reset tokens: %w", err)
+	}
+
+	return count, nil
+}
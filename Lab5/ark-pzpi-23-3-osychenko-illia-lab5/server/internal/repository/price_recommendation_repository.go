@@ -11,7 +11,7 @@ import (
 // PriceRecommendationRepository інтерфейс для роботи з рекомендаціями цін
 type PriceRecommendationRepository interface {
 	Create(ctx context.Context, recommendation *model.PriceRecommendation) error
-	GetByTripID(ctx context.Context, tripID int64) ([]model.PriceRecommendation, error)
+	GetByTripID(ctx context.Context, tripID int64, flaggedOnly bool) ([]model.PriceRecommendation, error)
 }
 
 // priceRecommendationRepository реалізація PriceRecommendationRepository
@@ -24,13 +24,14 @@ func NewPriceRecommendationRepository(db *sqlx.DB) PriceRecommendationRepository
 	return &priceRecommendationRepository{db: db}
 }
 
-// Create зберігає нову рекомендацію ціни
+// Create зберігає нову рекомендацію ціни разом з результатом перевірки сервером
 func (r *priceRecommendationRepository) Create(ctx context.Context, recommendation *model.PriceRecommendation) error {
 	query := `
 		INSERT INTO price_recommendations (
 			trip_id, base_price, recommended_price, occupancy_rate,
-			demand_coefficient, time_coefficient, day_coefficient
-		) VALUES ($1, $2, $3, $4, $5, $6, $7)
+			demand_coefficient, time_coefficient, day_coefficient,
+			device_id, server_price, server_occupancy_rate, is_flagged, divergence_reason
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 		RETURNING id, created_at`
 
 	err := r.db.QueryRowContext(ctx, query,
@@ -41,6 +42,11 @@ func (r *priceRecommendationRepository) Create(ctx context.Context, recommendati
 		recommendation.DemandCoeff,
 		recommendation.TimeCoeff,
 		recommendation.DayCoeff,
+		recommendation.DeviceID,
+		recommendation.ServerPrice,
+		recommendation.ServerOccupancyRate,
+		recommendation.IsFlagged,
+		recommendation.DivergenceReason,
 	).Scan(&recommendation.ID, &recommendation.CreatedAt)
 
 	if err != nil {
@@ -50,13 +56,16 @@ func (r *priceRecommendationRepository) Create(ctx context.Context, recommendati
 	return nil
 }
 
-// GetByTripID повертає всі рекомендації цін для рейсу
-func (r *priceRecommendationRepository) GetByTripID(ctx context.Context, tripID int64) ([]model.PriceRecommendation, error) {
-	var recommendations []model.PriceRecommendation
+// GetByTripID повертає рекомендації цін для рейсу, за потреби лише позначені як розбіжні
+func (r *priceRecommendationRepository) GetByTripID(ctx context.Context, tripID int64, flaggedOnly bool) ([]model.PriceRecommendation, error) {
+	recommendations := []model.PriceRecommendation{}
 	query := `
 		SELECT * FROM price_recommendations 
-		WHERE trip_id = $1 
-		ORDER BY created_at DESC`
+		WHERE trip_id = $1`
+	if flaggedOnly {
+		query += ` AND is_flagged`
+	}
+	query += ` ORDER BY created_at DESC`
 
 	err := r.db.SelectContext(ctx, &recommendations, query, tripID)
 	if err != nil {
@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"busoptima/internal/model"
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// RefreshTokenRepository інтерфейс для роботи з refresh токенами
+type RefreshTokenRepository interface {
+	Create(ctx context.Context, token *model.RefreshToken) error
+	GetByHash(ctx context.Context, tokenHash string) (*model.RefreshToken, error)
+	MarkUsed(ctx context.Context, id int64) (bool, error)
+	RevokeFamily(ctx context.Context, familyID, reason string) error
+	RevokeAllForUser(ctx context.Context, userID int64, reason string) error
+	GetActiveSessions(ctx context.Context, userID int64) ([]model.Session, error)
+}
+
+// refreshTokenRepository реалізація RefreshTokenRepository
+type refreshTokenRepository struct {
+	db *sqlx.DB
+}
+
+// NewRefreshTokenRepository створює новий екземпляр репозиторію refresh токенів
+func NewRefreshTokenRepository(db *sqlx.DB) RefreshTokenRepository {
+	return &refreshTokenRepository{db: db}
+}
+
+// Create зберігає новий refresh токен
+func (r *refreshTokenRepository) Create(ctx context.Context, token *model.RefreshToken) error {
+	query := `
+		INSERT INTO refresh_tokens (user_id, token_hash, family_id, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`
+
+	err := r.db.QueryRowContext(ctx, query,
+		token.UserID, token.TokenHash, token.FamilyID, token.ExpiresAt,
+	).Scan(&token.ID, &token.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create refresh token: %w", err)
+	}
+
+	return nil
+}
+
+// GetByHash повертає refresh токен за його хешем
+func (r *refreshTokenRepository) GetByHash(ctx context.Context, tokenHash string) (*model.RefreshToken, error) {
+	var token model.RefreshToken
+	query := `
+		SELECT id, user_id, token_hash, family_id, expires_at, used_at,
+			revoked_at, revoke_reason, created_at
+		FROM refresh_tokens
+		WHERE token_hash = $1`
+
+	err := r.db.GetContext(ctx, &token, query, tokenHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("refresh token not found")
+		}
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	return &token, nil
+}
+
+// MarkUsed атомарно позначає токен як використаний.
+// Повертає false, якщо токен вже був використаний або відкликаний.
+func (r *refreshTokenRepository) MarkUsed(ctx context.Context, id int64) (bool, error) {
+	query := `
+		UPDATE refresh_tokens SET used_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND used_at IS NULL AND revoked_at IS NULL`
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark refresh token as used: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// RevokeFamily відкликає всі активні токени сесії
+func (r *refreshTokenRepository) RevokeFamily(ctx context.Context, familyID, reason string) error {
+	query := `
+		UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP, revoke_reason = $2
+		WHERE family_id = $1 AND revoked_at IS NULL`
+
+	if _, err := r.db.ExecContext(ctx, query, familyID, reason); err != nil {
+		return fmt.Errorf("failed to revoke refresh token family: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeAllForUser відкликає всі активні refresh токени користувача
+func (r *refreshTokenRepository) RevokeAllForUser(ctx context.Context, userID int64, reason string) error {
+	query := `
+		UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP, revoke_reason = $2
+		WHERE user_id = $1 AND revoked_at IS NULL`
+
+	if _, err := r.db.ExecContext(ctx, query, userID, reason); err != nil {
+		return fmt.Errorf("failed to revoke user refresh tokens: %w", err)
+	}
+
+	return nil
+}
+
+// GetActiveSessions повертає сесії користувача, в яких є дійсний refresh токен
+func (r *refreshTokenRepository) GetActiveSessions(ctx context.Context, userID int64) ([]model.Session, error) {
+	sessions := []model.Session{}
+	query := `
+		SELECT family_id, MIN(created_at) as started_at, MAX(created_at) as last_refreshed_at,
+			MAX(expires_at) as expires_at
+		FROM refresh_tokens
+		WHERE user_id = $1
+		GROUP BY family_id
+		HAVING bool_or(revoked_at IS NULL AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP)
+		ORDER BY last_refreshed_at DESC`
+
+	if err := r.db.SelectContext(ctx, &sessions, query, userID); err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %w", err)
+	}
+
+	return sessions, nil
+}
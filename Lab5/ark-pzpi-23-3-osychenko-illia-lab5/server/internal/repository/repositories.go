@@ -1,6 +1,13 @@
 package repository
 
-import "github.com/jmoiron/sqlx"
+import (
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrNotFound повертається (обгорнутою з назвою сутності), коли запис не знайдено
+var ErrNotFound = errors.New("not found")
 
 // Repositories містить всі репозиторії
 type Repositories struct {
@@ -8,12 +15,24 @@ type Repositories struct {
 	Route               RouteRepository
 	Bus                 BusRepository
 	Device              DeviceRepository
+	DeviceHeartbeat     DeviceHeartbeatRepository
+	Firmware            FirmwareRepository
 	Trip                TripRepository
 	Event               PassengerEventRepository
 	Analytics           AnalyticsRepository
 	Audit               AuditLogRepository
 	PriceRecommendation PriceRecommendationRepository
 	Settings            SettingsRepository
+	RefreshToken        RefreshTokenRepository
+	TokenRevocation     TokenRevocationRepository
+	LoginAttempt        LoginAttemptRepository
+	PasswordReset       PasswordResetRepository
+	EmailOutbox         EmailOutboxRepository
+	TwoFactor           TwoFactorRepository
+	Role                RoleRepository
+	APIKey              APIKeyRepository
+	RouteAssignment     RouteAssignmentRepository
+	OIDC                OIDCRepository
 }
 
 // NewRepositories створює новий набір репозиторіїв
@@ -23,11 +42,23 @@ func NewRepositories(db *sqlx.DB) *Repositories {
 		Route:               NewRouteRepository(db),
 		Bus:                 NewBusRepository(db),
 		Device:              NewDeviceRepository(db),
+		DeviceHeartbeat:     NewDeviceHeartbeatRepository(db),
+		Firmware:            NewFirmwareRepository(db),
 		Trip:                NewTripRepository(db),
 		Event:               NewPassengerEventRepository(db),
 		Analytics:           NewAnalyticsRepository(db),
 		Audit:               NewAuditLogRepository(db),
 		PriceRecommendation: NewPriceRecommendationRepository(db),
 		Settings:            NewSettingsRepository(db),
+		RefreshToken:        NewRefreshTokenRepository(db),
+		TokenRevocation:     NewTokenRevocationRepository(db),
+		LoginAttempt:        NewLoginAttemptRepository(db),
+		PasswordReset:       NewPasswordResetRepository(db),
+		EmailOutbox:         NewEmailOutboxRepository(db),
+		TwoFactor:           NewTwoFactorRepository(db),
+		Role:                NewRoleRepository(db),
+		APIKey:              NewAPIKeyRepository(db),
+		RouteAssignment:     NewRouteAssignmentRepository(db),
+		OIDC:                NewOIDCRepository(db),
 	}
 }
@@ -0,0 +1,315 @@
+package repository
+
+import (
+	"busoptima/internal/model"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrRoleNameExists повертається, коли роль з такою назвою вже існує
+	ErrRoleNameExists = errors.New("role with this name already exists")
+	// ErrRoleInUse повертається при видаленні ролі, призначеної користувачам
+	ErrRoleInUse = errors.New("role is assigned to users")
+)
+
+// RoleRepository інтерфейс для роботи з ролями та дозволами
+type RoleRepository interface {
+	GetAll(ctx context.Context) ([]model.Role, error)
+	GetByID(ctx context.Context, id int64) (*model.Role, error)
+	Create(ctx context.Context, role *model.Role, permissions []string) error
+	Update(ctx context.Context, role *model.Role) error
+	Delete(ctx context.Context, id int64) error
+	SetMFARequired(ctx context.Context, id int64, required bool) error
+	SetPermissions(ctx context.Context, id int64, permissions []string) error
+	CountUsers(ctx context.Context, id int64) (int, error)
+	GetPermissionNames(ctx context.Context, id int64) ([]string, error)
+	GetPermissions(ctx context.Context) ([]model.Permission, error)
+	EnsurePermissions(ctx context.Context, names []string) (int, error)
+}
+
+// roleRepository реалізація RoleRepository
+type roleRepository struct {
+	db *sqlx.DB
+}
+
+// NewRoleRepository створює новий екземпляр репозиторію ролей
+func NewRoleRepository(db *sqlx.DB) RoleRepository {
+	return &roleRepository{db: db}
+}
+
+// GetAll повертає всі ролі разом з їх дозволами
+func (r *roleRepository) GetAll(ctx context.Context) ([]model.Role, error) {
+	var roles []model.Role
+	query := `SELECT id, name, COALESCE(description, '') as description, mfa_required, route_scoped FROM roles ORDER BY id`
+
+	if err := r.db.SelectContext(ctx, &roles, query); err != nil {
+		return nil, fmt.Errorf("failed to get roles: %w", err)
+	}
+
+	var rows []struct {
+		RoleID int64 `db:"role_id"`
+		model.Permission
+	}
+	permissionsQuery := `
+		SELECT rp.role_id, p.id, p.name, COALESCE(p.description, '') as description
+		FROM role_permissions rp
+		JOIN permissions p ON rp.permission_id = p.id
+		ORDER BY p.name`
+
+	if err := r.db.SelectContext(ctx, &rows, permissionsQuery); err != nil {
+		return nil, fmt.Errorf("failed to get role permissions: %w", err)
+	}
+
+	byRole := make(map[int64][]model.Permission)
+	for _, row := range rows {
+		byRole[row.RoleID] = append(byRole[row.RoleID], row.Permission)
+	}
+
+	for i := range roles {
+		roles[i].Permissions = byRole[roles[i].ID]
+	}
+
+	return roles, nil
+}
+
+// GetByID повертає роль за ID разом з її дозволами
+func (r *roleRepository) GetByID(ctx context.Context, id int64) (*model.Role, error) {
+	var role model.Role
+	query := `SELECT id, name, COALESCE(description, '') as description, mfa_required, route_scoped FROM roles WHERE id = $1`
+
+	err := r.db.GetContext(ctx, &role, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("role with id %d %w", id, ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get role: %w", err)
+	}
+
+	permissionsQuery := `
+		SELECT p.id, p.name, COALESCE(p.description, '') as description
+		FROM role_permissions rp
+		JOIN permissions p ON rp.permission_id = p.id
+		WHERE rp.role_id = $1
+		ORDER BY p.name`
+
+	if err := r.db.SelectContext(ctx, &role.Permissions, permissionsQuery, id); err != nil {
+		return nil, fmt.Errorf("failed to get role permissions: %w", err)
+	}
+
+	return &role, nil
+}
+
+// Create створює роль з набором дозволів
+func (r *roleRepository) Create(ctx context.Context, role *model.Role, permissions []string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO roles (name, description, mfa_required, route_scoped)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`
+
+	if err := tx.QueryRowContext(ctx, query, role.Name, role.Description, role.MFARequired, role.RouteScoped).Scan(&role.ID); err != nil {
+		return mapRoleConstraintError(err, "failed to create role")
+	}
+
+	if err := setRolePermissions(ctx, tx, role.ID, permissions); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Update оновлює назву, опис, налаштування 2FA та обмеження маршрутами для ролі
+func (r *roleRepository) Update(ctx context.Context, role *model.Role) error {
+	query := `UPDATE roles SET name = $2, description = $3, mfa_required = $4, route_scoped = $5 WHERE id = $1`
+
+	result, err := r.db.ExecContext(ctx, query, role.ID, role.Name, role.Description, role.MFARequired, role.RouteScoped)
+	if err != nil {
+		return mapRoleConstraintError(err, "failed to update role")
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("role with id %d %w", role.ID, ErrNotFound)
+	}
+
+	return nil
+}
+
+// Delete видаляє роль. Дозволи ролі видаляються каскадно
+func (r *roleRepository) Delete(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM roles WHERE id = $1`, id)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+			return ErrRoleInUse
+		}
+		return fmt.Errorf("failed to delete role: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("role with id %d %w", id, ErrNotFound)
+	}
+
+	return nil
+}
+
+// SetMFARequired вмикає або вимикає обов'язкову двофакторну автентифікацію для ролі
+func (r *roleRepository) SetMFARequired(ctx context.Context, id int64, required bool) error {
+	query := `UPDATE roles SET mfa_required = $2 WHERE id = $1`
+
+	result, err := r.db.ExecContext(ctx, query, id, required)
+	if err != nil {
+		return fmt.Errorf("failed to update role: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("role with id %d %w", id, ErrNotFound)
+	}
+
+	return nil
+}
+
+// SetPermissions замінює набір дозволів ролі
+func (r *roleRepository) SetPermissions(ctx context.Context, id int64, permissions []string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Блокуємо рядок ролі, щоб паралельні зміни дозволів не перемішались
+	var exists int64
+	if err := tx.GetContext(ctx, &exists, `SELECT id FROM roles WHERE id = $1 FOR UPDATE`, id); err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("role with id %d %w", id, ErrNotFound)
+		}
+		return fmt.Errorf("failed to get role: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM role_permissions WHERE role_id = $1`, id); err != nil {
+		return fmt.Errorf("failed to update role permissions: %w", err)
+	}
+
+	if err := setRolePermissions(ctx, tx, id, permissions); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CountUsers повертає кількість користувачів з роллю
+func (r *roleRepository) CountUsers(ctx context.Context, id int64) (int, error) {
+	var count int
+	if err := r.db.GetContext(ctx, &count, `SELECT COUNT(*) FROM users WHERE role_id = $1`, id); err != nil {
+		return 0, fmt.Errorf("failed to count role users: %w", err)
+	}
+	return count, nil
+}
+
+// GetPermissionNames повертає назви дозволів ролі
+func (r *roleRepository) GetPermissionNames(ctx context.Context, id int64) ([]string, error) {
+	permissions := []string{}
+	query := `
+		SELECT p.name
+		FROM role_permissions rp
+		JOIN permissions p ON rp.permission_id = p.id
+		WHERE rp.role_id = $1`
+
+	if err := r.db.SelectContext(ctx, &permissions, query, id); err != nil {
+		return nil, fmt.Errorf("failed to get role permissions: %w", err)
+	}
+	return permissions, nil
+}
+
+// GetPermissions повертає всі дозволи з бази даних
+func (r *roleRepository) GetPermissions(ctx context.Context) ([]model.Permission, error) {
+	var permissions []model.Permission
+	query := `SELECT id, name, COALESCE(description, '') as description FROM permissions ORDER BY name`
+
+	if err := r.db.SelectContext(ctx, &permissions, query); err != nil {
+		return nil, fmt.Errorf("failed to get permissions: %w", err)
+	}
+
+	return permissions, nil
+}
+
+// EnsurePermissions додає відсутні дозволи та повертає кількість доданих
+func (r *roleRepository) EnsurePermissions(ctx context.Context, names []string) (int, error) {
+	query := `
+		INSERT INTO permissions (name)
+		SELECT unnest($1::text[])
+		ON CONFLICT (name) DO NOTHING`
+
+	result, err := r.db.ExecContext(ctx, query, pq.Array(names))
+	if err != nil {
+		return 0, fmt.Errorf("failed to sync permissions: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return int(rowsAffected), nil
+}
+
+// setRolePermissions прив'язує дозволи до ролі. Невідомі назви дозволів повертають помилку
+func setRolePermissions(ctx context.Context, tx *sqlx.Tx, roleID int64, permissions []string) error {
+	if len(permissions) == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO role_permissions (role_id, permission_id)
+		SELECT $1, id FROM permissions WHERE name = ANY($2)`
+
+	result, err := tx.ExecContext(ctx, query, roleID, pq.Array(permissions))
+	if err != nil {
+		return fmt.Errorf("failed to set role permissions: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if int(rowsAffected) != len(permissions) {
+		return fmt.Errorf("unknown permission in %v", permissions)
+	}
+
+	return nil
+}
+
+// mapRoleConstraintError перетворює порушення унікальності назви ролі на ErrRoleNameExists
+func mapRoleConstraintError(err error, message string) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrRoleNameExists
+	}
+	return fmt.Errorf("%s: %w", message, err)
+}
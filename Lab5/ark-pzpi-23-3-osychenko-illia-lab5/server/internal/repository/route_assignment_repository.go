@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// RouteAssignmentRepository інтерфейс для роботи з призначеннями маршрутів користувачам
+type RouteAssignmentRepository interface {
+	GetRouteIDs(ctx context.Context, userID int64) ([]int64, error)
+	SetRouteIDs(ctx context.Context, userID int64, routeIDs []int64, assignedBy int64) error
+}
+
+// routeAssignmentRepository реалізація RouteAssignmentRepository
+type routeAssignmentRepository struct {
+	db *sqlx.DB
+}
+
+// NewRouteAssignmentRepository створює новий екземпляр репозиторію призначень маршрутів
+func NewRouteAssignmentRepository(db *sqlx.DB) RouteAssignmentRepository {
+	return &routeAssignmentRepository{db: db}
+}
+
+// GetRouteIDs повертає ідентифікатори маршрутів, призначених користувачу
+func (r *routeAssignmentRepository) GetRouteIDs(ctx context.Context, userID int64) ([]int64, error) {
+	routeIDs := []int64{}
+	query := `SELECT route_id FROM user_route_assignments WHERE user_id = $1 ORDER BY route_id`
+
+	if err := r.db.SelectContext(ctx, &routeIDs, query, userID); err != nil {
+		return nil, fmt.Errorf("failed to get route assignments: %w", err)
+	}
+
+	return routeIDs, nil
+}
+
+// SetRouteIDs замінює набір маршрутів, призначених користувачу
+func (r *routeAssignmentRepository) SetRouteIDs(ctx context.Context, userID int64, routeIDs []int64, assignedBy int64) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_route_assignments WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete route assignments: %w", err)
+	}
+
+	if len(routeIDs) > 0 {
+		query := `
+			INSERT INTO user_route_assignments (user_id, route_id, assigned_by)
+			SELECT $1, unnest($2::int[]), NULLIF($3, 0)
+			ON CONFLICT DO NOTHING`
+
+		if _, err := tx.ExecContext(ctx, query, userID, pq.Array(routeIDs), assignedBy); err != nil {
+			var pqErr *pq.Error
+			if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+				return fmt.Errorf("user or route not found")
+			}
+			return fmt.Errorf("failed to save route assignments: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
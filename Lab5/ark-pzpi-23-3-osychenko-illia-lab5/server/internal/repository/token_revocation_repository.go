@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"busoptima/internal/model"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// TokenRevocationRepository інтерфейс для роботи зі списком відкликаних токенів
+type TokenRevocationRepository interface {
+	RevokeToken(ctx context.Context, token *model.RevokedToken) error
+	RevokeUserTokens(ctx context.Context, revocation *model.UserTokenRevocation) error
+	GetActiveTokens(ctx context.Context) ([]model.RevokedToken, error)
+	GetUserRevocationsSince(ctx context.Context, since time.Time) ([]model.UserTokenRevocation, error)
+	RevokeDeviceTokens(ctx context.Context, revocation *model.DeviceTokenRevocation) error
+	GetDeviceRevocationsSince(ctx context.Context, since time.Time) ([]model.DeviceTokenRevocation, error)
+	DeleteExpired(ctx context.Context) error
+}
+
+// tokenRevocationRepository реалізація TokenRevocationRepository
+type tokenRevocationRepository struct {
+	db *sqlx.DB
+}
+
+// NewTokenRevocationRepository створює новий екземпляр репозиторію відкликаних токенів
+func NewTokenRevocationRepository(db *sqlx.DB) TokenRevocationRepository {
+	return &tokenRevocationRepository{db: db}
+}
+
+// RevokeToken додає токен до списку відкликаних
+func (r *tokenRevocationRepository) RevokeToken(ctx context.Context, token *model.RevokedToken) error {
+	query := `
+		INSERT INTO revoked_tokens (jti, user_id, expires_at, reason)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (jti) DO NOTHING`
+
+	if _, err := r.db.ExecContext(ctx, query, token.JTI, token.UserID, token.ExpiresAt, token.Reason); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeUserTokens відкликає всі токени користувача, видані до вказаного моменту
+func (r *tokenRevocationRepository) RevokeUserTokens(ctx context.Context, revocation *model.UserTokenRevocation) error {
+	query := `
+		INSERT INTO user_token_revocations (user_id, revoked_before, reason)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET
+			revoked_before = EXCLUDED.revoked_before,
+			reason = EXCLUDED.reason`
+
+	if _, err := r.db.ExecContext(ctx, query, revocation.UserID, revocation.RevokedBefore, revocation.Reason); err != nil {
+		return fmt.Errorf("failed to revoke user tokens: %w", err)
+	}
+
+	return nil
+}
+
+// GetActiveTokens повертає відкликані токени, термін дії яких ще не минув
+func (r *tokenRevocationRepository) GetActiveTokens(ctx context.Context) ([]model.RevokedToken, error) {
+	var tokens []model.RevokedToken
+	query := `
+		SELECT jti, user_id, expires_at, reason, revoked_at
+		FROM revoked_tokens
+		WHERE expires_at > CURRENT_TIMESTAMP`
+
+	if err := r.db.SelectContext(ctx, &tokens, query); err != nil {
+		return nil, fmt.Errorf("failed to get revoked tokens: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// GetUserRevocationsSince повертає відкликання користувачів, новіші за вказаний момент
+func (r *tokenRevocationRepository) GetUserRevocationsSince(ctx context.Context, since time.Time) ([]model.UserTokenRevocation, error) {
+	var revocations []model.UserTokenRevocation
+	query := `
+		SELECT user_id, revoked_before, reason
+		FROM user_token_revocations
+		WHERE revoked_before > $1`
+
+	if err := r.db.SelectContext(ctx, &revocations, query, since); err != nil {
+		return nil, fmt.Errorf("failed to get user token revocations: %w", err)
+	}
+
+	return revocations, nil
+}
+
+// RevokeDeviceTokens відкликає всі токени пристрою, видані до вказаного моменту
+func (r *tokenRevocationRepository) RevokeDeviceTokens(ctx context.Context, revocation *model.DeviceTokenRevocation) error {
+	query := `
+		INSERT INTO device_token_revocations (device_id, revoked_before, reason)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (device_id) DO UPDATE SET
+			revoked_before = EXCLUDED.revoked_before,
+			reason = EXCLUDED.reason`
+
+	if _, err := r.db.ExecContext(ctx, query, revocation.DeviceID, revocation.RevokedBefore, revocation.Reason); err != nil {
+		return fmt.Errorf("failed to revoke device tokens: %w", err)
+	}
+
+	return nil
+}
+
+// GetDeviceRevocationsSince повертає відкликання пристроїв, новіші за вказаний момент
+func (r *tokenRevocationRepository) GetDeviceRevocationsSince(ctx context.Context, since time.Time) ([]model.DeviceTokenRevocation, error) {
+	var revocations []model.DeviceTokenRevocation
+	query := `
+		SELECT device_id, revoked_before, reason
+		FROM device_token_revocations
+		WHERE revoked_before > $1`
+
+	if err := r.db.SelectContext(ctx, &revocations, query, since); err != nil {
+		return nil, fmt.Errorf("failed to get device token revocations: %w", err)
+	}
+
+	return revocations, nil
+}
+
+// DeleteExpired видаляє записи про токени, термін дії яких вже минув
+func (r *tokenRevocationRepository) DeleteExpired(ctx context.Context) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM revoked_tokens WHERE expires_at <= CURRENT_TIMESTAMP`); err != nil {
+		return fmt.Errorf("failed to delete expired revoked tokens: %w", err)
+	}
+
+	return nil
+}
@@ -16,6 +16,7 @@ type TripRepository interface {
 	GetAll(ctx context.Context, filters map[string]interface{}) ([]model.Trip, error)
 	Update(ctx context.Context, trip *model.Trip) error
 	UpdatePassengerCount(ctx context.Context, tripID int64, count int) error
+	GetCurrentCandidatesByBus(ctx context.Context, busID int64, scheduledFrom, scheduledTo time.Time) ([]model.Trip, error)
 }
 
 // tripRepository реалізація TripRepository
@@ -285,3 +286,21 @@ func (r *tripRepository) UpdatePassengerCount(ctx context.Context, tripID int64,
 
 	return nil
 }
+
+// GetCurrentCandidatesByBus повертає рейси автобуса, що виконуються (boarding або in_progress),
+// та заплановані з відправленням між scheduledFrom і scheduledTo. Поточний рейс серед них обирає сервіс
+func (r *tripRepository) GetCurrentCandidatesByBus(ctx context.Context, busID int64, scheduledFrom, scheduledTo time.Time) ([]model.Trip, error) {
+	query := `
+		SELECT id, route_id, bus_id, scheduled_departure, status FROM trips
+		WHERE bus_id = $1
+			AND (status IN ('boarding', 'in_progress')
+				OR (status = 'scheduled' AND scheduled_departure BETWEEN $2 AND $3))
+		ORDER BY scheduled_departure`
+
+	var trips []model.Trip
+	if err := r.db.SelectContext(ctx, &trips, query, busID, scheduledFrom, scheduledTo); err != nil {
+		return nil, fmt.Errorf("failed to get current trips: %w", err)
+	}
+
+	return trips, nil
+}
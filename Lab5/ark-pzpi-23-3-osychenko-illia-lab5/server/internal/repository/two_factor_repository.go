@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"busoptima/internal/model"
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// TwoFactorRepository інтерфейс для роботи з TOTP секретами та кодами відновлення
+type TwoFactorRepository interface {
+	GetTOTP(ctx context.Context, userID int64) (*model.UserTOTP, error)
+	UpsertTOTP(ctx context.Context, userID int64, secret string) error
+	ConfirmTOTP(ctx context.Context, userID int64) error
+	UseTOTPStep(ctx context.Context, userID int64, step int64) (bool, error)
+	DeleteTOTP(ctx context.Context, userID int64) error
+	ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes []string) error
+	UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error)
+	CountUnusedRecoveryCodes(ctx context.Context, userID int64) (int, error)
+}
+
+// twoFactorRepository реалізація TwoFactorRepository
+type twoFactorRepository struct {
+	db *sqlx.DB
+}
+
+// NewTwoFactorRepository створює новий екземпляр репозиторію двофакторної автентифікації
+func NewTwoFactorRepository(db *sqlx.DB) TwoFactorRepository {
+	return &twoFactorRepository{db: db}
+}
+
+// GetTOTP повертає TOTP секрет користувача або nil, якщо 2FA не налаштовано
+func (r *twoFactorRepository) GetTOTP(ctx context.Context, userID int64) (*model.UserTOTP, error) {
+	var totp model.UserTOTP
+	query := `
+		SELECT user_id, secret, confirmed_at, last_used_step, created_at
+		FROM user_totp
+		WHERE user_id = $1`
+
+	err := r.db.GetContext(ctx, &totp, query, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get TOTP secret: %w", err)
+	}
+
+	return &totp, nil
+}
+
+// UpsertTOTP зберігає новий непідтверджений секрет, замінюючи попередній
+func (r *twoFactorRepository) UpsertTOTP(ctx context.Context, userID int64, secret string) error {
+	query := `
+		INSERT INTO user_totp (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, confirmed_at = NULL, last_used_step = NULL, created_at = CURRENT_TIMESTAMP`
+
+	if _, err := r.db.ExecContext(ctx, query, userID, secret); err != nil {
+		return fmt.Errorf("failed to save TOTP secret: %w", err)
+	}
+
+	return nil
+}
+
+// ConfirmTOTP позначає секрет як підтверджений, після чого 2FA вважається увімкненою
+func (r *twoFactorRepository) ConfirmTOTP(ctx context.Context, userID int64) error {
+	query := `UPDATE user_totp SET confirmed_at = CURRENT_TIMESTAMP WHERE user_id = $1`
+
+	result, err := r.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to confirm TOTP secret: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("TOTP secret not found")
+	}
+
+	return nil
+}
+
+// UseTOTPStep атомарно фіксує використаний часовий інтервал.
+// Повертає false, якщо код з цього або пізнішого інтервалу вже використовувався.
+func (r *twoFactorRepository) UseTOTPStep(ctx context.Context, userID int64, step int64) (bool, error) {
+	query := `
+		UPDATE user_totp SET last_used_step = $2
+		WHERE user_id = $1 AND (last_used_step IS NULL OR last_used_step < $2)`
+
+	result, err := r.db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return false, fmt.Errorf("failed to update TOTP step: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// DeleteTOTP видаляє TOTP секрет та коди відновлення користувача
+func (r *twoFactorRepository) DeleteTOTP(ctx context.Context, userID int64) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete TOTP secret: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// ReplaceRecoveryCodes замінює всі коди відновлення користувача новим набором
+func (r *twoFactorRepository) ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes []string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	for _, hash := range codeHashes {
+		query := `INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)`
+		if _, err := tx.ExecContext(ctx, query, userID, hash); err != nil {
+			return fmt.Errorf("failed to save recovery code: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UseRecoveryCode атомарно позначає код відновлення використаним.
+// Повертає false, якщо код не знайдено або він вже використаний.
+func (r *twoFactorRepository) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error) {
+	query := `
+		UPDATE user_recovery_codes SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+
+	result, err := r.db.ExecContext(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// CountUnusedRecoveryCodes повертає кількість невикористаних кодів відновлення
+func (r *twoFactorRepository) CountUnusedRecoveryCodes(ctx context.Context, userID int64) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = $1 AND used_at IS NULL`
+
+	if err := r.db.GetContext(ctx, &count, query, userID); err != nil {
+		return 0, fmt.Errorf("failed to count recovery codes: %w", err)
+	}
+
+	return count, nil
+}
@@ -3,13 +3,19 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"time"
 
 	"busoptima/internal/model"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
+// ErrUnknownRole повертається, коли користувачу призначається роль, якої не існує
+var ErrUnknownRole = errors.New("role does not exist")
+
 // UserRepository інтерфейс для роботи з користувачами
 type UserRepository interface {
 	Create(ctx context.Context, user *model.User) error
@@ -17,8 +23,14 @@ type UserRepository interface {
 	GetByEmail(ctx context.Context, email string) (*model.User, error)
 	GetAll(ctx context.Context) ([]model.User, error)
 	Update(ctx context.Context, user *model.User) error
+	UpdateProfile(ctx context.Context, user *model.User) error
 	UpdateRole(ctx context.Context, userID, roleID int64) error
 	GetUserPermissions(ctx context.Context, userID int64) ([]string, error)
+	RecordFailedLogin(ctx context.Context, userID int64) (int, error)
+	LockUntil(ctx context.Context, userID int64, until time.Time) error
+	ResetFailedLogins(ctx context.Context, userID int64) error
+	SetActive(ctx context.Context, userID int64, active bool) error
+	UpdatePassword(ctx context.Context, userID int64, passwordHash string) error
 }
 
 // userRepository реалізація UserRepository
@@ -47,22 +59,26 @@ func (r *userRepository) Create(ctx context.Context, user *model.User) error {
 func (r *userRepository) GetByID(ctx context.Context, id int64) (*model.User, error) {
 	var user model.User
 	var roleName, roleDescription sql.NullString
+	var roleMFARequired, roleRouteScoped sql.NullBool
 
 	query := `
 		SELECT u.id, u.email, u.password_hash, u.full_name, u.role_id, u.is_active, 
-		       u.created_at, u.updated_at, r.name as role_name, r.description as role_description
+		       u.created_at, u.updated_at, u.failed_login_count, u.last_failed_login_at, u.locked_until,
+		       r.name as role_name, r.description as role_description, r.mfa_required as role_mfa_required,
+		       r.route_scoped as role_route_scoped
 		FROM users u
 		LEFT JOIN roles r ON u.role_id = r.id
 		WHERE u.id = $1`
 
 	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&user.ID, &user.Email, &user.PasswordHash, &user.FullName, &user.RoleID, &user.IsActive,
-		&user.CreatedAt, &user.UpdatedAt, &roleName, &roleDescription,
+		&user.CreatedAt, &user.UpdatedAt, &user.FailedLoginCount, &user.LastFailedLoginAt, &user.LockedUntil,
+		&roleName, &roleDescription, &roleMFARequired, &roleRouteScoped,
 	)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("user with id %d not found", id)
+			return nil, fmt.Errorf("user with id %d %w", id, ErrNotFound)
 		}
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
@@ -73,6 +89,8 @@ func (r *userRepository) GetByID(ctx context.Context, id int64) (*model.User, er
 			ID:          user.RoleID,
 			Name:        roleName.String,
 			Description: roleDescription.String,
+			MFARequired: roleMFARequired.Bool,
+			RouteScoped: roleRouteScoped.Bool,
 		}
 	}
 
@@ -83,22 +101,26 @@ func (r *userRepository) GetByID(ctx context.Context, id int64) (*model.User, er
 func (r *userRepository) GetByEmail(ctx context.Context, email string) (*model.User, error) {
 	var user model.User
 	var roleName, roleDescription sql.NullString
+	var roleMFARequired, roleRouteScoped sql.NullBool
 
 	query := `
 		SELECT u.id, u.email, u.password_hash, u.full_name, u.role_id, u.is_active, 
-		       u.created_at, u.updated_at, r.name as role_name, r.description as role_description
+		       u.created_at, u.updated_at, u.failed_login_count, u.last_failed_login_at, u.locked_until,
+		       r.name as role_name, r.description as role_description, r.mfa_required as role_mfa_required,
+		       r.route_scoped as role_route_scoped
 		FROM users u
 		LEFT JOIN roles r ON u.role_id = r.id
-		WHERE u.email = $1 AND u.is_active = true`
+		WHERE u.email = $1`
 
 	err := r.db.QueryRowContext(ctx, query, email).Scan(
 		&user.ID, &user.Email, &user.PasswordHash, &user.FullName, &user.RoleID, &user.IsActive,
-		&user.CreatedAt, &user.UpdatedAt, &roleName, &roleDescription,
+		&user.CreatedAt, &user.UpdatedAt, &user.FailedLoginCount, &user.LastFailedLoginAt, &user.LockedUntil,
+		&roleName, &roleDescription, &roleMFARequired, &roleRouteScoped,
 	)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("user with email %s not found", email)
+			return nil, fmt.Errorf("user with email %s %w", email, ErrNotFound)
 		}
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
@@ -109,6 +131,8 @@ func (r *userRepository) GetByEmail(ctx context.Context, email string) (*model.U
 			ID:          user.RoleID,
 			Name:        roleName.String,
 			Description: roleDescription.String,
+			MFARequired: roleMFARequired.Bool,
+			RouteScoped: roleRouteScoped.Bool,
 		}
 	}
 
@@ -119,7 +143,9 @@ func (r *userRepository) GetByEmail(ctx context.Context, email string) (*model.U
 func (r *userRepository) GetAll(ctx context.Context) ([]model.User, error) {
 	query := `
 		SELECT u.id, u.email, u.password_hash, u.full_name, u.role_id, u.is_active, 
-		       u.created_at, u.updated_at, r.name as role_name, r.description as role_description
+		       u.created_at, u.updated_at, u.failed_login_count, u.last_failed_login_at, u.locked_until,
+		       r.name as role_name, r.description as role_description, r.mfa_required as role_mfa_required,
+		       r.route_scoped as role_route_scoped
 		FROM users u
 		LEFT JOIN roles r ON u.role_id = r.id
 		ORDER BY u.created_at DESC`
@@ -134,10 +160,12 @@ func (r *userRepository) GetAll(ctx context.Context) ([]model.User, error) {
 	for rows.Next() {
 		var user model.User
 		var roleName, roleDescription sql.NullString
+		var roleMFARequired, roleRouteScoped sql.NullBool
 
 		err := rows.Scan(
 			&user.ID, &user.Email, &user.PasswordHash, &user.FullName, &user.RoleID, &user.IsActive,
-			&user.CreatedAt, &user.UpdatedAt, &roleName, &roleDescription,
+			&user.CreatedAt, &user.UpdatedAt, &user.FailedLoginCount, &user.LastFailedLoginAt, &user.LockedUntil,
+			&roleName, &roleDescription, &roleMFARequired, &roleRouteScoped,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan user: %w", err)
@@ -149,6 +177,8 @@ func (r *userRepository) GetAll(ctx context.Context) ([]model.User, error) {
 				ID:          user.RoleID,
 				Name:        roleName.String,
 				Description: roleDescription.String,
+				MFARequired: roleMFARequired.Bool,
+				RouteScoped: roleRouteScoped.Bool,
 			}
 		}
 
@@ -185,6 +215,30 @@ func (r *userRepository) Update(ctx context.Context, user *model.User) error {
 	return nil
 }
 
+// UpdateProfile оновлює лише email та ім'я користувача. Роль і стан облікового запису
+// не перезаписуються, тож паралельна зміна адміністратором не втрачається
+func (r *userRepository) UpdateProfile(ctx context.Context, user *model.User) error {
+	query := `
+		UPDATE users SET 
+			email = $1, full_name = $2,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3
+		RETURNING role_id, is_active, updated_at`
+
+	err := r.db.QueryRowContext(ctx, query,
+		user.Email, user.FullName, user.ID,
+	).Scan(&user.RoleID, &user.IsActive, &user.UpdatedAt)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("user with id %d %w", user.ID, ErrNotFound)
+		}
+		return fmt.Errorf("failed to update user profile: %w", err)
+	}
+
+	return nil
+}
+
 // UpdateRole оновлює роль користувача
 func (r *userRepository) UpdateRole(ctx context.Context, userID, roleID int64) error {
 	query := `
@@ -193,6 +247,10 @@ func (r *userRepository) UpdateRole(ctx context.Context, userID, roleID int64) e
 
 	result, err := r.db.ExecContext(ctx, query, roleID, userID)
 	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+			return ErrUnknownRole
+		}
 		return fmt.Errorf("failed to update user role: %w", err)
 	}
 
@@ -202,7 +260,7 @@ func (r *userRepository) UpdateRole(ctx context.Context, userID, roleID int64) e
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("user with id %d not found", userID)
+		return fmt.Errorf("user with id %d %w", userID, ErrNotFound)
 	}
 
 	return nil
@@ -226,3 +284,111 @@ func (r *userRepository) GetUserPermissions(ctx context.Context, userID int64) (
 
 	return permissions, nil
 }
+
+// RecordFailedLogin збільшує лічильник невдалих спроб входу та повертає його нове значення
+func (r *userRepository) RecordFailedLogin(ctx context.Context, userID int64) (int, error) {
+	query := `
+		UPDATE users SET
+			failed_login_count = failed_login_count + 1,
+			last_failed_login_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING failed_login_count`
+
+	var count int
+	if err := r.db.QueryRowContext(ctx, query, userID).Scan(&count); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("user with id %d not found", userID)
+		}
+		return 0, fmt.Errorf("failed to record failed login: %w", err)
+	}
+
+	return count, nil
+}
+
+// LockUntil блокує вхід користувача до вказаного моменту
+func (r *userRepository) LockUntil(ctx context.Context, userID int64, until time.Time) error {
+	query := `UPDATE users SET locked_until = $1 WHERE id = $2`
+
+	result, err := r.db.ExecContext(ctx, query, until, userID)
+	if err != nil {
+		return fmt.Errorf("failed to lock user: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("user with id %d not found", userID)
+	}
+
+	return nil
+}
+
+// ResetFailedLogins скидає лічильник невдалих спроб та знімає блокування
+func (r *userRepository) ResetFailedLogins(ctx context.Context, userID int64) error {
+	query := `
+		UPDATE users SET failed_login_count = 0, last_failed_login_at = NULL, locked_until = NULL
+		WHERE id = $1`
+
+	result, err := r.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to reset failed logins: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("user with id %d not found", userID)
+	}
+
+	return nil
+}
+
+// SetActive активує або деактивує користувача
+func (r *userRepository) SetActive(ctx context.Context, userID int64, active bool) error {
+	query := `UPDATE users SET is_active = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1`
+
+	result, err := r.db.ExecContext(ctx, query, userID, active)
+	if err != nil {
+		return fmt.Errorf("failed to update user status: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("user with id %d not found", userID)
+	}
+
+	return nil
+}
+
+// UpdatePassword замінює хеш пароля користувача
+func (r *userRepository) UpdatePassword(ctx context.Context, userID int64, passwordHash string) error {
+	query := `
+		UPDATE users SET password_hash = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2`
+
+	result, err := r.db.ExecContext(ctx, query, passwordHash, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("user with id %d not found", userID)
+	}
+
+	return nil
+}
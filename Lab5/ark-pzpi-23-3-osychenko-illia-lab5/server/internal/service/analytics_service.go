@@ -9,10 +9,10 @@ import (
 
 // AnalyticsService інтерфейс для роботи з аналітикою
 type AnalyticsService interface {
-	GetDashboard(ctx context.Context) (*DashboardData, error)
-	GetProfitability(ctx context.Context, routeID int64, from, to time.Time) (*ProfitabilityData, error)
-	CalculateTripAnalytics(ctx context.Context, tripID int64) (*model.TripAnalytics, error)
-	GetTripAnalytics(ctx context.Context, tripID int64) (*model.TripAnalytics, error)
+	GetDashboard(ctx context.Context, scope *RouteScope) (*DashboardData, error)
+	GetProfitability(ctx context.Context, scope *RouteScope, routeID int64, from, to time.Time) (*ProfitabilityData, error)
+	CalculateTripAnalytics(ctx context.Context, scope *RouteScope, tripID int64) (*model.TripAnalytics, error)
+	GetTripAnalytics(ctx context.Context, scope *RouteScope, tripID int64) (*model.TripAnalytics, error)
 }
 
 type DashboardData struct {
@@ -73,8 +73,9 @@ func NewAnalyticsService(analyticsRepo repository.AnalyticsRepository, tripRepo
 	}
 }
 
-// GetDashboard повертає агреговані дані для панелі моніторингу
-func (s *analyticsService) GetDashboard(ctx context.Context) (*DashboardData, error) {
+// GetDashboard повертає агреговані дані для панелі моніторингу.
+// Для користувача з обмеженим доступом враховуються лише рейси призначених йому маршрутів
+func (s *analyticsService) GetDashboard(ctx context.Context, scope *RouteScope) (*DashboardData, error) {
 	// Отримуємо активні рейси
 	trips, err := s.tripRepo.GetAll(ctx, map[string]interface{}{
 		"status": "in_progress",
@@ -83,18 +84,25 @@ func (s *analyticsService) GetDashboard(ctx context.Context) (*DashboardData, er
 		return nil, err
 	}
 
+	activeTrips := 0
+	for i := range trips {
+		if scope.Allows(trips[i].RouteID) {
+			activeTrips++
+		}
+	}
+
 	// Отримуємо аналітику за останні 7 днів для демонстрації
 	from := time.Now().AddDate(0, 0, -7).Truncate(24 * time.Hour)
 	to := time.Now().Add(24 * time.Hour)
 
-	analytics, err := s.analyticsRepo.GetProfitabilityByRoute(ctx, 0, from, to)
+	analytics, err := s.analyticsRepo.GetProfitabilityByRoute(ctx, scopeRouteIDs(scope), from, to)
 	if err != nil {
 		// Якщо немає даних, повертаємо базові значення
-		analytics = []model.TripAnalytics{}
+		analytics = []model.RouteTripAnalytics{}
 	}
 
 	dashboard := &DashboardData{
-		ActiveTrips:     len(trips),
+		ActiveTrips:     activeTrips,
 		TripsByCategory: make(map[string]int),
 	}
 
@@ -125,9 +133,19 @@ func (s *analyticsService) GetDashboard(ctx context.Context) (*DashboardData, er
 	return dashboard, nil
 }
 
-// GetProfitability повертає аналітику рентабельності за період
-func (s *analyticsService) GetProfitability(ctx context.Context, routeID int64, from, to time.Time) (*ProfitabilityData, error) {
-	analytics, err := s.analyticsRepo.GetProfitabilityByRoute(ctx, routeID, from, to)
+// GetProfitability повертає аналітику рентабельності за період.
+// Для користувача з обмеженим доступом враховуються лише рейси призначених йому маршрутів
+func (s *analyticsService) GetProfitability(ctx context.Context, scope *RouteScope, routeID int64, from, to time.Time) (*ProfitabilityData, error) {
+	routeIDs := scopeRouteIDs(scope)
+	if routeID != 0 {
+		if err := scope.Check(routeID); err != nil {
+			return nil, err
+		}
+		routeIDs = []int64{routeID}
+	}
+
+	// Маршрут кожного рейсу приходить разом з аналітикою, а обмеження доступу застосовується в запиті
+	analytics, err := s.analyticsRepo.GetProfitabilityByRoute(ctx, routeIDs, from, to)
 	if err != nil {
 		return nil, err
 	}
@@ -137,7 +155,9 @@ func (s *analyticsService) GetProfitability(ctx context.Context, routeID int64,
 
 	summary := ProfitabilitySummary{}
 
-	for _, a := range analytics {
+	for i := range analytics {
+		a := &analytics[i]
+
 		summary.TotalTrips++
 		summary.TotalPassengers += a.TotalPassengers
 		summary.TotalRevenue += a.Revenue
@@ -145,23 +165,17 @@ func (s *analyticsService) GetProfitability(ctx context.Context, routeID int64,
 		summary.TotalProfit += a.Profit
 		summary.AvgOccupancy += a.AvgOccupancyRate
 
-		// Отримуємо route_id з trip
-		trip, err := s.tripRepo.GetByID(ctx, a.TripID)
-		if err != nil {
-			continue
-		}
-
-		rp, exists := routeMap[trip.RouteID]
+		rp, exists := routeMap[a.RouteID]
 		if !exists {
 			routeName := "Невідомий маршрут"
-			if trip.Route != nil {
-				routeName = trip.Route.OriginCity + " - " + trip.Route.DestinationCity
+			if a.OriginCity != nil && a.DestinationCity != nil {
+				routeName = *a.OriginCity + " - " + *a.DestinationCity
 			}
 			rp = &RouteProfitability{
-				RouteID:   trip.RouteID,
+				RouteID:   a.RouteID,
 				RouteName: routeName,
 			}
-			routeMap[trip.RouteID] = rp
+			routeMap[a.RouteID] = rp
 		}
 
 		rp.TripsCount++
@@ -203,15 +217,42 @@ func (s *analyticsService) GetProfitability(ctx context.Context, routeID int64,
 }
 
 // CalculateTripAnalytics розраховує аналітику для рейсу
-func (s *analyticsService) CalculateTripAnalytics(ctx context.Context, tripID int64) (*model.TripAnalytics, error) {
+func (s *analyticsService) CalculateTripAnalytics(ctx context.Context, scope *RouteScope, tripID int64) (*model.TripAnalytics, error) {
+	if err := s.authorizeTrip(ctx, scope, tripID); err != nil {
+		return nil, err
+	}
 	return s.analyticsRepo.CalculateTripAnalytics(ctx, tripID)
 }
 
 // GetTripAnalytics повертає аналітику рейсу
-func (s *analyticsService) GetTripAnalytics(ctx context.Context, tripID int64) (*model.TripAnalytics, error) {
+func (s *analyticsService) GetTripAnalytics(ctx context.Context, scope *RouteScope, tripID int64) (*model.TripAnalytics, error) {
+	if err := s.authorizeTrip(ctx, scope, tripID); err != nil {
+		return nil, err
+	}
 	return s.analyticsRepo.GetTripAnalytics(ctx, tripID)
 }
 
+// authorizeTrip перевіряє, що рейс належить доступному користувачу маршруту
+func (s *analyticsService) authorizeTrip(ctx context.Context, scope *RouteScope, tripID int64) error {
+	if scope == nil {
+		return nil
+	}
+
+	trip, err := s.tripRepo.GetByID(ctx, tripID)
+	if err != nil {
+		return err
+	}
+	return scope.Check(trip.RouteID)
+}
+
+// scopeRouteIDs повертає маршрути, якими обмежується вибірка: nil - без обмежень
+func scopeRouteIDs(scope *RouteScope) []int64 {
+	if scope == nil {
+		return nil
+	}
+	return scope.RouteIDs()
+}
+
 // categorizeProfitability визначає категорію рентабельності
 func categorizeProfitability(profitability float64) string {
 	switch {
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"busoptima/internal/model"
+	"busoptima/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	// apiKeyPrefix префікс, за яким ключі BusOptima легко знайти в конфігураціях та логах
+	apiKeyPrefix = "bo_"
+	// apiKeyDisplayLength кількість перших символів ключа, що зберігаються для впізнавання
+	apiKeyDisplayLength = 11
+	// apiKeyUsageInterval як часто оновлюється час останнього використання ключа
+	apiKeyUsageInterval = time.Minute
+)
+
+// ErrInvalidAPIKey повертається для невідомого, відкликаного або простроченого ключа
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// ErrInvalidAPIKeyRequest повертається для некоректних даних ключа або дозволів, яких немає в адміністратора
+var ErrInvalidAPIKeyRequest = errors.New("invalid API key request")
+
+// ErrAPIKeyRouteScoped повертається, коли ключ створює або змінює користувач з обмеженням маршрутами.
+// Ключ діє на всі маршрути, тож інакше через нього можна було б обійти це обмеження
+var ErrAPIKeyRouteScoped = errors.New("users restricted to assigned routes cannot create or change API keys")
+
+// APIKeyCredentials новий ключ разом з його значенням (показується лише один раз)
+type APIKeyCredentials struct {
+	APIKey *model.APIKey
+	Key    string
+}
+
+// APIKeyService інтерфейс для керування API ключами інтеграцій
+type APIKeyService interface {
+	GetAll(ctx context.Context) ([]model.APIKey, error)
+	GetByID(ctx context.Context, id int64) (*model.APIKey, error)
+	Create(ctx context.Context, key *model.APIKey, grantorPermissions []string, grantorRoutes *RouteScope) (*APIKeyCredentials, error)
+	Update(ctx context.Context, key *model.APIKey, grantorPermissions []string, grantorRoutes *RouteScope) (*model.APIKey, error)
+	Revoke(ctx context.Context, id int64) error
+	Authenticate(ctx context.Context, rawKey, ipAddress string) (*model.APIKey, error)
+}
+
+// apiKeyService реалізація APIKeyService
+type apiKeyService struct {
+	apiKeyRepo repository.APIKeyRepository
+}
+
+// NewAPIKeyService створює новий сервіс API ключів
+func NewAPIKeyService(apiKeyRepo repository.APIKeyRepository) APIKeyService {
+	return &apiKeyService{apiKeyRepo: apiKeyRepo}
+}
+
+// GetAll повертає всі ключі
+func (s *apiKeyService) GetAll(ctx context.Context) ([]model.APIKey, error) {
+	return s.apiKeyRepo.GetAll(ctx)
+}
+
+// GetByID повертає ключ за ID
+func (s *apiKeyService) GetByID(ctx context.Context, id int64) (*model.APIKey, error) {
+	return s.apiKeyRepo.GetByID(ctx, id)
+}
+
+// Create генерує новий ключ. Видати можна лише дозволи, які має сам адміністратор,
+// і лише якщо він не обмежений призначеними маршрутами
+func (s *apiKeyService) Create(ctx context.Context, key *model.APIKey, grantorPermissions []string, grantorRoutes *RouteScope) (*APIKeyCredentials, error) {
+	if grantorRoutes != nil {
+		return nil, ErrAPIKeyRouteScoped
+	}
+
+	permissions, err := validateAPIKey(key, grantorPermissions)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := generateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	rawKey := apiKeyPrefix + secret
+
+	key.Permissions = permissions
+	key.KeyPrefix = rawKey[:apiKeyDisplayLength]
+	key.KeyHash = hashToken(rawKey)
+
+	if err := s.apiKeyRepo.Create(ctx, key); err != nil {
+		return nil, err
+	}
+
+	created, err := s.apiKeyRepo.GetByID(ctx, key.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &APIKeyCredentials{APIKey: created, Key: rawKey}, nil
+}
+
+// Update змінює назву, термін дії та дозволи ключа
+func (s *apiKeyService) Update(ctx context.Context, key *model.APIKey, grantorPermissions []string, grantorRoutes *RouteScope) (*model.APIKey, error) {
+	if grantorRoutes != nil {
+		return nil, ErrAPIKeyRouteScoped
+	}
+
+	permissions, err := validateAPIKey(key, grantorPermissions)
+	if err != nil {
+		return nil, err
+	}
+	key.Permissions = permissions
+
+	if err := s.apiKeyRepo.Update(ctx, key); err != nil {
+		return nil, err
+	}
+
+	return s.apiKeyRepo.GetByID(ctx, key.ID)
+}
+
+// Revoke відкликає ключ
+func (s *apiKeyService) Revoke(ctx context.Context, id int64) error {
+	return s.apiKeyRepo.Revoke(ctx, id)
+}
+
+// Authenticate перевіряє ключ та фіксує його використання
+func (s *apiKeyService) Authenticate(ctx context.Context, rawKey, ipAddress string) (*model.APIKey, error) {
+	if !strings.HasPrefix(rawKey, apiKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	key, err := s.apiKeyRepo.GetByHash(ctx, hashToken(rawKey))
+	if err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt)) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	// Помилка оновлення статистики не повинна блокувати запит
+	if err := s.apiKeyRepo.TouchLastUsed(ctx, key.ID, ipAddress, apiKeyUsageInterval); err != nil {
+		log.Printf("Failed to update API key usage: %v", err)
+	}
+
+	return key, nil
+}
+
+// validateAPIKey перевіряє дані ключа та повертає список дозволів без дублікатів
+func validateAPIKey(key *model.APIKey, grantorPermissions []string) ([]string, error) {
+	key.Name = strings.TrimSpace(key.Name)
+	if key.Name == "" {
+		return nil, fmt.Errorf("%w: API key name is required", ErrInvalidAPIKeyRequest)
+	}
+
+	if key.ExpiresAt != nil && !key.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("%w: expires_at must be in the future", ErrInvalidAPIKeyRequest)
+	}
+
+	if len(key.Permissions) == 0 {
+		return nil, fmt.Errorf("%w: at least one permission is required", ErrInvalidAPIKeyRequest)
+	}
+
+	granted := make(map[string]bool, len(grantorPermissions))
+	for _, p := range grantorPermissions {
+		granted[p] = true
+	}
+
+	seen := make(map[string]bool, len(key.Permissions))
+	permissions := make([]string, 0, len(key.Permissions))
+	for _, p := range key.Permissions {
+		if seen[p] {
+			continue
+		}
+		// Ключ не може мати більше прав, ніж адміністратор, який його створює
+		if !granted[p] {
+			return nil, fmt.Errorf("%w: permission %q does not exist or is not granted to you", ErrInvalidAPIKeyRequest, p)
+		}
+		seen[p] = true
+		permissions = append(permissions, p)
+	}
+
+	return permissions, nil
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"busoptima/internal/model"
+	"busoptima/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAPIKeys зберігає ключі за хешем та фіксує оновлення часу використання
+type fakeAPIKeys struct {
+	repository.APIKeyRepository
+
+	keys     map[string]*model.APIKey
+	touched  []int64
+	touchErr error
+}
+
+func (f *fakeAPIKeys) Create(ctx context.Context, key *model.APIKey) error {
+	key.ID = int64(len(f.keys) + 1)
+	stored := *key
+	f.keys[key.KeyHash] = &stored
+	return nil
+}
+
+func (f *fakeAPIKeys) GetByID(ctx context.Context, id int64) (*model.APIKey, error) {
+	for _, key := range f.keys {
+		if key.ID == id {
+			copied := *key
+			return &copied, nil
+		}
+	}
+	return nil, fmt.Errorf("API key with id %d %w", id, repository.ErrNotFound)
+}
+
+func (f *fakeAPIKeys) GetByHash(ctx context.Context, keyHash string) (*model.APIKey, error) {
+	key, ok := f.keys[keyHash]
+	if !ok {
+		return nil, fmt.Errorf("API key %w", repository.ErrNotFound)
+	}
+	copied := *key
+	return &copied, nil
+}
+
+func (f *fakeAPIKeys) TouchLastUsed(ctx context.Context, id int64, ipAddress string, minInterval time.Duration) error {
+	f.touched = append(f.touched, id)
+	return f.touchErr
+}
+
+func TestValidateAPIKey(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	grantor := []string{"analytics:read", "trips:read"}
+
+	tests := []struct {
+		name     string
+		key      model.APIKey
+		want     []string
+		wantName string
+		wantErr  bool
+	}{
+		{name: "permissions within grantor", key: model.APIKey{Name: " BI export ", Permissions: []string{"analytics:read"}}, want: []string{"analytics:read"}, wantName: "BI export"},
+		{name: "duplicates dropped", key: model.APIKey{Name: "BI", Permissions: []string{"trips:read", "analytics:read", "trips:read"}}, want: []string{"trips:read", "analytics:read"}, wantName: "BI"},
+		{name: "expiry in the future", key: model.APIKey{Name: "BI", Permissions: []string{"trips:read"}, ExpiresAt: &future}, want: []string{"trips:read"}, wantName: "BI"},
+		// Ключ не може мати більше прав, ніж той, хто його видає
+		{name: "permission the grantor lacks", key: model.APIKey{Name: "BI", Permissions: []string{"analytics:read", "users:write"}}, wantErr: true},
+		{name: "no permissions", key: model.APIKey{Name: "BI"}, wantErr: true},
+		{name: "blank name", key: model.APIKey{Name: "  ", Permissions: []string{"trips:read"}}, wantErr: true},
+		{name: "expiry in the past", key: model.APIKey{Name: "BI", Permissions: []string{"trips:read"}, ExpiresAt: &past}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := tt.key
+			permissions, err := validateAPIKey(&key, grantor)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidAPIKeyRequest)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, permissions)
+			assert.Equal(t, tt.wantName, key.Name)
+		})
+	}
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name      string
+		rawKey    string
+		stored    *model.APIKey
+		touchErr  error
+		wantValid bool
+	}{
+		{name: "active key", rawKey: "bo_active", stored: &model.APIKey{ID: 1}, wantValid: true},
+		{name: "key expiring later", rawKey: "bo_active", stored: &model.APIKey{ID: 1, ExpiresAt: &future}, wantValid: true},
+		// Статистика використання не впливає на результат перевірки
+		{name: "usage update failure", rawKey: "bo_active", stored: &model.APIKey{ID: 1}, touchErr: errors.New("connection refused"), wantValid: true},
+		{name: "revoked key", rawKey: "bo_active", stored: &model.APIKey{ID: 1, RevokedAt: &past}},
+		{name: "expired key", rawKey: "bo_active", stored: &model.APIKey{ID: 1, ExpiresAt: &past}},
+		{name: "unknown key", rawKey: "bo_unknown", stored: &model.APIKey{ID: 1}},
+		{name: "key without prefix", rawKey: "active", stored: &model.APIKey{ID: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeAPIKeys{keys: map[string]*model.APIKey{}, touchErr: tt.touchErr}
+			tt.stored.KeyHash = hashToken("bo_active")
+			store.keys[tt.stored.KeyHash] = tt.stored
+
+			key, err := NewAPIKeyService(store).Authenticate(context.Background(), tt.rawKey, "10.0.0.1")
+			if !tt.wantValid {
+				assert.ErrorIs(t, err, ErrInvalidAPIKey)
+				assert.Nil(t, key)
+				assert.Empty(t, store.touched)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.stored.ID, key.ID)
+			assert.Equal(t, []int64{tt.stored.ID}, store.touched)
+		})
+	}
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	store := &fakeAPIKeys{keys: map[string]*model.APIKey{}}
+	s := NewAPIKeyService(store)
+	ctx := context.Background()
+
+	credentials, err := s.Create(ctx, &model.APIKey{Name: "BI", Permissions: []string{"analytics:read"}}, []string{"analytics:read"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, credentials.Key[:apiKeyDisplayLength], credentials.APIKey.KeyPrefix)
+
+	// Зберігається лише хеш, і виданий ключ одразу приймається
+	key, err := s.Authenticate(ctx, credentials.Key, "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"analytics:read"}, key.Permissions)
+	assert.NotContains(t, store.keys, credentials.Key)
+}
+
+func TestAPIKeyChangesRejectRouteScopedGrantor(t *testing.T) {
+	s := NewAPIKeyService(&fakeAPIKeys{keys: map[string]*model.APIKey{}})
+	scope := NewRouteScope([]int64{1})
+	key := func() *model.APIKey { return &model.APIKey{ID: 1, Name: "BI", Permissions: []string{"trips:read"}} }
+
+	_, err := s.Create(context.Background(), key(), []string{"trips:read"}, scope)
+	assert.ErrorIs(t, err, ErrAPIKeyRouteScoped)
+
+	_, err = s.Update(context.Background(), key(), []string{"trips:read"}, scope)
+	assert.ErrorIs(t, err, ErrAPIKeyRouteScoped)
+}
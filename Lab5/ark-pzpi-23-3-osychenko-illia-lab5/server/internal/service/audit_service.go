@@ -10,6 +10,9 @@ import (
 // AuditService інтерфейс для роботи з журналом аудиту
 type AuditService interface {
 	LogAction(ctx context.Context, userID int64, action, entityType, entityID string, oldValues, newValues map[string]any, ipAddress string) error
+	LogDeviceAction(ctx context.Context, deviceID int64, action, entityType, entityID string, newValues map[string]any, ipAddress string) error
+	LogAPIKeyAction(ctx context.Context, apiKeyID int64, action, entityType, entityID string, oldValues, newValues map[string]any, ipAddress string) error
+	LogSecurityEvent(ctx context.Context, userID *int64, action string, details map[string]any, ipAddress string) error
 	GetAuditLogs(ctx context.Context, filters map[string]any) ([]model.AuditLog, error)
 	GetAuditLogsCount(ctx context.Context, filters map[string]any) (int64, error)
 }
@@ -46,6 +49,62 @@ func (s *auditService) LogAction(ctx context.Context, userID int64, action, enti
 	return s.auditRepo.Create(ctx, log)
 }
 
+// LogDeviceAction записує дію IoT-пристрою в журнал аудиту
+func (s *auditService) LogDeviceAction(ctx context.Context, deviceID int64, action, entityType, entityID string, newValues map[string]any, ipAddress string) error {
+	log := &model.AuditLog{
+		DeviceID:   &deviceID,
+		Action:     action,
+		EntityType: entityType,
+		IPAddress:  ipAddress,
+		OldValues:  make(map[string]any),
+		NewValues:  newValues,
+	}
+
+	if entityID != "" {
+		if id, err := strconv.ParseInt(entityID, 10, 64); err == nil {
+			log.EntityID = &id
+		}
+	}
+
+	return s.auditRepo.Create(ctx, log)
+}
+
+// LogAPIKeyAction записує дію, виконану через API-ключ, в журнал аудиту
+func (s *auditService) LogAPIKeyAction(ctx context.Context, apiKeyID int64, action, entityType, entityID string, oldValues, newValues map[string]any, ipAddress string) error {
+	log := &model.AuditLog{
+		APIKeyID:   &apiKeyID,
+		Action:     action,
+		EntityType: entityType,
+		IPAddress:  ipAddress,
+		OldValues:  oldValues,
+		NewValues:  newValues,
+	}
+
+	if entityID != "" {
+		if id, err := strconv.ParseInt(entityID, 10, 64); err == nil {
+			log.EntityID = &id
+		}
+	}
+
+	return s.auditRepo.Create(ctx, log)
+}
+
+// LogSecurityEvent записує подію безпеки (наприклад, невдалий вхід).
+// Користувач може бути невідомим, тому userID допускає nil
+func (s *auditService) LogSecurityEvent(ctx context.Context, userID *int64, action string, details map[string]any, ipAddress string) error {
+	log := &model.AuditLog{
+		UserID:     userID,
+		Action:     action,
+		EntityType: "auth",
+		EntityID:   userID,
+		IPAddress:  ipAddress,
+		OldValues:  make(map[string]any),
+		NewValues:  details,
+	}
+
+	return s.auditRepo.Create(ctx, log)
+}
+
 // GetAuditLogs повертає записи аудиту з фільтрами
 func (s *auditService) GetAuditLogs(ctx context.Context, filters map[string]any) ([]model.AuditLog, error) {
 	return s.auditRepo.GetAll(ctx, filters)
@@ -2,7 +2,13 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -14,28 +20,124 @@ import (
 
 // AuthService інтерфейс для автентифікації
 type AuthService interface {
-	Login(ctx context.Context, email, password string) (*LoginResponse, error)
-	DeviceAuth(ctx context.Context, serialNumber, token string) (*DeviceAuthResponse, error)
+	Login(ctx context.Context, email, password, ipAddress string) (*LoginResponse, error)
+	CompleteTwoFactorLogin(ctx context.Context, challengeToken, code, ipAddress string) (*LoginResponse, error)
+	StartTwoFactorEnrollment(ctx context.Context, challengeToken string) (*TwoFactorEnrollment, error)
+	ConfirmTwoFactor(ctx context.Context, userID int64, code, ipAddress string) ([]string, error)
+	DisableTwoFactor(ctx context.Context, userID int64, code, ipAddress string) error
+	RegenerateRecoveryCodes(ctx context.Context, userID int64, code, ipAddress string) ([]string, error)
+	CompleteExternalLogin(ctx context.Context, user *model.User, ipAddress string) (*LoginResponse, error)
+	DeviceAuth(ctx context.Context, serialNumber, token, firmwareVersion string) (*DeviceAuthResponse, error)
+	VerifyDeviceToken(token string) (*DeviceIdentity, error)
 	RefreshToken(ctx context.Context, refreshToken string) (*LoginResponse, error)
+	Logout(ctx context.Context, refreshToken, accessToken string) error
 	CreateUser(ctx context.Context, user *model.User, password string) error
 	UpdateUser(ctx context.Context, user *model.User) error
-	UpdateUserRole(ctx context.Context, userID, roleID int64) error
+	UpdateUserRole(ctx context.Context, userID, roleID int64, grantorPermissions []string, grantorScope *RouteScope) error
+	UnlockUser(ctx context.Context, userID int64) error
+	DeactivateUser(ctx context.Context, userID int64) error
+	ReactivateUser(ctx context.Context, userID int64) error
+	ForceLogout(ctx context.Context, userID int64) error
 	GetUsers(ctx context.Context) ([]model.User, error)
 }
 
+const (
+	// accessTokenTTL час життя access токена
+	accessTokenTTL = time.Hour
+	// refreshTokenTTL час життя refresh токена
+	refreshTokenTTL = time.Hour * 24 * 7 // 7 днів
+	// deviceTokenTTL час життя токена пристрою
+	deviceTokenTTL = time.Hour * 24
+
+	// maxFailedLogins кількість невдалих спроб поспіль до блокування облікового запису
+	maxFailedLogins = 5
+	// accountLockBase тривалість першого блокування облікового запису
+	accountLockBase = 15 * time.Minute
+	// accountLockMax максимальна тривалість блокування
+	accountLockMax = 24 * time.Hour
+	// loginBackoffBase затримка після першої невдалої спроби, далі подвоюється
+	loginBackoffBase = time.Second
+	// loginBackoffMax максимальна затримка між спробами
+	loginBackoffMax = time.Minute
+
+	// ipFailureWindow вікно, в якому рахуються невдалі спроби з однієї IP-адреси
+	ipFailureWindow = 15 * time.Minute
+	// ipBackoffThreshold кількість невдач з IP, після якої вмикається затримка
+	ipBackoffThreshold = 10
+	// ipMaxFailures кількість невдач з IP, після якої вхід блокується до кінця вікна
+	ipMaxFailures = 50
+
+	// mfaChallengeTTL час, протягом якого можна ввести код другого фактора
+	mfaChallengeTTL = 5 * time.Minute
+	// mfaChallengeTokenType тип токена проміжного етапу входу
+	mfaChallengeTokenType = "mfa_challenge"
+	// mfaPurposeVerify challenge для перевірки коду вже налаштованої 2FA
+	mfaPurposeVerify = "verify"
+	// mfaPurposeEnroll challenge для обов'язкового налаштування 2FA під час входу
+	mfaPurposeEnroll = "enroll"
+)
+
+// credentialFailureReasons причини невдалих спроб, що враховуються в ліміті для IP-адреси.
+// Спроби, відхилені через блокування чи затримку, не рахуються, інакше ліміт сам себе продовжував би
+var credentialFailureReasons = []string{"unknown_email", "invalid_password", "invalid_mfa_code"}
+
+// ErrInvalidChallenge повертається для недійсного, простроченого або вже використаного challenge токена
+var ErrInvalidChallenge = errors.New("invalid or expired challenge token")
+
+// ErrAccountDeactivated повертається при вході або оновленні токена деактивованого користувача
+var ErrAccountDeactivated = errors.New("account is deactivated")
+
+// dummyPasswordHash bcrypt хеш для порівняння, коли користувача не знайдено
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("busoptima-dummy-password"), bcrypt.DefaultCost)
+
+// LoginThrottledError повертається, коли вхід тимчасово заборонено
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (e *LoginThrottledError) Error() string {
+	if e.Locked {
+		return "account is temporarily locked due to too many failed login attempts"
+	}
+	return "too many login attempts, try again later"
+}
+
 // authService реалізація AuthService
 type authService struct {
-	userRepo   repository.UserRepository
-	deviceRepo repository.DeviceRepository
-	jwtSecret  string
+	userRepo    repository.UserRepository
+	roleRepo    repository.RoleRepository
+	deviceRepo  repository.DeviceRepository
+	refreshRepo repository.RefreshTokenRepository
+	revocations TokenRevocationService
+	keys        KeyService
+
+	loginAttempts repository.LoginAttemptRepository
+	auditService  AuditService
+	twoFactor     TwoFactorService
+	permissions   PermissionService
 }
 
-// LoginResponse відповідь на успішну автентифікацію
+// LoginResponse відповідь на автентифікацію.
+// Якщо потрібен другий фактор, замість токенів повертається challenge_token
 type LoginResponse struct {
-	AccessToken  string      `json:"access_token"`
-	RefreshToken string      `json:"refresh_token"`
-	ExpiresIn    int         `json:"expires_in"`
-	User         *model.User `json:"user"`
+	AccessToken  string      `json:"access_token,omitempty"`
+	RefreshToken string      `json:"refresh_token,omitempty"`
+	ExpiresIn    int         `json:"expires_in,omitempty"`
+	User         *model.User `json:"user,omitempty"`
+
+	MFARequired           bool     `json:"mfa_required,omitempty"`
+	MFAEnrollmentRequired bool     `json:"mfa_enrollment_required,omitempty"`
+	ChallengeToken        string   `json:"challenge_token,omitempty"`
+	RecoveryCodes         []string `json:"recovery_codes,omitempty"`
+}
+
+// mfaChallenge розібраний challenge токен
+type mfaChallenge struct {
+	jti       string
+	userID    int64
+	purpose   string
+	expiresAt time.Time
 }
 
 // DeviceAuthResponse відповідь на автентифікацію пристрою
@@ -45,49 +147,262 @@ type DeviceAuthResponse struct {
 	DeviceID    int64  `json:"device_id"`
 }
 
+// DeviceIdentity пристрій, якому виданий перевірений токен. JTI та IssuedAt дозволяють
+// довготривалим з'єднанням повторно перевіряти, чи токен не відкликано
+type DeviceIdentity struct {
+	DeviceID     int64
+	SerialNumber string
+	JTI          string
+	IssuedAt     time.Time
+	ExpiresAt    time.Time
+}
+
 // NewAuthService створює новий сервіс автентифікації
-func NewAuthService(userRepo repository.UserRepository, deviceRepo repository.DeviceRepository, jwtSecret string) AuthService {
+func NewAuthService(userRepo repository.UserRepository, roleRepo repository.RoleRepository, deviceRepo repository.DeviceRepository, refreshRepo repository.RefreshTokenRepository, revocations TokenRevocationService, keys KeyService, loginAttempts repository.LoginAttemptRepository, auditService AuditService, twoFactor TwoFactorService, permissions PermissionService) AuthService {
 	return &authService{
-		userRepo:   userRepo,
-		deviceRepo: deviceRepo,
-		jwtSecret:  jwtSecret,
+		userRepo:    userRepo,
+		roleRepo:    roleRepo,
+		deviceRepo:  deviceRepo,
+		refreshRepo: refreshRepo,
+		revocations: revocations,
+		keys:        keys,
+
+		loginAttempts: loginAttempts,
+		auditService:  auditService,
+		twoFactor:     twoFactor,
+		permissions:   permissions,
 	}
 }
 
-// Login автентифікує користувача
-func (s *authService) Login(ctx context.Context, email, password string) (*LoginResponse, error) {
-	fmt.Printf("DEBUG: Attempting login for email: %s\n", email)
+// Login автентифікує користувача.
+// Спроби обмежуються за IP-адресою та обліковим записом: після кожної невдачі зростає затримка,
+// а після maxFailedLogins невдач поспіль обліковий запис тимчасово блокується.
+// Якщо користувач має 2FA або вона обов'язкова для його ролі, повертається challenge_token,
+// а токени видаються лише після CompleteTwoFactorLogin.
+func (s *authService) Login(ctx context.Context, email, password, ipAddress string) (*LoginResponse, error) {
+	if err := s.checkIPThrottle(ctx, email, ipAddress); err != nil {
+		return nil, err
+	}
 
 	user, err := s.userRepo.GetByEmail(ctx, email)
 	if err != nil {
-		fmt.Printf("DEBUG: GetByEmail error: %v\n", err)
+		// Порівнюємо з фіктивним хешем, щоб час відповіді не видавав існування email
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		s.recordLoginFailure(ctx, email, nil, ipAddress, "unknown_email")
 		return nil, fmt.Errorf("invalid credentials")
 	}
 
-	fmt.Printf("DEBUG: Found user: %s, hash: %s\n", user.Email, user.PasswordHash[:20]+"...")
+	if err := s.checkAccountThrottle(ctx, user, ipAddress); err != nil {
+		return nil, err
+	}
+
+	// Перевіряємо пароль. Користувачі, створені при вході через OIDC, не мають локального пароля
+	// і входять лише через провайдера; для них порівняння з фіктивним хешем вирівнює час відповіді
+	passwordHash := []byte(user.PasswordHash)
+	if len(passwordHash) == 0 {
+		passwordHash = dummyPasswordHash
+	}
+	err = bcrypt.CompareHashAndPassword(passwordHash, []byte(password))
+	if err != nil || user.PasswordHash == "" {
+		return nil, s.handleFailedLogin(ctx, user, ipAddress, "invalid_password", fmt.Errorf("invalid credentials"))
+	}
+
+	// Про деактивацію повідомляємо лише після перевірки пароля, щоб не розкривати стан облікового запису
+	if !user.IsActive {
+		s.recordLoginFailure(ctx, email, &user.ID, ipAddress, "account_deactivated")
+		return nil, ErrAccountDeactivated
+	}
+
+	// Лічильник невдач не скидається до перевірки другого фактора,
+	// інакше знання пароля дозволило б необмежено підбирати код
+	return s.requireSecondFactor(ctx, user, ipAddress)
+}
+
+// requireSecondFactor повертає challenge_token, якщо користувач має 2FA або вона обов'язкова для його ролі,
+// інакше одразу відкриває сесію
+func (s *authService) requireSecondFactor(ctx context.Context, user *model.User, ipAddress string) (*LoginResponse, error) {
+	mfaEnabled, err := s.twoFactor.IsEnabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case mfaEnabled:
+		return s.issueChallenge(user.ID, mfaPurposeVerify)
+	case user.Role != nil && user.Role.MFARequired:
+		return s.issueChallenge(user.ID, mfaPurposeEnroll)
+	}
+
+	return s.completeLogin(ctx, user, ipAddress)
+}
 
-	// Перевіряємо пароль
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+// CompleteTwoFactorLogin завершує вхід кодом другого фактора.
+// Для challenge з метою enroll код підтверджує щойно налаштовану 2FA і у відповідь додаються коди відновлення
+func (s *authService) CompleteTwoFactorLogin(ctx context.Context, challengeToken, code, ipAddress string) (*LoginResponse, error) {
+	challenge, err := s.parseChallenge(challengeToken)
 	if err != nil {
-		fmt.Printf("DEBUG: Password comparison error: %v\n", err)
-		return nil, fmt.Errorf("invalid credentials")
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, challenge.userID)
+	if err != nil {
+		return nil, ErrInvalidChallenge
+	}
+
+	// Користувача могли деактивувати між введенням пароля та коду
+	if !user.IsActive {
+		return nil, ErrAccountDeactivated
+	}
+
+	var recoveryCodes []string
+	err = s.limitCodeAttempt(ctx, user, ipAddress, func() error {
+		var err error
+		if challenge.purpose == mfaPurposeEnroll {
+			recoveryCodes, err = s.twoFactor.Confirm(ctx, user.ID, code, ipAddress)
+		} else {
+			err = s.twoFactor.VerifyCode(ctx, user.ID, code, ipAddress)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Challenge одноразовий
+	if err := s.revocations.RevokeToken(ctx, challenge.jti, &user.ID, challenge.expiresAt, "mfa_challenge_used"); err != nil {
+		return nil, err
+	}
+
+	response, err := s.completeLogin(ctx, user, ipAddress)
+	if err != nil {
+		return nil, err
+	}
+	response.RecoveryCodes = recoveryCodes
+
+	return response, nil
+}
+
+// StartTwoFactorEnrollment генерує TOTP секрет для користувача, якому 2FA обов'язкова, але ще не налаштована
+func (s *authService) StartTwoFactorEnrollment(ctx context.Context, challengeToken string) (*TwoFactorEnrollment, error) {
+	challenge, err := s.parseChallenge(challengeToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if challenge.purpose != mfaPurposeEnroll {
+		return nil, ErrInvalidChallenge
+	}
+
+	return s.twoFactor.Enroll(ctx, challenge.userID)
+}
+
+// ConfirmTwoFactor вмикає 2FA автентифікованого користувача.
+// Невірні коди враховуються в тому ж ліміті спроб, що й при вході
+func (s *authService) ConfirmTwoFactor(ctx context.Context, userID int64, code, ipAddress string) ([]string, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var recoveryCodes []string
+	err = s.limitCodeAttempt(ctx, user, ipAddress, func() error {
+		var err error
+		recoveryCodes, err = s.twoFactor.Confirm(ctx, user.ID, code, ipAddress)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return recoveryCodes, nil
+}
+
+// DisableTwoFactor вимикає 2FA автентифікованого користувача з обмеженням кількості спроб
+func (s *authService) DisableTwoFactor(ctx context.Context, userID int64, code, ipAddress string) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
 	}
 
-	fmt.Printf("DEBUG: Password verification successful\n")
+	return s.limitCodeAttempt(ctx, user, ipAddress, func() error {
+		return s.twoFactor.Disable(ctx, user.ID, code, ipAddress)
+	})
+}
 
-	// Отримуємо дозволи користувача
-	permissions, err := s.userRepo.GetUserPermissions(ctx, user.ID)
+// RegenerateRecoveryCodes видає нові коди відновлення з обмеженням кількості спроб
+func (s *authService) RegenerateRecoveryCodes(ctx context.Context, userID int64, code, ipAddress string) ([]string, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user permissions: %w", err)
+		return nil, err
 	}
 
+	var recoveryCodes []string
+	err = s.limitCodeAttempt(ctx, user, ipAddress, func() error {
+		var err error
+		recoveryCodes, err = s.twoFactor.RegenerateRecoveryCodes(ctx, user.ID, code, ipAddress)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return recoveryCodes, nil
+}
+
+// limitCodeAttempt перевіряє код другого фактора з урахуванням затримок і блокувань за IP та обліковим записом.
+// Невірний код рахується як невдала спроба входу, інакше перебір кодів обходив би ліміт
+func (s *authService) limitCodeAttempt(ctx context.Context, user *model.User, ipAddress string, verify func() error) error {
+	if err := s.checkIPThrottle(ctx, user.Email, ipAddress); err != nil {
+		return err
+	}
+	if err := s.checkAccountThrottle(ctx, user, ipAddress); err != nil {
+		return err
+	}
+
+	if err := verify(); err != nil {
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			return s.handleFailedLogin(ctx, user, ipAddress, "invalid_mfa_code", err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// CompleteExternalLogin завершує вхід користувача, автентифікованого зовнішнім провайдером (OIDC).
+// Пароль не перевіряється - за нього відповідає провайдер, але 2FA запитується так само, як при вході паролем
+func (s *authService) CompleteExternalLogin(ctx context.Context, user *model.User, ipAddress string) (*LoginResponse, error) {
+	if !user.IsActive {
+		s.recordLoginFailure(ctx, user.Email, &user.ID, ipAddress, "account_deactivated")
+		return nil, ErrAccountDeactivated
+	}
+
+	return s.requireSecondFactor(ctx, user, ipAddress)
+}
+
+// completeLogin скидає лічильник невдач та відкриває нову сесію
+func (s *authService) completeLogin(ctx context.Context, user *model.User, ipAddress string) (*LoginResponse, error) {
+	if user.FailedLoginCount > 0 || user.LockedUntil != nil {
+		if err := s.userRepo.ResetFailedLogins(ctx, user.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	s.recordLoginAttempt(ctx, &model.LoginAttempt{Email: user.Email, UserID: &user.ID, IPAddress: ipAddress, Success: true})
+
 	// Генеруємо JWT токени
-	accessToken, err := s.generateAccessToken(user, permissions)
+	accessToken, err := s.generateAccessToken(user)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate access token: %w", err)
 	}
 
-	refreshToken, err := s.generateRefreshToken(user.ID)
+	// Кожен вхід відкриває нову сесію (нове сімейство refresh токенів)
+	familyID, err := generateRandomToken(16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate session id: %w", err)
+	}
+
+	refreshToken, err := s.issueRefreshToken(ctx, user.ID, familyID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
 	}
@@ -103,8 +418,233 @@ func (s *authService) Login(ctx context.Context, email, password string) (*Login
 	}, nil
 }
 
+// issueChallenge видає короткоживучий токен для другого етапу входу
+func (s *authService) issueChallenge(userID int64, purpose string) (*LoginResponse, error) {
+	jti, err := generateRandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{
+		"jti":     jti,
+		"user_id": userID,
+		"type":    mfaChallengeTokenType,
+		"purpose": purpose,
+		"exp":     time.Now().Add(mfaChallengeTTL).Unix(),
+		"iat":     jwt.NewNumericDate(time.Now()),
+	}
+
+	token, err := s.keys.Sign(claims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate challenge token: %w", err)
+	}
+
+	return &LoginResponse{
+		MFARequired:           true,
+		MFAEnrollmentRequired: purpose == mfaPurposeEnroll,
+		ChallengeToken:        token,
+		ExpiresIn:             int(mfaChallengeTTL.Seconds()),
+	}, nil
+}
+
+// parseChallenge перевіряє підпис, тип та відкликання challenge токена
+func (s *authService) parseChallenge(tokenString string) (*mfaChallenge, error) {
+	token, err := jwt.Parse(tokenString, s.keys.Keyfunc, jwt.WithValidMethods(s.keys.ValidMethods()))
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidChallenge
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidChallenge
+	}
+
+	tokenType, _ := claims["type"].(string)
+	jti, _ := claims["jti"].(string)
+	purpose, _ := claims["purpose"].(string)
+	userID, ok := claims["user_id"].(float64)
+	if tokenType != mfaChallengeTokenType || jti == "" || !ok {
+		return nil, ErrInvalidChallenge
+	}
+
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return nil, ErrInvalidChallenge
+	}
+
+	var issuedAt time.Time
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		issuedAt = iat.Time
+	}
+
+	if s.revocations.IsRevoked(jti, int64(userID), issuedAt) {
+		return nil, ErrInvalidChallenge
+	}
+
+	return &mfaChallenge{
+		jti:       jti,
+		userID:    int64(userID),
+		purpose:   purpose,
+		expiresAt: exp.Time,
+	}, nil
+}
+
+// UnlockUser знімає блокування входу та скидає лічильник невдалих спроб
+func (s *authService) UnlockUser(ctx context.Context, userID int64) error {
+	return s.userRepo.ResetFailedLogins(ctx, userID)
+}
+
+// checkIPThrottle обмежує кількість невдалих спроб входу з однієї IP-адреси
+func (s *authService) checkIPThrottle(ctx context.Context, email, ipAddress string) error {
+	now := time.Now()
+
+	failures, lastFailure, err := s.loginAttempts.GetIPFailures(ctx, ipAddress, now.Add(-ipFailureWindow), credentialFailureReasons)
+	if err != nil {
+		return err
+	}
+
+	if failures == 0 || lastFailure == nil {
+		return nil
+	}
+
+	var retryAt time.Time
+	switch {
+	case failures >= ipMaxFailures:
+		retryAt = lastFailure.Add(ipFailureWindow)
+	case failures >= ipBackoffThreshold:
+		retryAt = lastFailure.Add(loginBackoff(failures - ipBackoffThreshold + 1))
+	default:
+		return nil
+	}
+
+	if !now.Before(retryAt) {
+		return nil
+	}
+
+	s.audit(ctx, "LOGIN_BLOCKED", nil, map[string]any{
+		"email":       email,
+		"reason":      "ip_throttled",
+		"ip_failures": failures,
+	}, ipAddress)
+
+	return &LoginThrottledError{RetryAfter: retryAt.Sub(now)}
+}
+
+// checkAccountThrottle перевіряє блокування облікового запису та затримку між спробами
+func (s *authService) checkAccountThrottle(ctx context.Context, user *model.User, ipAddress string) error {
+	now := time.Now()
+
+	if user.LockedUntil != nil && now.Before(*user.LockedUntil) {
+		s.recordLoginFailure(ctx, user.Email, &user.ID, ipAddress, "account_locked")
+		return &LoginThrottledError{RetryAfter: user.LockedUntil.Sub(now), Locked: true}
+	}
+
+	// Експоненційна затримка між спробами для облікового запису
+	if user.FailedLoginCount > 0 && user.LastFailedLoginAt != nil {
+		retryAt := user.LastFailedLoginAt.Add(loginBackoff(user.FailedLoginCount))
+		if now.Before(retryAt) {
+			s.recordLoginFailure(ctx, user.Email, &user.ID, ipAddress, "throttled")
+			return &LoginThrottledError{RetryAfter: retryAt.Sub(now)}
+		}
+	}
+
+	return nil
+}
+
+// handleFailedLogin фіксує невдалу спробу (невірний пароль або код 2FA) та блокує обліковий запис при перевищенні ліміту.
+// Поки ліміт не досягнуто, повертає failure
+func (s *authService) handleFailedLogin(ctx context.Context, user *model.User, ipAddress, reason string, failure error) error {
+	count, err := s.userRepo.RecordFailedLogin(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	s.recordLoginAttempt(ctx, &model.LoginAttempt{Email: user.Email, UserID: &user.ID, IPAddress: ipAddress, Reason: &reason})
+
+	if count < maxFailedLogins {
+		s.audit(ctx, "LOGIN_FAILED", &user.ID, map[string]any{
+			"email":        user.Email,
+			"reason":       reason,
+			"failed_count": count,
+		}, ipAddress)
+		return failure
+	}
+
+	lockDuration := accountLockDuration(count)
+	if err := s.userRepo.LockUntil(ctx, user.ID, time.Now().Add(lockDuration)); err != nil {
+		return err
+	}
+
+	s.audit(ctx, "ACCOUNT_LOCKED", &user.ID, map[string]any{
+		"email":         user.Email,
+		"failed_count":  count,
+		"lock_duration": lockDuration.String(),
+	}, ipAddress)
+
+	return &LoginThrottledError{RetryAfter: lockDuration, Locked: true}
+}
+
+// recordLoginFailure записує невдалу спробу входу в журнал спроб та журнал аудиту
+func (s *authService) recordLoginFailure(ctx context.Context, email string, userID *int64, ipAddress, reason string) {
+	s.recordLoginAttempt(ctx, &model.LoginAttempt{Email: email, UserID: userID, IPAddress: ipAddress, Reason: &reason})
+
+	action := "LOGIN_FAILED"
+	if reason == "account_locked" {
+		action = "LOGIN_LOCKED"
+	}
+
+	s.audit(ctx, action, userID, map[string]any{
+		"email":  email,
+		"reason": reason,
+	}, ipAddress)
+}
+
+// recordLoginAttempt записує спробу входу. Помилка запису не повинна блокувати вхід
+func (s *authService) recordLoginAttempt(ctx context.Context, attempt *model.LoginAttempt) {
+	if err := s.loginAttempts.Create(ctx, attempt); err != nil {
+		log.Printf("Failed to record login attempt: %v", err)
+	}
+}
+
+// audit записує подію безпеки в журнал аудиту
+func (s *authService) audit(ctx context.Context, action string, userID *int64, details map[string]any, ipAddress string) {
+	if err := s.auditService.LogSecurityEvent(ctx, userID, action, details, ipAddress); err != nil {
+		log.Printf("Failed to write audit log: %v", err)
+	}
+}
+
+// loginBackoff повертає затримку після вказаної кількості невдалих спроб поспіль
+func loginBackoff(failures int) time.Duration {
+	if failures < 1 {
+		return 0
+	}
+	if failures > 16 {
+		return loginBackoffMax
+	}
+
+	delay := loginBackoffBase << (failures - 1)
+	if delay > loginBackoffMax {
+		return loginBackoffMax
+	}
+	return delay
+}
+
+// accountLockDuration повертає тривалість блокування; кожна наступна невдача після блокування подвоює її
+func accountLockDuration(failures int) time.Duration {
+	extra := failures - maxFailedLogins
+	if extra > 16 {
+		return accountLockMax
+	}
+
+	duration := accountLockBase << extra
+	if duration > accountLockMax {
+		return accountLockMax
+	}
+	return duration
+}
+
 // DeviceAuth автентифікує IoT-пристрій
-func (s *authService) DeviceAuth(ctx context.Context, serialNumber, token string) (*DeviceAuthResponse, error) {
+func (s *authService) DeviceAuth(ctx context.Context, serialNumber, token, firmwareVersion string) (*DeviceAuthResponse, error) {
 	// Отримуємо пристрій за серійним номером
 	device, err := s.deviceRepo.GetBySerialNumber(ctx, serialNumber)
 	if err != nil {
@@ -117,6 +657,13 @@ func (s *authService) DeviceAuth(ctx context.Context, serialNumber, token string
 		return nil, fmt.Errorf("invalid device credentials")
 	}
 
+	// Версія прошивки, про яку повідомив пристрій, показує прогрес розгортання оновлень
+	if firmwareVersion != "" && firmwareVersion != device.FirmwareVersion && len(firmwareVersion) <= firmwareVersionMaxLength {
+		if err := s.deviceRepo.UpdateFirmwareVersion(ctx, device.ID, firmwareVersion); err != nil {
+			log.Printf("Failed to update firmware version of device %d: %v", device.ID, err)
+		}
+	}
+
 	// Генеруємо токен для пристрою
 	deviceToken, err := s.generateDeviceToken(device.ID, serialNumber)
 	if err != nil {
@@ -130,52 +677,181 @@ func (s *authService) DeviceAuth(ctx context.Context, serialNumber, token string
 	}, nil
 }
 
-// RefreshToken оновлює токен доступу
-func (s *authService) RefreshToken(ctx context.Context, refreshToken string) (*LoginResponse, error) {
-	// Парсимо refresh token
-	token, err := jwt.Parse(refreshToken, func(token *jwt.Token) (interface{}, error) {
-		return []byte(s.jwtSecret), nil
-	})
+// VerifyDeviceToken перевіряє токен пристрою, виданий DeviceAuth, для каналів поза HTTP (MQTT)
+func (s *authService) VerifyDeviceToken(token string) (*DeviceIdentity, error) {
+	parsed, err := jwt.Parse(token, s.keys.Keyfunc, jwt.WithValidMethods(s.keys.ValidMethods()), jwt.WithExpirationRequired())
+	if err != nil || !parsed.Valid {
+		return nil, fmt.Errorf("invalid device token")
+	}
 
-	if err != nil || !token.Valid {
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("invalid device token")
+	}
+
+	tokenType, _ := claims["type"].(string)
+	deviceID, hasDevice := claims["device_id"].(float64)
+	serialNumber, _ := claims["serial_number"].(string)
+	if tokenType != "device" || !hasDevice || serialNumber == "" {
+		return nil, fmt.Errorf("invalid device token claims")
+	}
+
+	jti, _ := claims["jti"].(string)
+	var issuedAt time.Time
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		issuedAt = iat.Time
+	}
+	if s.revocations.IsDeviceRevoked(jti, int64(deviceID), issuedAt) {
+		return nil, fmt.Errorf("token has been revoked")
+	}
+
+	expiresAt, err := claims.GetExpirationTime()
+	if err != nil || expiresAt == nil {
+		return nil, fmt.Errorf("invalid device token claims")
+	}
+
+	return &DeviceIdentity{
+		DeviceID:     int64(deviceID),
+		SerialNumber: serialNumber,
+		JTI:          jti,
+		IssuedAt:     issuedAt,
+		ExpiresAt:    expiresAt.Time,
+	}, nil
+}
+
+// RefreshToken оновлює токен доступу та ротує refresh токен.
+// Повторне використання вже обміняного токена відкликає всю сесію.
+func (s *authService) RefreshToken(ctx context.Context, refreshToken string) (*LoginResponse, error) {
+	stored, err := s.refreshRepo.GetByHash(ctx, hashToken(refreshToken))
+	if err != nil {
 		return nil, fmt.Errorf("invalid refresh token")
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return nil, fmt.Errorf("invalid token claims")
+	if stored.RevokedAt != nil {
+		return nil, fmt.Errorf("refresh token revoked")
+	}
+
+	if stored.UsedAt != nil {
+		return nil, s.handleRefreshTokenReuse(ctx, stored)
+	}
+
+	if time.Now().After(stored.ExpiresAt) {
+		return nil, fmt.Errorf("refresh token expired")
 	}
 
-	userID := int64(claims["user_id"].(float64))
+	// Атомарно позначаємо токен використаним, щоб паралельний запит з тим самим токеном не пройшов
+	marked, err := s.refreshRepo.MarkUsed(ctx, stored.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+	if !marked {
+		return nil, s.handleRefreshTokenReuse(ctx, stored)
+	}
 
 	// Отримуємо користувача
-	user, err := s.userRepo.GetByID(ctx, userID)
+	user, err := s.userRepo.GetByID(ctx, stored.UserID)
 	if err != nil {
 		return nil, fmt.Errorf("user not found")
 	}
 
-	// Отримуємо дозволи
-	permissions, err := s.userRepo.GetUserPermissions(ctx, user.ID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get user permissions: %w", err)
+	if !user.IsActive {
+		if err := s.refreshRepo.RevokeFamily(ctx, stored.FamilyID, "user_deactivated"); err != nil {
+			return nil, fmt.Errorf("failed to revoke session: %w", err)
+		}
+		return nil, ErrAccountDeactivated
 	}
 
 	// Генеруємо новий access token
-	accessToken, err := s.generateAccessToken(user, permissions)
+	accessToken, err := s.generateAccessToken(user)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate access token: %w", err)
 	}
 
+	// Видаємо новий refresh token у межах тієї ж сесії
+	newRefreshToken, err := s.issueRefreshToken(ctx, user.ID, stored.FamilyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
 	user.PasswordHash = ""
 
 	return &LoginResponse{
 		AccessToken:  accessToken,
-		RefreshToken: refreshToken, // Повертаємо той самий refresh token
+		RefreshToken: newRefreshToken,
 		ExpiresIn:    3600,
 		User:         user,
 	}, nil
 }
 
+// Logout завершує сесію, відкликаючи всі refresh токени її сімейства.
+// Якщо передано access токен цієї сесії, він теж відкликається, а не діє до кінця свого терміну
+func (s *authService) Logout(ctx context.Context, refreshToken, accessToken string) error {
+	stored, err := s.refreshRepo.GetByHash(ctx, hashToken(refreshToken))
+	if err != nil {
+		return fmt.Errorf("invalid refresh token")
+	}
+
+	if err := s.refreshRepo.RevokeFamily(ctx, stored.FamilyID, "logout"); err != nil {
+		return fmt.Errorf("failed to logout: %w", err)
+	}
+
+	if accessToken == "" {
+		return nil
+	}
+
+	jti, expiresAt, ok := s.parseAccessToken(accessToken, stored.UserID)
+	if !ok {
+		// Недійсний або прострочений токен вже не дає доступу, відкликати нічого
+		return nil
+	}
+
+	if err := s.revocations.RevokeToken(ctx, jti, &stored.UserID, expiresAt, "logout"); err != nil {
+		return fmt.Errorf("failed to revoke access token: %w", err)
+	}
+
+	return nil
+}
+
+// parseAccessToken перевіряє підпис access токена та повертає його jti і час закінчення,
+// якщо токен виданий користувачу userID
+func (s *authService) parseAccessToken(tokenString string, userID int64) (string, time.Time, bool) {
+	token, err := jwt.Parse(tokenString, s.keys.Keyfunc, jwt.WithValidMethods(s.keys.ValidMethods()))
+	if err != nil || !token.Valid {
+		return "", time.Time{}, false
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", time.Time{}, false
+	}
+
+	// Службові токени (пристрою, challenge 2FA) мають тип і не є access токенами користувача
+	if _, hasType := claims["type"]; hasType {
+		return "", time.Time{}, false
+	}
+
+	jti, _ := claims["jti"].(string)
+	tokenUserID, ok := claims["user_id"].(float64)
+	if jti == "" || !ok || int64(tokenUserID) != userID {
+		return "", time.Time{}, false
+	}
+
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return "", time.Time{}, false
+	}
+
+	return jti, exp.Time, true
+}
+
+// handleRefreshTokenReuse відкликає сесію, в якій повторно використано refresh токен
+func (s *authService) handleRefreshTokenReuse(ctx context.Context, stored *model.RefreshToken) error {
+	if err := s.refreshRepo.RevokeFamily(ctx, stored.FamilyID, "reuse_detected"); err != nil {
+		return fmt.Errorf("failed to revoke compromised session: %w", err)
+	}
+	return fmt.Errorf("refresh token reuse detected, session revoked")
+}
+
 // CreateUser створює нового користувача
 func (s *authService) CreateUser(ctx context.Context, user *model.User, password string) error {
 	// Хешуємо пароль
@@ -192,12 +868,114 @@ func (s *authService) CreateUser(ctx context.Context, user *model.User, password
 
 // UpdateUser оновлює користувача
 func (s *authService) UpdateUser(ctx context.Context, user *model.User) error {
-	return s.userRepo.Update(ctx, user)
+	existing, err := s.userRepo.GetByID(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return err
+	}
+
+	// Нова роль діє з наступного запиту, деактивація додатково завершує всі сесії
+	s.permissions.InvalidateUser(user.ID)
+
+	if existing.IsActive && !user.IsActive {
+		return revokeUserSessions(ctx, s.revocations, s.refreshRepo, user.ID, "user_deactivated")
+	}
+
+	return nil
 }
 
-// UpdateUserRole оновлює роль користувача
-func (s *authService) UpdateUserRole(ctx context.Context, userID, roleID int64) error {
-	return s.userRepo.UpdateRole(ctx, userID, roleID)
+// DeactivateUser деактивує користувача та завершує всі його сесії
+func (s *authService) DeactivateUser(ctx context.Context, userID int64) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !user.IsActive {
+		return fmt.Errorf("user is already deactivated")
+	}
+
+	if err := s.userRepo.SetActive(ctx, userID, false); err != nil {
+		return err
+	}
+
+	s.permissions.InvalidateUser(userID)
+	return revokeUserSessions(ctx, s.revocations, s.refreshRepo, userID, "user_deactivated")
+}
+
+// ReactivateUser знову дозволяє вхід деактивованому користувачу.
+// Сесії, завершені під час деактивації, не відновлюються
+func (s *authService) ReactivateUser(ctx context.Context, userID int64) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.IsActive {
+		return fmt.Errorf("user is already active")
+	}
+
+	if err := s.userRepo.SetActive(ctx, userID, true); err != nil {
+		return err
+	}
+
+	s.permissions.InvalidateUser(userID)
+	return nil
+}
+
+// ForceLogout завершує всі сесії користувача, не змінюючи його стан
+func (s *authService) ForceLogout(ctx context.Context, userID int64) error {
+	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
+		return err
+	}
+
+	return revokeUserSessions(ctx, s.revocations, s.refreshRepo, userID, "forced_logout")
+}
+
+// UpdateUserRole оновлює роль користувача. Призначити можна лише роль, усі дозволи якої має сам адміністратор,
+// а користувач, обмежений маршрутами, призначає лише ролі з таким самим обмеженням
+func (s *authService) UpdateUserRole(ctx context.Context, userID, roleID int64, grantorPermissions []string, grantorScope *RouteScope) error {
+	role, err := s.roleRepo.GetByID(ctx, roleID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("%w: role %d does not exist", ErrInvalidRole, roleID)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := checkRouteScopeGrant(role, grantorScope); err != nil {
+		return err
+	}
+
+	granted := make(map[string]bool, len(grantorPermissions))
+	for _, p := range grantorPermissions {
+		granted[p] = true
+	}
+	for _, p := range role.Permissions {
+		if !granted[p.Name] {
+			return fmt.Errorf("%w: permission %q of role %q is not granted to you", ErrRoleExceedsGrantor, p.Name, role.Name)
+		}
+	}
+
+	if err := s.userRepo.UpdateRole(ctx, userID, roleID); err != nil {
+		if errors.Is(err, repository.ErrUnknownRole) {
+			return fmt.Errorf("%w: role %d does not exist", ErrInvalidRole, roleID)
+		}
+		return err
+	}
+
+	// Дозволи визначаються під час кожного запиту, тому достатньо скинути кеш
+	s.permissions.InvalidateUser(userID)
+	return nil
+}
+
+// revokeUserSessions відкликає всі access та refresh токени користувача
+func revokeUserSessions(ctx context.Context, revocations TokenRevocationService, refreshRepo repository.RefreshTokenRepository, userID int64, reason string) error {
+	if err := revocations.RevokeUserTokens(ctx, userID, reason); err != nil {
+		return err
+	}
+	return refreshRepo.RevokeAllForUser(ctx, userID, reason)
 }
 
 // GetUsers повертає список користувачів
@@ -205,43 +983,77 @@ func (s *authService) GetUsers(ctx context.Context) ([]model.User, error) {
 	return s.userRepo.GetAll(ctx)
 }
 
-// generateAccessToken генерує JWT токен доступу
-func (s *authService) generateAccessToken(user *model.User, permissions []string) (string, error) {
+// generateAccessToken генерує JWT токен доступу.
+// Токен містить лише ідентичність та роль, дозволи визначаються під час кожного запиту
+func (s *authService) generateAccessToken(user *model.User) (string, error) {
+	jti, err := generateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
 	claims := jwt.MapClaims{
-		"user_id":     user.ID,
-		"email":       user.Email,
-		"role":        user.Role.Name,
-		"permissions": permissions,
-		"exp":         time.Now().Add(time.Hour).Unix(),
-		"iat":         time.Now().Unix(),
+		"jti":     jti,
+		"user_id": user.ID,
+		"email":   user.Email,
+		"role":    user.Role.Name,
+		"exp":     time.Now().Add(accessTokenTTL).Unix(),
+		"iat":     jwt.NewNumericDate(time.Now()),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(s.jwtSecret))
+	return s.keys.Sign(claims)
 }
 
-// generateRefreshToken генерує JWT refresh токен
-func (s *authService) generateRefreshToken(userID int64) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(time.Hour * 24 * 7).Unix(), // 7 днів
-		"iat":     time.Now().Unix(),
+// issueRefreshToken генерує непрозорий refresh токен та зберігає його хеш
+func (s *authService) issueRefreshToken(ctx context.Context, userID int64, familyID string) (string, error) {
+	token, err := generateRandomToken(32)
+	if err != nil {
+		return "", err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(s.jwtSecret))
+	stored := &model.RefreshToken{
+		UserID:    userID,
+		TokenHash: hashToken(token),
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(refreshTokenTTL),
+	}
+
+	if err := s.refreshRepo.Create(ctx, stored); err != nil {
+		return "", err
+	}
+
+	return token, nil
 }
 
 // generateDeviceToken генерує JWT токен для пристрою
 func (s *authService) generateDeviceToken(deviceID int64, serialNumber string) (string, error) {
+	jti, err := generateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
 	claims := jwt.MapClaims{
+		"jti":           jti,
 		"device_id":     deviceID,
 		"serial_number": serialNumber,
 		"type":          "device",
-		"exp":           time.Now().Add(time.Hour * 24).Unix(), // 24 години
-		"iat":           time.Now().Unix(),
+		"exp":           time.Now().Add(deviceTokenTTL).Unix(),
+		"iat":           jwt.NewNumericDate(time.Now()),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(s.jwtSecret))
+	return s.keys.Sign(claims)
+}
+
+// generateRandomToken генерує криптографічно стійкий випадковий рядок
+func generateRandomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate random token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashToken повертає SHA-256 хеш токена для зберігання в базі даних
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,321 @@
+package service
+
+import (
+	"busoptima/internal/model"
+	"busoptima/internal/repository"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRefreshTokens зберігає refresh токени в пам'яті
+type fakeRefreshTokens struct {
+	repository.RefreshTokenRepository
+
+	mu     sync.Mutex
+	tokens map[string]*model.RefreshToken
+	nextID int64
+}
+
+func (f *fakeRefreshTokens) Create(ctx context.Context, token *model.RefreshToken) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	token.ID = f.nextID
+	token.CreatedAt = time.Now()
+	stored := *token
+	f.tokens[token.TokenHash] = &stored
+	return nil
+}
+
+func (f *fakeRefreshTokens) GetByHash(ctx context.Context, tokenHash string) (*model.RefreshToken, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	token, ok := f.tokens[tokenHash]
+	if !ok {
+		return nil, fmt.Errorf("refresh token not found")
+	}
+	copied := *token
+	return &copied, nil
+}
+
+func (f *fakeRefreshTokens) MarkUsed(ctx context.Context, id int64) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, token := range f.tokens {
+		if token.ID == id && token.UsedAt == nil && token.RevokedAt == nil {
+			now := time.Now()
+			token.UsedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeRefreshTokens) RevokeFamily(ctx context.Context, familyID, reason string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, token := range f.tokens {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			now := time.Now()
+			token.RevokedAt = &now
+			token.RevokeReason = &reason
+		}
+	}
+	return nil
+}
+
+// revokeReason повертає причину відкликання токена або "" для активного
+func (f *fakeRefreshTokens) revokeReason(token string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stored := f.tokens[hashToken(token)]
+	if stored == nil || stored.RevokeReason == nil {
+		return ""
+	}
+	return *stored.RevokeReason
+}
+
+// fakeRevocationStore приймає відкликання токенів без збереження
+type fakeRevocationStore struct {
+	repository.TokenRevocationRepository
+}
+
+func (fakeRevocationStore) RevokeToken(ctx context.Context, token *model.RevokedToken) error {
+	return nil
+}
+
+func (fakeRevocationStore) RevokeUserTokens(ctx context.Context, revocation *model.UserTokenRevocation) error {
+	return nil
+}
+
+func (fakeRevocationStore) RevokeDeviceTokens(ctx context.Context, revocation *model.DeviceTokenRevocation) error {
+	return nil
+}
+
+// fakeAuthUsers повертає єдиного користувача за ID
+type fakeAuthUsers struct {
+	repository.UserRepository
+	user *model.User
+}
+
+func (f *fakeAuthUsers) GetByID(ctx context.Context, id int64) (*model.User, error) {
+	if f.user == nil || f.user.ID != id {
+		return nil, fmt.Errorf("user with id %d %w", id, repository.ErrNotFound)
+	}
+	copied := *f.user
+	return &copied, nil
+}
+
+func (f *fakeAuthUsers) UpdateRole(ctx context.Context, userID, roleID int64) error {
+	if f.user == nil || f.user.ID != userID {
+		return fmt.Errorf("user with id %d %w", userID, repository.ErrNotFound)
+	}
+	f.user.RoleID = roleID
+	return nil
+}
+
+// fakeUserInvalidations фіксує скидання кешу дозволів користувачів
+type fakeUserInvalidations struct {
+	PermissionService
+	users []int64
+}
+
+func (f *fakeUserInvalidations) InvalidateUser(userID int64) {
+	f.users = append(f.users, userID)
+}
+
+// authTestEnv сервіс автентифікації зі сховищами в пам'яті та тимчасовим ключем підпису
+type authTestEnv struct {
+	service     *authService
+	refresh     *fakeRefreshTokens
+	revocations TokenRevocationService
+	user        *model.User
+}
+
+func newAuthTestEnv(t *testing.T) *authTestEnv {
+	t.Helper()
+
+	keys, err := NewKeyService("", true)
+	require.NoError(t, err)
+
+	user := &model.User{ID: 7, Email: "dispatcher@busoptima.ua", RoleID: 2, Role: &model.Role{ID: 2, Name: "dispatcher"}, IsActive: true}
+	refresh := &fakeRefreshTokens{tokens: make(map[string]*model.RefreshToken)}
+	revocations := NewTokenRevocationService(fakeRevocationStore{})
+
+	return &authTestEnv{
+		service: &authService{
+			userRepo:    &fakeAuthUsers{user: user},
+			refreshRepo: refresh,
+			revocations: revocations,
+			keys:        keys,
+		},
+		refresh:     refresh,
+		revocations: revocations,
+		user:        user,
+	}
+}
+
+// startSession видає refresh токен нової сесії, як це робить вхід
+func (env *authTestEnv) startSession(t *testing.T) string {
+	t.Helper()
+
+	familyID, err := generateRandomToken(16)
+	require.NoError(t, err)
+	token, err := env.service.issueRefreshToken(context.Background(), env.user.ID, familyID)
+	require.NoError(t, err)
+	return token
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	env := newAuthTestEnv(t)
+	ctx := context.Background()
+	first := env.startSession(t)
+
+	response, err := env.service.RefreshToken(ctx, first)
+	require.NoError(t, err)
+	assert.NotEmpty(t, response.AccessToken)
+	assert.NotEqual(t, first, response.RefreshToken)
+
+	// Новий токен належить тій самій сесії і знову обмінюється
+	second, err := env.service.refreshRepo.GetByHash(ctx, hashToken(response.RefreshToken))
+	require.NoError(t, err)
+	original, err := env.service.refreshRepo.GetByHash(ctx, hashToken(first))
+	require.NoError(t, err)
+	assert.Equal(t, original.FamilyID, second.FamilyID)
+
+	_, err = env.service.RefreshToken(ctx, response.RefreshToken)
+	require.NoError(t, err)
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	tests := []struct {
+		name string
+		// reuse повертає токен, що пред'являється повторно, після обміну first -> rotated
+		reuse func(first, rotated string) string
+	}{
+		{name: "rotated-away token replayed", reuse: func(first, rotated string) string { return first }},
+		{name: "current token replayed after legitimate refresh", reuse: func(first, rotated string) string { return rotated }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newAuthTestEnv(t)
+			ctx := context.Background()
+			first := env.startSession(t)
+			other := env.startSession(t)
+
+			response, err := env.service.RefreshToken(ctx, first)
+			require.NoError(t, err)
+			rotated := response.RefreshToken
+
+			replayed := tt.reuse(first, rotated)
+			latest := rotated
+			if replayed == rotated {
+				response, err = env.service.RefreshToken(ctx, rotated)
+				require.NoError(t, err)
+				latest = response.RefreshToken
+			}
+
+			_, err = env.service.RefreshToken(ctx, replayed)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "reuse detected")
+
+			// Уся сесія відкликана, тож і найновіший токен більше не приймається
+			assert.Equal(t, "reuse_detected", env.refresh.revokeReason(latest))
+			_, err = env.service.RefreshToken(ctx, latest)
+			assert.Error(t, err)
+
+			// Інші сесії користувача не зачеплені
+			assert.Equal(t, "", env.refresh.revokeReason(other))
+			_, err = env.service.RefreshToken(ctx, other)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestRefreshTokenRejectsInactiveUser(t *testing.T) {
+	env := newAuthTestEnv(t)
+	token := env.startSession(t)
+	env.user.IsActive = false
+
+	_, err := env.service.RefreshToken(context.Background(), token)
+	assert.ErrorIs(t, err, ErrAccountDeactivated)
+	assert.Equal(t, "user_deactivated", env.refresh.revokeReason(token))
+}
+
+func TestLogoutRevokesSessionAccessToken(t *testing.T) {
+	env := newAuthTestEnv(t)
+	ctx := context.Background()
+	response, err := env.service.RefreshToken(ctx, env.startSession(t))
+	require.NoError(t, err)
+
+	require.NoError(t, env.service.Logout(ctx, response.RefreshToken, response.AccessToken))
+
+	assert.Equal(t, "logout", env.refresh.revokeReason(response.RefreshToken))
+	jti, _, ok := env.service.parseAccessToken(response.AccessToken, env.user.ID)
+	require.True(t, ok)
+	assert.True(t, env.revocations.IsRevoked(jti, env.user.ID, time.Now()))
+}
+
+func TestLogoutIgnoresForeignAccessToken(t *testing.T) {
+	env := newAuthTestEnv(t)
+	ctx := context.Background()
+	refreshToken := env.startSession(t)
+
+	other := &model.User{ID: 8, Role: &model.Role{Name: "dispatcher"}}
+	foreignToken, err := env.service.generateAccessToken(other)
+	require.NoError(t, err)
+
+	require.NoError(t, env.service.Logout(ctx, refreshToken, foreignToken))
+
+	jti, _, ok := env.service.parseAccessToken(foreignToken, other.ID)
+	require.True(t, ok)
+	assert.False(t, env.revocations.IsRevoked(jti, other.ID, time.Now()))
+}
+
+func TestUpdateUserRoleCapsAtGrantor(t *testing.T) {
+	scope := NewRouteScope([]int64{1})
+
+	tests := []struct {
+		name         string
+		userID       int64
+		roleID       int64
+		grantor      []string
+		grantorScope *RouteScope
+		wantErr      error
+	}{
+		{name: "role within grantor permissions", userID: 7, roleID: 3, grantor: []string{"analytics:read", "users:write"}},
+		{name: "built-in admin role", userID: 7, roleID: 1, grantor: []string{"users:write"}, wantErr: ErrRoleExceedsGrantor},
+		{name: "role with a permission the grantor lacks", userID: 7, roleID: 3, grantor: []string{"users:write"}, wantErr: ErrRoleExceedsGrantor},
+		{name: "route-scoped grantor assigns route-scoped role", userID: 7, roleID: 2, grantor: []string{"trips:read", "users:write"}, grantorScope: scope},
+		{name: "route-scoped grantor assigns role without route limit", userID: 7, roleID: 3, grantor: []string{"analytics:read", "users:write"}, grantorScope: scope, wantErr: ErrRoleExceedsGrantor},
+		{name: "missing role", userID: 7, roleID: 99, grantor: []string{"users:write"}, wantErr: ErrInvalidRole},
+		{name: "missing user", userID: 8, roleID: 3, grantor: []string{"analytics:read"}, wantErr: repository.ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newAuthTestEnv(t)
+			invalidations := &fakeUserInvalidations{}
+			env.service.roleRepo = newFakeRoleStore()
+			env.service.permissions = invalidations
+
+			err := env.service.UpdateUserRole(context.Background(), tt.userID, tt.roleID, tt.grantor, tt.grantorScope)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Equal(t, int64(2), env.user.RoleID)
+				assert.Empty(t, invalidations.users)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.roleID, env.user.RoleID)
+			assert.Equal(t, []int64{tt.userID}, invalidations.users)
+		})
+	}
+}
@@ -0,0 +1,412 @@
+package service
+
+import (
+	"busoptima/internal/model"
+	"busoptima/internal/repository"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrDeviceNotFound повертається, коли пристрою з указаним ID не існує
+	ErrDeviceNotFound = errors.New("device not found")
+	// ErrDeviceConflict повертається, коли серійний номер зайнятий або автобус вже має пристрій
+	ErrDeviceConflict = errors.New("device conflict")
+	// ErrInvalidDevice повертається для некоректних даних пристрою або дії над деактивованим пристроєм
+	ErrInvalidDevice = errors.New("invalid device request")
+)
+
+// Стани пристрою для моніторингу
+const (
+	// DeviceOnline пристрій виходив на зв'язок протягом deviceOnlineWindow
+	DeviceOnline = "online"
+	// DeviceOffline пристрій давно не виходив на зв'язок
+	DeviceOffline = "offline"
+	// DeviceNeverSeen пристрій ще жодного разу не надсилав heartbeat чи події
+	DeviceNeverSeen = "never_seen"
+	// DeviceInactive пристрій деактивовано адміністратором
+	DeviceInactive = "inactive"
+)
+
+// Попередження за показниками останнього heartbeat
+const (
+	AlertLowBattery   = "low_battery"
+	AlertWeakSignal   = "weak_signal"
+	AlertLowMemory    = "low_memory"
+	AlertEventBacklog = "event_backlog"
+)
+
+const (
+	// deviceOnlineWindow пропуск кількох heartbeat поспіль вважається втратою зв'язку
+	deviceOnlineWindow = 4 * heartbeatInterval
+	// lowBatteryPercent заряд, нижче якого потрібна заміна або зарядка батареї
+	lowBatteryPercent = 20
+	// weakSignalRSSI рівень сигналу, нижче якого синхронізація стає ненадійною
+	weakSignalRSSI = -80
+	// lowFreeHeapBytes обсяг вільної пам'яті, нижче якого прошивка ризикує перезавантажитись
+	lowFreeHeapBytes = 32 * 1024
+	// eventBacklogThreshold кількість подій у буфері, що свідчить про проблеми з синхронізацією
+	eventBacklogThreshold = 100
+	// heartbeatHistoryLimit максимальна кількість показників у відповіді історії
+	heartbeatHistoryLimit = 1000
+)
+
+// DeviceService інтерфейс для адміністрування IoT-пристроїв
+type DeviceService interface {
+	Register(ctx context.Context, device *model.Device) (*DeviceCredentials, error)
+	GetByID(ctx context.Context, id int64) (*model.Device, error)
+	GetAll(ctx context.Context) ([]model.Device, error)
+	BindBus(ctx context.Context, deviceID, busID int64) (*model.Device, error)
+	UnbindBus(ctx context.Context, deviceID int64) (*model.Device, error)
+	Deactivate(ctx context.Context, deviceID int64) error
+	RotateSecret(ctx context.Context, deviceID int64) (*DeviceCredentials, error)
+	SetGroup(ctx context.Context, deviceID int64, group string) (*model.Device, error)
+	GetStatus(ctx context.Context, deviceID int64) (*DeviceStatus, error)
+	GetStatuses(ctx context.Context) ([]DeviceStatus, error)
+	GetHeartbeats(ctx context.Context, deviceID int64, since time.Time, limit int) ([]model.DeviceHeartbeat, error)
+	StartHeartbeatRetention(ctx context.Context, retention, interval time.Duration)
+}
+
+// DeviceStatus стан пристрою для моніторингу
+type DeviceStatus struct {
+	Device *model.Device `json:"device"`
+	State  string        `json:"state" example:"online" enums:"online,offline,never_seen,inactive"`
+	// LastSeenAt останній heartbeat або синхронізація подій, залежно від того, що пізніше
+	LastSeenAt    *time.Time             `json:"last_seen_at"`
+	LastHeartbeat *model.DeviceHeartbeat `json:"last_heartbeat"`
+	Alerts        []string               `json:"alerts" example:"low_battery"`
+}
+
+// DeviceCredentials облікові дані пристрою. Секрет повертається лише один раз
+// і на сервері зберігається тільки його bcrypt хеш.
+type DeviceCredentials struct {
+	Device *model.Device `json:"device"`
+	Secret string        `json:"secret"`
+}
+
+type deviceService struct {
+	deviceRepo    repository.DeviceRepository
+	busRepo       repository.BusRepository
+	heartbeatRepo repository.DeviceHeartbeatRepository
+	revocations   TokenRevocationService
+}
+
+// NewDeviceService створює новий сервіс пристроїв
+func NewDeviceService(deviceRepo repository.DeviceRepository, busRepo repository.BusRepository, heartbeatRepo repository.DeviceHeartbeatRepository, revocations TokenRevocationService) DeviceService {
+	return &deviceService{
+		deviceRepo:    deviceRepo,
+		busRepo:       busRepo,
+		heartbeatRepo: heartbeatRepo,
+		revocations:   revocations,
+	}
+}
+
+// Register реєструє новий пристрій та генерує його секрет
+func (s *deviceService) Register(ctx context.Context, device *model.Device) (*DeviceCredentials, error) {
+	if device.SerialNumber == "" {
+		return nil, fmt.Errorf("%w: serial number is required", ErrInvalidDevice)
+	}
+
+	if device.BusID != nil {
+		if err := s.ensureBusAvailable(ctx, *device.BusID, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	secret, hash, err := generateDeviceSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	device.AuthTokenHash = hash
+	device.IsActive = true
+
+	if err := s.deviceRepo.Create(ctx, device); err != nil {
+		return nil, deviceError(err)
+	}
+
+	created, err := s.deviceRepo.GetByID(ctx, device.ID)
+	if err != nil {
+		return nil, deviceError(err)
+	}
+
+	return &DeviceCredentials{Device: created, Secret: secret}, nil
+}
+
+// GetByID повертає пристрій за ідентифікатором
+func (s *deviceService) GetByID(ctx context.Context, id int64) (*model.Device, error) {
+	device, err := s.deviceRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, deviceError(err)
+	}
+	return device, nil
+}
+
+// GetAll повертає список всіх пристроїв
+func (s *deviceService) GetAll(ctx context.Context) ([]model.Device, error) {
+	return s.deviceRepo.GetAll(ctx)
+}
+
+// BindBus прив'язує пристрій до автобуса
+func (s *deviceService) BindBus(ctx context.Context, deviceID, busID int64) (*model.Device, error) {
+	device, err := s.deviceRepo.GetByID(ctx, deviceID)
+	if err != nil {
+		return nil, deviceError(err)
+	}
+
+	if !device.IsActive {
+		return nil, fmt.Errorf("%w: device is deactivated", ErrInvalidDevice)
+	}
+
+	if err := s.ensureBusAvailable(ctx, busID, deviceID); err != nil {
+		return nil, err
+	}
+
+	if err := s.deviceRepo.UpdateBus(ctx, deviceID, &busID); err != nil {
+		return nil, deviceError(err)
+	}
+
+	return s.GetByID(ctx, deviceID)
+}
+
+// UnbindBus відв'язує пристрій від автобуса
+func (s *deviceService) UnbindBus(ctx context.Context, deviceID int64) (*model.Device, error) {
+	if err := s.deviceRepo.UpdateBus(ctx, deviceID, nil); err != nil {
+		return nil, deviceError(err)
+	}
+
+	return s.GetByID(ctx, deviceID)
+}
+
+// Deactivate деактивує пристрій
+func (s *deviceService) Deactivate(ctx context.Context, deviceID int64) error {
+	if err := s.deviceRepo.Deactivate(ctx, deviceID); err != nil {
+		return deviceError(err)
+	}
+
+	return s.revocations.RevokeDeviceTokens(ctx, deviceID, "device_deactivated")
+}
+
+// RotateSecret генерує новий секрет пристрою, старий секрет перестає діяти
+func (s *deviceService) RotateSecret(ctx context.Context, deviceID int64) (*DeviceCredentials, error) {
+	device, err := s.deviceRepo.GetByID(ctx, deviceID)
+	if err != nil {
+		return nil, deviceError(err)
+	}
+
+	if !device.IsActive {
+		return nil, fmt.Errorf("%w: device is deactivated", ErrInvalidDevice)
+	}
+
+	secret, hash, err := generateDeviceSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.deviceRepo.UpdateAuthTokenHash(ctx, deviceID, hash); err != nil {
+		return nil, deviceError(err)
+	}
+
+	// Токени, видані за старим секретом, інакше діяли б ще до 24 годин
+	if err := s.revocations.RevokeDeviceTokens(ctx, deviceID, "secret_rotated"); err != nil {
+		return nil, err
+	}
+
+	return &DeviceCredentials{Device: device, Secret: secret}, nil
+}
+
+// SetGroup додає пристрій до групи розгортання прошивки. Порожня назва прибирає пристрій з групи
+func (s *deviceService) SetGroup(ctx context.Context, deviceID int64, group string) (*model.Device, error) {
+	var value *string
+	if group = strings.TrimSpace(group); group != "" {
+		if len(group) > deviceGroupMaxLength {
+			return nil, fmt.Errorf("%w: device group must be at most %d characters", ErrInvalidDevice, deviceGroupMaxLength)
+		}
+		value = &group
+	}
+
+	if err := s.deviceRepo.UpdateGroup(ctx, deviceID, value); err != nil {
+		return nil, deviceError(err)
+	}
+
+	return s.GetByID(ctx, deviceID)
+}
+
+// GetStatus повертає стан пристрою разом з останніми показниками
+func (s *deviceService) GetStatus(ctx context.Context, deviceID int64) (*DeviceStatus, error) {
+	device, err := s.deviceRepo.GetByID(ctx, deviceID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrDeviceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	heartbeat, err := s.heartbeatRepo.GetLatest(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	status := buildDeviceStatus(device, heartbeat, time.Now())
+	return &status, nil
+}
+
+// GetStatuses повертає стан усіх пристроїв
+func (s *deviceService) GetStatuses(ctx context.Context) ([]DeviceStatus, error) {
+	devices, err := s.deviceRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	latest, err := s.heartbeatRepo.GetLatestForAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	statuses := make([]DeviceStatus, 0, len(devices))
+	for i := range devices {
+		var heartbeat *model.DeviceHeartbeat
+		if h, ok := latest[devices[i].ID]; ok {
+			heartbeat = &h
+		}
+		statuses = append(statuses, buildDeviceStatus(&devices[i], heartbeat, now))
+	}
+
+	return statuses, nil
+}
+
+// GetHeartbeats повертає історію показників пристрою, починаючи з since
+func (s *deviceService) GetHeartbeats(ctx context.Context, deviceID int64, since time.Time, limit int) ([]model.DeviceHeartbeat, error) {
+	_, err := s.deviceRepo.GetByID(ctx, deviceID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrDeviceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 || limit > heartbeatHistoryLimit {
+		limit = heartbeatHistoryLimit
+	}
+
+	return s.heartbeatRepo.GetByDevice(ctx, deviceID, since, limit)
+}
+
+// StartHeartbeatRetention запускає періодичне видалення показників, старших за retention
+func (s *deviceService) StartHeartbeatRetention(ctx context.Context, retention, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := s.heartbeatRepo.DeleteOlderThan(ctx, time.Now().Add(-retention)); err != nil {
+					log.Printf("Failed to delete old heartbeats: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// buildDeviceStatus визначає стан пристрою та попередження за останнім зв'язком і показниками
+func buildDeviceStatus(device *model.Device, heartbeat *model.DeviceHeartbeat, now time.Time) DeviceStatus {
+	status := DeviceStatus{
+		Device:        device,
+		LastHeartbeat: heartbeat,
+		Alerts:        []string{},
+	}
+
+	status.LastSeenAt = device.LastHeartbeatAt
+	if device.LastSyncAt != nil && (status.LastSeenAt == nil || device.LastSyncAt.After(*status.LastSeenAt)) {
+		status.LastSeenAt = device.LastSyncAt
+	}
+
+	switch {
+	case !device.IsActive:
+		status.State = DeviceInactive
+	case status.LastSeenAt == nil:
+		status.State = DeviceNeverSeen
+	case now.Sub(*status.LastSeenAt) <= deviceOnlineWindow:
+		status.State = DeviceOnline
+	default:
+		status.State = DeviceOffline
+	}
+
+	if heartbeat == nil {
+		return status
+	}
+
+	if heartbeat.BatteryPercent != nil && *heartbeat.BatteryPercent < lowBatteryPercent {
+		status.Alerts = append(status.Alerts, AlertLowBattery)
+	}
+	if heartbeat.RSSI != nil && *heartbeat.RSSI < weakSignalRSSI {
+		status.Alerts = append(status.Alerts, AlertWeakSignal)
+	}
+	if heartbeat.FreeHeapBytes != nil && *heartbeat.FreeHeapBytes < lowFreeHeapBytes {
+		status.Alerts = append(status.Alerts, AlertLowMemory)
+	}
+	if heartbeat.BufferedEvents >= eventBacklogThreshold {
+		status.Alerts = append(status.Alerts, AlertEventBacklog)
+	}
+
+	return status
+}
+
+// ensureBusAvailable перевіряє, що автобус існує і не має іншого прив'язаного пристрою
+func (s *deviceService) ensureBusAvailable(ctx context.Context, busID, deviceID int64) error {
+	if _, err := s.busRepo.GetByID(ctx, busID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: bus with id %d not found", ErrInvalidDevice, busID)
+		}
+		return err
+	}
+
+	bound, err := s.deviceRepo.GetByBusID(ctx, busID)
+	if err != nil {
+		return err
+	}
+
+	if bound != nil && bound.ID != deviceID {
+		return fmt.Errorf("%w: bus already has a bound device (%s)", ErrDeviceConflict, bound.SerialNumber)
+	}
+
+	return nil
+}
+
+// deviceError перетворює помилки репозиторію на помилки сервісу пристроїв.
+// Інші помилки (зокрема помилки БД) повертаються без змін
+func deviceError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return ErrDeviceNotFound
+	case errors.Is(err, repository.ErrDeviceSerialExists), errors.Is(err, repository.ErrBusAlreadyBound):
+		return fmt.Errorf("%w: %v", ErrDeviceConflict, err)
+	}
+	return err
+}
+
+// generateDeviceSecret генерує секрет пристрою та його bcrypt хеш
+func generateDeviceSecret() (string, string, error) {
+	secret, err := generateRandomToken(24)
+	if err != nil {
+		return "", "", err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to hash device secret: %w", err)
+	}
+
+	return secret, string(hash), nil
+}
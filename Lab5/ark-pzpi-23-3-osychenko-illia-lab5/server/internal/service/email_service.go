@@ -0,0 +1,222 @@
+package service
+
+import (
+	"busoptima/internal/model"
+	"busoptima/internal/repository"
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// emailBatchSize кількість листів, що відправляються за один прохід
+	emailBatchSize = 20
+	// emailSendLease час, на який лист резервується за одним відправником
+	emailSendLease = 5 * time.Minute
+	// emailMaxAttempts кількість спроб відправлення до позначення листа як failed
+	emailMaxAttempts = 5
+	// emailRetryBase затримка перед першою повторною спробою, далі подвоюється
+	emailRetryBase = time.Minute
+)
+
+// MailMessage лист для відправлення
+type MailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// MailSender інтерфейс транспорту відправлення листів
+type MailSender interface {
+	Send(ctx context.Context, msg *MailMessage) error
+}
+
+// EmailService інтерфейс черги вихідних листів
+type EmailService interface {
+	Enqueue(ctx context.Context, to, subject, body string) error
+	DispatchPending(ctx context.Context) (int, error)
+	StartDispatcher(ctx context.Context, interval time.Duration)
+}
+
+// emailService реалізація EmailService.
+// Листи спочатку зберігаються в таблиці email_outbox, а потім відправляються фоново,
+// тому збій поштового сервера не впливає на запит користувача.
+type emailService struct {
+	outboxRepo repository.EmailOutboxRepository
+	sender     MailSender
+}
+
+// NewEmailService створює новий сервіс черги листів
+func NewEmailService(outboxRepo repository.EmailOutboxRepository, sender MailSender) EmailService {
+	return &emailService{
+		outboxRepo: outboxRepo,
+		sender:     sender,
+	}
+}
+
+// Enqueue додає лист до черги відправлення
+func (s *emailService) Enqueue(ctx context.Context, to, subject, body string) error {
+	return s.outboxRepo.Enqueue(ctx, &model.OutboxEmail{
+		Recipient: to,
+		Subject:   subject,
+		Body:      body,
+	})
+}
+
+// DispatchPending відправляє листи, готові до відправлення, та повертає кількість відправлених
+func (s *emailService) DispatchPending(ctx context.Context) (int, error) {
+	emails, err := s.outboxRepo.ClaimPending(ctx, emailBatchSize, emailSendLease)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, email := range emails {
+		err := s.sender.Send(ctx, &MailMessage{To: email.Recipient, Subject: email.Subject, Body: email.Body})
+		if err == nil {
+			if err := s.outboxRepo.MarkSent(ctx, email.ID); err != nil {
+				return sent, err
+			}
+			sent++
+			continue
+		}
+
+		var nextAttemptAt *time.Time
+		if email.Attempts < emailMaxAttempts {
+			next := time.Now().Add(emailRetryBase << (email.Attempts - 1))
+			nextAttemptAt = &next
+		}
+
+		log.Printf("Failed to send email %d (attempt %d): %v", email.ID, email.Attempts, err)
+		if err := s.outboxRepo.MarkFailed(ctx, email.ID, err.Error(), nextAttemptAt); err != nil {
+			return sent, err
+		}
+	}
+
+	return sent, nil
+}
+
+// StartDispatcher запускає періодичне відправлення листів з черги
+func (s *emailService) StartDispatcher(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := s.DispatchPending(ctx); err != nil {
+					log.Printf("Failed to dispatch emails: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// logMailSender виводить листи в лог замість відправлення (для локальної розробки)
+type logMailSender struct{}
+
+// NewLogMailSender створює відправник, що пише листи в лог
+func NewLogMailSender() MailSender {
+	return &logMailSender{}
+}
+
+// Send виводить лист у лог
+func (s *logMailSender) Send(ctx context.Context, msg *MailMessage) error {
+	log.Printf("EMAIL to=%s subject=%q\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// fileMailSender зберігає листи у файли .eml (для локальної розробки)
+type fileMailSender struct {
+	dir  string
+	from string
+}
+
+// NewFileMailSender створює відправник, що зберігає листи в каталог
+func NewFileMailSender(dir, from string) MailSender {
+	return &fileMailSender{dir: dir, from: from}
+}
+
+// Send зберігає лист у файл
+func (s *fileMailSender) Send(ctx context.Context, msg *MailMessage) error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create mail directory: %w", err)
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), sanitizeFileName(msg.To))
+	if err := os.WriteFile(filepath.Join(s.dir, name), buildMailMessage(s.from, msg), 0o644); err != nil {
+		return fmt.Errorf("failed to write email file: %w", err)
+	}
+
+	return nil
+}
+
+// smtpMailSender відправляє листи через SMTP сервер
+type smtpMailSender struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTPMailSender створює відправник через SMTP. Автентифікація використовується, якщо вказано ім'я користувача
+func NewSMTPMailSender(host, port, username, password, from string) MailSender {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &smtpMailSender{
+		addr: net.JoinHostPort(host, port),
+		auth: auth,
+		from: from,
+	}
+}
+
+// Send відправляє лист через SMTP
+func (s *smtpMailSender) Send(ctx context.Context, msg *MailMessage) error {
+	if err := smtp.SendMail(s.addr, s.auth, s.from, []string{msg.To}, buildMailMessage(s.from, msg)); err != nil {
+		return fmt.Errorf("failed to send email via SMTP: %w", err)
+	}
+	return nil
+}
+
+// buildMailMessage формує текст листа у форматі RFC 5322
+func buildMailMessage(from string, msg *MailMessage) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + stripLineBreaks(msg.To) + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", stripLineBreaks(msg.Subject)) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// stripLineBreaks видаляє переноси рядків, щоб значення не могло додати власні заголовки
+func stripLineBreaks(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
+
+// sanitizeFileName замінює символи, небезпечні для імені файлу
+func sanitizeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_', r == '@':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// MIMEApplicationCBOR тип вмісту компактного пакета подій
+const MIMEApplicationCBOR = "application/cbor"
+
+// Коди типів подій у компактному пакеті
+const (
+	compactEventEntry = 0
+	compactEventExit  = 1
+)
+
+// CompactEventBatch пакет подій у CBOR. Замість назв полів використовуються числові ключі,
+// кожна подія кодується масивом, а її час - зміщенням у мілісекундах від попередньої події
+// (для першої - від BaseTime), тож пакет у кілька разів менший за JSON
+type CompactEventBatch struct {
+	TripID int64 `cbor:"1,keyasint"`
+	// BaseTime Unix-час у мілісекундах, від якого відраховується час першої події
+	BaseTime int64          `cbor:"2,keyasint"`
+	Events   []CompactEvent `cbor:"3,keyasint"`
+}
+
+// CompactEvent подія пакета: [local_id, тип (0 - entry, 1 - exit), зміщення часу в мс,
+// широта, довгота, passenger_count_after]
+type CompactEvent struct {
+	_                   struct{} `cbor:",toarray"`
+	LocalID             int
+	EventType           int
+	TimeDelta           int64
+	Latitude            float64
+	Longitude           float64
+	PassengerCountAfter int
+}
+
+var (
+	compactEncMode cbor.EncMode
+	compactDecMode cbor.DecMode
+)
+
+func init() {
+	var err error
+
+	// Координати, які точно вміщуються в float32 або float16, кодуються коротше
+	compactEncMode, err = cbor.EncOptions{ShortestFloat: cbor.ShortestFloat16}.EncMode()
+	if err != nil {
+		panic(err)
+	}
+
+	compactDecMode, err = cbor.DecOptions{DupMapKey: cbor.DupMapKeyEnforcedAPF}.DecMode()
+	if err != nil {
+		panic(err)
+	}
+}
+
+// EncodeCompactEvents кодує пакет подій у компактний формат.
+// Час подій має бути у форматі RFC 3339, точність зберігається до мілісекунд
+func EncodeCompactEvents(tripID int64, inputs []SyncEventInput) ([]byte, error) {
+	batch := CompactEventBatch{TripID: tripID, Events: make([]CompactEvent, len(inputs))}
+
+	var previous int64
+	for i := range inputs {
+		e := &inputs[i]
+		timestamp, err := time.Parse(time.RFC3339, e.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("event %d: invalid timestamp: %w", e.LocalID, err)
+		}
+
+		millis := timestamp.UnixMilli()
+		if i == 0 {
+			batch.BaseTime = millis
+			previous = millis
+		}
+
+		eventType, err := compactEventTypeCode(e.EventType)
+		if err != nil {
+			return nil, fmt.Errorf("event %d: %w", e.LocalID, err)
+		}
+
+		batch.Events[i] = CompactEvent{
+			LocalID:             e.LocalID,
+			EventType:           eventType,
+			TimeDelta:           millis - previous,
+			Latitude:            e.Latitude,
+			Longitude:           e.Longitude,
+			PassengerCountAfter: e.PassengerCountAfter,
+		}
+		previous = millis
+	}
+
+	return compactEncMode.Marshal(batch)
+}
+
+// DecodeCompactEvents розкодовує компактний пакет у рейс і події того ж вигляду, що й у JSON,
+// тож далі вони проходять ту саму перевірку в SyncEvents
+func DecodeCompactEvents(data []byte) (int64, []SyncEventInput, error) {
+	var batch CompactEventBatch
+	if err := compactDecMode.Unmarshal(data, &batch); err != nil {
+		return 0, nil, fmt.Errorf("invalid compact event batch: %w", err)
+	}
+
+	inputs := make([]SyncEventInput, len(batch.Events))
+	millis := batch.BaseTime
+	for i := range batch.Events {
+		e := &batch.Events[i]
+		millis += e.TimeDelta
+
+		inputs[i] = SyncEventInput{
+			LocalID:             e.LocalID,
+			EventType:           compactEventTypeName(e.EventType),
+			Timestamp:           time.UnixMilli(millis).UTC().Format(time.RFC3339Nano),
+			Latitude:            e.Latitude,
+			Longitude:           e.Longitude,
+			PassengerCountAfter: e.PassengerCountAfter,
+		}
+	}
+
+	return batch.TripID, inputs, nil
+}
+
+// compactEventTypeCode повертає код типу події для компактного пакета
+func compactEventTypeCode(eventType string) (int, error) {
+	switch eventTypeAliases[eventType] {
+	case "entry":
+		return compactEventEntry, nil
+	case "exit":
+		return compactEventExit, nil
+	}
+	return 0, fmt.Errorf("unknown event type %q", eventType)
+}
+
+// compactEventTypeName повертає тип події за кодом. Невідомий код залишається числом
+// і відхиляється в SyncEvents як invalid_event_type
+func compactEventTypeName(code int) string {
+	switch code {
+	case compactEventEntry:
+		return "entry"
+	case compactEventExit:
+		return "exit"
+	}
+	return strconv.Itoa(code)
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// compactTestEvents пакет з мілісекундами, зміщенням часового поясу, нульовою та від'ємною різницею часу
+var compactTestEvents = []SyncEventInput{
+	{LocalID: 1, EventType: "entry", Timestamp: "2024-05-01T08:00:00.123+03:00", Latitude: 49.9935, Longitude: 36.2304, PassengerCountAfter: 1},
+	{LocalID: 2, EventType: "entry", Timestamp: "2024-05-01T08:00:00.123+03:00", Latitude: 49.9935, Longitude: 36.2304, PassengerCountAfter: 2},
+	{LocalID: 3, EventType: "exit", Timestamp: "2024-05-01T04:59:59.001Z", Latitude: 50.4501, Longitude: 30.5234, PassengerCountAfter: 1},
+	{LocalID: 4, EventType: "alight", Timestamp: "2024-05-01T07:15:30.999-02:30", Latitude: 0, Longitude: -0.5, PassengerCountAfter: 0},
+}
+
+func TestCompactEventsMatchJSON(t *testing.T) {
+	data, err := EncodeCompactEvents(42, compactTestEvents)
+	require.NoError(t, err)
+
+	tripID, decoded, err := DecodeCompactEvents(data)
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), tripID)
+
+	body, err := json.Marshal(compactTestEvents)
+	require.NoError(t, err)
+	var fromJSON []SyncEventInput
+	require.NoError(t, json.Unmarshal(body, &fromJSON))
+
+	want := ToPassengerEvents(42, fromJSON)
+	got := ToPassengerEvents(tripID, decoded)
+	require.Len(t, got, len(want))
+
+	for i := range want {
+		assert.True(t, want[i].Timestamp.Equal(got[i].Timestamp), "event %d: %s != %s", i, want[i].Timestamp, got[i].Timestamp)
+		assert.Equal(t, want[i].TripID, got[i].TripID)
+		assert.Equal(t, *want[i].DeviceLocalID, *got[i].DeviceLocalID)
+		assert.Equal(t, *want[i].Latitude, *got[i].Latitude)
+		assert.Equal(t, *want[i].Longitude, *got[i].Longitude)
+		assert.Equal(t, want[i].PassengerCountAfter, got[i].PassengerCountAfter)
+	}
+
+	// Старі назви типів кодуються тими самими кодами, тож після розкодування вони вже нормалізовані
+	assert.Equal(t, []string{"entry", "entry", "exit", "exit"}, []string{got[0].EventType, got[1].EventType, got[2].EventType, got[3].EventType})
+}
+
+func TestCompactEventsTimeDeltas(t *testing.T) {
+	data, err := EncodeCompactEvents(42, compactTestEvents)
+	require.NoError(t, err)
+
+	var batch CompactEventBatch
+	require.NoError(t, compactDecMode.Unmarshal(data, &batch))
+
+	assert.Equal(t, int64(1714539600123), batch.BaseTime)
+	require.Len(t, batch.Events, 4)
+	assert.Equal(t, int64(0), batch.Events[0].TimeDelta)
+	assert.Equal(t, int64(0), batch.Events[1].TimeDelta, "same timestamp")
+	assert.Equal(t, int64(-1122), batch.Events[2].TimeDelta, "event earlier than the previous one")
+	assert.Equal(t, int64(17131998), batch.Events[3].TimeDelta)
+}
+
+func TestCompactEventsRejectInvalidInput(t *testing.T) {
+	_, err := EncodeCompactEvents(42, []SyncEventInput{{LocalID: 1, EventType: "entry", Timestamp: "yesterday"}})
+	assert.Error(t, err)
+
+	_, err = EncodeCompactEvents(42, []SyncEventInput{{LocalID: 1, EventType: "teleport", Timestamp: "2024-05-01T08:00:00Z"}})
+	assert.Error(t, err)
+
+	_, _, err = DecodeCompactEvents([]byte{0xff, 0x00})
+	assert.Error(t, err)
+}
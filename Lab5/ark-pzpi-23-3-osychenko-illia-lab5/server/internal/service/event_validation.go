@@ -0,0 +1,203 @@
+package service
+
+import (
+	"busoptima/internal/model"
+	"busoptima/internal/repository"
+	"context"
+	"sort"
+	"time"
+)
+
+// eventClockSkew допустиме випередження годинника пристрою відносно сервера
+const eventClockSkew = 5 * time.Minute
+
+// Причини відхилення події: повторне надсилання не допоможе
+const (
+	ReasonMissingLocalID   = "missing_local_id"
+	ReasonInvalidTimestamp = "invalid_timestamp"
+	ReasonFutureTimestamp  = "timestamp_in_future"
+	ReasonInvalidEventType = "invalid_event_type"
+)
+
+// Причини карантину: подія збережена окремо і не впливає на кількість пасажирів
+const (
+	ReasonCountBelowZero = "count_below_zero"
+	ReasonOverCapacity   = "over_capacity"
+)
+
+// ReasonCountReconciled подію прийнято, але passenger_count_after виправлено за поточною кількістю рейсу
+const ReasonCountReconciled = "count_reconciled"
+
+// eventTypeAliases назви типів подій, які надсилають старі версії прошивки
+var eventTypeAliases = map[string]string{
+	"entry":  "entry",
+	"exit":   "exit",
+	"board":  "entry",
+	"alight": "exit",
+}
+
+// validateEvent перевіряє формат події та приводить тип до значень БД.
+// Повертає причину відхилення або порожній рядок
+func validateEvent(event *model.PassengerEvent, now time.Time) string {
+	if event.DeviceLocalID == nil || *event.DeviceLocalID <= 0 {
+		return ReasonMissingLocalID
+	}
+
+	if event.Timestamp.IsZero() {
+		return ReasonInvalidTimestamp
+	}
+	if event.Timestamp.After(now.Add(eventClockSkew)) {
+		return ReasonFutureTimestamp
+	}
+
+	eventType, ok := eventTypeAliases[event.EventType]
+	if !ok {
+		return ReasonInvalidEventType
+	}
+	event.EventType = eventType
+
+	return ""
+}
+
+// occupancyEntry подія в хронології рейсу: +1 для входу, -1 для виходу
+type occupancyEntry struct {
+	timestamp time.Time
+	delta     int
+}
+
+// occupancyTracker відтворює кількість пасажирів рейсу за хронологією подій, з якою звіряються події пристрою.
+// Подія перевіряється за кількістю на момент її часу, тож затримана (наприклад, після роботи офлайн) подія
+// не звіряється з новішим станом рейсу. Кількість рахується так само, як у RecomputeOccupancy:
+// з нуля і без переходу нижче нуля
+type occupancyTracker struct {
+	entries  []occupancyEntry
+	capacity int
+}
+
+// newOccupancyTracker будує хронологію зі збережених подій рейсу, впорядкованих за часом
+func newOccupancyTracker(events []model.PassengerEvent, capacity int) *occupancyTracker {
+	tracker := &occupancyTracker{
+		entries:  make([]occupancyEntry, 0, len(events)),
+		capacity: capacity,
+	}
+	for i := range events {
+		tracker.entries = append(tracker.entries, occupancyEntry{timestamp: events[i].Timestamp, delta: eventDelta(events[i].EventType)})
+	}
+	return tracker
+}
+
+// eventDelta повертає зміну кількості пасажирів для типу події
+func eventDelta(eventType string) int {
+	if eventType == "exit" {
+		return -1
+	}
+	return 1
+}
+
+// apply вставляє подію в хронологію за її часом. Якщо подія неможлива в цей момент або робить
+// неможливими пізніші події рейсу, повертає причину карантину і хронологія не змінюється.
+// Інакше passenger_count_after замінюється кількістю на момент події, а значення пристрою
+// зберігається в ReportedCount, якщо вони розходяться.
+// before - кількість пасажирів безпосередньо перед подією, later - чи є в хронології пізніші події
+func (t *occupancyTracker) apply(event *model.PassengerEvent) (reason string, before int, later bool) {
+	position := sort.Search(len(t.entries), func(i int) bool {
+		return t.entries[i].timestamp.After(event.Timestamp)
+	})
+	before = t.countAt(position)
+	later = position < len(t.entries)
+
+	delta := eventDelta(event.EventType)
+	next := before + delta
+
+	switch {
+	case next < 0:
+		return ReasonCountBelowZero, before, later
+	case t.capacity > 0 && next > t.capacity:
+		return ReasonOverCapacity, before, later
+	case t.violations(position, next) > t.violations(position, before):
+		// Наприклад, затриманий вихід, після якого пізніший вихід опустив би кількість нижче нуля
+		if delta < 0 {
+			return ReasonCountBelowZero, before, later
+		}
+		return ReasonOverCapacity, before, later
+	}
+
+	if event.PassengerCountAfter != next {
+		reported := event.PassengerCountAfter
+		event.ReportedCount = &reported
+		event.PassengerCountAfter = next
+	}
+
+	t.entries = append(t.entries, occupancyEntry{})
+	copy(t.entries[position+1:], t.entries[position:])
+	t.entries[position] = occupancyEntry{timestamp: event.Timestamp, delta: delta}
+
+	return "", before, later
+}
+
+// countAt повертає кількість пасажирів після перших n подій хронології
+func (t *occupancyTracker) countAt(n int) int {
+	count := 0
+	for _, entry := range t.entries[:n] {
+		count = max(count+entry.delta, 0)
+	}
+	return count
+}
+
+// violations рахує події хронології, починаючи з from, які при початковій кількості count
+// опустили б її нижче нуля або підняли понад місткість
+func (t *occupancyTracker) violations(from, count int) int {
+	violations := 0
+	for _, entry := range t.entries[from:] {
+		count += entry.delta
+		if count < 0 {
+			violations++
+			count = 0
+		} else if t.capacity > 0 && count > t.capacity {
+			violations++
+		}
+	}
+	return violations
+}
+
+// releaseQuarantined повторно звіряє відкладені події рейсу, які ще не переглянуто, з хронологією tracker.
+// Події, що стали можливими (наприклад, після отримання затриманого входу), переносяться до подій рейсу.
+// Звірка повторюється, доки переноситься хоча б одна подія, бо перенесена подія може зробити можливою іншу
+func releaseQuarantined(ctx context.Context, tx repository.TripEvents, tracker *occupancyTracker) ([]model.QuarantinedEvent, error) {
+	pending, err := tx.GetPendingQuarantined(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var released []model.QuarantinedEvent
+	for changed := true; changed; {
+		changed = false
+		remaining := pending[:0]
+		for _, q := range pending {
+			localID := q.DeviceLocalID
+			event := model.PassengerEvent{
+				TripID:              q.TripID,
+				EventType:           q.EventType,
+				Timestamp:           q.Timestamp,
+				Latitude:            q.Latitude,
+				Longitude:           q.Longitude,
+				PassengerCountAfter: q.PassengerCountAfter,
+				DeviceLocalID:       &localID,
+				IsSynced:            true,
+			}
+			if reason, _, _ := tracker.apply(&event); reason != "" {
+				remaining = append(remaining, q)
+				continue
+			}
+
+			if err := tx.ReleaseQuarantined(ctx, q.ID, &event); err != nil {
+				return nil, err
+			}
+			released = append(released, q)
+			changed = true
+		}
+		pending = remaining
+	}
+
+	return released, nil
+}
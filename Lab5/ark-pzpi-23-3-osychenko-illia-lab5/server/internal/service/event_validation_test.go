@@ -0,0 +1,123 @@
+package service
+
+import (
+	"busoptima/internal/model"
+	"busoptima/internal/repository"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var trackerStart = time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+
+// storedEvent подія рейсу через minutes хвилин після trackerStart
+func storedEvent(eventType string, minutes int) model.PassengerEvent {
+	return model.PassengerEvent{EventType: eventType, Timestamp: trackerStart.Add(time.Duration(minutes) * time.Minute)}
+}
+
+func TestOccupancyTrackerAcceptsDelayedExit(t *testing.T) {
+	// Два входи о 8:00 і 8:10, вихід о 8:30. Поточна кількість рейсу - 1
+	tracker := newOccupancyTracker([]model.PassengerEvent{
+		storedEvent("entry", 0),
+		storedEvent("entry", 10),
+		storedEvent("exit", 30),
+	}, 50)
+
+	// Вихід о 8:20, надісланий після роботи офлайн, звіряється з кількістю 2 на момент 8:20
+	event := storedEvent("exit", 20)
+	event.PassengerCountAfter = 1
+	reason, before, later := tracker.apply(&event)
+	assert.Empty(t, reason)
+	assert.Equal(t, 2, before)
+	assert.True(t, later)
+	assert.Nil(t, event.ReportedCount)
+
+	// Тепер рейс порожній: ще один вихід о 8:40 неможливий
+	event = storedEvent("exit", 40)
+	reason, before, later = tracker.apply(&event)
+	assert.Equal(t, ReasonCountBelowZero, reason)
+	assert.Equal(t, 0, before)
+	assert.False(t, later)
+}
+
+func TestOccupancyTrackerRejectsEventBreakingLaterEvents(t *testing.T) {
+	tracker := newOccupancyTracker([]model.PassengerEvent{
+		storedEvent("entry", 0),
+		storedEvent("exit", 30),
+	}, 2)
+
+	// Вихід о 8:20 можливий сам по собі, але тоді вихід о 8:30 опустив би кількість нижче нуля
+	event := storedEvent("exit", 20)
+	reason, before, _ := tracker.apply(&event)
+	assert.Equal(t, ReasonCountBelowZero, reason)
+	assert.Equal(t, 1, before)
+
+	// Вхід о 8:20 не переповнює автобус місткістю 2
+	event = storedEvent("entry", 20)
+	reason, _, _ = tracker.apply(&event)
+	assert.Empty(t, reason)
+
+	// Ще один вхід о 8:10 переповнив би автобус до виходу о 8:30
+	event = storedEvent("entry", 10)
+	reason, before, _ = tracker.apply(&event)
+	assert.Equal(t, ReasonOverCapacity, reason)
+	assert.Equal(t, 1, before)
+}
+
+func TestOccupancyTrackerReconcilesReportedCount(t *testing.T) {
+	tracker := newOccupancyTracker([]model.PassengerEvent{storedEvent("entry", 0)}, 0)
+
+	event := storedEvent("entry", 5)
+	event.PassengerCountAfter = 7
+	reason, _, later := tracker.apply(&event)
+	require.Empty(t, reason)
+	assert.False(t, later)
+	assert.Equal(t, 2, event.PassengerCountAfter)
+	require.NotNil(t, event.ReportedCount)
+	assert.Equal(t, 7, *event.ReportedCount)
+}
+
+// fakeTripEvents відкладені події рейсу в пам'яті
+type fakeTripEvents struct {
+	repository.TripEvents
+	pending  []model.QuarantinedEvent
+	released []model.PassengerEvent
+}
+
+func (f *fakeTripEvents) GetPendingQuarantined(ctx context.Context) ([]model.QuarantinedEvent, error) {
+	return append([]model.QuarantinedEvent(nil), f.pending...), nil
+}
+
+func (f *fakeTripEvents) ReleaseQuarantined(ctx context.Context, id int64, event *model.PassengerEvent) error {
+	f.released = append(f.released, *event)
+	return nil
+}
+
+func TestReleaseQuarantinedRechecksPendingEvents(t *testing.T) {
+	// Два виходи о 8:20 і 8:25 відкладено, бо до них на рейсі не було пасажирів
+	tx := &fakeTripEvents{pending: []model.QuarantinedEvent{
+		{ID: 1, EventType: "exit", Timestamp: trackerStart.Add(20 * time.Minute), DeviceLocalID: 11},
+		{ID: 2, EventType: "exit", Timestamp: trackerStart.Add(25 * time.Minute), DeviceLocalID: 12},
+		{ID: 3, EventType: "exit", Timestamp: trackerStart.Add(40 * time.Minute), DeviceLocalID: 13},
+	}}
+
+	// Затримані входи о 8:00 і 8:10 роблять можливими перші два виходи, але не третій
+	tracker := newOccupancyTracker([]model.PassengerEvent{
+		storedEvent("entry", 0),
+		storedEvent("entry", 10),
+	}, 50)
+
+	released, err := releaseQuarantined(context.Background(), tx, tracker)
+	require.NoError(t, err)
+	require.Len(t, released, 2)
+	assert.Equal(t, int64(1), released[0].ID)
+	assert.Equal(t, int64(2), released[1].ID)
+
+	require.Len(t, tx.released, 2)
+	assert.Equal(t, 1, tx.released[0].PassengerCountAfter)
+	assert.Equal(t, 0, tx.released[1].PassengerCountAfter)
+	assert.Equal(t, 12, *tx.released[1].DeviceLocalID)
+}
@@ -0,0 +1,387 @@
+package service
+
+import (
+	"busoptima/internal/model"
+	"busoptima/internal/repository"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// firmwareVersionMaxLength максимальна довжина версії прошивки (devices.firmware_version)
+	firmwareVersionMaxLength = 20
+	// deviceGroupMaxLength максимальна довжина назви групи пристроїв
+	deviceGroupMaxLength = 50
+	// firmwareManifestTTL час дії підписаного маніфесту оновлення
+	firmwareManifestTTL = time.Hour
+	// firmwareManifestAudience аудиторія маніфесту, щоб його не можна було використати як інший токен сервера
+	firmwareManifestAudience = "firmware"
+	// firmwarePollInterval рекомендований період перевірки оновлень пристроєм
+	firmwarePollInterval = 6 * time.Hour
+)
+
+var (
+	// ErrInvalidFirmware повертається, коли прошивка або розгортання задані некоректно
+	ErrInvalidFirmware = errors.New("invalid firmware")
+	// ErrFirmwareNotAssigned повертається, коли пристрій завантажує прошивку, яка йому не призначена
+	ErrFirmwareNotAssigned = errors.New("firmware is not assigned to this device")
+)
+
+// FirmwareService інтерфейс для розгортання прошивок IoT-пристроїв
+type FirmwareService interface {
+	UploadRelease(ctx context.Context, release *model.FirmwareRelease, data []byte) (*model.FirmwareRelease, error)
+	GetReleases(ctx context.Context) ([]model.FirmwareRelease, error)
+	CreateRollout(ctx context.Context, rollout *model.FirmwareRollout) (*RolloutProgress, error)
+	GetRollouts(ctx context.Context) ([]RolloutProgress, error)
+	GetRollout(ctx context.Context, id int64) (*RolloutProgress, error)
+	UpdateRolloutPercent(ctx context.Context, id int64, percent int) (*RolloutProgress, error)
+	StopRollout(ctx context.Context, id int64) error
+	GetManifest(ctx context.Context, deviceID int64) (*FirmwareManifest, error)
+	GetDownload(ctx context.Context, deviceID, firmwareID int64) (*model.FirmwareRelease, []byte, error)
+}
+
+// RolloutProgress розгортання разом з прогресом оновлення пристроїв.
+// Пристрій враховується лише в розгортанні, яке для нього діє (пристрій > група > весь парк)
+type RolloutProgress struct {
+	Rollout *model.FirmwareRollout `json:"rollout"`
+	// TargetedDevices активні пристрої, для яких діє це розгортання
+	TargetedDevices int `json:"targeted_devices" example:"40"`
+	// EligibleDevices пристрої, що потрапили в rollout_percent
+	EligibleDevices int `json:"eligible_devices" example:"10"`
+	// UpdatedDevices пристрої з EligibleDevices, що вже повідомили цільову версію
+	UpdatedDevices int `json:"updated_devices" example:"7"`
+	// PendingDevices пристрої з EligibleDevices, що ще не оновились
+	PendingDevices int `json:"pending_devices" example:"3"`
+}
+
+// FirmwareManifest відповідь пристрою на перевірку оновлень.
+// Поля оновлення дублюються в Manifest - JWT, підписаному ключем сервера (перевіряється через /.well-known/jwks.json)
+type FirmwareManifest struct {
+	UpdateAvailable     bool   `json:"update_available" example:"true"`
+	CurrentVersion      string `json:"current_version" example:"1.2.0"`
+	Version             string `json:"version,omitempty" example:"1.3.0"`
+	DownloadURL         string `json:"download_url,omitempty" example:"/api/iot/firmware/1/download"`
+	ChecksumSHA256      string `json:"checksum_sha256,omitempty"`
+	SizeBytes           int64  `json:"size_bytes,omitempty" example:"1048576"`
+	Manifest            string `json:"manifest,omitempty"`
+	PollIntervalSeconds int    `json:"poll_interval_seconds" example:"21600"`
+}
+
+// firmwareService реалізація FirmwareService
+type firmwareService struct {
+	firmwareRepo repository.FirmwareRepository
+	deviceRepo   repository.DeviceRepository
+	keys         KeyService
+}
+
+// NewFirmwareService створює новий сервіс прошивок
+func NewFirmwareService(firmwareRepo repository.FirmwareRepository, deviceRepo repository.DeviceRepository, keys KeyService) FirmwareService {
+	return &firmwareService{
+		firmwareRepo: firmwareRepo,
+		deviceRepo:   deviceRepo,
+		keys:         keys,
+	}
+}
+
+// UploadRelease перевіряє контрольну суму файлу та зберігає прошивку
+func (s *firmwareService) UploadRelease(ctx context.Context, release *model.FirmwareRelease, data []byte) (*model.FirmwareRelease, error) {
+	release.Version = strings.TrimSpace(release.Version)
+	if release.Version == "" || len(release.Version) > firmwareVersionMaxLength {
+		return nil, fmt.Errorf("%w: version must be 1-%d characters long", ErrInvalidFirmware, firmwareVersionMaxLength)
+	}
+
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: firmware file is empty", ErrInvalidFirmware)
+	}
+
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+	if !strings.EqualFold(strings.TrimSpace(release.ChecksumSHA256), checksum) {
+		return nil, fmt.Errorf("%w: sha256 checksum does not match the uploaded file", ErrInvalidFirmware)
+	}
+
+	release.ChecksumSHA256 = checksum
+	release.SizeBytes = int64(len(data))
+
+	if err := s.firmwareRepo.CreateRelease(ctx, release, data); err != nil {
+		return nil, err
+	}
+
+	return release, nil
+}
+
+// GetReleases повертає список прошивок
+func (s *firmwareService) GetReleases(ctx context.Context) ([]model.FirmwareRelease, error) {
+	return s.firmwareRepo.GetReleases(ctx)
+}
+
+// CreateRollout призначає цільову версію пристрою, групі або всім пристроям
+func (s *firmwareService) CreateRollout(ctx context.Context, rollout *model.FirmwareRollout) (*RolloutProgress, error) {
+	if rollout.RolloutPercent < 0 || rollout.RolloutPercent > 100 {
+		return nil, fmt.Errorf("%w: rollout_percent must be between 0 and 100", ErrInvalidFirmware)
+	}
+
+	if rollout.DeviceGroup != nil {
+		group := strings.TrimSpace(*rollout.DeviceGroup)
+		if group == "" {
+			rollout.DeviceGroup = nil
+		} else {
+			rollout.DeviceGroup = &group
+		}
+	}
+
+	if rollout.DeviceID != nil && rollout.DeviceGroup != nil {
+		return nil, fmt.Errorf("%w: rollout targets either a device or a device group", ErrInvalidFirmware)
+	}
+
+	if _, err := s.firmwareRepo.GetRelease(ctx, rollout.FirmwareID); err != nil {
+		return nil, err
+	}
+
+	if rollout.DeviceID != nil {
+		if _, err := s.deviceRepo.GetByID(ctx, *rollout.DeviceID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.firmwareRepo.CreateRollout(ctx, rollout); err != nil {
+		return nil, err
+	}
+
+	return s.GetRollout(ctx, rollout.ID)
+}
+
+// GetRollouts повертає всі розгортання з прогресом
+func (s *firmwareService) GetRollouts(ctx context.Context) ([]RolloutProgress, error) {
+	rollouts, err := s.firmwareRepo.GetRollouts(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	progress, err := s.calculateProgress(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]RolloutProgress, len(rollouts))
+	for i := range rollouts {
+		result[i] = progress[rollouts[i].ID]
+		result[i].Rollout = &rollouts[i]
+	}
+
+	return result, nil
+}
+
+// GetRollout повертає розгортання з прогресом
+func (s *firmwareService) GetRollout(ctx context.Context, id int64) (*RolloutProgress, error) {
+	rollout, err := s.firmwareRepo.GetRollout(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	progress, err := s.calculateProgress(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := progress[id]
+	result.Rollout = rollout
+	return &result, nil
+}
+
+// UpdateRolloutPercent змінює частку пристроїв розгортання.
+// Пристрої, що вже потрапили в розгортання, залишаються в ньому при збільшенні частки
+func (s *firmwareService) UpdateRolloutPercent(ctx context.Context, id int64, percent int) (*RolloutProgress, error) {
+	if percent < 0 || percent > 100 {
+		return nil, fmt.Errorf("%w: rollout_percent must be between 0 and 100", ErrInvalidFirmware)
+	}
+
+	if err := s.firmwareRepo.UpdateRolloutPercent(ctx, id, percent); err != nil {
+		return nil, err
+	}
+
+	return s.GetRollout(ctx, id)
+}
+
+// StopRollout зупиняє розгортання
+func (s *firmwareService) StopRollout(ctx context.Context, id int64) error {
+	return s.firmwareRepo.StopRollout(ctx, id)
+}
+
+// GetManifest повертає підписаний маніфест оновлення, якщо для пристрою призначено іншу версію
+func (s *firmwareService) GetManifest(ctx context.Context, deviceID int64) (*FirmwareManifest, error) {
+	device, release, err := s.resolveTarget(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &FirmwareManifest{
+		CurrentVersion:      device.FirmwareVersion,
+		PollIntervalSeconds: int(firmwarePollInterval.Seconds()),
+	}
+
+	if release == nil || release.Version == device.FirmwareVersion {
+		return manifest, nil
+	}
+
+	manifest.UpdateAvailable = true
+	manifest.Version = release.Version
+	manifest.DownloadURL = fmt.Sprintf("/api/iot/firmware/%d/download", release.ID)
+	manifest.ChecksumSHA256 = release.ChecksumSHA256
+	manifest.SizeBytes = release.SizeBytes
+
+	now := time.Now()
+	signed, err := s.keys.Sign(jwt.MapClaims{
+		"type":            "firmware_manifest",
+		"aud":             firmwareManifestAudience,
+		"sub":             device.SerialNumber,
+		"device_id":       device.ID,
+		"version":         release.Version,
+		"download_url":    manifest.DownloadURL,
+		"checksum_sha256": release.ChecksumSHA256,
+		"size_bytes":      release.SizeBytes,
+		"iat":             now.Unix(),
+		"exp":             now.Add(firmwareManifestTTL).Unix(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign firmware manifest: %w", err)
+	}
+	manifest.Manifest = signed
+
+	return manifest, nil
+}
+
+// GetDownload повертає файл прошивки, якщо саме вона призначена пристрою
+func (s *firmwareService) GetDownload(ctx context.Context, deviceID, firmwareID int64) (*model.FirmwareRelease, []byte, error) {
+	_, release, err := s.resolveTarget(ctx, deviceID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if release == nil || release.ID != firmwareID {
+		return nil, nil, ErrFirmwareNotAssigned
+	}
+
+	data, err := s.firmwareRepo.GetReleaseData(ctx, firmwareID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return release, data, nil
+}
+
+// resolveTarget повертає пристрій та призначену йому прошивку (nil, якщо оновлення немає)
+func (s *firmwareService) resolveTarget(ctx context.Context, deviceID int64) (*model.Device, *model.FirmwareRelease, error) {
+	device, err := s.deviceRepo.GetByID(ctx, deviceID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil, fmt.Errorf("%w: %v", ErrDeviceAccessDenied, err)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !device.IsActive {
+		return nil, nil, fmt.Errorf("%w: device is deactivated", ErrDeviceAccessDenied)
+	}
+
+	rollouts, err := s.firmwareRepo.GetRollouts(ctx, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rollout := effectiveRollout(device, rollouts)
+	if rollout == nil || !inRolloutCohort(device, rollout) {
+		return device, nil, nil
+	}
+
+	release, err := s.firmwareRepo.GetRelease(ctx, rollout.FirmwareID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return device, release, nil
+}
+
+// calculateProgress рахує прогрес усіх активних розгортань за ID розгортання
+func (s *firmwareService) calculateProgress(ctx context.Context) (map[int64]RolloutProgress, error) {
+	rollouts, err := s.firmwareRepo.GetRollouts(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := s.deviceRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	progress := make(map[int64]RolloutProgress, len(rollouts))
+	for i := range devices {
+		device := &devices[i]
+		if !device.IsActive {
+			continue
+		}
+
+		rollout := effectiveRollout(device, rollouts)
+		if rollout == nil {
+			continue
+		}
+
+		p := progress[rollout.ID]
+		p.TargetedDevices++
+		if inRolloutCohort(device, rollout) {
+			p.EligibleDevices++
+			if device.FirmwareVersion == rollout.FirmwareVersion {
+				p.UpdatedDevices++
+			} else {
+				p.PendingDevices++
+			}
+		}
+		progress[rollout.ID] = p
+	}
+
+	return progress, nil
+}
+
+// effectiveRollout повертає розгортання, яке діє для пристрою: призначене самому пристрою,
+// інакше його групі, інакше всьому парку
+func effectiveRollout(device *model.Device, rollouts []model.FirmwareRollout) *model.FirmwareRollout {
+	var byGroup, fleet *model.FirmwareRollout
+	for i := range rollouts {
+		rollout := &rollouts[i]
+		switch {
+		case rollout.DeviceID != nil:
+			if *rollout.DeviceID == device.ID {
+				return rollout
+			}
+		case rollout.DeviceGroup != nil:
+			if byGroup == nil && device.DeviceGroup != nil && *rollout.DeviceGroup == *device.DeviceGroup {
+				byGroup = rollout
+			}
+		default:
+			if fleet == nil {
+				fleet = rollout
+			}
+		}
+	}
+
+	if byGroup != nil {
+		return byGroup
+	}
+	return fleet
+}
+
+// inRolloutCohort визначає, чи потрапляє пристрій у rollout_percent.
+// Кошик пристрою стабільний для розгортання, тому збільшення частки лише додає пристрої
+func inRolloutCohort(device *model.Device, rollout *model.FirmwareRollout) bool {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%d:%s", rollout.ID, device.SerialNumber)
+	return int(h.Sum32()%100) < rollout.RolloutPercent
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"busoptima/internal/model"
+	"busoptima/internal/repository"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEffectiveRollout(t *testing.T) {
+	deviceID, otherDeviceID := int64(7), int64(8)
+	pilot, night := "pilot", "night"
+
+	fleet := model.FirmwareRollout{ID: 1}
+	group := model.FirmwareRollout{ID: 2, DeviceGroup: &pilot}
+	otherGroup := model.FirmwareRollout{ID: 3, DeviceGroup: &night}
+	device := model.FirmwareRollout{ID: 4, DeviceID: &deviceID}
+	otherDevice := model.FirmwareRollout{ID: 5, DeviceID: &otherDeviceID}
+	laterFleet := model.FirmwareRollout{ID: 6}
+
+	tests := []struct {
+		name     string
+		group    *string
+		rollouts []model.FirmwareRollout
+		want     int64
+	}{
+		{name: "no rollouts", group: &pilot},
+		{name: "fleet only", group: &pilot, rollouts: []model.FirmwareRollout{fleet}, want: 1},
+		{name: "group over fleet", group: &pilot, rollouts: []model.FirmwareRollout{fleet, group}, want: 2},
+		{name: "device over group and fleet", group: &pilot, rollouts: []model.FirmwareRollout{fleet, group, device}, want: 4},
+		{name: "device listed first", group: &pilot, rollouts: []model.FirmwareRollout{device, group, fleet}, want: 4},
+		{name: "other group falls back to fleet", group: &pilot, rollouts: []model.FirmwareRollout{otherGroup, fleet}, want: 1},
+		{name: "device without group ignores group rollouts", rollouts: []model.FirmwareRollout{group, fleet}, want: 1},
+		{name: "other device falls back to group", group: &pilot, rollouts: []model.FirmwareRollout{otherDevice, group}, want: 2},
+		{name: "first fleet rollout wins", group: &pilot, rollouts: []model.FirmwareRollout{fleet, laterFleet}, want: 1},
+		{name: "unmatched targets only", group: &pilot, rollouts: []model.FirmwareRollout{otherGroup, otherDevice}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := effectiveRollout(&model.Device{ID: deviceID, DeviceGroup: tt.group}, tt.rollouts)
+			if tt.want == 0 {
+				assert.Nil(t, got)
+				return
+			}
+			require.NotNil(t, got)
+			assert.Equal(t, tt.want, got.ID)
+		})
+	}
+}
+
+func TestInRolloutCohortOnlyGrowsWithPercent(t *testing.T) {
+	devices := make([]*model.Device, 500)
+	for i := range devices {
+		devices[i] = &model.Device{ID: int64(i + 1), SerialNumber: fmt.Sprintf("BO-%04d", i+1)}
+	}
+
+	tests := []struct {
+		name string
+		from int
+		to   int
+	}{
+		{name: "0 to 10", from: 0, to: 10},
+		{name: "10 to 25", from: 10, to: 25},
+		{name: "25 to 50", from: 25, to: 50},
+		{name: "50 to 100", from: 50, to: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := &model.FirmwareRollout{ID: 3, RolloutPercent: tt.from}
+			after := &model.FirmwareRollout{ID: 3, RolloutPercent: tt.to}
+
+			eligible := 0
+			for _, device := range devices {
+				// Пристрій, що вже отримав оновлення, не випадає з розгортання
+				if inRolloutCohort(device, before) {
+					assert.True(t, inRolloutCohort(device, after), device.SerialNumber)
+				}
+				if inRolloutCohort(device, after) {
+					eligible++
+				}
+			}
+			assert.InDelta(t, len(devices)*tt.to/100, eligible, float64(len(devices))/10)
+		})
+	}
+}
+
+func TestInRolloutCohortBounds(t *testing.T) {
+	for i := 1; i <= 100; i++ {
+		device := &model.Device{ID: int64(i), SerialNumber: fmt.Sprintf("BO-%04d", i)}
+		assert.False(t, inRolloutCohort(device, &model.FirmwareRollout{ID: 1, RolloutPercent: 0}))
+		assert.True(t, inRolloutCohort(device, &model.FirmwareRollout{ID: 1, RolloutPercent: 100}))
+	}
+}
+
+// fakeFirmwareStore повертає задані розгортання та прошивку
+type fakeFirmwareStore struct {
+	repository.FirmwareRepository
+	rollouts []model.FirmwareRollout
+	release  *model.FirmwareRelease
+}
+
+func (f *fakeFirmwareStore) GetRollouts(ctx context.Context, activeOnly bool) ([]model.FirmwareRollout, error) {
+	return f.rollouts, nil
+}
+
+func (f *fakeFirmwareStore) GetRelease(ctx context.Context, id int64) (*model.FirmwareRelease, error) {
+	return f.release, nil
+}
+
+func TestManifestIsSignedForFirmwareAudience(t *testing.T) {
+	keys, err := NewKeyService("", true)
+	require.NoError(t, err)
+
+	store := &fakeFirmwareStore{
+		rollouts: []model.FirmwareRollout{{ID: 1, FirmwareID: 2, FirmwareVersion: "1.3.0", RolloutPercent: 100}},
+		release:  &model.FirmwareRelease{ID: 2, Version: "1.3.0", ChecksumSHA256: "abc", SizeBytes: 1024},
+	}
+	devices := fakeDeviceLookup{device: &model.Device{ID: 7, SerialNumber: "BO-0007", FirmwareVersion: "1.2.0", IsActive: true}}
+
+	manifest, err := NewFirmwareService(store, devices, keys).GetManifest(context.Background(), 7)
+	require.NoError(t, err)
+	require.True(t, manifest.UpdateAvailable)
+
+	_, err = jwt.Parse(manifest.Manifest, keys.Keyfunc, jwt.WithValidMethods(keys.ValidMethods()), jwt.WithAudience(firmwareManifestAudience))
+	assert.NoError(t, err)
+
+	// Маніфест не приймається там, де очікується інша аудиторія
+	_, err = jwt.Parse(manifest.Manifest, keys.Keyfunc, jwt.WithValidMethods(keys.ValidMethods()), jwt.WithAudience("busoptima"))
+	assert.ErrorIs(t, err, jwt.ErrTokenInvalidAudience)
+}
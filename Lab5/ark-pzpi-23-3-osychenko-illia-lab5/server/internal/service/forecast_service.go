@@ -8,10 +8,11 @@ import (
 	"time"
 )
 
-// ForecastService інтерфейс для прогнозування попиту
+// ForecastService інтерфейс для прогнозування попиту.
+// scope обмежує доступ маршрутами, призначеними користувачу (nil - без обмежень)
 type ForecastService interface {
-	ForecastDemand(ctx context.Context, routeID int64, targetDate time.Time) (*ForecastResponse, error)
-	GetForecasts(ctx context.Context, routeID int64, from, to time.Time) (*ForecastsResponse, error)
+	ForecastDemand(ctx context.Context, scope *RouteScope, routeID int64, targetDate time.Time) (*ForecastResponse, error)
+	GetForecasts(ctx context.Context, scope *RouteScope, routeID int64, from, to time.Time) (*ForecastsResponse, error)
 }
 
 type ForecastResponse struct {
@@ -38,7 +39,11 @@ func NewForecastService(analyticsRepo repository.AnalyticsRepository, routeRepo
 }
 
 // ForecastDemand прогнозує попит на конкретну дату методом ковзного середнього
-func (s *forecastService) ForecastDemand(ctx context.Context, routeID int64, targetDate time.Time) (*ForecastResponse, error) {
+func (s *forecastService) ForecastDemand(ctx context.Context, scope *RouteScope, routeID int64, targetDate time.Time) (*ForecastResponse, error) {
+	if err := scope.Check(routeID); err != nil {
+		return nil, err
+	}
+
 	route, err := s.routeRepo.GetByID(ctx, routeID)
 	if err != nil {
 		return nil, err
@@ -198,7 +203,11 @@ func (s *forecastService) calculateStdDev(data []int, mean float64) float64 {
 	return math.Sqrt(sumSquares / float64(count))
 }
 
-func (s *forecastService) GetForecasts(ctx context.Context, routeID int64, from, to time.Time) (*ForecastsResponse, error) {
+func (s *forecastService) GetForecasts(ctx context.Context, scope *RouteScope, routeID int64, from, to time.Time) (*ForecastsResponse, error) {
+	if err := scope.Check(routeID); err != nil {
+		return nil, err
+	}
+
 	route, err := s.routeRepo.GetByID(ctx, routeID)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"busoptima/internal/model"
+	"busoptima/internal/repository"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectCurrentTrip(t *testing.T) {
+	at := func(id int64, status string, minutes int) model.Trip {
+		return model.Trip{ID: id, Status: status, ScheduledDeparture: trackerStart.Add(time.Duration(minutes) * time.Minute)}
+	}
+
+	tests := []struct {
+		name  string
+		trips []model.Trip
+		want  int64
+	}{
+		{name: "no trips"},
+		{name: "nearest scheduled trip", trips: []model.Trip{at(2, "scheduled", 120), at(1, "scheduled", 30)}, want: 1},
+		{name: "late scheduled trip before a later one", trips: []model.Trip{at(1, "scheduled", -40), at(2, "scheduled", 30)}, want: 1},
+		// Наступний рейс не обирається, поки попередній не завершено, навіть якщо час його відправлення настав
+		{name: "running trip over a due scheduled trip", trips: []model.Trip{at(1, "in_progress", -90), at(2, "scheduled", -5)}, want: 1},
+		{name: "boarding trip", trips: []model.Trip{at(2, "scheduled", 10), at(1, "boarding", 15)}, want: 1},
+		{name: "latest of several running trips", trips: []model.Trip{at(1, "in_progress", -180), at(2, "boarding", -10)}, want: 2},
+		{name: "finished trips are ignored", trips: []model.Trip{at(1, "completed", -60), at(2, "cancelled", 10), at(3, "scheduled", 60)}, want: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := selectCurrentTrip(tt.trips)
+			if tt.want == 0 {
+				assert.Nil(t, got)
+				return
+			}
+			require.NotNil(t, got)
+			assert.Equal(t, tt.want, got.ID)
+		})
+	}
+}
+
+// fakeCurrentTrips рейси автобуса та межі, в яких сервіс шукав заплановані рейси
+type fakeCurrentTrips struct {
+	repository.TripRepository
+
+	candidates []model.Trip
+	queried    bool
+	from, to   time.Time
+}
+
+func (f *fakeCurrentTrips) GetCurrentCandidatesByBus(ctx context.Context, busID int64, scheduledFrom, scheduledTo time.Time) ([]model.Trip, error) {
+	f.queried = true
+	f.from, f.to = scheduledFrom, scheduledTo
+	return f.candidates, nil
+}
+
+func (f *fakeCurrentTrips) GetByID(ctx context.Context, id int64) (*model.Trip, error) {
+	for _, trip := range f.candidates {
+		if trip.ID == id {
+			trip.Route = &model.Route{BasePrice: 500}
+			trip.Bus = &model.Bus{Capacity: 50}
+			return &trip, nil
+		}
+	}
+	return nil, nil
+}
+
+// fakePricingParameters повертає параметри ціноутворення з фіксованою версією
+type fakePricingParameters struct {
+	PricingService
+}
+
+func (fakePricingParameters) GetParameters(ctx context.Context) (*PricingParameters, error) {
+	return &PricingParameters{Version: "3f2a9c0d1b7e4a65"}, nil
+}
+
+func TestGetCurrentTrip(t *testing.T) {
+	busID := int64(3)
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		device     *model.Device
+		candidates []model.Trip
+		wantStatus string
+		wantTripID int64
+	}{
+		{name: "running trip", device: &model.Device{ID: 7, BusID: &busID, IsActive: true}, candidates: []model.Trip{{ID: 11, Status: "in_progress", ScheduledDeparture: now.Add(-time.Hour)}, {ID: 12, Status: "scheduled", ScheduledDeparture: now.Add(time.Hour)}}, wantStatus: CurrentTripActive, wantTripID: 11},
+		{name: "next scheduled trip", device: &model.Device{ID: 7, BusID: &busID, IsActive: true}, candidates: []model.Trip{{ID: 12, Status: "scheduled", ScheduledDeparture: now.Add(time.Hour)}}, wantStatus: CurrentTripUpcoming, wantTripID: 12},
+		{name: "no trip", device: &model.Device{ID: 7, BusID: &busID, IsActive: true}, wantStatus: CurrentTripNone},
+		{name: "device without bus", device: &model.Device{ID: 7, IsActive: true}, wantStatus: CurrentTripNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trips := &fakeCurrentTrips{candidates: tt.candidates}
+			s := &iotService{deviceRepo: fakeDeviceLookup{device: tt.device}, tripRepo: trips, pricing: fakePricingParameters{}}
+
+			response, err := s.GetCurrentTrip(context.Background(), 7)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, response.Status)
+			assert.Equal(t, 300, response.PollIntervalSeconds)
+
+			if tt.device.BusID == nil {
+				assert.False(t, trips.queried)
+			} else {
+				// Заплановані рейси шукаються від години тому до 12 годин наперед
+				assert.WithinDuration(t, now.Add(-time.Hour), trips.from, time.Minute)
+				assert.WithinDuration(t, now.Add(12*time.Hour), trips.to, time.Minute)
+			}
+
+			if tt.wantTripID == 0 {
+				assert.Nil(t, response.Config)
+				return
+			}
+			require.NotNil(t, response.Config)
+			assert.Equal(t, tt.wantTripID, response.Config.TripID)
+			assert.Equal(t, 50, response.Config.BusCapacity)
+			assert.Equal(t, "3f2a9c0d1b7e4a65", response.Config.Pricing.Version)
+		})
+	}
+}
+
+func TestGetCurrentTripForDeactivatedDevice(t *testing.T) {
+	busID := int64(3)
+	trips := &fakeCurrentTrips{}
+	s := &iotService{deviceRepo: fakeDeviceLookup{device: &model.Device{ID: 7, BusID: &busID}}, tripRepo: trips}
+
+	_, err := s.GetCurrentTrip(context.Background(), 7)
+	assert.ErrorIs(t, err, ErrDeviceAccessDenied)
+	assert.False(t, trips.queried)
+}
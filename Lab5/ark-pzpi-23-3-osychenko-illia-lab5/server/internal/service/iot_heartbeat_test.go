@@ -0,0 +1,80 @@
+package service
+
+import (
+	"busoptima/internal/model"
+	"busoptima/internal/repository"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeHeartbeats зберігає отримані heartbeat в пам'яті
+type fakeHeartbeats struct {
+	repository.DeviceHeartbeatRepository
+	created []model.DeviceHeartbeat
+}
+
+func (f *fakeHeartbeats) Create(ctx context.Context, heartbeat *model.DeviceHeartbeat) error {
+	heartbeat.ReceivedAt = time.Date(2024, 5, 1, 8, 15, 0, 0, time.UTC)
+	f.created = append(f.created, *heartbeat)
+	return nil
+}
+
+func TestRecordHeartbeatValidatesTelemetry(t *testing.T) {
+	intPtr := func(v int) *int { return &v }
+	strPtr := func(s string) *string { return &s }
+
+	tests := []struct {
+		name      string
+		heartbeat model.DeviceHeartbeat
+		wantErr   bool
+	}{
+		{name: "all fields", heartbeat: model.DeviceHeartbeat{FirmwareVersion: strPtr("1.2.0"), UptimeSeconds: 86400, FreeHeapBytes: intPtr(142000), BufferedEvents: 3, RSSI: intPtr(-67), BatteryPercent: intPtr(87)}},
+		// Пристрої без батареї, Wi-Fi чи звіту про пам'ять не надсилають ці поля
+		{name: "required fields only", heartbeat: model.DeviceHeartbeat{UptimeSeconds: 10}},
+		{name: "boundary values", heartbeat: model.DeviceHeartbeat{FreeHeapBytes: intPtr(0), RSSI: intPtr(-127), BatteryPercent: intPtr(100), FirmwareVersion: strPtr(strings.Repeat("9", firmwareVersionMaxLength))}},
+		{name: "strongest signal", heartbeat: model.DeviceHeartbeat{RSSI: intPtr(0), BatteryPercent: intPtr(0)}},
+		{name: "negative uptime", heartbeat: model.DeviceHeartbeat{UptimeSeconds: -1}, wantErr: true},
+		{name: "negative free heap", heartbeat: model.DeviceHeartbeat{FreeHeapBytes: intPtr(-1)}, wantErr: true},
+		{name: "negative buffered events", heartbeat: model.DeviceHeartbeat{BufferedEvents: -1}, wantErr: true},
+		{name: "rssi above zero", heartbeat: model.DeviceHeartbeat{RSSI: intPtr(1)}, wantErr: true},
+		{name: "rssi below range", heartbeat: model.DeviceHeartbeat{RSSI: intPtr(-128)}, wantErr: true},
+		{name: "battery above 100", heartbeat: model.DeviceHeartbeat{BatteryPercent: intPtr(101)}, wantErr: true},
+		{name: "negative battery", heartbeat: model.DeviceHeartbeat{BatteryPercent: intPtr(-1)}, wantErr: true},
+		{name: "firmware version too long", heartbeat: model.DeviceHeartbeat{FirmwareVersion: strPtr(strings.Repeat("9", firmwareVersionMaxLength+1))}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			heartbeats := &fakeHeartbeats{}
+			s := &iotService{deviceRepo: fakeDeviceLookup{device: &model.Device{ID: 7, IsActive: true}}, heartbeatRepo: heartbeats}
+
+			heartbeat := tt.heartbeat
+			response, err := s.RecordHeartbeat(context.Background(), 7, &heartbeat)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidHeartbeat)
+				assert.Empty(t, heartbeats.created)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Len(t, heartbeats.created, 1)
+			assert.Equal(t, int64(7), heartbeats.created[0].DeviceID)
+			assert.Equal(t, "2024-05-01T08:15:00Z", response.ServerTime)
+			assert.Equal(t, 30, response.HeartbeatIntervalSeconds)
+		})
+	}
+}
+
+func TestRecordHeartbeatFromDeactivatedDevice(t *testing.T) {
+	heartbeats := &fakeHeartbeats{}
+	s := &iotService{deviceRepo: fakeDeviceLookup{device: &model.Device{ID: 7}}, heartbeatRepo: heartbeats}
+
+	_, err := s.RecordHeartbeat(context.Background(), 7, &model.DeviceHeartbeat{UptimeSeconds: 10})
+	assert.ErrorIs(t, err, ErrDeviceAccessDenied)
+	assert.Empty(t, heartbeats.created)
+}
@@ -4,22 +4,101 @@ import (
 	"busoptima/internal/model"
 	"busoptima/internal/repository"
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"log"
+	"math"
+	"sort"
 	"time"
 )
 
+// ErrDeviceAccessDenied повертається, коли пристрій звертається до рейсу чужого автобуса
+var ErrDeviceAccessDenied = errors.New("device is not allowed to access this trip")
+
+// ErrTripNotFound повертається, коли пристрій звертається до рейсу, якого не існує
+var ErrTripNotFound = errors.New("trip not found")
+
+// ErrInvalidHeartbeat повертається, коли показники heartbeat виходять за допустимі межі
+var ErrInvalidHeartbeat = errors.New("invalid heartbeat")
+
+// heartbeatInterval період, з яким пристрій має надсилати heartbeat
+const heartbeatInterval = 30 * time.Second
+
 // IoTService інтерфейс для роботи з IoT-пристроями
 type IoTService interface {
-	SyncEvents(ctx context.Context, tripID int64, events []model.PassengerEvent) (*SyncEventsResponse, error)
-	SendPriceRecommendation(ctx context.Context, recommendation *model.PriceRecommendation) error
-	GetTripConfig(ctx context.Context, tripID int64) (*TripConfig, error)
+	SyncEvents(ctx context.Context, deviceID, tripID int64, events []model.PassengerEvent) (*SyncEventsResponse, error)
+	SendPriceRecommendation(ctx context.Context, deviceID int64, recommendation *model.PriceRecommendation) (*PriceVerification, error)
+	GetTripConfig(ctx context.Context, deviceID, tripID int64) (*TripConfig, error)
+	GetCurrentTrip(ctx context.Context, deviceID int64) (*CurrentTripResponse, error)
+	RecordHeartbeat(ctx context.Context, deviceID int64, heartbeat *model.DeviceHeartbeat) (*HeartbeatResponse, error)
+}
+
+// SyncEventInput подія пасажира у форматі, який надсилає пристрій
+type SyncEventInput struct {
+	LocalID             int     `json:"local_id"`
+	EventType           string  `json:"event_type"`
+	Timestamp           string  `json:"timestamp"`
+	Latitude            float64 `json:"latitude"`
+	Longitude           float64 `json:"longitude"`
+	PassengerCountAfter int     `json:"passenger_count_after"`
+}
+
+// ToPassengerEvents конвертує події пристрою в модель.
+// Подія з невірним timestamp отримує нульовий час і відхиляється в SyncEvents окремо, а не весь пакет
+func ToPassengerEvents(tripID int64, inputs []SyncEventInput) []model.PassengerEvent {
+	events := make([]model.PassengerEvent, len(inputs))
+	for i := range inputs {
+		// Вказівники беруться на елемент зрізу, а не на змінну циклу, спільну для всіх ітерацій
+		e := &inputs[i]
+		timestamp, _ := time.Parse(time.RFC3339, e.Timestamp)
+
+		events[i] = model.PassengerEvent{
+			TripID:              tripID,
+			EventType:           e.EventType,
+			Timestamp:           timestamp,
+			Latitude:            &e.Latitude,
+			Longitude:           &e.Longitude,
+			PassengerCountAfter: e.PassengerCountAfter,
+			DeviceLocalID:       &e.LocalID,
+		}
+	}
+	return events
+}
+
+// Статуси обробки події з пакета синхронізації
+const (
+	// EventAccepted подію збережено
+	EventAccepted = "accepted"
+	// EventDuplicate подію з цим local_id вже отримано раніше
+	EventDuplicate = "duplicate"
+	// EventQuarantined подію збережено для перевірки, на кількість пасажирів вона не впливає
+	EventQuarantined = "quarantined"
+	// EventRejected подію відхилено, повторне надсилання не допоможе
+	EventRejected = "rejected"
+)
+
+// EventSyncResult результат обробки однієї події. Будь-який статус остаточний,
+// тож пристрій може видалити подію з буфера
+type EventSyncResult struct {
+	LocalID int    `json:"local_id" example:"123"`
+	Status  string `json:"status" example:"accepted" enums:"accepted,duplicate,quarantined,rejected"`
+	Reason  string `json:"reason,omitempty" example:"count_reconciled"`
+	// PassengerCountAfter кількість пасажирів після події, як її зберіг сервер
+	PassengerCountAfter *int `json:"passenger_count_after,omitempty" example:"25"`
 }
 
 type SyncEventsResponse struct {
-	SyncedCount           int    `json:"synced_count"`
-	LastSyncedLocalID     int    `json:"last_synced_local_id"`
-	TripCurrentPassengers int    `json:"trip_current_passengers"`
-	ServerTime            string `json:"server_time"`
+	SyncedCount           int               `json:"synced_count"`
+	AcceptedCount         int               `json:"accepted_count"`
+	DuplicateCount        int               `json:"duplicate_count"`
+	QuarantinedCount      int               `json:"quarantined_count"`
+	RejectedCount         int               `json:"rejected_count"`
+	ReconciledCount       int               `json:"reconciled_count"`
+	LastSyncedLocalID     int               `json:"last_synced_local_id"`
+	TripCurrentPassengers int               `json:"trip_current_passengers"`
+	Results               []EventSyncResult `json:"results"`
+	ServerTime            string            `json:"server_time"`
 }
 
 type TripConfig struct {
@@ -27,6 +106,68 @@ type TripConfig struct {
 	RouteID     int64   `json:"route_id"`
 	BusCapacity int     `json:"bus_capacity"`
 	BasePrice   float64 `json:"base_price"`
+	// DepartureTime запланований час відправлення, за яким рахуються коефіцієнти часу та дня
+	DepartureTime time.Time          `json:"departure_time"`
+	Pricing       *PricingParameters `json:"pricing"`
+}
+
+// Причини розбіжності рекомендації ціни пристрою з розрахунком сервера
+const (
+	// PriceBasePriceMismatch пристрій рахував від іншої базової ціни, ніж ціна маршруту
+	PriceBasePriceMismatch = "base_price_mismatch"
+	// PriceOccupancyMismatch завантаженість пристрою суттєво відрізняється від завантаженості рейсу на сервері
+	PriceOccupancyMismatch = "occupancy_mismatch"
+	// PriceMismatch за тих самих умов пристрій отримав іншу ціну (інші коефіцієнти або параметри)
+	PriceMismatch = "price_mismatch"
+)
+
+// basePriceTolerance допустима розбіжність базової ціни через округлення
+const basePriceTolerance = 0.01
+
+// PriceVerification результат перевірки рекомендації ціни пристрою сервером
+type PriceVerification struct {
+	Flagged bool   `json:"flagged" example:"false"`
+	Reason  string `json:"reason,omitempty" example:"price_mismatch" enums:"base_price_mismatch,occupancy_mismatch,price_mismatch"`
+	// DevicePrice ціна, яку надіслав пристрій
+	DevicePrice float64 `json:"device_price" example:"550"`
+	// ServerPrice ціна, розрахована сервером за фактичною завантаженістю та часом відправлення рейсу
+	ServerPrice         float64 `json:"server_price" example:"550"`
+	ServerOccupancyRate float64 `json:"server_occupancy_rate" example:"56"`
+}
+
+// Стани поточного рейсу пристрою
+const (
+	// CurrentTripActive автобус пристрою виконує рейс (boarding або in_progress)
+	CurrentTripActive = "active"
+	// CurrentTripUpcoming найближчий запланований рейс автобуса
+	CurrentTripUpcoming = "upcoming"
+	// CurrentTripNone рейсу немає або пристрій не прив'язаний до автобуса
+	CurrentTripNone = "none"
+)
+
+const (
+	// currentTripLateGrace скільки запланований рейс, що не почався вчасно, ще вважається наступним
+	currentTripLateGrace = time.Hour
+	// currentTripLookahead наскільки наперед шукається наступний запланований рейс
+	currentTripLookahead = 12 * time.Hour
+	// currentTripPollInterval період, з яким пристрій має повторно запитувати поточний рейс
+	currentTripPollInterval = 5 * time.Minute
+)
+
+// CurrentTripResponse поточний або наступний рейс автобуса пристрою
+type CurrentTripResponse struct {
+	Status string `json:"status" example:"active" enums:"active,upcoming,none"`
+	// Config конфігурація рейсу, відсутня для статусу none
+	Config *TripConfig `json:"config,omitempty"`
+	// PollIntervalSeconds через скільки пристрою варто запитати поточний рейс знову
+	PollIntervalSeconds int `json:"poll_interval_seconds" example:"300"`
+}
+
+// HeartbeatResponse відповідь на heartbeat пристрою
+type HeartbeatResponse struct {
+	ServerTime string `json:"server_time" example:"2023-12-15T08:15:00Z"`
+	// HeartbeatIntervalSeconds період, з яким пристрій має надсилати наступні heartbeat
+	HeartbeatIntervalSeconds int `json:"heartbeat_interval_seconds" example:"30"`
 }
 
 type iotService struct {
@@ -34,86 +175,399 @@ type iotService struct {
 	eventRepo       repository.PassengerEventRepository
 	tripRepo        repository.TripRepository
 	priceRecommRepo repository.PriceRecommendationRepository
+	heartbeatRepo   repository.DeviceHeartbeatRepository
+	pricing         PricingService
 }
 
-func NewIoTService(deviceRepo repository.DeviceRepository, eventRepo repository.PassengerEventRepository, tripRepo repository.TripRepository, priceRecommRepo repository.PriceRecommendationRepository) IoTService {
+func NewIoTService(deviceRepo repository.DeviceRepository, eventRepo repository.PassengerEventRepository, tripRepo repository.TripRepository, priceRecommRepo repository.PriceRecommendationRepository, heartbeatRepo repository.DeviceHeartbeatRepository, pricing PricingService) IoTService {
 	return &iotService{
 		deviceRepo:      deviceRepo,
 		eventRepo:       eventRepo,
 		tripRepo:        tripRepo,
 		priceRecommRepo: priceRecommRepo,
+		heartbeatRepo:   heartbeatRepo,
+		pricing:         pricing,
 	}
 }
 
-// SyncEvents синхронізує події пасажирів від IoT-пристрою
-func (s *iotService) SyncEvents(ctx context.Context, tripID int64, events []model.PassengerEvent) (*SyncEventsResponse, error) {
-	if len(events) == 0 {
-		return &SyncEventsResponse{
-			SyncedCount:           0,
-			LastSyncedLocalID:     0,
-			TripCurrentPassengers: 0,
-			ServerTime:            time.Now().Format(time.RFC3339),
-		}, nil
+// SyncEvents синхронізує події пасажирів від IoT-пристрою.
+// Кожна подія перевіряється та звіряється з кількістю пасажирів рейсу: некоректні відхиляються,
+// неможливі (від'ємна кількість або понад місткість) відкладаються в карантин
+func (s *iotService) SyncEvents(ctx context.Context, deviceID, tripID int64, events []model.PassengerEvent) (*SyncEventsResponse, error) {
+	trip, err := s.authorizeTrip(ctx, deviceID, tripID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &SyncEventsResponse{
+		Results: make([]EventSyncResult, len(events)),
 	}
 
-	// Встановлюємо trip_id для всіх подій
 	for i := range events {
 		events[i].TripID = tripID
+		if events[i].DeviceLocalID != nil {
+			response.Results[i].LocalID = *events[i].DeviceLocalID
+		}
 	}
 
-	// Зберігаємо події пакетом
-	err := s.eventRepo.BatchCreate(ctx, events)
+	// Рейс блокується до кінця синхронізації: паралельний пакет того самого рейсу чекає і звіряється
+	// вже з її результатом, а карантин, події та кількість пасажирів зберігаються разом
+	err = s.eventRepo.LockTrip(ctx, tripID, func(tx repository.TripEvents) error {
+		return s.reconcileEvents(ctx, tx, trip, deviceID, events, response.Results)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to sync events: %w", err)
 	}
 
+	for _, result := range response.Results {
+		switch result.Status {
+		case EventAccepted:
+			response.AcceptedCount++
+			if result.Reason == ReasonCountReconciled {
+				response.ReconciledCount++
+			}
+		case EventDuplicate:
+			response.DuplicateCount++
+		case EventQuarantined:
+			response.QuarantinedCount++
+		case EventRejected:
+			response.RejectedCount++
+		}
+
+		if result.LocalID > response.LastSyncedLocalID {
+			response.LastSyncedLocalID = result.LocalID
+		}
+	}
+	response.SyncedCount = response.AcceptedCount + response.DuplicateCount + response.QuarantinedCount
+
+	// Час синхронізації лише для моніторингу, тому його помилка не скасовує вже збережені події
+	if err := s.deviceRepo.UpdateLastSync(ctx, deviceID); err != nil {
+		log.Printf("Failed to update last sync of device %d: %v", deviceID, err)
+	}
+
 	// Отримуємо оновлену інформацію про рейс
-	trip, err := s.tripRepo.GetByID(ctx, tripID)
+	trip, err = s.tripRepo.GetByID(ctx, tripID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get trip: %w", err)
 	}
 
-	// Знаходимо останню подію для local_id
-	lastLocalID := 0
-	if len(events) > 0 && events[len(events)-1].DeviceLocalID != nil {
-		lastLocalID = *events[len(events)-1].DeviceLocalID
+	response.TripCurrentPassengers = trip.CurrentPassengers
+	response.ServerTime = time.Now().Format(time.RFC3339)
+
+	return response, nil
+}
+
+// reconcileEvents звіряє події з кількістю пасажирів рейсу та зберігає їх у транзакції tx.
+// Результат кожної події записується в results за її індексом
+func (s *iotService) reconcileEvents(ctx context.Context, tx repository.TripEvents, trip *model.Trip, deviceID int64, events []model.PassengerEvent, results []EventSyncResult) error {
+	localIDs := make([]int, 0, len(events))
+	for i := range events {
+		if events[i].DeviceLocalID != nil {
+			localIDs = append(localIDs, *events[i].DeviceLocalID)
+		}
+	}
+
+	// Повторно надіслані події не повинні змінювати кількість пасажирів
+	received, err := tx.GetReceivedLocalIDs(ctx, deviceID, localIDs)
+	if err != nil {
+		return err
 	}
 
-	return &SyncEventsResponse{
-		SyncedCount:           len(events),
-		LastSyncedLocalID:     lastLocalID,
-		TripCurrentPassengers: trip.CurrentPassengers,
-		ServerTime:            time.Now().Format(time.RFC3339),
-	}, nil
+	// Кожна подія звіряється з кількістю на момент її часу, відтвореною за збереженими подіями рейсу
+	stored, err := tx.GetEvents(ctx)
+	if err != nil {
+		return err
+	}
+	capacity := 0
+	if trip.Bus != nil {
+		capacity = trip.Bus.Capacity
+	}
+	tracker := newOccupancyTracker(stored, capacity)
+
+	// Події звіряються в порядку часу, навіть якщо пристрій надіслав їх інакше
+	order := make([]int, len(events))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return events[order[a]].Timestamp.Before(events[order[b]].Timestamp)
+	})
+
+	now := time.Now()
+	outOfOrder := false
+
+	var accepted []model.PassengerEvent
+	var acceptedIndexes []int
+	var quarantined []model.QuarantinedEvent
+	var quarantinedIndexes []int
+	for _, i := range order {
+		event := &events[i]
+		result := &results[i]
+
+		if reason := validateEvent(event, now); reason != "" {
+			result.Status = EventRejected
+			result.Reason = reason
+			continue
+		}
+
+		localID := *event.DeviceLocalID
+		if received[localID] {
+			result.Status = EventDuplicate
+			continue
+		}
+		received[localID] = true
+
+		reason, before, later := tracker.apply(event)
+		if reason != "" {
+			quarantined = append(quarantined, model.QuarantinedEvent{
+				DeviceID:            deviceID,
+				TripID:              trip.ID,
+				EventType:           event.EventType,
+				Timestamp:           event.Timestamp,
+				Latitude:            event.Latitude,
+				Longitude:           event.Longitude,
+				PassengerCountAfter: event.PassengerCountAfter,
+				RunningCount:        before,
+				DeviceLocalID:       localID,
+				Reason:              reason,
+			})
+			quarantinedIndexes = append(quarantinedIndexes, i)
+			result.Reason = reason
+			continue
+		}
+
+		if event.ReportedCount != nil {
+			result.Reason = ReasonCountReconciled
+		}
+		if later {
+			outOfOrder = true
+		}
+		accepted = append(accepted, *event)
+		acceptedIndexes = append(acceptedIndexes, i)
+	}
+
+	// Зберігаємо події пакетами; події, надіслані паралельним запитом, пропускаються
+	inserted, err := tx.Quarantine(ctx, quarantined)
+	if err != nil {
+		return err
+	}
+	for i, index := range quarantinedIndexes {
+		markStored(&results[index], inserted[i], EventQuarantined, nil)
+	}
+
+	inserted, err = tx.Create(ctx, deviceID, accepted)
+	if err != nil {
+		return err
+	}
+	for i, index := range acceptedIndexes {
+		markStored(&results[index], inserted[i], EventAccepted, &accepted[i].PassengerCountAfter)
+	}
+
+	// Затримані події (наприклад, після роботи офлайн) змінюють кількість для пізніших подій рейсу:
+	// відкладені раніше події можуть стати можливими, а кількості перераховуються в порядку часу
+	if outOfOrder {
+		released, err := releaseQuarantined(ctx, tx, tracker)
+		if err != nil {
+			return err
+		}
+		for _, q := range released {
+			if q.DeviceID != deviceID {
+				continue
+			}
+			for _, index := range quarantinedIndexes {
+				if results[index].LocalID == q.DeviceLocalID && results[index].Status == EventQuarantined {
+					results[index].Status = EventAccepted
+					results[index].Reason = ""
+				}
+			}
+		}
+
+		if _, err := tx.RecomputeOccupancy(ctx); err != nil {
+			return fmt.Errorf("failed to recompute trip occupancy: %w", err)
+		}
+	}
+
+	return nil
 }
 
-// SendPriceRecommendation зберігає рекомендацію ціни від IoT-пристрою
-func (s *iotService) SendPriceRecommendation(ctx context.Context, recommendation *model.PriceRecommendation) error {
-	// Перевіряємо, чи існує рейс
-	_, err := s.tripRepo.GetByID(ctx, recommendation.TripID)
+// markStored встановлює статус збереженої події або duplicate, якщо її вже зберіг інший запит
+func markStored(result *EventSyncResult, inserted bool, status string, count *int) {
+	if !inserted {
+		result.Status = EventDuplicate
+		result.Reason = ""
+		return
+	}
+	result.Status = status
+	result.PassengerCountAfter = count
+}
+
+// SendPriceRecommendation перевіряє та зберігає рекомендацію ціни від IoT-пристрою.
+// Сервер перераховує ціну за фактичною завантаженістю та запланованим часом відправлення рейсу;
+// якщо ціна пристрою розходиться з нею більше допустимого, рекомендація зберігається позначеною
+// разом з обома цінами, і в аналітиці замість неї використовується ціна сервера
+func (s *iotService) SendPriceRecommendation(ctx context.Context, deviceID int64, recommendation *model.PriceRecommendation) (*PriceVerification, error) {
+	// Перевіряємо, що рейс існує і виконується автобусом пристрою
+	trip, err := s.authorizeTrip(ctx, deviceID, recommendation.TripID)
+	if err != nil {
+		return nil, err
+	}
+
+	if trip.Route == nil {
+		return nil, fmt.Errorf("route of trip %d not found", trip.ID)
+	}
+
+	capacity := 0
+	if trip.Bus != nil {
+		capacity = trip.Bus.Capacity
+	}
+
+	expected, err := s.pricing.CalculatePrice(ctx, trip.Route.BasePrice, trip.CurrentPassengers, capacity, trip.ScheduledDeparture)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate price: %w", err)
+	}
+
+	// Допуски входять до версіонованих параметрів ціноутворення, як і коефіцієнти
+	params, err := s.pricing.GetParameters(ctx)
 	if err != nil {
-		return fmt.Errorf("trip not found: %w", err)
+		return nil, fmt.Errorf("failed to get pricing parameters: %w", err)
+	}
+
+	verification := &PriceVerification{
+		Reason:              priceDivergence(recommendation, expected, params),
+		DevicePrice:         recommendation.RecommendedPrice,
+		ServerPrice:         expected.RecommendedPrice,
+		ServerOccupancyRate: expected.OccupancyRate,
+	}
+	verification.Flagged = verification.Reason != ""
+
+	recommendation.DeviceID = &deviceID
+	recommendation.ServerPrice = &verification.ServerPrice
+	recommendation.ServerOccupancyRate = &verification.ServerOccupancyRate
+	recommendation.IsFlagged = verification.Flagged
+	if verification.Flagged {
+		recommendation.DivergenceReason = &verification.Reason
+		log.Printf("Price recommendation from device %d for trip %d flagged (%s): device %.2f, server %.2f",
+			deviceID, trip.ID, verification.Reason, verification.DevicePrice, verification.ServerPrice)
 	}
 
 	// Зберігаємо рекомендацію ціни
-	err = s.priceRecommRepo.Create(ctx, recommendation)
+	if err := s.priceRecommRepo.Create(ctx, recommendation); err != nil {
+		return nil, fmt.Errorf("failed to save price recommendation: %w", err)
+	}
+
+	return verification, nil
+}
+
+// priceDivergence порівнює рекомендацію пристрою з розрахунком сервера з допусками params.
+// Завантаженість перевіряється завжди, навіть якщо ціна в межах допуску, щоб вигадана пристроєм
+// завантаженість не зберігалась без позначки. Повертає причину розбіжності або порожній рядок
+func priceDivergence(recommendation *model.PriceRecommendation, expected *PriceRecommendation, params *PricingParameters) string {
+	switch {
+	case math.Abs(recommendation.BasePrice-expected.BasePrice) > basePriceTolerance:
+		return PriceBasePriceMismatch
+	case math.Abs(recommendation.OccupancyRate-expected.OccupancyRate) > params.OccupancyTolerancePoints:
+		return PriceOccupancyMismatch
+	case math.Abs(recommendation.RecommendedPrice-expected.RecommendedPrice) > expected.BasePrice*params.PriceTolerancePercent/100:
+		return PriceMismatch
+	default:
+		return ""
+	}
+}
+
+// GetTripConfig повертає конфігурацію рейсу разом з параметрами ціноутворення для IoT-пристрою
+func (s *iotService) GetTripConfig(ctx context.Context, deviceID, tripID int64) (*TripConfig, error) {
+	trip, err := s.authorizeTrip(ctx, deviceID, tripID)
 	if err != nil {
-		return fmt.Errorf("failed to save price recommendation: %w", err)
+		return nil, err
 	}
 
-	return nil
+	return s.buildTripConfig(ctx, trip)
 }
 
-// GetTripConfig повертає конфігурацію рейсу для IoT-пристрою
-func (s *iotService) GetTripConfig(ctx context.Context, tripID int64) (*TripConfig, error) {
-	trip, err := s.tripRepo.GetByID(ctx, tripID)
+// GetCurrentTrip визначає рейс автобуса пристрою за розкладом і статусом: рейс, що виконується,
+// або найближчий запланований. Пристрою не потрібно знати ID рейсу заздалегідь
+func (s *iotService) GetCurrentTrip(ctx context.Context, deviceID int64) (*CurrentTripResponse, error) {
+	device, err := s.activeDevice(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &CurrentTripResponse{
+		Status:              CurrentTripNone,
+		PollIntervalSeconds: int(currentTripPollInterval.Seconds()),
+	}
+
+	// Пристрій ще не прив'язали до автобуса - це не помилка, прив'язка може з'явитися пізніше
+	if device.BusID == nil {
+		return response, nil
+	}
+
+	now := time.Now()
+	candidates, err := s.tripRepo.GetCurrentCandidatesByBus(ctx, *device.BusID, now.Add(-currentTripLateGrace), now.Add(currentTripLookahead))
+	if err != nil {
+		return nil, err
+	}
+	current := selectCurrentTrip(candidates)
+	if current == nil {
+		return response, nil
+	}
+
+	trip, err := s.tripRepo.GetByID(ctx, current.ID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get trip: %w", err)
 	}
 
+	config, err := s.buildTripConfig(ctx, trip)
+	if err != nil {
+		return nil, err
+	}
+
+	response.Status = CurrentTripActive
+	if trip.Status == "scheduled" {
+		response.Status = CurrentTripUpcoming
+	}
+	response.Config = config
+
+	return response, nil
+}
+
+// selectCurrentTrip обирає рейс, що виконується (boarding або in_progress), інакше найближчий запланований.
+// Поки рейс виконується, наступний не обирається, навіть якщо час його відправлення вже настав.
+// Якщо рейсів, що виконуються, кілька, обирається той, що відправлявся останнім
+func selectCurrentTrip(trips []model.Trip) *model.Trip {
+	var active, upcoming *model.Trip
+	for i := range trips {
+		trip := &trips[i]
+		switch trip.Status {
+		case "boarding", "in_progress":
+			if active == nil || trip.ScheduledDeparture.After(active.ScheduledDeparture) {
+				active = trip
+			}
+		case "scheduled":
+			if upcoming == nil || trip.ScheduledDeparture.Before(upcoming.ScheduledDeparture) {
+				upcoming = trip
+			}
+		}
+	}
+
+	if active != nil {
+		return active
+	}
+	return upcoming
+}
+
+// buildTripConfig формує конфігурацію рейсу з параметрами ціноутворення
+func (s *iotService) buildTripConfig(ctx context.Context, trip *model.Trip) (*TripConfig, error) {
+	pricing, err := s.pricing.GetParameters(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pricing parameters: %w", err)
+	}
+
 	config := &TripConfig{
-		TripID:  tripID,
-		RouteID: trip.RouteID,
+		TripID:        trip.ID,
+		RouteID:       trip.RouteID,
+		DepartureTime: trip.ScheduledDeparture,
+		Pricing:       pricing,
 	}
 
 	if trip.Route != nil {
@@ -126,3 +580,83 @@ func (s *iotService) GetTripConfig(ctx context.Context, tripID int64) (*TripConf
 
 	return config, nil
 }
+
+// RecordHeartbeat зберігає показники стану пристрою
+func (s *iotService) RecordHeartbeat(ctx context.Context, deviceID int64, heartbeat *model.DeviceHeartbeat) (*HeartbeatResponse, error) {
+	if err := validateHeartbeat(heartbeat); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.activeDevice(ctx, deviceID); err != nil {
+		return nil, err
+	}
+
+	heartbeat.DeviceID = deviceID
+	if err := s.heartbeatRepo.Create(ctx, heartbeat); err != nil {
+		return nil, err
+	}
+
+	return &HeartbeatResponse{
+		ServerTime:               heartbeat.ReceivedAt.Format(time.RFC3339),
+		HeartbeatIntervalSeconds: int(heartbeatInterval.Seconds()),
+	}, nil
+}
+
+// validateHeartbeat перевіряє, що показники heartbeat фізично можливі
+func validateHeartbeat(heartbeat *model.DeviceHeartbeat) error {
+	switch {
+	case heartbeat.UptimeSeconds < 0:
+		return fmt.Errorf("%w: uptime_seconds must not be negative", ErrInvalidHeartbeat)
+	case heartbeat.FreeHeapBytes != nil && *heartbeat.FreeHeapBytes < 0:
+		return fmt.Errorf("%w: free_heap_bytes must not be negative", ErrInvalidHeartbeat)
+	case heartbeat.BufferedEvents < 0:
+		return fmt.Errorf("%w: buffered_events must not be negative", ErrInvalidHeartbeat)
+	case heartbeat.RSSI != nil && (*heartbeat.RSSI < -127 || *heartbeat.RSSI > 0):
+		return fmt.Errorf("%w: rssi must be between -127 and 0 dBm", ErrInvalidHeartbeat)
+	case heartbeat.BatteryPercent != nil && (*heartbeat.BatteryPercent < 0 || *heartbeat.BatteryPercent > 100):
+		return fmt.Errorf("%w: battery_percent must be between 0 and 100", ErrInvalidHeartbeat)
+	case heartbeat.FirmwareVersion != nil && len(*heartbeat.FirmwareVersion) > firmwareVersionMaxLength:
+		return fmt.Errorf("%w: firmware_version must be at most %d characters", ErrInvalidHeartbeat, firmwareVersionMaxLength)
+	}
+	return nil
+}
+
+// activeDevice повертає пристрій, якщо він існує та активний. Помилки БД повертаються без змін,
+// щоб пристрій отримав 500 (або відхилений пакет MQTT) і повторив запит, а не вважав відмову остаточною
+func (s *iotService) activeDevice(ctx context.Context, deviceID int64) (*model.Device, error) {
+	device, err := s.deviceRepo.GetByID(ctx, deviceID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %v", ErrDeviceAccessDenied, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !device.IsActive {
+		return nil, fmt.Errorf("%w: device is deactivated", ErrDeviceAccessDenied)
+	}
+
+	return device, nil
+}
+
+// authorizeTrip перевіряє, що пристрій активний і прив'язаний до автобуса, який виконує рейс
+func (s *iotService) authorizeTrip(ctx context.Context, deviceID, tripID int64) (*model.Trip, error) {
+	device, err := s.activeDevice(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	trip, err := s.tripRepo.GetByID(ctx, tripID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %d", ErrTripNotFound, tripID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if device.BusID == nil || *device.BusID != trip.BusID {
+		return nil, fmt.Errorf("%w: trip %d is not served by the device bus", ErrDeviceAccessDenied, tripID)
+	}
+
+	return trip, nil
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"busoptima/internal/model"
+	"busoptima/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPriceDivergence(t *testing.T) {
+	params := &PricingParameters{PriceTolerancePercent: 10, OccupancyTolerancePoints: 10}
+	// Розрахунок сервера: базова ціна 500, допуск ціни 50 грн, завантаженість 60%
+	expected := &PriceRecommendation{BasePrice: 500, RecommendedPrice: 550, OccupancyRate: 60}
+
+	tests := []struct {
+		name      string
+		basePrice float64
+		price     float64
+		occupancy float64
+		want      string
+	}{
+		{name: "matches server", basePrice: 500, price: 550, occupancy: 60, want: ""},
+		{name: "price at upper tolerance", basePrice: 500, price: 600, occupancy: 60, want: ""},
+		{name: "price at lower tolerance", basePrice: 500, price: 500, occupancy: 60, want: ""},
+		{name: "price above tolerance", basePrice: 500, price: 600.5, occupancy: 60, want: PriceMismatch},
+		{name: "price below tolerance", basePrice: 500, price: 495, occupancy: 60, want: PriceMismatch},
+		{name: "occupancy at tolerance", basePrice: 500, price: 550, occupancy: 70, want: ""},
+		{name: "occupancy above tolerance with matching price", basePrice: 500, price: 550, occupancy: 70.5, want: PriceOccupancyMismatch},
+		{name: "occupancy below tolerance with matching price", basePrice: 500, price: 550, occupancy: 45, want: PriceOccupancyMismatch},
+		{name: "occupancy reported before price", basePrice: 500, price: 700, occupancy: 95, want: PriceOccupancyMismatch},
+		{name: "base price rounding", basePrice: 500.01, price: 550, occupancy: 60, want: ""},
+		{name: "base price differs", basePrice: 450, price: 550, occupancy: 60, want: PriceBasePriceMismatch},
+		{name: "base price reported first", basePrice: 450, price: 900, occupancy: 95, want: PriceBasePriceMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recommendation := &model.PriceRecommendation{BasePrice: tt.basePrice, RecommendedPrice: tt.price, OccupancyRate: tt.occupancy}
+			assert.Equal(t, tt.want, priceDivergence(recommendation, expected, params))
+		})
+	}
+}
+
+func TestPriceDivergenceUsesParameterTolerances(t *testing.T) {
+	expected := &PriceRecommendation{BasePrice: 500, RecommendedPrice: 550, OccupancyRate: 60}
+	recommendation := &model.PriceRecommendation{BasePrice: 500, RecommendedPrice: 580, OccupancyRate: 64}
+
+	assert.Equal(t, "", priceDivergence(recommendation, expected, &PricingParameters{PriceTolerancePercent: 10, OccupancyTolerancePoints: 10}))
+	assert.Equal(t, PriceMismatch, priceDivergence(recommendation, expected, &PricingParameters{PriceTolerancePercent: 5, OccupancyTolerancePoints: 10}))
+	assert.Equal(t, PriceOccupancyMismatch, priceDivergence(recommendation, expected, &PricingParameters{PriceTolerancePercent: 10, OccupancyTolerancePoints: 3}))
+}
+
+// fakeDeviceLookup повертає заданий пристрій або помилку
+type fakeDeviceLookup struct {
+	repository.DeviceRepository
+	device *model.Device
+	err    error
+}
+
+func (f fakeDeviceLookup) GetByID(ctx context.Context, id int64) (*model.Device, error) {
+	return f.device, f.err
+}
+
+func TestActiveDeviceDeniesOnlyMissingOrInactiveDevices(t *testing.T) {
+	dbErr := errors.New("connection refused")
+
+	tests := []struct {
+		name       string
+		lookup     fakeDeviceLookup
+		wantDenied bool
+		wantErr    error
+	}{
+		{name: "active device", lookup: fakeDeviceLookup{device: &model.Device{ID: 1, IsActive: true}}},
+		{name: "deactivated device", lookup: fakeDeviceLookup{device: &model.Device{ID: 1}}, wantDenied: true},
+		{name: "missing device", lookup: fakeDeviceLookup{err: fmt.Errorf("device with id 1 %w", repository.ErrNotFound)}, wantDenied: true},
+		{name: "database failure", lookup: fakeDeviceLookup{err: fmt.Errorf("failed to get device: %w", dbErr)}, wantErr: dbErr},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &iotService{deviceRepo: tt.lookup}
+			device, err := s.activeDevice(context.Background(), 1)
+
+			assert.Equal(t, tt.wantDenied, errors.Is(err, ErrDeviceAccessDenied))
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+			if !tt.wantDenied && tt.wantErr == nil {
+				assert.NoError(t, err)
+				assert.NotNil(t, device)
+			}
+		})
+	}
+}
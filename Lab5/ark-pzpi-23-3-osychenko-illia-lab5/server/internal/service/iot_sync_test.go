@@ -0,0 +1,195 @@
+package service
+
+import (
+	"busoptima/internal/model"
+	"busoptima/internal/repository"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSyncDevices активний пристрій 7, прив'язаний до автобуса 3
+type fakeSyncDevices struct {
+	repository.DeviceRepository
+}
+
+func (fakeSyncDevices) GetByID(ctx context.Context, id int64) (*model.Device, error) {
+	busID := int64(3)
+	return &model.Device{ID: id, BusID: &busID, IsActive: true}, nil
+}
+
+func (fakeSyncDevices) UpdateLastSync(ctx context.Context, deviceID int64) error {
+	return nil
+}
+
+// fakeSyncTx збережені події рейсу 42 в пам'яті
+type fakeSyncTx struct {
+	repository.TripEvents
+
+	received    map[int]bool
+	stored      []model.PassengerEvent
+	quarantined []model.QuarantinedEvent
+	// raced local_id подій, які між читанням і вставкою зберіг паралельний запит
+	raced map[int]bool
+}
+
+func (f *fakeSyncTx) GetEvents(ctx context.Context) ([]model.PassengerEvent, error) {
+	return append([]model.PassengerEvent(nil), f.stored...), nil
+}
+
+func (f *fakeSyncTx) GetReceivedLocalIDs(ctx context.Context, deviceID int64, localIDs []int) (map[int]bool, error) {
+	received := make(map[int]bool)
+	for _, id := range localIDs {
+		if f.received[id] {
+			received[id] = true
+		}
+	}
+	return received, nil
+}
+
+func (f *fakeSyncTx) Quarantine(ctx context.Context, events []model.QuarantinedEvent) ([]bool, error) {
+	f.quarantined = append(f.quarantined, events...)
+	inserted := make([]bool, len(events))
+	for i := range inserted {
+		inserted[i] = true
+	}
+	return inserted, nil
+}
+
+func (f *fakeSyncTx) Create(ctx context.Context, deviceID int64, events []model.PassengerEvent) ([]bool, error) {
+	inserted := make([]bool, len(events))
+	for i, event := range events {
+		if f.raced[*event.DeviceLocalID] {
+			continue
+		}
+		f.stored = append(f.stored, event)
+		inserted[i] = true
+	}
+	return inserted, nil
+}
+
+func (f *fakeSyncTx) GetPendingQuarantined(ctx context.Context) ([]model.QuarantinedEvent, error) {
+	return nil, nil
+}
+
+func (f *fakeSyncTx) RecomputeOccupancy(ctx context.Context) (*model.OccupancyRecompute, error) {
+	return &model.OccupancyRecompute{}, nil
+}
+
+// fakeSyncEvents виконує синхронізацію в «транзакції» tx
+type fakeSyncEvents struct {
+	repository.PassengerEventRepository
+	tx *fakeSyncTx
+}
+
+func (f *fakeSyncEvents) LockTrip(ctx context.Context, tripID int64, fn func(events repository.TripEvents) error) error {
+	return fn(f.tx)
+}
+
+// fakeSyncTrips рейс 42 автобуса 3 з кількістю пасажирів за збереженими подіями
+type fakeSyncTrips struct {
+	repository.TripRepository
+	tx *fakeSyncTx
+}
+
+func (f *fakeSyncTrips) GetByID(ctx context.Context, id int64) (*model.Trip, error) {
+	trip := &model.Trip{ID: id, BusID: 3, Bus: &model.Bus{Capacity: 50}}
+	if n := len(f.tx.stored); n > 0 {
+		trip.CurrentPassengers = f.tx.stored[n-1].PassengerCountAfter
+	}
+	return trip, nil
+}
+
+func TestSyncEventsDeduplicatesByLocalID(t *testing.T) {
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	event := func(localID, minutes, countAfter int) model.PassengerEvent {
+		return model.PassengerEvent{EventType: "entry", Timestamp: start.Add(time.Duration(minutes) * time.Minute), PassengerCountAfter: countAfter, DeviceLocalID: &localID}
+	}
+
+	tests := []struct {
+		name          string
+		received      []int
+		raced         []int
+		batch         []model.PassengerEvent
+		wantStatuses  []string
+		wantSynced    int
+		wantAccepted  int
+		wantDuplicate int
+		wantStored    int
+		wantLastID    int
+	}{
+		{
+			name:         "new events",
+			batch:        []model.PassengerEvent{event(1, 0, 1), event(2, 1, 2)},
+			wantStatuses: []string{EventAccepted, EventAccepted},
+			wantSynced:   2, wantAccepted: 2, wantStored: 2, wantLastID: 2,
+		},
+		{
+			// Пристрій не отримав відповідь і надіслав пакет повторно
+			name:         "resent batch",
+			received:     []int{1, 2},
+			batch:        []model.PassengerEvent{event(1, 0, 1), event(2, 1, 2)},
+			wantStatuses: []string{EventDuplicate, EventDuplicate},
+			wantSynced:   2, wantDuplicate: 2, wantStored: 2, wantLastID: 2,
+		},
+		{
+			name:         "partly resent batch",
+			received:     []int{1},
+			batch:        []model.PassengerEvent{event(1, 0, 1), event(2, 1, 2)},
+			wantStatuses: []string{EventDuplicate, EventAccepted},
+			wantSynced:   2, wantAccepted: 1, wantDuplicate: 1, wantStored: 2, wantLastID: 2,
+		},
+		{
+			name:         "local id repeated within the batch",
+			batch:        []model.PassengerEvent{event(1, 0, 1), event(1, 1, 2)},
+			wantStatuses: []string{EventAccepted, EventDuplicate},
+			wantSynced:   2, wantAccepted: 1, wantDuplicate: 1, wantStored: 1, wantLastID: 1,
+		},
+		{
+			name:         "stored by a concurrent request",
+			raced:        []int{2},
+			batch:        []model.PassengerEvent{event(1, 0, 1), event(2, 1, 2)},
+			wantStatuses: []string{EventAccepted, EventDuplicate},
+			wantSynced:   2, wantAccepted: 1, wantDuplicate: 1, wantStored: 1, wantLastID: 2,
+		},
+		{
+			// Подія без local_id не може бути дедуплікована, тому відхиляється і не входить у synced_count
+			name:         "missing local id",
+			batch:        []model.PassengerEvent{event(0, 0, 1), event(3, 1, 1)},
+			wantStatuses: []string{EventRejected, EventAccepted},
+			wantSynced:   1, wantAccepted: 1, wantStored: 1, wantLastID: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := &fakeSyncTx{received: map[int]bool{}, raced: map[int]bool{}}
+			for _, id := range tt.received {
+				tx.received[id] = true
+				tx.stored = append(tx.stored, event(id, id-1, id))
+			}
+			for _, id := range tt.raced {
+				tx.raced[id] = true
+			}
+			s := &iotService{deviceRepo: fakeSyncDevices{}, eventRepo: &fakeSyncEvents{tx: tx}, tripRepo: &fakeSyncTrips{tx: tx}}
+
+			response, err := s.SyncEvents(context.Background(), 7, 42, tt.batch)
+			require.NoError(t, err)
+
+			statuses := make([]string, len(response.Results))
+			for i, result := range response.Results {
+				statuses[i] = result.Status
+			}
+			assert.Equal(t, tt.wantStatuses, statuses)
+			assert.Equal(t, tt.wantSynced, response.SyncedCount)
+			assert.Equal(t, tt.wantAccepted, response.AcceptedCount)
+			assert.Equal(t, tt.wantDuplicate, response.DuplicateCount)
+			assert.Equal(t, tt.wantLastID, response.LastSyncedLocalID)
+			assert.Len(t, tx.stored, tt.wantStored)
+			assert.Equal(t, len(tx.stored), response.TripCurrentPassengers)
+		})
+	}
+}
@@ -0,0 +1,323 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// KeyService інтерфейс для підпису та перевірки JWT асиметричними ключами
+type KeyService interface {
+	Sign(claims jwt.MapClaims) (string, error)
+	Keyfunc(token *jwt.Token) (interface{}, error)
+	ValidMethods() []string
+	ActiveKID() string
+	JWKS() *JWKSet
+	Reload() error
+	StartAutoReload(ctx context.Context, interval time.Duration)
+}
+
+// JWK публічний ключ у форматі JSON Web Key (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty" example:"OKP"`
+	Use string `json:"use" example:"sig"`
+	Alg string `json:"alg" example:"EdDSA"`
+	Kid string `json:"kid" example:"20250101000000"`
+	Crv string `json:"crv,omitempty" example:"Ed25519"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// JWKSet набір публічних ключів для /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// signingKey ключ підпису. Для ключів, що виводяться з обігу, може бути лише публічна частина
+type signingKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+// keyService реалізація KeyService.
+// Ключі завантажуються з каталогу: кожен файл <kid>.pem містить приватний ключ RSA або Ed25519
+// (підпис і перевірка) або лише публічний ключ (тільки перевірка, для ротації).
+// Новими токенами підписує приватний ключ з найбільшим kid, тому зручно називати файли за датою.
+type keyService struct {
+	dir string
+	// allowEphemeral дозволяє працювати з тимчасовим ключем, коли каталог порожній (лише для розробки)
+	allowEphemeral bool
+
+	mu        sync.RWMutex
+	keys      map[string]*signingKey
+	active    *signingKey
+	ephemeral *signingKey
+}
+
+// NewKeyService створює сервіс ключів та завантажує ключі з каталогу.
+// Без жодного приватного ключа сервіс не створюється, якщо не дозволено тимчасовий ключ
+func NewKeyService(dir string, allowEphemeral bool) (KeyService, error) {
+	s := &keyService{dir: dir, allowEphemeral: allowEphemeral}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Sign підписує claims активним ключем та додає kid до заголовка
+func (s *keyService) Sign(claims jwt.MapClaims) (string, error) {
+	s.mu.RLock()
+	key := s.active
+	s.mu.RUnlock()
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.private)
+}
+
+// Keyfunc повертає публічний ключ для перевірки токена за його kid
+func (s *keyService) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, fmt.Errorf("token has no kid")
+	}
+
+	s.mu.RLock()
+	key, ok := s.keys[kid]
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s for key %q", token.Method.Alg(), kid)
+	}
+
+	return key.public, nil
+}
+
+// ValidMethods повертає алгоритми, які приймаються при перевірці токенів
+func (s *keyService) ValidMethods() []string {
+	return []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}
+}
+
+// ActiveKID повертає ідентифікатор ключа, яким підписуються нові токени
+func (s *keyService) ActiveKID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.active.kid
+}
+
+// JWKS повертає публічні частини всіх ключів, що приймаються для перевірки
+func (s *keyService) JWKS() *JWKSet {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	kids := make([]string, 0, len(s.keys))
+	for kid := range s.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	set := &JWKSet{Keys: make([]JWK, 0, len(kids))}
+	for _, kid := range kids {
+		set.Keys = append(set.Keys, s.keys[kid].jwk())
+	}
+
+	return set
+}
+
+// Reload перечитує каталог ключів. При помилці залишається попередній набір ключів
+func (s *keyService) Reload() error {
+	keys, err := loadSigningKeys(s.dir)
+	if err != nil {
+		return err
+	}
+
+	var active *signingKey
+	for _, key := range keys {
+		if key.private != nil && (active == nil || key.kid > active.kid) {
+			active = key
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if active == nil {
+		if !s.allowEphemeral {
+			return fmt.Errorf("no private signing key found in %q", s.dir)
+		}
+
+		// У режимі розробки працюємо з тимчасовим ключем, токени не переживуть перезапуск
+		if s.ephemeral == nil {
+			ephemeral, err := generateEphemeralKey()
+			if err != nil {
+				return err
+			}
+			s.ephemeral = ephemeral
+			log.Printf("ERROR: no signing keys found in %q, using ephemeral key %s; tokens will be invalid after restart", s.dir, ephemeral.kid)
+		}
+		active = s.ephemeral
+	}
+
+	// Токени, підписані тимчасовим ключем, лишаються дійсними і після появи ключів у каталозі
+	if s.ephemeral != nil {
+		keys[s.ephemeral.kid] = s.ephemeral
+	}
+
+	if s.active != nil && s.active.kid != active.kid {
+		log.Printf("JWT signing key rotated: %s -> %s", s.active.kid, active.kid)
+	}
+
+	s.keys = keys
+	s.active = active
+
+	return nil
+}
+
+// StartAutoReload запускає періодичне перечитування каталогу ключів
+func (s *keyService) StartAutoReload(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.Reload(); err != nil {
+					log.Printf("ERROR: failed to reload signing keys, keeping previous keys: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// jwk перетворює публічну частину ключа у формат JWK
+func (k *signingKey) jwk() JWK {
+	jwk := JWK{Use: "sig", Alg: k.method.Alg(), Kid: k.kid}
+
+	switch pub := k.public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	}
+
+	return jwk
+}
+
+// loadSigningKeys завантажує всі *.pem файли з каталогу
+func loadSigningKeys(dir string) (map[string]*signingKey, error) {
+	keys := make(map[string]*signingKey)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list signing keys: %w", err)
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signing key %s: %w", file, err)
+		}
+
+		kid := strings.TrimSuffix(filepath.Base(file), ".pem")
+		key, err := parseSigningKey(kid, data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signing key %s: %w", file, err)
+		}
+
+		keys[kid] = key
+	}
+
+	return keys, nil
+}
+
+// parseSigningKey розбирає PEM з приватним або публічним ключем RSA чи Ed25519
+func parseSigningKey(kid string, data []byte) (*signingKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var parsed any
+	var err error
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{kid: kid}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.method, key.private, key.public = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.method, key.public = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.method, key.private, key.public = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.method, key.public = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, expected RSA or Ed25519", parsed)
+	}
+
+	if pub, ok := key.public.(*rsa.PublicKey); ok && pub.N.BitLen() < 2048 {
+		return nil, fmt.Errorf("RSA key must be at least 2048 bits")
+	}
+
+	return key, nil
+}
+
+// generateEphemeralKey генерує тимчасовий Ed25519 ключ для запуску без каталогу ключів
+func generateEphemeralKey() (*signingKey, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ephemeral key: %w", err)
+	}
+
+	return &signingKey{
+		kid:     "ephemeral-" + time.Now().UTC().Format("20060102150405"),
+		method:  jwt.SigningMethodEdDSA,
+		private: private,
+		public:  public,
+	}, nil
+}
@@ -0,0 +1,410 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// oidcHTTPTimeout час очікування відповіді провайдера ідентичності
+	oidcHTTPTimeout = 10 * time.Second
+	// oidcKeysRefreshInterval мінімальний інтервал між перечитуваннями JWKS при невідомому kid
+	oidcKeysRefreshInterval = time.Minute
+)
+
+// OIDCIdentity дані користувача з перевіреного ID токена
+type OIDCIdentity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Groups        []string
+}
+
+// OIDCProvider інтерфейс провайдера OpenID Connect (authorization code flow з PKCE)
+type OIDCProvider interface {
+	Issuer() string
+	AuthorizationURL(ctx context.Context, state, nonce, codeChallenge string) (string, error)
+	Exchange(ctx context.Context, code, codeVerifier, nonce string) (*OIDCIdentity, error)
+}
+
+// oidcMetadata частина документа /.well-known/openid-configuration
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcJWK публічний ключ провайдера (RSA або EC P-256)
+type oidcJWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// oidcProvider реалізація OIDCProvider.
+// Метадані провайдера завантажуються при першому вході, тому сервер запускається і без доступного IdP.
+type oidcProvider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	scopes       []string
+	groupsClaim  string
+	httpClient   *http.Client
+
+	mu           sync.RWMutex
+	metadata     *oidcMetadata
+	keys         map[string]crypto.PublicKey
+	keysLoadedAt time.Time
+}
+
+// NewOIDCProvider створює клієнт провайдера OpenID Connect
+func NewOIDCProvider(issuer, clientID, clientSecret, redirectURL string, scopes []string, groupsClaim string) OIDCProvider {
+	return &oidcProvider{
+		issuer:       strings.TrimSuffix(issuer, "/"),
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		redirectURL:  redirectURL,
+		scopes:       scopes,
+		groupsClaim:  groupsClaim,
+		httpClient:   &http.Client{Timeout: oidcHTTPTimeout},
+	}
+}
+
+// Issuer повертає ідентифікатор провайдера
+func (p *oidcProvider) Issuer() string {
+	return p.issuer
+}
+
+// AuthorizationURL формує адресу сторінки входу провайдера
+func (p *oidcProvider) AuthorizationURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.clientID},
+		"redirect_uri":          {p.redirectURL},
+		"scope":                 {strings.Join(p.scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(metadata.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return metadata.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// Exchange обмінює код авторизації на ID токен та повертає перевірені дані користувача
+func (p *oidcProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*OIDCIdentity, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.redirectURL},
+		"code_verifier": {codeVerifier},
+		"client_id":     {p.clientID},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.clientSecret != "" {
+		// client_secret_basic: облікові дані кодуються як form-urlencoded (RFC 6749, 2.3.1)
+		req.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach identity provider: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&tokens); err != nil {
+		return nil, fmt.Errorf("invalid token response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token exchange failed: %s %s", tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	return p.verifyIDToken(ctx, tokens.IDToken, nonce)
+}
+
+// verifyIDToken перевіряє підпис, видавця, аудиторію, термін дії та nonce ID токена
+func (p *oidcProvider) verifyIDToken(ctx context.Context, raw, nonce string) (*OIDCIdentity, error) {
+	token, err := jwt.Parse(raw, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.publicKey(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256"}),
+		jwt.WithIssuer(p.issuer),
+		jwt.WithAudience(p.clientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(30*time.Second),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token: %w", err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid id_token claims")
+	}
+
+	if tokenNonce, _ := claims["nonce"].(string); tokenNonce == "" || tokenNonce != nonce {
+		return nil, errors.New("id_token nonce mismatch")
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, errors.New("id_token has no subject")
+	}
+
+	identity := &OIDCIdentity{
+		Issuer:  p.issuer,
+		Subject: subject,
+		Groups:  stringList(claims[p.groupsClaim]),
+	}
+	identity.Email, _ = claims["email"].(string)
+	identity.Name, _ = claims["name"].(string)
+
+	// Деякі провайдери передають email_verified рядком
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = verified
+	case string:
+		identity.EmailVerified = verified == "true"
+	}
+
+	return identity, nil
+}
+
+// discover завантажує метадані провайдера
+func (p *oidcProvider) discover(ctx context.Context) (*oidcMetadata, error) {
+	p.mu.RLock()
+	metadata := p.metadata
+	p.mu.RUnlock()
+
+	if metadata != nil {
+		return metadata, nil
+	}
+
+	metadata = &oidcMetadata{}
+	if err := p.getJSON(ctx, p.issuer+"/.well-known/openid-configuration", metadata); err != nil {
+		return nil, fmt.Errorf("failed to load OIDC discovery document: %w", err)
+	}
+
+	if strings.TrimSuffix(metadata.Issuer, "/") != p.issuer {
+		return nil, fmt.Errorf("OIDC issuer mismatch: expected %q, got %q", p.issuer, metadata.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, errors.New("OIDC discovery document is incomplete")
+	}
+
+	p.mu.Lock()
+	p.metadata = metadata
+	p.mu.Unlock()
+
+	return metadata, nil
+}
+
+// publicKey повертає ключ провайдера за kid. Невідомий kid перечитує JWKS (ротація ключів IdP)
+func (p *oidcProvider) publicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.RLock()
+	key, ok := p.lookupKey(kid)
+	stale := time.Since(p.keysLoadedAt) > oidcKeysRefreshInterval
+	p.mu.RUnlock()
+
+	if ok {
+		return key, nil
+	}
+	if !stale {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	if err := p.loadKeys(ctx); err != nil {
+		return nil, err
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+// lookupKey шукає ключ за kid. Токен без kid приймається, лише якщо у провайдера один ключ
+func (p *oidcProvider) lookupKey(kid string) (crypto.PublicKey, bool) {
+	if kid == "" {
+		if len(p.keys) != 1 {
+			return nil, false
+		}
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+// loadKeys завантажує JWKS провайдера
+func (p *oidcProvider) loadKeys(ctx context.Context) error {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return err
+	}
+
+	var set struct {
+		Keys []oidcJWK `json:"keys"`
+	}
+	if err := p.getJSON(ctx, metadata.JWKSURI, &set); err != nil {
+		return fmt.Errorf("failed to load OIDC signing keys: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			// Ключі непідтримуваних типів пропускаємо, токени ними не приймуться
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.keysLoadedAt = time.Now()
+	p.mu.Unlock()
+
+	return nil
+}
+
+// getJSON виконує GET запит та розбирає JSON відповідь
+func (p *oidcProvider) getJSON(ctx context.Context, endpoint string, target any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, endpoint)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(target)
+}
+
+// publicKey перетворює JWK на публічний ключ
+func (k *oidcJWK) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("EC point is not on curve")
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// stringList повертає значення claim як список рядків (масив або один рядок)
+func stringList(value any) []string {
+	switch v := value.(type) {
+	case []any:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	case string:
+		if v == "" {
+			return nil
+		}
+		return []string{v}
+	default:
+		return nil
+	}
+}
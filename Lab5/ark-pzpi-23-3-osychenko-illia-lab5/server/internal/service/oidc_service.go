@@ -0,0 +1,349 @@
+package service
+
+import (
+	"busoptima/internal/model"
+	"busoptima/internal/repository"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// oidcLoginTTL час, протягом якого потрібно завершити вхід на сторінці провайдера
+const oidcLoginTTL = 10 * time.Minute
+
+var (
+	// ErrOIDCDisabled повертається, якщо вхід через OIDC не налаштовано
+	ErrOIDCDisabled = errors.New("OIDC login is not configured")
+	// ErrInvalidOIDCState повертається для невідомого, простроченого або вже використаного state
+	ErrInvalidOIDCState = errors.New("invalid or expired login state")
+	// ErrOIDCNoRole повертається, якщо жодна група користувача не відповідає ролі BusOptima
+	ErrOIDCNoRole = errors.New("no BusOptima role is mapped to your identity provider groups")
+	// ErrInvalidCodeChallenge повертається, якщо code_challenge не є base64url SHA-256 хешем
+	ErrInvalidCodeChallenge = errors.New("code_challenge must be a base64url-encoded SHA-256 hash (S256)")
+	// ErrOIDCAccountNotLinked повертається, якщо обліковий запис з email провайдера вже існує, але не прив'язаний
+	ErrOIDCAccountNotLinked = errors.New("an account with this email already exists; sign in with your password and link the identity provider in your profile")
+	// ErrOIDCIdentityInUse повертається, якщо обліковий запис провайдера вже прив'язано до іншого користувача
+	ErrOIDCIdentityInUse = errors.New("this identity provider account is already linked to another user")
+)
+
+// OIDCRoleMapping відповідність групи провайдера ролі BusOptima
+type OIDCRoleMapping struct {
+	Group string
+	Role  string
+}
+
+// OIDCAuthorization адреса сторінки входу провайдера
+type OIDCAuthorization struct {
+	AuthorizationURL string `json:"authorization_url" example:"https://idp.example.com/authorize?response_type=code&..."`
+	State            string `json:"state" example:"Zk3q..."`
+	ExpiresIn        int    `json:"expires_in" example:"600"`
+}
+
+// OIDCService інтерфейс входу через OpenID Connect
+type OIDCService interface {
+	Enabled() bool
+	StartLogin(ctx context.Context, codeChallenge string) (*OIDCAuthorization, error)
+	CompleteLogin(ctx context.Context, code, state, codeVerifier, ipAddress string) (*LoginResponse, error)
+	StartLink(ctx context.Context, userID int64, codeChallenge string) (*OIDCAuthorization, error)
+	CompleteLink(ctx context.Context, userID int64, code, state, codeVerifier, ipAddress string) error
+}
+
+// oidcService реалізація OIDCService.
+// Користувач прив'язується до облікового запису провайдера за парою iss + sub. При першому вході
+// обліковий запис створюється автоматично з роллю за групами провайдера, наявні облікові записи
+// прив'язуються лише явно через StartLink/CompleteLink.
+type oidcService struct {
+	provider    OIDCProvider
+	oidcRepo    repository.OIDCRepository
+	userRepo    repository.UserRepository
+	roleRepo    repository.RoleRepository
+	auth        AuthService
+	audit       AuditService
+	roleMapping []OIDCRoleMapping
+	defaultRole string
+}
+
+// NewOIDCService створює сервіс входу через OIDC. Якщо provider дорівнює nil, вхід вимкнено
+func NewOIDCService(provider OIDCProvider, oidcRepo repository.OIDCRepository, userRepo repository.UserRepository, roleRepo repository.RoleRepository, auth AuthService, audit AuditService, roleMapping []OIDCRoleMapping, defaultRole string) OIDCService {
+	return &oidcService{
+		provider:    provider,
+		oidcRepo:    oidcRepo,
+		userRepo:    userRepo,
+		roleRepo:    roleRepo,
+		auth:        auth,
+		audit:       audit,
+		roleMapping: roleMapping,
+		defaultRole: defaultRole,
+	}
+}
+
+// ParseOIDCRoleMapping розбирає відповідність груп ролям у форматі "група=роль,група=роль".
+// Порядок важливий: користувач отримує роль першої групи, що збіглася
+func ParseOIDCRoleMapping(value string) ([]OIDCRoleMapping, error) {
+	var mapping []OIDCRoleMapping
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		group, role, ok := strings.Cut(pair, "=")
+		group, role = strings.TrimSpace(group), strings.TrimSpace(role)
+		if !ok || group == "" || role == "" {
+			return nil, fmt.Errorf("invalid OIDC role mapping %q, expected group=role", pair)
+		}
+
+		mapping = append(mapping, OIDCRoleMapping{Group: group, Role: role})
+	}
+	return mapping, nil
+}
+
+// Enabled повертає true, якщо вхід через OIDC налаштовано
+func (s *oidcService) Enabled() bool {
+	return s.provider != nil
+}
+
+// StartLogin створює state та nonce і повертає адресу сторінки входу провайдера.
+// codeChallenge (PKCE, S256) обчислює клієнт; його code_verifier потрібен для завершення входу,
+// тож код авторизації не можна використати з іншого браузера
+func (s *oidcService) StartLogin(ctx context.Context, codeChallenge string) (*OIDCAuthorization, error) {
+	return s.startAuthorization(ctx, codeChallenge, nil)
+}
+
+// StartLink починає прив'язку облікового запису провайдера до користувача, що вже увійшов
+func (s *oidcService) StartLink(ctx context.Context, userID int64, codeChallenge string) (*OIDCAuthorization, error) {
+	return s.startAuthorization(ctx, codeChallenge, &userID)
+}
+
+// startAuthorization зберігає стан входу або прив'язки та формує адресу сторінки входу провайдера
+func (s *oidcService) startAuthorization(ctx context.Context, codeChallenge string, linkUserID *int64) (*OIDCAuthorization, error) {
+	if !s.Enabled() {
+		return nil, ErrOIDCDisabled
+	}
+
+	if challenge, err := base64.RawURLEncoding.DecodeString(codeChallenge); err != nil || len(challenge) != sha256.Size {
+		return nil, ErrInvalidCodeChallenge
+	}
+
+	state, err := generateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := generateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.oidcRepo.CreateLoginState(ctx, &model.OIDCLoginState{
+		StateHash:     hashToken(state),
+		Nonce:         nonce,
+		CodeChallenge: codeChallenge,
+		LinkUserID:    linkUserID,
+		ExpiresAt:     time.Now().Add(oidcLoginTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	authorizationURL, err := s.provider.AuthorizationURL(ctx, state, nonce, codeChallenge)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OIDCAuthorization{
+		AuthorizationURL: authorizationURL,
+		State:            state,
+		ExpiresIn:        int(oidcLoginTTL.Seconds()),
+	}, nil
+}
+
+// CompleteLogin обмінює код авторизації на ID токен, знаходить або створює користувача
+// та завершує вхід так само, як звичайний вхід паролем (включно з 2FA)
+func (s *oidcService) CompleteLogin(ctx context.Context, code, state, codeVerifier, ipAddress string) (*LoginResponse, error) {
+	if !s.Enabled() {
+		return nil, ErrOIDCDisabled
+	}
+
+	// State одноразовий, тому повторна відправка того самого коду не пройде.
+	// Стан прив'язки завершується лише через CompleteLink
+	stored, err := s.oidcRepo.ConsumeLoginState(ctx, hashToken(state), pkceChallenge(codeVerifier))
+	if err != nil || stored.LinkUserID != nil {
+		return nil, ErrInvalidOIDCState
+	}
+
+	identity, err := s.provider.Exchange(ctx, code, codeVerifier, stored.Nonce)
+	if err != nil {
+		s.logEvent(ctx, nil, "OIDC_LOGIN_FAILED", map[string]any{"reason": err.Error()}, ipAddress)
+		return nil, fmt.Errorf("identity provider login failed: %w", err)
+	}
+
+	user, err := s.resolveUser(ctx, identity, ipAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := s.auth.CompleteExternalLogin(ctx, user, ipAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logEvent(ctx, &user.ID, "OIDC_LOGIN", map[string]any{"issuer": identity.Issuer, "subject": identity.Subject, "mfa_required": response.MFARequired}, ipAddress)
+
+	return response, nil
+}
+
+// CompleteLink прив'язує обліковий запис провайдера до користувача, що почав прив'язку через StartLink
+func (s *oidcService) CompleteLink(ctx context.Context, userID int64, code, state, codeVerifier, ipAddress string) error {
+	if !s.Enabled() {
+		return ErrOIDCDisabled
+	}
+
+	stored, err := s.oidcRepo.ConsumeLoginState(ctx, hashToken(state), pkceChallenge(codeVerifier))
+	if err != nil || stored.LinkUserID == nil || *stored.LinkUserID != userID {
+		return ErrInvalidOIDCState
+	}
+
+	identity, err := s.provider.Exchange(ctx, code, codeVerifier, stored.Nonce)
+	if err != nil {
+		s.logEvent(ctx, &userID, "OIDC_LINK_FAILED", map[string]any{"reason": err.Error()}, ipAddress)
+		return fmt.Errorf("identity provider login failed: %w", err)
+	}
+
+	link, err := s.oidcRepo.GetIdentity(ctx, identity.Issuer, identity.Subject)
+	if err != nil {
+		return err
+	}
+	if link != nil {
+		if link.UserID == userID {
+			return nil
+		}
+		return ErrOIDCIdentityInUse
+	}
+
+	err = s.oidcRepo.CreateIdentity(ctx, &model.UserIdentity{Issuer: identity.Issuer, Subject: identity.Subject, UserID: userID, Email: optionalString(identity.Email)})
+	if err != nil {
+		if errors.Is(err, repository.ErrIdentityLinked) {
+			return ErrOIDCIdentityInUse
+		}
+		return err
+	}
+
+	s.logEvent(ctx, &userID, "OIDC_IDENTITY_LINKED", map[string]any{"issuer": identity.Issuer, "subject": identity.Subject}, ipAddress)
+
+	return nil
+}
+
+// resolveUser повертає користувача, прив'язаного до облікового запису провайдера, або створює нового.
+// Наявний локальний обліковий запис з тим самим email не прив'язується автоматично: користувач
+// має увійти паролем і прив'язати провайдера сам. Роль за групами провайдера призначається
+// лише новому обліковому запису, далі нею керує адміністратор
+func (s *oidcService) resolveUser(ctx context.Context, identity *OIDCIdentity, ipAddress string) (*model.User, error) {
+	email := optionalString(identity.Email)
+
+	link, err := s.oidcRepo.GetIdentity(ctx, identity.Issuer, identity.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if link != nil {
+		if err := s.oidcRepo.TouchIdentity(ctx, identity.Issuer, identity.Subject, email); err != nil {
+			return nil, err
+		}
+		return s.userRepo.GetByID(ctx, link.UserID)
+	}
+
+	if identity.Email == "" {
+		return nil, errors.New("identity provider did not return an email address")
+	}
+
+	existing, err := s.userRepo.GetByEmail(ctx, identity.Email)
+	if err == nil {
+		s.logEvent(ctx, &existing.ID, "OIDC_LOGIN_FAILED", map[string]any{"reason": "account_not_linked", "issuer": identity.Issuer, "subject": identity.Subject}, ipAddress)
+		return nil, ErrOIDCAccountNotLinked
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+
+	roleName := s.mapRole(identity.Groups)
+	if roleName == "" {
+		s.logEvent(ctx, nil, "OIDC_LOGIN_FAILED", map[string]any{"reason": "no_role", "subject": identity.Subject, "groups": identity.Groups}, ipAddress)
+		return nil, ErrOIDCNoRole
+	}
+
+	roleID, err := s.findRole(ctx, roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	fullName := identity.Name
+	if fullName == "" {
+		fullName = identity.Email
+	}
+
+	// Користувач створюється без локального пароля: вхід паролем і відновлення пароля для нього недоступні
+	user := &model.User{
+		Email:    identity.Email,
+		FullName: fullName,
+		RoleID:   roleID,
+	}
+	if err := s.oidcRepo.CreateUserWithIdentity(ctx, user, &model.UserIdentity{Issuer: identity.Issuer, Subject: identity.Subject, Email: email}); err != nil {
+		return nil, err
+	}
+	s.logEvent(ctx, &user.ID, "OIDC_USER_PROVISIONED", map[string]any{"issuer": identity.Issuer, "subject": identity.Subject, "email": identity.Email, "role": roleName}, ipAddress)
+
+	return s.userRepo.GetByID(ctx, user.ID)
+}
+
+// mapRole повертає назву ролі для груп користувача або роль за замовчуванням
+func (s *oidcService) mapRole(groups []string) string {
+	for _, mapping := range s.roleMapping {
+		for _, group := range groups {
+			if group == mapping.Group {
+				return mapping.Role
+			}
+		}
+	}
+	return s.defaultRole
+}
+
+// findRole повертає ID ролі за назвою
+func (s *oidcService) findRole(ctx context.Context, name string) (int64, error) {
+	roles, err := s.roleRepo.GetAll(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, role := range roles {
+		if role.Name == name {
+			return role.ID, nil
+		}
+	}
+
+	return 0, fmt.Errorf("mapped role %q does not exist", name)
+}
+
+// logEvent записує подію в журнал аудиту. Помилка запису не перериває вхід
+func (s *oidcService) logEvent(ctx context.Context, userID *int64, action string, details map[string]any, ipAddress string) {
+	if err := s.audit.LogSecurityEvent(ctx, userID, action, details, ipAddress); err != nil {
+		log.Printf("Failed to write audit log: %v", err)
+	}
+}
+
+// pkceChallenge обчислює code_challenge методом S256 (RFC 7636)
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// optionalString повертає nil для порожнього рядка
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
@@ -0,0 +1,315 @@
+package service
+
+import (
+	"busoptima/internal/mockidp"
+	"busoptima/internal/model"
+	"busoptima/internal/repository"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testOIDCClientID     = "busoptima"
+	testOIDCClientSecret = "busoptima-secret"
+	testOIDCRedirectURL  = "http://localhost:8080/login/callback"
+)
+
+// fakeOIDCStore зберігає стани входу, прив'язки та користувачів у пам'яті
+type fakeOIDCStore struct {
+	repository.OIDCRepository
+	repository.UserRepository
+
+	mu         sync.Mutex
+	states     map[string]model.OIDCLoginState
+	identities map[string]model.UserIdentity
+	users      map[int64]*model.User
+	nextUserID int64
+}
+
+func newFakeOIDCStore() *fakeOIDCStore {
+	return &fakeOIDCStore{
+		states:     make(map[string]model.OIDCLoginState),
+		identities: make(map[string]model.UserIdentity),
+		users:      make(map[int64]*model.User),
+	}
+}
+
+func (f *fakeOIDCStore) CreateLoginState(ctx context.Context, state *model.OIDCLoginState) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.states[state.StateHash] = *state
+	return nil
+}
+
+func (f *fakeOIDCStore) ConsumeLoginState(ctx context.Context, stateHash, codeChallenge string) (*model.OIDCLoginState, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	state, ok := f.states[stateHash]
+	if !ok || state.CodeChallenge != codeChallenge || time.Now().After(state.ExpiresAt) {
+		return nil, fmt.Errorf("login state not found")
+	}
+	delete(f.states, stateHash)
+	return &state, nil
+}
+
+func (f *fakeOIDCStore) GetIdentity(ctx context.Context, issuer, subject string) (*model.UserIdentity, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	identity, ok := f.identities[issuer+"|"+subject]
+	if !ok {
+		return nil, nil
+	}
+	return &identity, nil
+}
+
+func (f *fakeOIDCStore) CreateIdentity(ctx context.Context, identity *model.UserIdentity) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := identity.Issuer + "|" + identity.Subject
+	if _, ok := f.identities[key]; ok {
+		return repository.ErrIdentityLinked
+	}
+	f.identities[key] = *identity
+	return nil
+}
+
+func (f *fakeOIDCStore) CreateUserWithIdentity(ctx context.Context, user *model.User, identity *model.UserIdentity) error {
+	f.addUser(user)
+	identity.UserID = user.ID
+	return f.CreateIdentity(ctx, identity)
+}
+
+func (f *fakeOIDCStore) TouchIdentity(ctx context.Context, issuer, subject string, email *string) error {
+	return nil
+}
+
+func (f *fakeOIDCStore) GetByID(ctx context.Context, id int64) (*model.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	user, ok := f.users[id]
+	if !ok {
+		return nil, fmt.Errorf("user with id %d %w", id, repository.ErrNotFound)
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (f *fakeOIDCStore) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, user := range f.users {
+		if user.Email == email {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, fmt.Errorf("user with email %s %w", email, repository.ErrNotFound)
+}
+
+// addUser додає користувача з новим ID
+func (f *fakeOIDCStore) addUser(user *model.User) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextUserID++
+	user.ID = f.nextUserID
+	user.IsActive = true
+	copied := *user
+	f.users[user.ID] = &copied
+}
+
+// fakeOIDCRoles повертає фіксований список ролей
+type fakeOIDCRoles struct {
+	repository.RoleRepository
+}
+
+func (fakeOIDCRoles) GetAll(ctx context.Context) ([]model.Role, error) {
+	return []model.Role{{ID: 1, Name: "admin"}, {ID: 2, Name: "dispatcher"}}, nil
+}
+
+// fakeExternalAuth фіксує користувачів, для яких завершено вхід
+type fakeExternalAuth struct {
+	AuthService
+	loggedIn []int64
+}
+
+func (f *fakeExternalAuth) CompleteExternalLogin(ctx context.Context, user *model.User, ipAddress string) (*LoginResponse, error) {
+	f.loggedIn = append(f.loggedIn, user.ID)
+	return &LoginResponse{AccessToken: "access", User: user}, nil
+}
+
+// fakeSecurityAudit приймає записи аудиту без збереження
+type fakeSecurityAudit struct {
+	AuditService
+}
+
+func (fakeSecurityAudit) LogSecurityEvent(ctx context.Context, userID *int64, action string, details map[string]any, ipAddress string) error {
+	return nil
+}
+
+// oidcTestEnv сервіс OIDC, під'єднаний до мок-провайдера
+type oidcTestEnv struct {
+	service OIDCService
+	store   *fakeOIDCStore
+	auth    *fakeExternalAuth
+}
+
+func newOIDCTestEnv(t *testing.T) *oidcTestEnv {
+	t.Helper()
+
+	idp, err := mockidp.NewServer(testOIDCClientID, testOIDCClientSecret, mockidp.User{
+		Subject: "mock-user-1",
+		Email:   "oidc.user@busoptima.ua",
+		Name:    "OIDC User",
+		Groups:  []string{"busoptima-dispatchers"},
+	})
+	require.NoError(t, err)
+	t.Cleanup(idp.Close)
+
+	provider := NewOIDCProvider(idp.URL, testOIDCClientID, testOIDCClientSecret, testOIDCRedirectURL, []string{"openid", "email", "profile"}, "groups")
+	store := newFakeOIDCStore()
+	auth := &fakeExternalAuth{}
+	mapping := []OIDCRoleMapping{{Group: "busoptima-dispatchers", Role: "dispatcher"}}
+
+	return &oidcTestEnv{
+		service: NewOIDCService(provider, store, store, fakeOIDCRoles{}, auth, fakeSecurityAudit{}, mapping, ""),
+		store:   store,
+		auth:    auth,
+	}
+}
+
+// authorize проходить сторінку входу мок-провайдера і повертає code та state з redirect_uri
+func authorize(t *testing.T, authorization *OIDCAuthorization) (string, string) {
+	t.Helper()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authorization.AuthorizationURL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(location.String(), testOIDCRedirectURL))
+
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestOIDCCallbackProvisionsUserWithoutPassword(t *testing.T) {
+	env := newOIDCTestEnv(t)
+	ctx := context.Background()
+	verifier := "login-verifier-0123456789-0123456789-0123456789"
+
+	authorization, err := env.service.StartLogin(ctx, pkceChallenge(verifier))
+	require.NoError(t, err)
+	code, state := authorize(t, authorization)
+	assert.Equal(t, authorization.State, state)
+
+	response, err := env.service.CompleteLogin(ctx, code, state, verifier, "127.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, "oidc.user@busoptima.ua", response.User.Email)
+	assert.Equal(t, int64(2), response.User.RoleID, "role comes from the group mapping")
+	assert.Empty(t, response.User.PasswordHash, "federated users have no local password")
+	assert.Equal(t, []int64{response.User.ID}, env.auth.loggedIn)
+
+	// Повторне використання коду та state не проходить
+	_, err = env.service.CompleteLogin(ctx, code, state, verifier, "127.0.0.1")
+	assert.ErrorIs(t, err, ErrInvalidOIDCState)
+}
+
+func TestOIDCCallbackKeepsRoleOfExistingLink(t *testing.T) {
+	env := newOIDCTestEnv(t)
+	ctx := context.Background()
+	verifier := "role-verifier-0123456789-0123456789-0123456789"
+
+	authorization, err := env.service.StartLogin(ctx, pkceChallenge(verifier))
+	require.NoError(t, err)
+	code, state := authorize(t, authorization)
+	response, err := env.service.CompleteLogin(ctx, code, state, verifier, "127.0.0.1")
+	require.NoError(t, err)
+
+	// Адміністратор змінив роль - наступний вхід її не перезаписує
+	env.store.mu.Lock()
+	env.store.users[response.User.ID].RoleID = 1
+	env.store.mu.Unlock()
+
+	authorization, err = env.service.StartLogin(ctx, pkceChallenge(verifier))
+	require.NoError(t, err)
+	code, state = authorize(t, authorization)
+	response, err = env.service.CompleteLogin(ctx, code, state, verifier, "127.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), response.User.RoleID)
+}
+
+func TestOIDCCallbackRejectsStateFromAnotherBrowser(t *testing.T) {
+	env := newOIDCTestEnv(t)
+	ctx := context.Background()
+	verifier := "owner-verifier-0123456789-0123456789-0123456789"
+
+	authorization, err := env.service.StartLogin(ctx, pkceChallenge(verifier))
+	require.NoError(t, err)
+	code, state := authorize(t, authorization)
+
+	_, err = env.service.CompleteLogin(ctx, code, state, "other-verifier-0123456789-0123456789-012345", "127.0.0.1")
+	assert.ErrorIs(t, err, ErrInvalidOIDCState)
+	assert.Empty(t, env.auth.loggedIn)
+
+	// Чужа спроба не витрачає state власника
+	_, err = env.service.CompleteLogin(ctx, code, state, verifier, "127.0.0.1")
+	assert.NoError(t, err)
+}
+
+func TestOIDCStartLoginRequiresCodeChallenge(t *testing.T) {
+	env := newOIDCTestEnv(t)
+
+	_, err := env.service.StartLogin(context.Background(), "")
+	assert.ErrorIs(t, err, ErrInvalidCodeChallenge)
+
+	_, err = env.service.StartLogin(context.Background(), "plain-verifier")
+	assert.ErrorIs(t, err, ErrInvalidCodeChallenge)
+}
+
+func TestOIDCCallbackRequiresExplicitLinking(t *testing.T) {
+	env := newOIDCTestEnv(t)
+	ctx := context.Background()
+	verifier := "link-verifier-0123456789-0123456789-0123456789"
+
+	local := &model.User{Email: "oidc.user@busoptima.ua", FullName: "Local User", PasswordHash: "hash", RoleID: 1}
+	env.store.addUser(local)
+
+	authorization, err := env.service.StartLogin(ctx, pkceChallenge(verifier))
+	require.NoError(t, err)
+	code, state := authorize(t, authorization)
+	_, err = env.service.CompleteLogin(ctx, code, state, verifier, "127.0.0.1")
+	assert.ErrorIs(t, err, ErrOIDCAccountNotLinked)
+	assert.Empty(t, env.auth.loggedIn)
+
+	// Стан прив'язки не можна завершити як вхід або від імені іншого користувача
+	authorization, err = env.service.StartLink(ctx, local.ID, pkceChallenge(verifier))
+	require.NoError(t, err)
+	code, state = authorize(t, authorization)
+	assert.ErrorIs(t, env.service.CompleteLink(ctx, local.ID+1, code, state, verifier, "127.0.0.1"), ErrInvalidOIDCState)
+
+	authorization, err = env.service.StartLink(ctx, local.ID, pkceChallenge(verifier))
+	require.NoError(t, err)
+	code, state = authorize(t, authorization)
+	require.NoError(t, env.service.CompleteLink(ctx, local.ID, code, state, verifier, "127.0.0.1"))
+
+	authorization, err = env.service.StartLogin(ctx, pkceChallenge(verifier))
+	require.NoError(t, err)
+	code, state = authorize(t, authorization)
+	response, err := env.service.CompleteLogin(ctx, code, state, verifier, "127.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, local.ID, response.User.ID)
+	assert.Equal(t, int64(1), response.User.RoleID, "linking does not apply the group mapping")
+}
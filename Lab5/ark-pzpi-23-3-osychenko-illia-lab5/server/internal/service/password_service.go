@@ -0,0 +1,234 @@
+package service
+
+import (
+	"busoptima/internal/model"
+	"busoptima/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// minPasswordLength мінімальна довжина нового пароля
+	minPasswordLength = 8
+	// passwordResetTTL час дії токена відновлення пароля
+	passwordResetTTL = time.Hour
+	// passwordResetWindow вікно, в якому обмежується кількість запитів відновлення
+	passwordResetWindow = 15 * time.Minute
+	// passwordResetMaxRequests максимальна кількість запитів відновлення у вікні
+	passwordResetMaxRequests = 3
+)
+
+var (
+	// ErrInvalidCurrentPassword повертається, коли поточний пароль вказано невірно
+	ErrInvalidCurrentPassword = errors.New("current password is incorrect")
+	// ErrNoLocalPassword повертається для користувачів, що входять лише через провайдера OIDC
+	ErrNoLocalPassword = errors.New("this account signs in through the identity provider and has no password")
+)
+
+// PasswordService інтерфейс для зміни та відновлення пароля
+type PasswordService interface {
+	ChangePassword(ctx context.Context, userID int64, currentPassword, newPassword, ipAddress string) error
+	RequestPasswordReset(ctx context.Context, email, ipAddress string) error
+	ResetPassword(ctx context.Context, token, newPassword, ipAddress string) error
+}
+
+// passwordService реалізація PasswordService
+type passwordService struct {
+	userRepo    repository.UserRepository
+	resetRepo   repository.PasswordResetRepository
+	refreshRepo repository.RefreshTokenRepository
+	revocations TokenRevocationService
+	audit       AuditService
+	appBaseURL  string
+}
+
+// NewPasswordService створює новий сервіс паролів
+func NewPasswordService(userRepo repository.UserRepository, resetRepo repository.PasswordResetRepository, refreshRepo repository.RefreshTokenRepository, revocations TokenRevocationService, audit AuditService, appBaseURL string) PasswordService {
+	return &passwordService{
+		userRepo:    userRepo,
+		resetRepo:   resetRepo,
+		refreshRepo: refreshRepo,
+		revocations: revocations,
+		audit:       audit,
+		appBaseURL:  appBaseURL,
+	}
+}
+
+// ChangePassword змінює пароль автентифікованого користувача та завершує всі його сесії
+func (s *passwordService) ChangePassword(ctx context.Context, userID int64, currentPassword, newPassword, ipAddress string) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if user.PasswordHash == "" {
+		return ErrNoLocalPassword
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(currentPassword)); err != nil {
+		return ErrInvalidCurrentPassword
+	}
+
+	if currentPassword == newPassword {
+		return fmt.Errorf("new password must differ from the current one")
+	}
+
+	if err := s.setPassword(ctx, user.ID, newPassword); err != nil {
+		return err
+	}
+
+	s.logEvent(ctx, &user.ID, "PASSWORD_CHANGED", map[string]any{}, ipAddress)
+
+	return revokeUserSessions(ctx, s.revocations, s.refreshRepo, user.ID, "password_changed")
+}
+
+// RequestPasswordReset створює токен відновлення та ставить лист у чергу.
+// Для невідомого email помилка не повертається, щоб не розкривати наявність облікового запису
+func (s *passwordService) RequestPasswordReset(ctx context.Context, email, ipAddress string) error {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		s.logEvent(ctx, nil, "PASSWORD_RESET_REQUESTED", map[string]any{"email": email, "reason": "unknown_email"}, ipAddress)
+		return nil
+	}
+	if !user.IsActive {
+		s.logEvent(ctx, &user.ID, "PASSWORD_RESET_REQUESTED", map[string]any{"email": email, "reason": "account_deactivated"}, ipAddress)
+		return nil
+	}
+	// Інакше відновлення дозволило б задати локальний пароль і входити в обхід провайдера
+	if user.PasswordHash == "" {
+		s.logEvent(ctx, &user.ID, "PASSWORD_RESET_REQUESTED", map[string]any{"email": email, "reason": "no_local_password"}, ipAddress)
+		return nil
+	}
+
+	recent, err := s.resetRepo.CountRecentForUser(ctx, user.ID, time.Now().Add(-passwordResetWindow))
+	if err != nil {
+		return err
+	}
+	if recent >= passwordResetMaxRequests {
+		s.logEvent(ctx, &user.ID, "PASSWORD_RESET_REQUESTED", map[string]any{"email": email, "reason": "rate_limited"}, ipAddress)
+		return nil
+	}
+
+	token, err := generateRandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	reset := &model.PasswordResetToken{
+		UserID:      user.ID,
+		TokenHash:   hashToken(token),
+		ExpiresAt:   time.Now().Add(passwordResetTTL),
+		RequestedIP: &ipAddress,
+	}
+
+	body := fmt.Sprintf(`Вітаємо, %s!
+
+Ми отримали запит на відновлення пароля до вашого облікового запису BusOptima.
+Щоб встановити новий пароль, перейдіть за посиланням:
+
+%s/reset-password?token=%s
+
+Посилання дійсне протягом %d хвилин і може бути використане лише один раз.
+Якщо ви не надсилали запит, просто проігноруйте цей лист.
+`, user.FullName, s.appBaseURL, token, int(passwordResetTTL.Minutes()))
+
+	// Токен і лист з ним зберігаються разом: без листа токен нікому не відомий,
+	// а лист без збереженого токена містив би непрацююче посилання.
+	// Дійсним залишається лише останній виданий токен. Текст листа видаляється з черги після
+	// відправлення, інакше посилання з токеном лишалося б у БД та резервних копіях
+	message := &model.OutboxEmail{Recipient: user.Email, Subject: "Відновлення пароля BusOptima", Body: body, Sensitive: true}
+	if err := s.resetRepo.Create(ctx, reset, message); err != nil {
+		return err
+	}
+
+	s.logEvent(ctx, &user.ID, "PASSWORD_RESET_REQUESTED", map[string]any{"email": email}, ipAddress)
+
+	return nil
+}
+
+// ResetPassword встановлює новий пароль за одноразовим токеном відновлення
+func (s *passwordService) ResetPassword(ctx context.Context, token, newPassword, ipAddress string) error {
+	if err := validatePassword(newPassword); err != nil {
+		return err
+	}
+
+	reset, err := s.resetRepo.GetByHash(ctx, hashToken(token))
+	if err != nil {
+		return fmt.Errorf("invalid or expired reset token")
+	}
+
+	user, err := s.userRepo.GetByID(ctx, reset.UserID)
+	if err != nil {
+		return err
+	}
+	if user.PasswordHash == "" {
+		return ErrNoLocalPassword
+	}
+
+	hash, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	// Токен позначається використаним разом зі зміною пароля, тож він не спрацює вдруге
+	// і не пропаде, якщо пароль зберегти не вдалося. Власник пошти підтвердив доступ,
+	// тому блокування входу теж знімається
+	consumed, err := s.resetRepo.Consume(ctx, reset, hash)
+	if err != nil {
+		return err
+	}
+	if !consumed {
+		return fmt.Errorf("invalid or expired reset token")
+	}
+
+	s.logEvent(ctx, &reset.UserID, "PASSWORD_RESET", map[string]any{}, ipAddress)
+
+	return revokeUserSessions(ctx, s.revocations, s.refreshRepo, reset.UserID, "password_reset")
+}
+
+// setPassword перевіряє та зберігає новий пароль
+func (s *passwordService) setPassword(ctx context.Context, userID int64, password string) error {
+	if err := validatePassword(password); err != nil {
+		return err
+	}
+
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	return s.userRepo.UpdatePassword(ctx, userID, hash)
+}
+
+// hashPassword повертає bcrypt хеш пароля
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// logEvent записує подію в журнал аудиту. Помилка запису не перериває операцію
+func (s *passwordService) logEvent(ctx context.Context, userID *int64, action string, details map[string]any, ipAddress string) {
+	if err := s.audit.LogSecurityEvent(ctx, userID, action, details, ipAddress); err != nil {
+		log.Printf("Failed to write audit log: %v", err)
+	}
+}
+
+// validatePassword перевіряє вимоги до пароля
+func validatePassword(password string) error {
+	if len([]rune(password)) < minPasswordLength {
+		return fmt.Errorf("password must be at least %d characters long", minPasswordLength)
+	}
+	// bcrypt враховує лише перші 72 байти
+	if len(password) > 72 {
+		return fmt.Errorf("password must be at most 72 bytes long")
+	}
+	return nil
+}
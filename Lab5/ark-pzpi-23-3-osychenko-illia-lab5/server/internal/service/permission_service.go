@@ -0,0 +1,193 @@
+package service
+
+import (
+	"busoptima/internal/repository"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// permissionCacheTTL час, після якого кешовані дані перечитуються з БД.
+// Локальні зміни скидають кеш одразу, TTL потрібен для змін, зроблених іншими екземплярами сервера
+const permissionCacheTTL = time.Minute
+
+// ErrUserNotFound повертається, коли користувача з токена більше не існує
+var ErrUserNotFound = errors.New("user not found")
+
+// UserAccess роль, дозволи та доступні маршрути користувача на момент запиту
+type UserAccess struct {
+	RoleID      int64
+	Role        string
+	Active      bool
+	Permissions []string
+	// Routes nil, якщо роль не обмежена призначеними маршрутами
+	Routes *RouteScope
+}
+
+// PermissionService інтерфейс для визначення дозволів користувача під час запиту
+type PermissionService interface {
+	Resolve(ctx context.Context, userID int64) (*UserAccess, error)
+	InvalidateUser(userID int64)
+	InvalidateRole(roleID int64)
+}
+
+// cachedUser кешоване призначення ролі та маршрутів користувачу
+type cachedUser struct {
+	roleID   int64
+	role     string
+	active   bool
+	routes   *RouteScope
+	loadedAt time.Time
+}
+
+// cachedRole кешований набір дозволів ролі
+type cachedRole struct {
+	permissions []string
+	loadedAt    time.Time
+}
+
+// permissionService реалізація PermissionService.
+// Кешує відображення користувач->роль та роль->дозволи, тому зміна ролі чи її дозволів
+// діє з наступного запиту без перевидачі токенів.
+type permissionService struct {
+	userRepo       repository.UserRepository
+	roleRepo       repository.RoleRepository
+	assignmentRepo repository.RouteAssignmentRepository
+
+	mu    sync.RWMutex
+	users map[int64]cachedUser
+	roles map[int64]cachedRole
+	// generation збільшується при кожному скиданні кешу. Дані, завантажені з БД до скидання,
+	// могли застаріти, тому в кеш потрапляють лише завантаження, під час яких скидань не було
+	generation uint64
+}
+
+// NewPermissionService створює новий сервіс дозволів
+func NewPermissionService(userRepo repository.UserRepository, roleRepo repository.RoleRepository, assignmentRepo repository.RouteAssignmentRepository) PermissionService {
+	return &permissionService{
+		userRepo:       userRepo,
+		roleRepo:       roleRepo,
+		assignmentRepo: assignmentRepo,
+		users:          make(map[int64]cachedUser),
+		roles:          make(map[int64]cachedRole),
+	}
+}
+
+// Resolve повертає поточну роль та дозволи користувача
+func (s *permissionService) Resolve(ctx context.Context, userID int64) (*UserAccess, error) {
+	user, err := s.resolveUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	access := &UserAccess{
+		RoleID: user.roleID,
+		Role:   user.role,
+		Active: user.active,
+		Routes: user.routes,
+	}
+
+	// Неактивний користувач не має жодних дозволів
+	if !user.active {
+		return access, nil
+	}
+
+	access.Permissions, err = s.resolveRole(ctx, user.roleID)
+	if err != nil {
+		return nil, err
+	}
+
+	return access, nil
+}
+
+// InvalidateUser скидає кеш ролі та призначених маршрутів користувача
+func (s *permissionService) InvalidateUser(userID int64) {
+	s.mu.Lock()
+	delete(s.users, userID)
+	s.generation++
+	s.mu.Unlock()
+}
+
+// InvalidateRole скидає кеш дозволів ролі та призначень користувачів (назва ролі могла змінитись)
+func (s *permissionService) InvalidateRole(roleID int64) {
+	s.mu.Lock()
+	delete(s.roles, roleID)
+	for userID, user := range s.users {
+		if user.roleID == roleID {
+			delete(s.users, userID)
+		}
+	}
+	s.generation++
+	s.mu.Unlock()
+}
+
+// resolveUser повертає роль та доступні маршрути користувача з кешу або з БД
+func (s *permissionService) resolveUser(ctx context.Context, userID int64) (cachedUser, error) {
+	s.mu.RLock()
+	user, ok := s.users[userID]
+	generation := s.generation
+	s.mu.RUnlock()
+
+	if ok && time.Since(user.loadedAt) < permissionCacheTTL {
+		return user, nil
+	}
+
+	loaded, err := s.userRepo.GetByID(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return cachedUser{}, ErrUserNotFound
+	}
+	if err != nil {
+		return cachedUser{}, err
+	}
+
+	user = cachedUser{
+		roleID:   loaded.RoleID,
+		active:   loaded.IsActive,
+		loadedAt: time.Now(),
+	}
+	if loaded.Role != nil {
+		user.role = loaded.Role.Name
+
+		if loaded.Role.RouteScoped {
+			routeIDs, err := s.assignmentRepo.GetRouteIDs(ctx, userID)
+			if err != nil {
+				return cachedUser{}, err
+			}
+			user.routes = NewRouteScope(routeIDs)
+		}
+	}
+
+	s.mu.Lock()
+	if s.generation == generation {
+		s.users[userID] = user
+	}
+	s.mu.Unlock()
+
+	return user, nil
+}
+
+// resolveRole повертає дозволи ролі з кешу або з БД
+func (s *permissionService) resolveRole(ctx context.Context, roleID int64) ([]string, error) {
+	s.mu.RLock()
+	role, ok := s.roles[roleID]
+	generation := s.generation
+	s.mu.RUnlock()
+
+	if ok && time.Since(role.loadedAt) < permissionCacheTTL {
+		return role.permissions, nil
+	}
+
+	permissions, err := s.roleRepo.GetPermissionNames(ctx, roleID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if s.generation == generation {
+		s.roles[roleID] = cachedRole{permissions: permissions, loadedAt: time.Now()}
+	}
+	s.mu.Unlock()
+
+	return permissions, nil
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"busoptima/internal/model"
+	"busoptima/internal/repository"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAccessStore рахує звернення до БД. duringUserLoad та duringRoleLoad викликаються посеред
+// завантаження, імітуючи зміну ролі чи дозволів іншим запитом, поки дані ще читаються
+type fakeAccessStore struct {
+	user           model.User
+	permissions    []string
+	userLoads      int
+	roleLoads      int
+	duringUserLoad func()
+	duringRoleLoad func()
+}
+
+// fakeAccessUsers та fakeAccessRoles дають доступ до спільного fakeAccessStore через інтерфейси репозиторіїв
+type fakeAccessUsers struct {
+	repository.UserRepository
+	store *fakeAccessStore
+}
+
+type fakeAccessRoles struct {
+	repository.RoleRepository
+	store *fakeAccessStore
+}
+
+func (f fakeAccessUsers) GetByID(ctx context.Context, id int64) (*model.User, error) {
+	return f.store.loadUser(id)
+}
+
+func (f fakeAccessRoles) GetPermissionNames(ctx context.Context, id int64) ([]string, error) {
+	return f.store.loadPermissions()
+}
+
+func (f *fakeAccessStore) loadUser(id int64) (*model.User, error) {
+	if id != f.user.ID {
+		return nil, fmt.Errorf("user with id %d %w", id, repository.ErrNotFound)
+	}
+	f.userLoads++
+	loaded := f.user
+	if hook := f.duringUserLoad; hook != nil {
+		f.duringUserLoad = nil
+		hook()
+	}
+	return &loaded, nil
+}
+
+func (f *fakeAccessStore) loadPermissions() ([]string, error) {
+	f.roleLoads++
+	loaded := f.permissions
+	if hook := f.duringRoleLoad; hook != nil {
+		f.duringRoleLoad = nil
+		hook()
+	}
+	return loaded, nil
+}
+
+func newAccessStore() *fakeAccessStore {
+	return &fakeAccessStore{
+		user:        model.User{ID: 7, RoleID: 2, Role: &model.Role{ID: 2, Name: "dispatcher"}, IsActive: true},
+		permissions: []string{"trips:read"},
+	}
+}
+
+func TestResolveCachesLoadedAccess(t *testing.T) {
+	store := newAccessStore()
+	permissions := NewPermissionService(fakeAccessUsers{store: store}, fakeAccessRoles{store: store}, nil)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		access, err := permissions.Resolve(ctx, 7)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"trips:read"}, access.Permissions)
+	}
+
+	assert.Equal(t, 1, store.userLoads)
+	assert.Equal(t, 1, store.roleLoads)
+}
+
+func TestResolveSkipsCachingLoadsRacedByInvalidation(t *testing.T) {
+	tests := []struct {
+		name string
+		// duringRoleLoad зміна відбувається під час читання дозволів ролі, інакше - під час читання користувача
+		duringRoleLoad bool
+		invalidate     func(PermissionService)
+		// change застосовує зміну, про яку сповіщає invalidate, вже після того, як старі дані прочитано
+		change func(*fakeAccessStore)
+		want   *UserAccess
+	}{
+		{
+			name:       "user invalidated while loading",
+			invalidate: func(p PermissionService) { p.InvalidateUser(7) },
+			change:     func(s *fakeAccessStore) { s.user.IsActive = false },
+			want:       &UserAccess{RoleID: 2, Role: "dispatcher", Active: false},
+		},
+		{
+			name:           "role invalidated while loading",
+			duringRoleLoad: true,
+			invalidate:     func(p PermissionService) { p.InvalidateRole(2) },
+			change:         func(s *fakeAccessStore) { s.permissions = []string{"trips:read", "trips:write"} },
+			want:           &UserAccess{RoleID: 2, Role: "dispatcher", Active: true, Permissions: []string{"trips:read", "trips:write"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newAccessStore()
+			permissions := NewPermissionService(fakeAccessUsers{store: store}, fakeAccessRoles{store: store}, nil)
+			ctx := context.Background()
+
+			hook := func() {
+				tt.change(store)
+				tt.invalidate(permissions)
+			}
+			if tt.duringRoleLoad {
+				store.duringRoleLoad = hook
+			} else {
+				store.duringUserLoad = hook
+			}
+
+			// Перший запит отримує дані, прочитані до зміни, але не кешує їх
+			_, err := permissions.Resolve(ctx, 7)
+			require.NoError(t, err)
+
+			access, err := permissions.Resolve(ctx, 7)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, access)
+		})
+	}
+}
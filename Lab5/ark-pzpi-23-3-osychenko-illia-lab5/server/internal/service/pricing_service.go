@@ -1,7 +1,11 @@
 package service
 
 import (
+	"busoptima/internal/model"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"math"
 	"time"
 )
@@ -10,6 +14,7 @@ import (
 type PricingService interface {
 	CalculatePrice(ctx context.Context, basePrice float64, currentPassengers, capacity int, departureTime time.Time) (*PriceRecommendation, error)
 	CalculatePriceWithCoefficients(basePrice, demandCoeff, timeCoeff, dayCoeff, minCoeff, maxCoeff float64) float64
+	GetParameters(ctx context.Context) (*PricingParameters, error)
 }
 
 // PriceRecommendation структура рекомендації ціни
@@ -26,6 +31,69 @@ type PriceRecommendation struct {
 	Recommendation   string  `json:"recommendation"`
 }
 
+// PricingParameters повний набір параметрів ціноутворення.
+// Сервер рахує ціну саме за ними, а пристрій отримує їх у конфігурації рейсу, тож обидва отримують однакову ціну
+type PricingParameters struct {
+	// Version хеш параметрів, змінюється разом з будь-яким із них
+	Version string `json:"version" example:"3f2a9c0d1b7e4a65"`
+	// Пороги завантаженості (%), що розділяють рівні попиту
+	LowDemandThreshold    float64            `json:"low_demand_threshold" example:"30"`
+	MediumDemandThreshold float64            `json:"medium_demand_threshold" example:"60"`
+	HighDemandThreshold   float64            `json:"high_demand_threshold" example:"85"`
+	DemandCoefficients    DemandCoefficients `json:"demand_coefficients"`
+	PeakHours             []HourRange        `json:"peak_hours"`
+	PeakHoursCoefficient  float64            `json:"peak_hours_coefficient" example:"1.2"`
+	NightHours            HourRange          `json:"night_hours"`
+	NightCoefficient      float64            `json:"night_coefficient" example:"0.8"`
+	WeekendCoefficient    float64            `json:"weekend_coefficient" example:"1.15"`
+	// Seasons сезонні періоди в порядку пріоритету: діє перший, що містить дату відправлення
+	Seasons                    []SeasonalPeriod `json:"seasons"`
+	DefaultSeasonalCoefficient float64          `json:"default_seasonal_coefficient" example:"1"`
+	PriceMinCoefficient        float64          `json:"price_min_coefficient" example:"0.7"`
+	PriceMaxCoefficient        float64          `json:"price_max_coefficient" example:"1.5"`
+	// RoundingStep крок округлення рекомендованої ціни, грн
+	RoundingStep float64 `json:"rounding_step" example:"5"`
+	// PriceTolerancePercent допустима розбіжність ціни пристрою з ціною сервера, % від базової ціни.
+	// Покриває округлення та події, які пристрій ще не синхронізував
+	PriceTolerancePercent float64 `json:"price_tolerance_percent" example:"10"`
+	// OccupancyTolerancePoints допустима розбіжність завантаженості пристрою із сервером, процентних пунктів
+	OccupancyTolerancePoints float64 `json:"occupancy_tolerance_points" example:"10"`
+}
+
+// DemandCoefficients коефіцієнти попиту для рівнів завантаженості:
+// low - нижче low_demand_threshold, medium - нижче medium_demand_threshold, high - нижче high_demand_threshold
+type DemandCoefficients struct {
+	Low      float64 `json:"low" example:"0.75"`
+	Medium   float64 `json:"medium" example:"0.95"`
+	High     float64 `json:"high" example:"1.1"`
+	VeryHigh float64 `json:"very_high" example:"1.4"`
+}
+
+// HourRange проміжок годин доби включно. Якщо Start > End, проміжок переходить через північ
+type HourRange struct {
+	Start int `json:"start" example:"7"`
+	End   int `json:"end" example:"9"`
+}
+
+// SeasonalPeriod сезонний період включно. Якщо початок пізніше кінця, період переходить через Новий рік
+type SeasonalPeriod struct {
+	Name        string  `json:"name" example:"summer"`
+	StartMonth  int     `json:"start_month" example:"6"`
+	StartDay    int     `json:"start_day" example:"1"`
+	EndMonth    int     `json:"end_month" example:"8"`
+	EndDay      int     `json:"end_day" example:"31"`
+	Coefficient float64 `json:"coefficient" example:"1.1"`
+}
+
+// pricingRoundingStep крок округлення рекомендованої ціни, грн
+const pricingRoundingStep = 5.0
+
+// pricingSeasons сезонні періоди, коефіцієнти яких задаються в seasonal_coefficients налаштувань
+var pricingSeasons = []SeasonalPeriod{
+	{Name: "new_year", StartMonth: 12, StartDay: 25, EndMonth: 1, EndDay: 10},
+	{Name: "summer", StartMonth: 6, StartDay: 1, EndMonth: 8, EndDay: 31},
+}
+
 type pricingService struct {
 	settingsService SettingsService
 }
@@ -37,10 +105,66 @@ func NewPricingService(settingsService SettingsService) PricingService {
 	}
 }
 
+// GetParameters повертає параметри ціноутворення за поточними системними налаштуваннями
+func (s *pricingService) GetParameters(ctx context.Context) (*PricingParameters, error) {
+	settings, err := s.settingsService.GetSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPricingParameters(settings), nil
+}
+
+// NewPricingParameters формує параметри ціноутворення з системних налаштувань
+func NewPricingParameters(settings *model.SystemSettings) *PricingParameters {
+	params := &PricingParameters{
+		LowDemandThreshold:    float64(settings.LowDemandThreshold),
+		MediumDemandThreshold: 60,
+		HighDemandThreshold:   float64(settings.HighDemandThreshold),
+		DemandCoefficients: DemandCoefficients{
+			Low:      0.75, // Низька завантаженість - знижка
+			Medium:   0.95, // Помірна завантаженість - невелика знижка
+			High:     1.10, // Висока завантаженість - підвищення
+			VeryHigh: 1.40, // Критична завантаженість - значне підвищення
+		},
+		// Пікові години (ранок та вечір)
+		PeakHours:                  []HourRange{{Start: 7, End: 9}, {Start: 17, End: 19}},
+		PeakHoursCoefficient:       settings.PeakHoursCoefficient,
+		NightHours:                 HourRange{Start: 23, End: 6},
+		NightCoefficient:           0.80,
+		WeekendCoefficient:         settings.WeekendCoefficient,
+		Seasons:                    []SeasonalPeriod{},
+		DefaultSeasonalCoefficient: 1.00,
+		PriceMinCoefficient:        settings.PriceMinCoefficient,
+		PriceMaxCoefficient:        settings.PriceMaxCoefficient,
+		RoundingStep:               pricingRoundingStep,
+		PriceTolerancePercent:      10,
+		OccupancyTolerancePoints:   10,
+	}
+
+	// До параметрів потрапляють лише сезони, для яких задано коефіцієнт
+	for _, season := range pricingSeasons {
+		if coeff, exists := settings.SeasonalCoefficients[season.Name]; exists {
+			season.Coefficient = coeff
+			params.Seasons = append(params.Seasons, season)
+		}
+	}
+	if coeff, exists := settings.SeasonalCoefficients["regular"]; exists {
+		params.DefaultSeasonalCoefficient = coeff
+	}
+
+	// Версія - хеш самих параметрів, тому змінюється і після зміни налаштувань, і після зміни формули
+	data, _ := json.Marshal(params)
+	sum := sha256.Sum256(data)
+	params.Version = hex.EncodeToString(sum[:8])
+
+	return params
+}
+
 // CalculatePrice розраховує рекомендовану ціну на основі завантаженості та часу
 func (s *pricingService) CalculatePrice(ctx context.Context, basePrice float64, currentPassengers, capacity int, departureTime time.Time) (*PriceRecommendation, error) {
-	// Отримуємо поточні системні налаштування
-	settings, err := s.settingsService.GetSettings(ctx)
+	// Отримуємо параметри за поточними системними налаштуваннями
+	params, err := s.GetParameters(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -51,17 +175,17 @@ func (s *pricingService) CalculatePrice(ctx context.Context, basePrice float64,
 		occupancyRate = float64(currentPassengers) / float64(capacity) * 100
 	}
 
-	// Коефіцієнт попиту на основі завантаженості та налаштувань
-	demandCoeff := s.calculateDemandCoefficient(occupancyRate, settings.LowDemandThreshold, settings.HighDemandThreshold)
+	// Коефіцієнт попиту на основі завантаженості
+	demandCoeff := params.demandCoefficient(occupancyRate)
 
-	// Коефіцієнт часу (пікові години)
-	timeCoeff := s.calculateTimeCoefficient(departureTime, settings.PeakHoursCoefficient)
+	// Коефіцієнт часу (пікові та нічні години)
+	timeCoeff := params.timeCoefficient(departureTime)
 
-	// Коефіцієнт дня (вихідні/будні)
-	dayCoeff := s.calculateDayCoefficient(departureTime, settings.WeekendCoefficient, settings.SeasonalCoefficients)
+	// Коефіцієнт дня (вихідні/будні та сезон)
+	dayCoeff := params.dayCoefficient(departureTime)
 
 	// Розрахунок рекомендованої ціни
-	recommendedPrice := s.CalculatePriceWithCoefficients(basePrice, demandCoeff, timeCoeff, dayCoeff, settings.PriceMinCoefficient, settings.PriceMaxCoefficient)
+	recommendedPrice := params.price(basePrice, demandCoeff, timeCoeff, dayCoeff)
 
 	// Розрахунок зміни ціни
 	priceChange := recommendedPrice - basePrice
@@ -89,93 +213,101 @@ func (s *pricingService) CalculatePrice(ctx context.Context, basePrice float64,
 
 // CalculatePriceWithCoefficients розраховує ціну з заданими коефіцієнтами
 func (s *pricingService) CalculatePriceWithCoefficients(basePrice, demandCoeff, timeCoeff, dayCoeff, minCoeff, maxCoeff float64) float64 {
-	// Розрахунок за формулою: P_рек = P_баз × K_попит × K_час × K_день
+	params := &PricingParameters{PriceMinCoefficient: minCoeff, PriceMaxCoefficient: maxCoeff, RoundingStep: pricingRoundingStep}
+	return params.price(basePrice, demandCoeff, timeCoeff, dayCoeff)
+}
+
+// price розраховує ціну за формулою P_рек = P_баз × K_попит × K_час × K_день
+// з обмеженням діапазону та округленням
+func (p *PricingParameters) price(basePrice, demandCoeff, timeCoeff, dayCoeff float64) float64 {
 	recommendedPrice := basePrice * demandCoeff * timeCoeff * dayCoeff
 
 	// Обмеження діапазону на основі системних налаштувань
-	minPrice := basePrice * minCoeff
-	maxPrice := basePrice * maxCoeff
+	minPrice := basePrice * p.PriceMinCoefficient
+	maxPrice := basePrice * p.PriceMaxCoefficient
 	recommendedPrice = math.Max(minPrice, math.Min(maxPrice, recommendedPrice))
 
-	// Округлення до найближчих 5 грн
-	recommendedPrice = math.Round(recommendedPrice/5) * 5
+	// Округлення до найближчого кроку
+	if p.RoundingStep > 0 {
+		recommendedPrice = math.Round(recommendedPrice/p.RoundingStep) * p.RoundingStep
+	}
 
 	return recommendedPrice
 }
 
-// calculateDemandCoefficient розраховує коефіцієнт попиту на основі завантаженості та налаштувань
-func (s *pricingService) calculateDemandCoefficient(occupancyRate float64, lowThreshold, highThreshold int) float64 {
+// demandCoefficient розраховує коефіцієнт попиту на основі завантаженості
+func (p *PricingParameters) demandCoefficient(occupancyRate float64) float64 {
 	switch {
-	case occupancyRate < float64(lowThreshold):
-		return 0.75 // Низька завантаженість - знижка
-	case occupancyRate < 60:
-		return 0.95 // Помірна завантаженість - невелика знижка
-	case occupancyRate < float64(highThreshold):
-		return 1.10 // Висока завантаженість - підвищення
+	case occupancyRate < p.LowDemandThreshold:
+		return p.DemandCoefficients.Low
+	case occupancyRate < p.MediumDemandThreshold:
+		return p.DemandCoefficients.Medium
+	case occupancyRate < p.HighDemandThreshold:
+		return p.DemandCoefficients.High
 	default:
-		return 1.40 // Критична завантаженість - значне підвищення
+		return p.DemandCoefficients.VeryHigh
 	}
 }
 
-// calculateTimeCoefficient розраховує коефіцієнт часу на основі години доби та налаштувань
-func (s *pricingService) calculateTimeCoefficient(departureTime time.Time, peakCoeff float64) float64 {
+// timeCoefficient розраховує коефіцієнт часу на основі години доби
+func (p *PricingParameters) timeCoefficient(departureTime time.Time) float64 {
 	hour := departureTime.Hour()
 
-	// Пікові години (ранок та вечір)
-	if (hour >= 7 && hour <= 9) || (hour >= 17 && hour <= 19) {
-		return peakCoeff
+	for _, peak := range p.PeakHours {
+		if peak.contains(hour) {
+			return p.PeakHoursCoefficient
+		}
 	}
 
-	// Нічні години
-	if hour >= 23 || hour <= 6 {
-		return 0.80
+	if p.NightHours.contains(hour) {
+		return p.NightCoefficient
 	}
 
 	// Звичайний час
 	return 1.00
 }
 
-// calculateDayCoefficient розраховує коефіцієнт дня на основі дня тижня та сезонних налаштувань
-func (s *pricingService) calculateDayCoefficient(departureTime time.Time, weekendCoeff float64, seasonalCoeffs map[string]float64) float64 {
+// dayCoefficient розраховує коефіцієнт дня на основі дня тижня та сезону
+func (p *PricingParameters) dayCoefficient(departureTime time.Time) float64 {
 	weekday := departureTime.Weekday()
 	baseCoeff := 1.00
 
 	// Вихідні дні (субота, неділя)
 	if weekday == time.Saturday || weekday == time.Sunday {
-		baseCoeff = weekendCoeff
+		baseCoeff = p.WeekendCoefficient
 	}
 
-	// Сезонні коефіцієнти
-	seasonCoeff := s.getSeasonalCoefficient(departureTime, seasonalCoeffs)
-
-	return baseCoeff * seasonCoeff
+	return baseCoeff * p.seasonalCoefficient(departureTime)
 }
 
-// getSeasonalCoefficient повертає сезонний коефіцієнт
-func (s *pricingService) getSeasonalCoefficient(date time.Time, seasonalCoeffs map[string]float64) float64 {
-	month := date.Month()
-	day := date.Day()
-
-	// Новорічні свята
-	if (month == time.December && day >= 25) || (month == time.January && day <= 10) {
-		if coeff, exists := seasonalCoeffs["new_year"]; exists {
-			return coeff
+// seasonalCoefficient повертає коефіцієнт першого сезону, що містить дату
+func (p *PricingParameters) seasonalCoefficient(date time.Time) float64 {
+	for _, season := range p.Seasons {
+		if season.contains(date) {
+			return season.Coefficient
 		}
 	}
+	return p.DefaultSeasonalCoefficient
+}
 
-	// Літній період
-	if month >= time.June && month <= time.August {
-		if coeff, exists := seasonalCoeffs["summer"]; exists {
-			return coeff
-		}
+// contains перевіряє, чи входить година в проміжок
+func (r HourRange) contains(hour int) bool {
+	if r.Start <= r.End {
+		return hour >= r.Start && hour <= r.End
 	}
+	return hour >= r.Start || hour <= r.End
+}
 
-	// Звичайний період
-	if coeff, exists := seasonalCoeffs["regular"]; exists {
-		return coeff
-	}
+// contains перевіряє, чи входить дата в сезонний період
+func (s SeasonalPeriod) contains(date time.Time) bool {
+	day := int(date.Month())*100 + date.Day()
+	start := s.StartMonth*100 + s.StartDay
+	end := s.EndMonth*100 + s.EndDay
 
-	return 1.00
+	if start <= end {
+		return day >= start && day <= end
+	}
+	return day >= start || day <= end
 }
 
 // GetPriceCategory повертає категорію ціни для відображення
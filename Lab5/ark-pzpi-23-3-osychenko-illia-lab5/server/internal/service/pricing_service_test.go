@@ -0,0 +1,53 @@
+package service
+
+import (
+	"busoptima/internal/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPricingParametersVersion(t *testing.T) {
+	settings := func() *model.SystemSettings {
+		return &model.SystemSettings{
+			PeakHoursCoefficient: 1.2,
+			WeekendCoefficient:   1.15,
+			HighDemandThreshold:  85,
+			LowDemandThreshold:   30,
+			PriceMinCoefficient:  0.7,
+			PriceMaxCoefficient:  1.5,
+			SeasonalCoefficients: map[string]float64{"summer": 1.1},
+		}
+	}
+	base := NewPricingParameters(settings()).Version
+
+	tests := []struct {
+		name   string
+		change func(s *model.SystemSettings)
+		same   bool
+	}{
+		// Налаштування, що не входять до параметрів ціноутворення, версію не змінюють
+		{name: "unrelated settings", change: func(s *model.SystemSettings) { s.FuelPricePerLiter = 55; s.UpdatedAt = time.Now() }, same: true},
+		{name: "peak hours coefficient", change: func(s *model.SystemSettings) { s.PeakHoursCoefficient = 1.25 }},
+		{name: "demand threshold", change: func(s *model.SystemSettings) { s.HighDemandThreshold = 90 }},
+		{name: "price bounds", change: func(s *model.SystemSettings) { s.PriceMaxCoefficient = 1.6 }},
+		{name: "seasonal coefficient", change: func(s *model.SystemSettings) { s.SeasonalCoefficients["summer"] = 1.2 }},
+		{name: "new season", change: func(s *model.SystemSettings) { s.SeasonalCoefficients["new_year"] = 1.3 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed := settings()
+			tt.change(changed)
+
+			version := NewPricingParameters(changed).Version
+			assert.Len(t, version, 16)
+			if tt.same {
+				assert.Equal(t, base, version)
+			} else {
+				assert.NotEqual(t, base, version)
+			}
+		})
+	}
+}
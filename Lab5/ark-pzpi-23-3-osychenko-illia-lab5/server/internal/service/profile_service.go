@@ -0,0 +1,112 @@
+package service
+
+import (
+	"busoptima/internal/model"
+	"busoptima/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"strings"
+
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ProfileUpdate зміни власного профілю. nil поля не змінюються
+type ProfileUpdate struct {
+	FullName *string
+	Email    *string
+	// CurrentPassword потрібен лише для зміни email
+	CurrentPassword string
+}
+
+// ProfileService інтерфейс для перегляду та зміни власного облікового запису
+type ProfileService interface {
+	GetProfile(ctx context.Context, userID int64) (*model.User, error)
+	UpdateProfile(ctx context.Context, userID int64, update ProfileUpdate, ipAddress string) (*model.User, error)
+	GetSessions(ctx context.Context, userID int64) ([]model.Session, error)
+}
+
+// profileService реалізація ProfileService
+type profileService struct {
+	userRepo    repository.UserRepository
+	refreshRepo repository.RefreshTokenRepository
+	audit       AuditService
+}
+
+// NewProfileService створює новий сервіс профілю
+func NewProfileService(userRepo repository.UserRepository, refreshRepo repository.RefreshTokenRepository, audit AuditService) ProfileService {
+	return &profileService{
+		userRepo:    userRepo,
+		refreshRepo: refreshRepo,
+		audit:       audit,
+	}
+}
+
+// GetProfile повертає профіль користувача
+func (s *profileService) GetProfile(ctx context.Context, userID int64) (*model.User, error) {
+	return s.userRepo.GetByID(ctx, userID)
+}
+
+// UpdateProfile змінює ім'я та email користувача.
+// Роль і стан облікового запису змінюються лише через адміністративні ендпоінти
+func (s *profileService) UpdateProfile(ctx context.Context, userID int64, update ProfileUpdate, ipAddress string) (*model.User, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]any{}
+
+	if update.FullName != nil {
+		fullName := strings.TrimSpace(*update.FullName)
+		if fullName == "" {
+			return nil, fmt.Errorf("full name must not be empty")
+		}
+		if fullName != user.FullName {
+			changes["full_name"] = fullName
+			user.FullName = fullName
+		}
+	}
+
+	if update.Email != nil {
+		email := strings.TrimSpace(*update.Email)
+		if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+			return nil, fmt.Errorf("invalid email address")
+		}
+		if !strings.EqualFold(email, user.Email) {
+			// Email використовується для входу та відновлення пароля, тому його зміна потребує пароля
+			if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(update.CurrentPassword)); err != nil {
+				return nil, ErrInvalidCurrentPassword
+			}
+			changes["old_email"] = user.Email
+			changes["email"] = email
+			user.Email = email
+		}
+	}
+
+	if len(changes) == 0 {
+		return user, nil
+	}
+
+	if err := s.userRepo.UpdateProfile(ctx, user); err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return nil, fmt.Errorf("email is already in use")
+		}
+		return nil, err
+	}
+
+	if err := s.audit.LogSecurityEvent(ctx, &user.ID, "PROFILE_UPDATED", changes, ipAddress); err != nil {
+		log.Printf("Failed to write audit log: %v", err)
+	}
+
+	return user, nil
+}
+
+// GetSessions повертає активні сесії користувача
+func (s *profileService) GetSessions(ctx context.Context, userID int64) ([]model.Session, error) {
+	return s.refreshRepo.GetActiveSessions(ctx, userID)
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"busoptima/internal/model"
+	"busoptima/internal/repository"
+	"context"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fakeProfileUsers віддає знімок користувача, прочитаний до змін адміністратора (read),
+// а UpdateProfile працює з поточним рядком (row), як UPDATE ... RETURNING
+type fakeProfileUsers struct {
+	repository.UserRepository
+
+	read      model.User
+	row       model.User
+	updates   int
+	updateErr error
+}
+
+func (f *fakeProfileUsers) GetByID(ctx context.Context, id int64) (*model.User, error) {
+	copied := f.read
+	return &copied, nil
+}
+
+func (f *fakeProfileUsers) UpdateProfile(ctx context.Context, user *model.User) error {
+	if f.updateErr != nil {
+		return f.updateErr
+	}
+	f.updates++
+	f.row.Email, f.row.FullName = user.Email, user.FullName
+	user.RoleID, user.IsActive = f.row.RoleID, f.row.IsActive
+	return nil
+}
+
+// fakeProfileAudit фіксує записи аудиту безпеки
+type fakeProfileAudit struct {
+	AuditService
+	actions []string
+	details []map[string]any
+}
+
+func (f *fakeProfileAudit) LogSecurityEvent(ctx context.Context, userID *int64, action string, details map[string]any, ipAddress string) error {
+	f.actions = append(f.actions, action)
+	f.details = append(f.details, details)
+	return nil
+}
+
+func TestUpdateProfile(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("current-password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	strPtr := func(s string) *string { return &s }
+
+	tests := []struct {
+		name        string
+		update      ProfileUpdate
+		updateErr   error
+		wantName    string
+		wantEmail   string
+		wantChanges map[string]any
+		wantErr     string
+		wantErrIs   error
+	}{
+		{
+			name:        "full name is trimmed",
+			update:      ProfileUpdate{FullName: strPtr("  Олена Коваль ")},
+			wantName:    "Олена Коваль",
+			wantEmail:   "dispatcher@busoptima.ua",
+			wantChanges: map[string]any{"full_name": "Олена Коваль"},
+		},
+		{
+			name:        "email with current password",
+			update:      ProfileUpdate{Email: strPtr("olena@busoptima.ua"), CurrentPassword: "current-password"},
+			wantName:    "Олена",
+			wantEmail:   "olena@busoptima.ua",
+			wantChanges: map[string]any{"old_email": "dispatcher@busoptima.ua", "email": "olena@busoptima.ua"},
+		},
+		// Зміна лише регістру не вважається зміною email і не потребує пароля
+		{name: "email differing only in case", update: ProfileUpdate{Email: strPtr("Dispatcher@busoptima.ua")}, wantName: "Олена", wantEmail: "dispatcher@busoptima.ua"},
+		{name: "nothing sent", wantName: "Олена", wantEmail: "dispatcher@busoptima.ua"},
+		{name: "email without current password", update: ProfileUpdate{Email: strPtr("olena@busoptima.ua")}, wantErrIs: ErrInvalidCurrentPassword},
+		{name: "email with wrong password", update: ProfileUpdate{Email: strPtr("olena@busoptima.ua"), CurrentPassword: "guess"}, wantErrIs: ErrInvalidCurrentPassword},
+		{name: "blank full name", update: ProfileUpdate{FullName: strPtr("  ")}, wantErr: "full name must not be empty"},
+		{name: "invalid email", update: ProfileUpdate{Email: strPtr("Olena <olena@busoptima.ua>"), CurrentPassword: "current-password"}, wantErr: "invalid email address"},
+		{
+			name:      "email taken by another user",
+			update:    ProfileUpdate{Email: strPtr("admin@busoptima.ua"), CurrentPassword: "current-password"},
+			updateErr: &pq.Error{Code: "23505"},
+			wantErr:   "email is already in use",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			read := model.User{ID: 7, Email: "dispatcher@busoptima.ua", FullName: "Олена", PasswordHash: string(hash), RoleID: 2, IsActive: true}
+			// Поки користувач редагував профіль, адміністратор змінив йому роль і деактивував обліковий запис
+			row := read
+			row.RoleID, row.IsActive = 3, false
+
+			users := &fakeProfileUsers{read: read, row: row, updateErr: tt.updateErr}
+			audit := &fakeProfileAudit{}
+
+			user, err := NewProfileService(users, nil, audit).UpdateProfile(context.Background(), 7, tt.update, "10.0.0.1")
+			switch {
+			case tt.wantErrIs != nil:
+				assert.ErrorIs(t, err, tt.wantErrIs)
+			case tt.wantErr != "":
+				assert.EqualError(t, err, tt.wantErr)
+			}
+			if tt.wantErrIs != nil || tt.wantErr != "" {
+				assert.Zero(t, users.updates)
+				assert.Empty(t, audit.actions)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantName, user.FullName)
+			assert.Equal(t, tt.wantEmail, user.Email)
+			if tt.wantChanges == nil {
+				assert.Zero(t, users.updates)
+				assert.Empty(t, audit.actions)
+				return
+			}
+
+			assert.Equal(t, 1, users.updates)
+			assert.Equal(t, []string{"PROFILE_UPDATED"}, audit.actions)
+			assert.Equal(t, []map[string]any{tt.wantChanges}, audit.details)
+			// Роль і стан облікового запису не перезаписуються значеннями, прочитаними до оновлення
+			assert.Equal(t, int64(3), users.row.RoleID)
+			assert.False(t, users.row.IsActive)
+			assert.Equal(t, int64(3), user.RoleID)
+			assert.False(t, user.IsActive)
+		})
+	}
+}
@@ -0,0 +1,312 @@
+package service
+
+import (
+	"busoptima/internal/model"
+	"busoptima/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// builtInAdminRole назва вбудованої ролі адміністратора
+const builtInAdminRole = "admin"
+
+var (
+	// ErrBuiltInRole повертається при спробі змінити або видалити вбудовану роль адміністратора
+	ErrBuiltInRole = errors.New("the built-in admin role cannot be modified or deleted")
+	// ErrRoleExceedsGrantor повертається, коли роль дала б більше прав, ніж має той, хто її налаштовує чи призначає
+	ErrRoleExceedsGrantor = errors.New("role exceeds your own access")
+	// ErrRoleNotFound повертається, коли ролі з указаним ID не існує
+	ErrRoleNotFound = errors.New("role not found")
+	// ErrRoleConflict повертається, коли назва ролі зайнята або роль призначена користувачам
+	ErrRoleConflict = errors.New("role conflict")
+	// ErrInvalidRole повертається для некоректних даних ролі
+	ErrInvalidRole = errors.New("invalid role")
+)
+
+// RoleUpdate зміни ролі. MFARequired та RouteScoped змінюються, лише якщо передані
+type RoleUpdate struct {
+	Name        string
+	Description string
+	MFARequired *bool
+	RouteScoped *bool
+}
+
+// RoleService інтерфейс для керування ролями та їх дозволами
+type RoleService interface {
+	GetAll(ctx context.Context) ([]model.Role, error)
+	GetByID(ctx context.Context, id int64) (*model.Role, error)
+	Create(ctx context.Context, role *model.Role, permissions, grantorPermissions []string, grantorScope *RouteScope) (*model.Role, error)
+	Update(ctx context.Context, id int64, update RoleUpdate, grantorScope *RouteScope) (*model.Role, error)
+	Delete(ctx context.Context, id int64) error
+	SetMFARequired(ctx context.Context, roleID int64, required bool) (*model.Role, error)
+	SetPermissions(ctx context.Context, roleID int64, permissions, grantorPermissions []string) (*model.Role, error)
+	GetPermissions(ctx context.Context) ([]model.Permission, error)
+	SyncPermissions(ctx context.Context, names []string) error
+}
+
+// roleService реалізація RoleService
+type roleService struct {
+	roleRepo    repository.RoleRepository
+	permissions PermissionService
+
+	mu        sync.RWMutex
+	catalogue map[string]bool
+}
+
+// NewRoleService створює новий сервіс ролей
+func NewRoleService(roleRepo repository.RoleRepository, permissions PermissionService) RoleService {
+	return &roleService{
+		roleRepo:    roleRepo,
+		permissions: permissions,
+		catalogue:   make(map[string]bool),
+	}
+}
+
+// GetAll повертає всі ролі
+func (s *roleService) GetAll(ctx context.Context) ([]model.Role, error) {
+	return s.roleRepo.GetAll(ctx)
+}
+
+// GetByID повертає роль за ID
+func (s *roleService) GetByID(ctx context.Context, id int64) (*model.Role, error) {
+	role, err := s.roleRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, roleError(err)
+	}
+	return role, nil
+}
+
+// Create створює роль з дозволами з каталогу. Роль не може мати дозволів, яких немає в її творця,
+// а користувач, обмежений маршрутами, може створити лише роль з таким самим обмеженням
+func (s *roleService) Create(ctx context.Context, role *model.Role, permissions, grantorPermissions []string, grantorScope *RouteScope) (*model.Role, error) {
+	if err := validateRole(role); err != nil {
+		return nil, err
+	}
+	if err := checkRouteScopeGrant(role, grantorScope); err != nil {
+		return nil, err
+	}
+
+	permissions, err := s.validatePermissions(permissions, grantorPermissions)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.roleRepo.Create(ctx, role, permissions); err != nil {
+		return nil, roleError(err)
+	}
+
+	return s.GetByID(ctx, role.ID)
+}
+
+// Update оновлює назву та опис ролі, а також обов'язковість 2FA та обмеження маршрутами, якщо їх передано.
+// Користувач, обмежений маршрутами, не може зняти це обмеження з ролі
+func (s *roleService) Update(ctx context.Context, id int64, update RoleUpdate, grantorScope *RouteScope) (*model.Role, error) {
+	role, err := s.checkNotBuiltIn(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	role.Name = update.Name
+	role.Description = update.Description
+	if update.MFARequired != nil {
+		role.MFARequired = *update.MFARequired
+	}
+	if update.RouteScoped != nil {
+		role.RouteScoped = *update.RouteScoped
+	}
+
+	if err := validateRole(role); err != nil {
+		return nil, err
+	}
+	if err := checkRouteScopeGrant(role, grantorScope); err != nil {
+		return nil, err
+	}
+
+	if err := s.roleRepo.Update(ctx, role); err != nil {
+		return nil, roleError(err)
+	}
+
+	s.permissions.InvalidateRole(role.ID)
+
+	return s.GetByID(ctx, role.ID)
+}
+
+// Delete видаляє роль, якщо вона не призначена жодному користувачу
+func (s *roleService) Delete(ctx context.Context, id int64) error {
+	if _, err := s.checkNotBuiltIn(ctx, id); err != nil {
+		return err
+	}
+
+	count, err := s.roleRepo.CountUsers(ctx, id)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: role is assigned to %d users, reassign them first", ErrRoleConflict, count)
+	}
+
+	if err := s.roleRepo.Delete(ctx, id); err != nil {
+		return roleError(err)
+	}
+
+	s.permissions.InvalidateRole(id)
+	return nil
+}
+
+// SetMFARequired вмикає або вимикає обов'язкову 2FA для ролі.
+// Користувачі без 2FA налаштують її під час наступного входу
+func (s *roleService) SetMFARequired(ctx context.Context, roleID int64, required bool) (*model.Role, error) {
+	if _, err := s.checkNotBuiltIn(ctx, roleID); err != nil {
+		return nil, err
+	}
+
+	if err := s.roleRepo.SetMFARequired(ctx, roleID, required); err != nil {
+		return nil, roleError(err)
+	}
+
+	s.permissions.InvalidateRole(roleID)
+
+	return s.GetByID(ctx, roleID)
+}
+
+// SetPermissions замінює дозволи ролі. Нові дозволи діють з наступного запиту користувачів ролі.
+// Призначити можна лише дозволи, які має сам адміністратор
+func (s *roleService) SetPermissions(ctx context.Context, roleID int64, permissions, grantorPermissions []string) (*model.Role, error) {
+	if _, err := s.checkNotBuiltIn(ctx, roleID); err != nil {
+		return nil, err
+	}
+
+	permissions, err := s.validatePermissions(permissions, grantorPermissions)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.roleRepo.SetPermissions(ctx, roleID, permissions); err != nil {
+		return nil, roleError(err)
+	}
+
+	s.permissions.InvalidateRole(roleID)
+
+	return s.GetByID(ctx, roleID)
+}
+
+// GetPermissions повертає каталог дозволів, що перевіряються в API
+func (s *roleService) GetPermissions(ctx context.Context) ([]model.Permission, error) {
+	all, err := s.roleRepo.GetPermissions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	permissions := make([]model.Permission, 0, len(s.catalogue))
+	for _, p := range all {
+		if s.catalogue[p.Name] {
+			permissions = append(permissions, p)
+		}
+	}
+
+	return permissions, nil
+}
+
+// SyncPermissions встановлює каталог дозволів та додає до бази даних відсутні
+func (s *roleService) SyncPermissions(ctx context.Context, names []string) error {
+	added, err := s.roleRepo.EnsurePermissions(ctx, names)
+	if err != nil {
+		return err
+	}
+	if added > 0 {
+		log.Printf("Added %d new permissions to the catalogue", added)
+	}
+
+	catalogue := make(map[string]bool, len(names))
+	for _, name := range names {
+		catalogue[name] = true
+	}
+
+	s.mu.Lock()
+	s.catalogue = catalogue
+	s.mu.Unlock()
+
+	return nil
+}
+
+// checkNotBuiltIn повертає роль, якщо це не вбудована роль адміністратора. Її змінювати заборонено,
+// інакше можна було б позбавити всіх адміністраторів доступу
+func (s *roleService) checkNotBuiltIn(ctx context.Context, roleID int64) (*model.Role, error) {
+	role, err := s.GetByID(ctx, roleID)
+	if err != nil {
+		return nil, err
+	}
+	if role.Name == builtInAdminRole {
+		return nil, ErrBuiltInRole
+	}
+	return role, nil
+}
+
+// validatePermissions перевіряє, що всі дозволи є в каталозі та надані адміністратору, і прибирає дублікати
+func (s *roleService) validatePermissions(permissions, grantorPermissions []string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	granted := make(map[string]bool, len(grantorPermissions))
+	for _, p := range grantorPermissions {
+		granted[p] = true
+	}
+
+	seen := make(map[string]bool, len(permissions))
+	result := make([]string, 0, len(permissions))
+	for _, p := range permissions {
+		if seen[p] {
+			continue
+		}
+		if !s.catalogue[p] {
+			return nil, fmt.Errorf("%w: unknown permission %q", ErrInvalidRole, p)
+		}
+		// Роль не може мати більше прав, ніж адміністратор, який її налаштовує
+		if !granted[p] {
+			return nil, fmt.Errorf("%w: permission %q is not granted to you", ErrRoleExceedsGrantor, p)
+		}
+		seen[p] = true
+		result = append(result, p)
+	}
+
+	return result, nil
+}
+
+// checkRouteScopeGrant забороняє користувачу, обмеженому маршрутами, налаштовувати роль без цього обмеження
+func checkRouteScopeGrant(role *model.Role, grantorScope *RouteScope) error {
+	if grantorScope != nil && !role.RouteScoped {
+		return fmt.Errorf("%w: you can only manage roles limited to assigned routes", ErrRoleExceedsGrantor)
+	}
+	return nil
+}
+
+// validateRole перевіряє назву ролі
+func validateRole(role *model.Role) error {
+	role.Name = strings.TrimSpace(role.Name)
+	if role.Name == "" {
+		return fmt.Errorf("%w: role name is required", ErrInvalidRole)
+	}
+	if len(role.Name) > 50 {
+		return fmt.Errorf("%w: role name must be at most 50 characters long", ErrInvalidRole)
+	}
+	return nil
+}
+
+// roleError перетворює помилки репозиторію на помилки сервісу ролей.
+// Інші помилки (зокрема помилки БД) повертаються без змін
+func roleError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return ErrRoleNotFound
+	case errors.Is(err, repository.ErrRoleNameExists), errors.Is(err, repository.ErrRoleInUse):
+		return fmt.Errorf("%w: %v", ErrRoleConflict, err)
+	}
+	return err
+}
@@ -0,0 +1,286 @@
+package service
+
+import (
+	"busoptima/internal/model"
+	"busoptima/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRoleStore зберігає ролі в пам'яті та фіксує, які ролі змінювались
+type fakeRoleStore struct {
+	repository.RoleRepository
+
+	roles   map[int64]*model.Role
+	users   map[int64]int
+	changed []int64
+	err     error
+}
+
+func newFakeRoleStore() *fakeRoleStore {
+	return &fakeRoleStore{
+		roles: map[int64]*model.Role{
+			1: {ID: 1, Name: "admin", Permissions: []model.Permission{{Name: "roles:write"}, {Name: "users:write"}}},
+			2: {ID: 2, Name: "dispatcher", RouteScoped: true, MFARequired: true, Permissions: []model.Permission{{Name: "trips:read"}}},
+			3: {ID: 3, Name: "analyst", Permissions: []model.Permission{{Name: "analytics:read"}}},
+		},
+		users: map[int64]int{},
+	}
+}
+
+func (f *fakeRoleStore) GetByID(ctx context.Context, id int64) (*model.Role, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	role, ok := f.roles[id]
+	if !ok {
+		return nil, fmt.Errorf("role with id %d %w", id, repository.ErrNotFound)
+	}
+	copied := *role
+	return &copied, nil
+}
+
+func (f *fakeRoleStore) Create(ctx context.Context, role *model.Role, permissions []string) error {
+	role.ID = int64(len(f.roles) + 1)
+	stored := *role
+	f.roles[role.ID] = &stored
+	return nil
+}
+
+func (f *fakeRoleStore) Update(ctx context.Context, role *model.Role) error {
+	stored := *role
+	f.roles[role.ID] = &stored
+	f.changed = append(f.changed, role.ID)
+	return nil
+}
+
+func (f *fakeRoleStore) Delete(ctx context.Context, id int64) error {
+	delete(f.roles, id)
+	f.changed = append(f.changed, id)
+	return nil
+}
+
+func (f *fakeRoleStore) SetMFARequired(ctx context.Context, id int64, required bool) error {
+	f.roles[id].MFARequired = required
+	f.changed = append(f.changed, id)
+	return nil
+}
+
+func (f *fakeRoleStore) SetPermissions(ctx context.Context, id int64, permissions []string) error {
+	f.roles[id].Permissions = nil
+	for _, p := range permissions {
+		f.roles[id].Permissions = append(f.roles[id].Permissions, model.Permission{Name: p})
+	}
+	f.changed = append(f.changed, id)
+	return nil
+}
+
+func (f *fakeRoleStore) CountUsers(ctx context.Context, id int64) (int, error) {
+	return f.users[id], nil
+}
+
+// fakeRoleInvalidations фіксує скидання кешу дозволів ролей
+type fakeRoleInvalidations struct {
+	PermissionService
+	roles []int64
+}
+
+func (f *fakeRoleInvalidations) InvalidateRole(roleID int64) {
+	f.roles = append(f.roles, roleID)
+}
+
+func newRoleTestService(store *fakeRoleStore, invalidations *fakeRoleInvalidations) *roleService {
+	s := NewRoleService(store, invalidations).(*roleService)
+	s.catalogue = map[string]bool{"trips:read": true, "trips:write": true, "analytics:read": true}
+	return s
+}
+
+func TestValidatePermissionsCapsAtGrantor(t *testing.T) {
+	grantor := []string{"trips:read", "analytics:read"}
+
+	tests := []struct {
+		name        string
+		permissions []string
+		want        []string
+		wantErr     error
+	}{
+		{name: "subset of grantor", permissions: []string{"trips:read"}, want: []string{"trips:read"}},
+		{name: "duplicates dropped", permissions: []string{"trips:read", "analytics:read", "trips:read"}, want: []string{"trips:read", "analytics:read"}},
+		{name: "no permissions", permissions: nil, want: []string{}},
+		{name: "permission the grantor lacks", permissions: []string{"trips:read", "trips:write"}, wantErr: ErrRoleExceedsGrantor},
+		{name: "permission outside the catalogue", permissions: []string{"users:write"}, wantErr: ErrInvalidRole},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newRoleTestService(newFakeRoleStore(), &fakeRoleInvalidations{})
+
+			got, err := s.validatePermissions(tt.permissions, grantor)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRoleMutationsProtectBuiltInAdmin(t *testing.T) {
+	grantor := []string{"trips:read"}
+	mfa := true
+
+	tests := []struct {
+		name   string
+		mutate func(s *roleService, roleID int64) error
+	}{
+		{name: "update", mutate: func(s *roleService, roleID int64) error {
+			_, err := s.Update(context.Background(), roleID, RoleUpdate{Name: "renamed", MFARequired: &mfa}, nil)
+			return err
+		}},
+		{name: "delete", mutate: func(s *roleService, roleID int64) error {
+			return s.Delete(context.Background(), roleID)
+		}},
+		{name: "set permissions", mutate: func(s *roleService, roleID int64) error {
+			_, err := s.SetPermissions(context.Background(), roleID, []string{"trips:read"}, grantor)
+			return err
+		}},
+		{name: "set mfa required", mutate: func(s *roleService, roleID int64) error {
+			_, err := s.SetMFARequired(context.Background(), roleID, true)
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+" of admin", func(t *testing.T) {
+			store, invalidations := newFakeRoleStore(), &fakeRoleInvalidations{}
+
+			assert.ErrorIs(t, tt.mutate(newRoleTestService(store, invalidations), 1), ErrBuiltInRole)
+			assert.Empty(t, store.changed)
+			assert.Empty(t, invalidations.roles)
+		})
+
+		t.Run(tt.name+" of another role", func(t *testing.T) {
+			store, invalidations := newFakeRoleStore(), &fakeRoleInvalidations{}
+
+			require.NoError(t, tt.mutate(newRoleTestService(store, invalidations), 3))
+			assert.Equal(t, []int64{3}, store.changed)
+			// Зміна діє з наступного запиту користувачів ролі
+			assert.Equal(t, []int64{3}, invalidations.roles)
+		})
+
+		t.Run(tt.name+" of a missing role", func(t *testing.T) {
+			store := newFakeRoleStore()
+
+			assert.ErrorIs(t, tt.mutate(newRoleTestService(store, &fakeRoleInvalidations{}), 99), ErrRoleNotFound)
+			assert.Empty(t, store.changed)
+		})
+	}
+}
+
+func TestRoleLookupPassesDatabaseErrorsThrough(t *testing.T) {
+	dbErr := errors.New("connection refused")
+	store := newFakeRoleStore()
+	store.err = fmt.Errorf("failed to get role: %w", dbErr)
+	s := newRoleTestService(store, &fakeRoleInvalidations{})
+
+	_, err := s.SetMFARequired(context.Background(), 3, true)
+	assert.ErrorIs(t, err, dbErr)
+	assert.NotErrorIs(t, err, ErrRoleNotFound)
+}
+
+func TestDeleteRoleAssignedToUsers(t *testing.T) {
+	tests := []struct {
+		name    string
+		users   int
+		wantErr error
+	}{
+		{name: "unassigned role", users: 0},
+		{name: "role with users", users: 2, wantErr: ErrRoleConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeRoleStore()
+			store.users[3] = tt.users
+
+			err := newRoleTestService(store, &fakeRoleInvalidations{}).Delete(context.Background(), 3)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Contains(t, store.roles, int64(3))
+				return
+			}
+			require.NoError(t, err)
+			assert.NotContains(t, store.roles, int64(3))
+		})
+	}
+}
+
+func TestUpdateRoleSettings(t *testing.T) {
+	enabled, disabled := true, false
+	scope := NewRouteScope([]int64{1})
+
+	tests := []struct {
+		name            string
+		update          RoleUpdate
+		grantorScope    *RouteScope
+		wantMFARequired bool
+		wantRouteScoped bool
+		wantErr         error
+	}{
+		{name: "omitted settings are kept", update: RoleUpdate{Name: "dispatcher"}, wantMFARequired: true, wantRouteScoped: true},
+		{name: "sent settings are applied", update: RoleUpdate{Name: "dispatcher", MFARequired: &disabled, RouteScoped: &disabled}},
+		{name: "route-scoped grantor keeps the route limit", update: RoleUpdate{Name: "dispatcher", MFARequired: &disabled}, grantorScope: scope, wantRouteScoped: true},
+		{name: "route-scoped grantor cannot lift the route limit", update: RoleUpdate{Name: "dispatcher", RouteScoped: &disabled}, grantorScope: scope, wantErr: ErrRoleExceedsGrantor},
+		{name: "route-scoped grantor can confirm the route limit", update: RoleUpdate{Name: "dispatcher", RouteScoped: &enabled}, grantorScope: scope, wantMFARequired: true, wantRouteScoped: true},
+		{name: "name is required", update: RoleUpdate{Name: " "}, wantErr: ErrInvalidRole},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeRoleStore()
+
+			role, err := newRoleTestService(store, &fakeRoleInvalidations{}).Update(context.Background(), 2, tt.update, tt.grantorScope)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Empty(t, store.changed)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantMFARequired, role.MFARequired)
+			assert.Equal(t, tt.wantRouteScoped, role.RouteScoped)
+		})
+	}
+}
+
+func TestCreateRoleByRouteScopedGrantor(t *testing.T) {
+	scope := NewRouteScope([]int64{1})
+
+	tests := []struct {
+		name        string
+		routeScoped bool
+		wantErr     error
+	}{
+		{name: "route-scoped role", routeScoped: true},
+		{name: "role without route limit", routeScoped: false, wantErr: ErrRoleExceedsGrantor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newRoleTestService(newFakeRoleStore(), &fakeRoleInvalidations{})
+
+			role := &model.Role{Name: "night_dispatcher", RouteScoped: tt.routeScoped}
+			_, err := s.Create(context.Background(), role, []string{"trips:read"}, []string{"trips:read"}, scope)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"errors"
+	"sort"
+)
+
+// ErrRouteOutOfScope повертається, коли користувач звертається до маршруту поза своїми призначеннями
+var ErrRouteOutOfScope = errors.New("route is outside of your assigned routes")
+
+// RouteScope набір маршрутів, доступних користувачу.
+// nil означає доступ до всіх маршрутів (роль без обмежень, API ключ)
+type RouteScope struct {
+	routeIDs map[int64]struct{}
+}
+
+// NewRouteScope створює обмеження доступу вказаними маршрутами
+func NewRouteScope(routeIDs []int64) *RouteScope {
+	scope := &RouteScope{routeIDs: make(map[int64]struct{}, len(routeIDs))}
+	for _, id := range routeIDs {
+		scope.routeIDs[id] = struct{}{}
+	}
+	return scope
+}
+
+// Allows перевіряє, чи доступний маршрут
+func (s *RouteScope) Allows(routeID int64) bool {
+	if s == nil {
+		return true
+	}
+	_, ok := s.routeIDs[routeID]
+	return ok
+}
+
+// RouteIDs повертає відсортовані ідентифікатори доступних маршрутів
+func (s *RouteScope) RouteIDs() []int64 {
+	ids := make([]int64, 0, len(s.routeIDs))
+	for id := range s.routeIDs {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// Check повертає ErrRouteOutOfScope, якщо маршрут недоступний
+func (s *RouteScope) Check(routeID int64) error {
+	if !s.Allows(routeID) {
+		return ErrRouteOutOfScope
+	}
+	return nil
+}
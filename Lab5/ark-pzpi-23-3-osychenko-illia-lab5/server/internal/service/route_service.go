@@ -6,45 +6,94 @@ import (
 	"busoptima/internal/repository"
 )
 
-// RouteService інтерфейс для роботи з маршрутами
+// RouteService інтерфейс для роботи з маршрутами.
+// scope обмежує доступ маршрутами, призначеними користувачу (nil - без обмежень)
 type RouteService interface {
-	Create(ctx context.Context, route *model.Route) error
-	GetByID(ctx context.Context, id int64) (*model.Route, error)
-	GetAll(ctx context.Context, activeOnly bool) ([]model.Route, error)
-	Update(ctx context.Context, route *model.Route) error
-	Delete(ctx context.Context, id int64) error
+	Create(ctx context.Context, scope *RouteScope, route *model.Route) error
+	GetByID(ctx context.Context, scope *RouteScope, id int64) (*model.Route, error)
+	GetAll(ctx context.Context, scope *RouteScope, activeOnly bool) ([]model.Route, error)
+	Update(ctx context.Context, scope *RouteScope, route *model.Route) error
+	Delete(ctx context.Context, scope *RouteScope, id int64) error
+	GetAssignments(ctx context.Context, userID int64) ([]int64, error)
+	SetAssignments(ctx context.Context, userID int64, routeIDs []int64, assignedBy int64) ([]int64, error)
 }
 
 // routeService реалізація RouteService
 type routeService struct {
-	routeRepo repository.RouteRepository
-	auditRepo repository.AuditLogRepository
+	routeRepo      repository.RouteRepository
+	auditRepo      repository.AuditLogRepository
+	assignmentRepo repository.RouteAssignmentRepository
+	permissions    PermissionService
 }
 
 // NewRouteService створює новий сервіс маршрутів
-func NewRouteService(routeRepo repository.RouteRepository, auditRepo repository.AuditLogRepository) RouteService {
+func NewRouteService(routeRepo repository.RouteRepository, auditRepo repository.AuditLogRepository, assignmentRepo repository.RouteAssignmentRepository, permissions PermissionService) RouteService {
 	return &routeService{
-		routeRepo: routeRepo,
-		auditRepo: auditRepo,
+		routeRepo:      routeRepo,
+		auditRepo:      auditRepo,
+		assignmentRepo: assignmentRepo,
+		permissions:    permissions,
 	}
 }
 
-func (s *routeService) Create(ctx context.Context, route *model.Route) error {
+// Create створює маршрут. Користувач з обмеженим доступом не може створювати маршрути,
+// оскільки новий маршрут ще не призначений йому
+func (s *routeService) Create(ctx context.Context, scope *RouteScope, route *model.Route) error {
+	if scope != nil {
+		return ErrRouteOutOfScope
+	}
 	return s.routeRepo.Create(ctx, route)
 }
 
-func (s *routeService) GetByID(ctx context.Context, id int64) (*model.Route, error) {
+func (s *routeService) GetByID(ctx context.Context, scope *RouteScope, id int64) (*model.Route, error) {
+	if err := scope.Check(id); err != nil {
+		return nil, err
+	}
 	return s.routeRepo.GetByID(ctx, id)
 }
 
-func (s *routeService) GetAll(ctx context.Context, activeOnly bool) ([]model.Route, error) {
-	return s.routeRepo.GetAll(ctx, activeOnly)
+// GetAll повертає маршрути, доступні користувачу
+func (s *routeService) GetAll(ctx context.Context, scope *RouteScope, activeOnly bool) ([]model.Route, error) {
+	routes, err := s.routeRepo.GetAll(ctx, activeOnly)
+	if err != nil || scope == nil {
+		return routes, err
+	}
+
+	allowed := make([]model.Route, 0, len(routes))
+	for _, route := range routes {
+		if scope.Allows(route.ID) {
+			allowed = append(allowed, route)
+		}
+	}
+	return allowed, nil
 }
 
-func (s *routeService) Update(ctx context.Context, route *model.Route) error {
+func (s *routeService) Update(ctx context.Context, scope *RouteScope, route *model.Route) error {
+	if err := scope.Check(route.ID); err != nil {
+		return err
+	}
 	return s.routeRepo.Update(ctx, route)
 }
 
-func (s *routeService) Delete(ctx context.Context, id int64) error {
+func (s *routeService) Delete(ctx context.Context, scope *RouteScope, id int64) error {
+	if err := scope.Check(id); err != nil {
+		return err
+	}
 	return s.routeRepo.Delete(ctx, id)
-}
\ No newline at end of file
+}
+
+// GetAssignments повертає маршрути, призначені користувачу
+func (s *routeService) GetAssignments(ctx context.Context, userID int64) ([]int64, error) {
+	return s.assignmentRepo.GetRouteIDs(ctx, userID)
+}
+
+// SetAssignments замінює маршрути, призначені користувачу. Зміни діють з наступного запиту
+func (s *routeService) SetAssignments(ctx context.Context, userID int64, routeIDs []int64, assignedBy int64) ([]int64, error) {
+	if err := s.assignmentRepo.SetRouteIDs(ctx, userID, routeIDs, assignedBy); err != nil {
+		return nil, err
+	}
+
+	s.permissions.InvalidateUser(userID)
+
+	return s.assignmentRepo.GetRouteIDs(ctx, userID)
+}
@@ -13,4 +13,16 @@ type Services struct {
 	Settings  SettingsService
 	Backup    BackupService
 	Audit     AuditService
+	Device    DeviceService
+	Firmware  FirmwareService
+	Tokens    TokenRevocationService
+	Keys      KeyService
+	Password  PasswordService
+	Email     EmailService
+	TwoFactor TwoFactorService
+	Role      RoleService
+	APIKeys   APIKeyService
+	Access    PermissionService
+	Profile   ProfileService
+	OIDC      OIDCService
 }
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"busoptima/internal/model"
+	"busoptima/internal/repository"
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// TokenRevocationService інтерфейс для відкликання access токенів
+type TokenRevocationService interface {
+	IsRevoked(jti string, userID int64, issuedAt time.Time) bool
+	IsDeviceRevoked(jti string, deviceID int64, issuedAt time.Time) bool
+	RevokeToken(ctx context.Context, jti string, userID *int64, expiresAt time.Time, reason string) error
+	RevokeUserTokens(ctx context.Context, userID int64, reason string) error
+	RevokeDeviceTokens(ctx context.Context, deviceID int64, reason string) error
+	Refresh(ctx context.Context) error
+	StartSync(ctx context.Context, interval time.Duration)
+}
+
+// tokenRevocationService реалізація TokenRevocationService.
+// Перевірка виконується по кешу в пам'яті, база даних є джерелом істини
+// і періодично перечитується, щоб відкликання з інших інстансів теж враховувались.
+type tokenRevocationService struct {
+	repo repository.TokenRevocationRepository
+
+	mu      sync.RWMutex
+	tokens  map[string]time.Time // jti -> expires_at
+	users   map[int64]time.Time  // user_id -> revoked_before
+	devices map[int64]time.Time  // device_id -> revoked_before
+}
+
+// NewTokenRevocationService створює новий сервіс відкликання токенів
+func NewTokenRevocationService(repo repository.TokenRevocationRepository) TokenRevocationService {
+	return &tokenRevocationService{
+		repo:    repo,
+		tokens:  make(map[string]time.Time),
+		users:   make(map[int64]time.Time),
+		devices: make(map[int64]time.Time),
+	}
+}
+
+// IsRevoked перевіряє, чи відкликаний токен
+func (s *tokenRevocationService) IsRevoked(jti string, userID int64, issuedAt time.Time) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if jti != "" {
+		if _, revoked := s.tokens[jti]; revoked {
+			return true
+		}
+	}
+
+	if userID > 0 {
+		if before, ok := s.users[userID]; ok && !issuedAt.After(before) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsDeviceRevoked перевіряє, чи відкликаний токен пристрою
+func (s *tokenRevocationService) IsDeviceRevoked(jti string, deviceID int64, issuedAt time.Time) bool {
+	if s.IsRevoked(jti, 0, issuedAt) {
+		return true
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	before, ok := s.devices[deviceID]
+	return ok && !issuedAt.After(before)
+}
+
+// RevokeToken відкликає окремий токен за його jti
+func (s *tokenRevocationService) RevokeToken(ctx context.Context, jti string, userID *int64, expiresAt time.Time, reason string) error {
+	if jti == "" {
+		return fmt.Errorf("token has no jti")
+	}
+
+	err := s.repo.RevokeToken(ctx, &model.RevokedToken{
+		JTI:       jti,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+		Reason:    &reason,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.tokens[jti] = expiresAt
+	s.mu.Unlock()
+
+	return nil
+}
+
+// RevokeUserTokens відкликає всі токени користувача, видані до поточного моменту
+func (s *tokenRevocationService) RevokeUserTokens(ctx context.Context, userID int64, reason string) error {
+	// iat має точність до мілісекунди і не більший за реальний час видачі, тож усі токени,
+	// видані до цього моменту, відкликаються, а нові - ні (крім виданих у ту саму мілісекунду)
+	revokedBefore := time.Now()
+
+	err := s.repo.RevokeUserTokens(ctx, &model.UserTokenRevocation{
+		UserID:        userID,
+		RevokedBefore: revokedBefore,
+		Reason:        &reason,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.users[userID] = revokedBefore
+	s.mu.Unlock()
+
+	return nil
+}
+
+// RevokeDeviceTokens відкликає всі токени пристрою, видані до поточного моменту
+func (s *tokenRevocationService) RevokeDeviceTokens(ctx context.Context, deviceID int64, reason string) error {
+	revokedBefore := time.Now()
+
+	err := s.repo.RevokeDeviceTokens(ctx, &model.DeviceTokenRevocation{
+		DeviceID:      deviceID,
+		RevokedBefore: revokedBefore,
+		Reason:        &reason,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.devices[deviceID] = revokedBefore
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Refresh перечитує список відкликаних токенів з бази даних
+func (s *tokenRevocationService) Refresh(ctx context.Context) error {
+	if err := s.repo.DeleteExpired(ctx); err != nil {
+		return err
+	}
+
+	tokens, err := s.repo.GetActiveTokens(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Відкликання користувача старші за час життя access токена вже нічого не блокують
+	users, err := s.repo.GetUserRevocationsSince(ctx, time.Now().Add(-accessTokenTTL))
+	if err != nil {
+		return err
+	}
+
+	devices, err := s.repo.GetDeviceRevocationsSince(ctx, time.Now().Add(-deviceTokenTTL))
+	if err != nil {
+		return err
+	}
+
+	tokenMap := make(map[string]time.Time, len(tokens))
+	for _, t := range tokens {
+		tokenMap[t.JTI] = t.ExpiresAt
+	}
+
+	userMap := make(map[int64]time.Time, len(users))
+	for _, u := range users {
+		userMap[u.UserID] = u.RevokedBefore
+	}
+
+	deviceMap := make(map[int64]time.Time, len(devices))
+	for _, d := range devices {
+		deviceMap[d.DeviceID] = d.RevokedBefore
+	}
+
+	s.mu.Lock()
+	s.tokens = tokenMap
+	s.users = userMap
+	s.devices = deviceMap
+	s.mu.Unlock()
+
+	return nil
+}
+
+// StartSync запускає періодичну синхронізацію кешу з базою даних
+func (s *tokenRevocationService) StartSync(ctx context.Context, interval time.Duration) {
+	if err := s.Refresh(ctx); err != nil {
+		log.Printf("Failed to load revoked tokens: %v", err)
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.Refresh(ctx); err != nil {
+					log.Printf("Failed to refresh revoked tokens: %v", err)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMain встановлює точність iat так само, як cmd/api
+func TestMain(m *testing.M) {
+	jwt.TimePrecision = time.Millisecond
+	os.Exit(m.Run())
+}
+
+// issuedAt повертає iat так, як його прочитає middleware після підпису та розбору токена
+func issuedAt(t *testing.T, at time.Time) time.Time {
+	t.Helper()
+
+	encoded, err := jwt.NewNumericDate(at).MarshalJSON()
+	require.NoError(t, err)
+
+	var decoded jwt.NumericDate
+	require.NoError(t, decoded.UnmarshalJSON(encoded))
+	return decoded.Time
+}
+
+func TestIsRevokedUserCutoff(t *testing.T) {
+	service := NewTokenRevocationService(fakeRevocationStore{}).(*tokenRevocationService)
+	cutoff := time.Date(2026, 3, 1, 12, 0, 0, 500_000_000, time.UTC)
+	service.users[7] = cutoff
+
+	tests := []struct {
+		name     string
+		userID   int64
+		issuedAt time.Time
+		want     bool
+	}{
+		{name: "issued a second before cutoff", userID: 7, issuedAt: cutoff.Add(-time.Second), want: true},
+		{name: "issued a millisecond before cutoff", userID: 7, issuedAt: cutoff.Add(-time.Millisecond), want: true},
+		{name: "issued at cutoff", userID: 7, issuedAt: cutoff, want: true},
+		{name: "issued later within the cutoff millisecond", userID: 7, issuedAt: cutoff.Add(900 * time.Microsecond), want: true},
+		// iat розбирається як float64 секунд, тому прочитаний час буває на мілісекунду меншим за виданий:
+		// токен, виданий у наступну мілісекунду, ще може вважатись відкликаним, але не пізніше
+		{name: "issued two milliseconds after cutoff", userID: 7, issuedAt: cutoff.Add(2 * time.Millisecond), want: false},
+		// З секундною точністю iat такого токена округлювався б до 12:00:00 і він вважався б відкликаним
+		{name: "issued after cutoff within the same second", userID: 7, issuedAt: cutoff.Add(300 * time.Millisecond), want: false},
+		{name: "another user", userID: 8, issuedAt: cutoff.Add(-time.Second), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, service.IsRevoked("jti", tt.userID, issuedAt(t, tt.issuedAt)))
+		})
+	}
+}
+
+func TestIsRevokedByJTI(t *testing.T) {
+	service := NewTokenRevocationService(fakeRevocationStore{})
+	require.NoError(t, service.RevokeToken(context.Background(), "revoked-jti", nil, time.Now().Add(time.Hour), "logout"))
+
+	assert.True(t, service.IsRevoked("revoked-jti", 7, time.Now()))
+	assert.False(t, service.IsRevoked("other-jti", 7, time.Now()))
+	assert.False(t, service.IsRevoked("", 7, time.Now()))
+}
+
+func TestRevokeUserTokensSparesTokensIssuedAfterwards(t *testing.T) {
+	service := NewTokenRevocationService(fakeRevocationStore{})
+	before := issuedAt(t, time.Now())
+
+	require.NoError(t, service.RevokeUserTokens(context.Background(), 7, "forced_logout"))
+	time.Sleep(5 * time.Millisecond)
+	after := issuedAt(t, time.Now())
+
+	assert.True(t, service.IsRevoked("jti", 7, before))
+	assert.False(t, service.IsRevoked("jti", 7, after))
+}
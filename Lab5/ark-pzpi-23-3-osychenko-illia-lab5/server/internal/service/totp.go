@@ -0,0 +1,101 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// totpIssuer назва сервісу, що показується в застосунку-автентифікаторі
+	totpIssuer = "BusOptima"
+	// totpPeriod тривалість одного часового інтервалу
+	totpPeriod = 30 * time.Second
+	// totpDigits кількість цифр коду
+	totpDigits = 6
+	// totpSkew кількість сусідніх інтервалів, що приймаються для компенсації розбіжності годинників
+	totpSkew = 1
+	// totpSecretSize розмір секрету в байтах (160 біт, як рекомендує RFC 4226)
+	totpSecretSize = 20
+)
+
+// totpEncoding кодування секрету, яке очікують застосунки-автентифікатори
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateTOTPSecret генерує випадковий секрет у кодуванні base32
+func generateTOTPSecret() (string, error) {
+	buf := make([]byte, totpSecretSize)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate TOTP secret: %w", err)
+	}
+	return totpEncoding.EncodeToString(buf), nil
+}
+
+// totpProvisioningURI формує otpauth:// URI для QR-коду
+func totpProvisioningURI(account, secret string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", totpIssuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(int(totpPeriod.Seconds())))
+
+	label := url.PathEscape(totpIssuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// totpStep повертає номер часового інтервалу для моменту часу
+func totpStep(t time.Time) int64 {
+	return t.Unix() / int64(totpPeriod.Seconds())
+}
+
+// totpCode обчислює код для часового інтервалу (RFC 6238, HMAC-SHA1)
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// Динамічне усічення згідно з RFC 4226
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
+
+// validateTOTP перевіряє код та повертає інтервал, якому він відповідає
+func validateTOTP(secret, code string, now time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false
+	}
+
+	current := totpStep(now)
+	for i := -totpSkew; i <= totpSkew; i++ {
+		step := current + int64(i)
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// rfc6238Secret спільний секрет тестових векторів RFC 6238 для HMAC-SHA1 ("12345678901234567890")
+var rfc6238Secret = []byte("12345678901234567890")
+
+// Тестові вектори з додатка B RFC 6238 (SHA1). У RFC коди 8-значні,
+// 6-значний код - це їх останні 6 цифр, бо усічення бере остачу від 10^digits
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestTOTPCodeRFC6238Vectors(t *testing.T) {
+	for _, v := range rfc6238Vectors {
+		step := totpStep(time.Unix(v.unix, 0))
+		assert.Equal(t, v.code, totpCode(rfc6238Secret, step), "time %d", v.unix)
+	}
+}
+
+func TestValidateTOTPRFC6238Vectors(t *testing.T) {
+	secret := totpEncoding.EncodeToString(rfc6238Secret)
+
+	for _, v := range rfc6238Vectors {
+		now := time.Unix(v.unix, 0)
+
+		step, ok := validateTOTP(secret, v.code, now)
+		assert.True(t, ok, "time %d", v.unix)
+		assert.Equal(t, totpStep(now), step, "time %d", v.unix)
+
+		// Код попереднього та наступного інтервалу приймається, далі - ні
+		_, ok = validateTOTP(secret, v.code, now.Add(totpPeriod))
+		assert.True(t, ok, "time %d + 1 step", v.unix)
+		_, ok = validateTOTP(secret, v.code, now.Add(2*totpPeriod))
+		assert.False(t, ok, "time %d + 2 steps", v.unix)
+	}
+}
+
+func TestValidateTOTPRejectsMalformedInput(t *testing.T) {
+	secret := totpEncoding.EncodeToString(rfc6238Secret)
+	now := time.Unix(59, 0)
+
+	_, ok := validateTOTP(secret, "28708", now)
+	assert.False(t, ok, "short code")
+
+	_, ok = validateTOTP(secret, "94287082", now)
+	assert.False(t, ok, "8-digit code")
+
+	_, ok = validateTOTP("not base32!", "287082", now)
+	assert.False(t, ok, "invalid secret")
+
+	_, ok = validateTOTP(secret, " 287082 ", now)
+	assert.True(t, ok, "surrounding spaces are ignored")
+}
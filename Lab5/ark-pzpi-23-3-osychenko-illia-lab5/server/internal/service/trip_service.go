@@ -2,56 +2,188 @@ package service
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"busoptima/internal/model"
 	"busoptima/internal/repository"
 )
 
-// TripService інтерфейс для роботи з рейсами
+// TripService інтерфейс для роботи з рейсами.
+// scope обмежує доступ рейсами призначених користувачу маршрутів (nil - без обмежень)
 type TripService interface {
-	Create(ctx context.Context, trip *model.Trip) error
-	GetByID(ctx context.Context, id int64) (*model.Trip, error)
-	GetAll(ctx context.Context, filters map[string]interface{}) ([]model.Trip, error)
-	Update(ctx context.Context, trip *model.Trip) error
-	GetEvents(ctx context.Context, tripID int64) ([]model.PassengerEvent, error)
-	GetAnalytics(ctx context.Context, tripID int64) (*model.TripAnalytics, error)
+	Create(ctx context.Context, scope *RouteScope, trip *model.Trip) error
+	GetByID(ctx context.Context, scope *RouteScope, id int64) (*model.Trip, error)
+	GetAll(ctx context.Context, scope *RouteScope, filters map[string]interface{}) ([]model.Trip, error)
+	Update(ctx context.Context, scope *RouteScope, trip *model.Trip) error
+	GetEvents(ctx context.Context, scope *RouteScope, tripID int64) ([]model.PassengerEvent, error)
+	GetAnalytics(ctx context.Context, scope *RouteScope, tripID int64) (*model.TripAnalytics, error)
+	GetQuarantinedEvents(ctx context.Context, scope *RouteScope, tripID int64) ([]model.QuarantinedEvent, error)
+	ReviewQuarantinedEvent(ctx context.Context, scope *RouteScope, tripID, eventID, reviewerID int64, note string) error
+	RecomputeOccupancy(ctx context.Context, scope *RouteScope, tripID int64) (*model.OccupancyRecompute, error)
+	GetPriceRecommendations(ctx context.Context, scope *RouteScope, tripID int64, flaggedOnly bool) ([]model.PriceRecommendation, error)
 }
 
 type tripService struct {
-	tripRepo      repository.TripRepository
-	eventRepo     repository.PassengerEventRepository
-	analyticsRepo repository.AnalyticsRepository
-	auditRepo     repository.AuditLogRepository
+	tripRepo        repository.TripRepository
+	eventRepo       repository.PassengerEventRepository
+	analyticsRepo   repository.AnalyticsRepository
+	auditRepo       repository.AuditLogRepository
+	priceRecommRepo repository.PriceRecommendationRepository
 }
 
-func NewTripService(tripRepo repository.TripRepository, eventRepo repository.PassengerEventRepository, analyticsRepo repository.AnalyticsRepository, auditRepo repository.AuditLogRepository) TripService {
+func NewTripService(tripRepo repository.TripRepository, eventRepo repository.PassengerEventRepository, analyticsRepo repository.AnalyticsRepository, auditRepo repository.AuditLogRepository, priceRecommRepo repository.PriceRecommendationRepository) TripService {
 	return &tripService{
-		tripRepo:      tripRepo,
-		eventRepo:     eventRepo,
-		analyticsRepo: analyticsRepo,
-		auditRepo:     auditRepo,
+		tripRepo:        tripRepo,
+		eventRepo:       eventRepo,
+		analyticsRepo:   analyticsRepo,
+		auditRepo:       auditRepo,
+		priceRecommRepo: priceRecommRepo,
 	}
 }
 
-func (s *tripService) Create(ctx context.Context, trip *model.Trip) error {
+func (s *tripService) Create(ctx context.Context, scope *RouteScope, trip *model.Trip) error {
+	if err := scope.Check(trip.RouteID); err != nil {
+		return err
+	}
 	return s.tripRepo.Create(ctx, trip)
 }
 
-func (s *tripService) GetByID(ctx context.Context, id int64) (*model.Trip, error) {
-	return s.tripRepo.GetByID(ctx, id)
+func (s *tripService) GetByID(ctx context.Context, scope *RouteScope, id int64) (*model.Trip, error) {
+	return s.authorizeTrip(ctx, scope, id)
 }
 
-func (s *tripService) GetAll(ctx context.Context, filters map[string]interface{}) ([]model.Trip, error) {
-	return s.tripRepo.GetAll(ctx, filters)
+// GetAll повертає рейси з урахуванням фільтрів лише для доступних маршрутів
+func (s *tripService) GetAll(ctx context.Context, scope *RouteScope, filters map[string]interface{}) ([]model.Trip, error) {
+	trips, err := s.tripRepo.GetAll(ctx, filters)
+	if err != nil || scope == nil {
+		return trips, err
+	}
+
+	allowed := make([]model.Trip, 0, len(trips))
+	for _, trip := range trips {
+		if scope.Allows(trip.RouteID) {
+			allowed = append(allowed, trip)
+		}
+	}
+	return allowed, nil
 }
 
-func (s *tripService) Update(ctx context.Context, trip *model.Trip) error {
+// Update оновлює рейс. Перевіряється як поточний маршрут рейсу, так і новий,
+// щоб рейс не можна було перенести на чужий маршрут або забрати з нього
+func (s *tripService) Update(ctx context.Context, scope *RouteScope, trip *model.Trip) error {
+	if scope != nil {
+		if _, err := s.authorizeTrip(ctx, scope, trip.ID); err != nil {
+			return err
+		}
+		if err := scope.Check(trip.RouteID); err != nil {
+			return err
+		}
+	}
 	return s.tripRepo.Update(ctx, trip)
 }
 
-func (s *tripService) GetEvents(ctx context.Context, tripID int64) ([]model.PassengerEvent, error) {
+func (s *tripService) GetEvents(ctx context.Context, scope *RouteScope, tripID int64) ([]model.PassengerEvent, error) {
+	if scope != nil {
+		if _, err := s.authorizeTrip(ctx, scope, tripID); err != nil {
+			return nil, err
+		}
+	}
 	return s.eventRepo.GetByTripID(ctx, tripID)
 }
 
-func (s *tripService) GetAnalytics(ctx context.Context, tripID int64) (*model.TripAnalytics, error) {
+func (s *tripService) GetAnalytics(ctx context.Context, scope *RouteScope, tripID int64) (*model.TripAnalytics, error) {
+	if scope != nil {
+		if _, err := s.authorizeTrip(ctx, scope, tripID); err != nil {
+			return nil, err
+		}
+	}
 	return s.analyticsRepo.GetTripAnalytics(ctx, tripID)
-}
\ No newline at end of file
+}
+
+// GetQuarantinedEvents повертає події рейсу, відкладені для перевірки
+func (s *tripService) GetQuarantinedEvents(ctx context.Context, scope *RouteScope, tripID int64) ([]model.QuarantinedEvent, error) {
+	if scope != nil {
+		if _, err := s.authorizeTrip(ctx, scope, tripID); err != nil {
+			return nil, err
+		}
+	}
+	return s.eventRepo.GetQuarantined(ctx, tripID)
+}
+
+// GetPriceRecommendations повертає рекомендації цін від пристроїв для рейсу разом з результатом перевірки сервером
+func (s *tripService) GetPriceRecommendations(ctx context.Context, scope *RouteScope, tripID int64, flaggedOnly bool) ([]model.PriceRecommendation, error) {
+	if scope != nil {
+		if _, err := s.authorizeTrip(ctx, scope, tripID); err != nil {
+			return nil, err
+		}
+	}
+	return s.priceRecommRepo.GetByTripID(ctx, tripID, flaggedOnly)
+}
+
+// ReviewQuarantinedEvent позначає відкладену подію переглянутою. На кількість пасажирів це не впливає
+func (s *tripService) ReviewQuarantinedEvent(ctx context.Context, scope *RouteScope, tripID, eventID, reviewerID int64, note string) error {
+	if scope != nil {
+		if _, err := s.authorizeTrip(ctx, scope, tripID); err != nil {
+			return err
+		}
+	}
+	return s.eventRepo.ReviewQuarantined(ctx, tripID, eventID, reviewerID, note)
+}
+
+// RecomputeOccupancy перераховує кількість пасажирів рейсу за подіями в порядку часу.
+// Спершу повторно звіряються відкладені події, які ще не переглянуто: можливі тепер переносяться до подій рейсу
+func (s *tripService) RecomputeOccupancy(ctx context.Context, scope *RouteScope, tripID int64) (*model.OccupancyRecompute, error) {
+	trip, err := s.authorizeTrip(ctx, scope, tripID)
+	if err != nil {
+		return nil, err
+	}
+
+	capacity := 0
+	if trip.Bus != nil {
+		capacity = trip.Bus.Capacity
+	}
+
+	var recompute *model.OccupancyRecompute
+	err = s.eventRepo.LockTrip(ctx, tripID, func(tx repository.TripEvents) error {
+		events, err := tx.GetEvents(ctx)
+		if err != nil {
+			return err
+		}
+
+		released, err := releaseQuarantined(ctx, tx, newOccupancyTracker(events, capacity))
+		if err != nil {
+			return err
+		}
+
+		recompute, err = tx.RecomputeOccupancy(ctx)
+		if err != nil {
+			return err
+		}
+		recompute.ReleasedEventIDs = make([]int64, 0, len(released))
+		for _, q := range released {
+			recompute.ReleasedEventIDs = append(recompute.ReleasedEventIDs, q.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return recompute, nil
+}
+
+// authorizeTrip повертає рейс, якщо його маршрут доступний користувачу
+func (s *tripService) authorizeTrip(ctx context.Context, scope *RouteScope, tripID int64) (*model.Trip, error) {
+	trip, err := s.tripRepo.GetByID(ctx, tripID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %d", ErrTripNotFound, tripID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := scope.Check(trip.RouteID); err != nil {
+		return nil, err
+	}
+	return trip, nil
+}
@@ -0,0 +1,320 @@
+package service
+
+import (
+	"busoptima/internal/repository"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	// recoveryCodeCount кількість кодів відновлення, що видаються за раз
+	recoveryCodeCount = 10
+	// recoveryCodeLength довжина коду відновлення без дефіса
+	recoveryCodeLength = 10
+)
+
+// recoveryCodeAlphabet символи кодів відновлення без схожих на вигляд (0/O, 1/I/L)
+const recoveryCodeAlphabet = "23456789ABCDEFGHJKMNPQRSTUVWXYZ"
+
+var (
+	// ErrInvalidTwoFactorCode повертається, коли TOTP код або код відновлення невірний
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor authentication code")
+	// ErrTwoFactorRequired повертається при спробі вимкнути 2FA, обов'язкову для ролі
+	ErrTwoFactorRequired = errors.New("two-factor authentication is required for your role")
+)
+
+// TwoFactorStatus стан двофакторної автентифікації користувача
+type TwoFactorStatus struct {
+	Enabled           bool `json:"enabled"`
+	Required          bool `json:"required"`
+	PendingEnrollment bool `json:"pending_enrollment"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
+
+// TwoFactorEnrollment дані для додавання облікового запису в застосунок-автентифікатор
+type TwoFactorEnrollment struct {
+	Secret          string `json:"secret" example:"JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"`
+	ProvisioningURI string `json:"provisioning_uri" example:"otpauth://totp/BusOptima:admin@busoptima.ua?issuer=BusOptima&secret=JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"`
+}
+
+// TwoFactorService інтерфейс для керування двофакторною автентифікацією (TOTP)
+type TwoFactorService interface {
+	Status(ctx context.Context, userID int64) (*TwoFactorStatus, error)
+	IsEnabled(ctx context.Context, userID int64) (bool, error)
+	Enroll(ctx context.Context, userID int64) (*TwoFactorEnrollment, error)
+	Confirm(ctx context.Context, userID int64, code, ipAddress string) ([]string, error)
+	Disable(ctx context.Context, userID int64, code, ipAddress string) error
+	RegenerateRecoveryCodes(ctx context.Context, userID int64, code, ipAddress string) ([]string, error)
+	VerifyCode(ctx context.Context, userID int64, code, ipAddress string) error
+}
+
+// twoFactorService реалізація TwoFactorService
+type twoFactorService struct {
+	twoFactorRepo repository.TwoFactorRepository
+	userRepo      repository.UserRepository
+	audit         AuditService
+}
+
+// NewTwoFactorService створює новий сервіс двофакторної автентифікації
+func NewTwoFactorService(twoFactorRepo repository.TwoFactorRepository, userRepo repository.UserRepository, audit AuditService) TwoFactorService {
+	return &twoFactorService{
+		twoFactorRepo: twoFactorRepo,
+		userRepo:      userRepo,
+		audit:         audit,
+	}
+}
+
+// Status повертає стан 2FA користувача
+func (s *twoFactorService) Status(ctx context.Context, userID int64) (*TwoFactorStatus, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	totp, err := s.twoFactorRepo.GetTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &TwoFactorStatus{
+		Required: user.Role != nil && user.Role.MFARequired,
+	}
+
+	if totp != nil {
+		status.Enabled = totp.ConfirmedAt != nil
+		status.PendingEnrollment = totp.ConfirmedAt == nil
+	}
+
+	if status.Enabled {
+		status.RecoveryCodesLeft, err = s.twoFactorRepo.CountUnusedRecoveryCodes(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return status, nil
+}
+
+// IsEnabled перевіряє, чи підтверджено 2FA для користувача
+func (s *twoFactorService) IsEnabled(ctx context.Context, userID int64) (bool, error) {
+	totp, err := s.twoFactorRepo.GetTOTP(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return totp != nil && totp.ConfirmedAt != nil, nil
+}
+
+// Enroll генерує новий секрет. 2FA вмикається лише після підтвердження кодом з застосунку
+func (s *twoFactorService) Enroll(ctx context.Context, userID int64) (*TwoFactorEnrollment, error) {
+	enabled, err := s.IsEnabled(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, fmt.Errorf("two-factor authentication is already enabled")
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.twoFactorRepo.UpsertTOTP(ctx, userID, secret); err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorEnrollment{
+		Secret:          secret,
+		ProvisioningURI: totpProvisioningURI(user.Email, secret),
+	}, nil
+}
+
+// Confirm вмикає 2FA після перевірки першого коду та повертає коди відновлення
+func (s *twoFactorService) Confirm(ctx context.Context, userID int64, code, ipAddress string) ([]string, error) {
+	totp, err := s.twoFactorRepo.GetTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if totp == nil {
+		return nil, fmt.Errorf("two-factor enrollment has not been started")
+	}
+	if totp.ConfirmedAt != nil {
+		return nil, fmt.Errorf("two-factor authentication is already enabled")
+	}
+
+	if err := s.verifyTOTP(ctx, userID, totp.Secret, code); err != nil {
+		return nil, err
+	}
+
+	if err := s.twoFactorRepo.ConfirmTOTP(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	codes, err := s.issueRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logEvent(ctx, userID, "MFA_ENABLED", map[string]any{}, ipAddress)
+
+	return codes, nil
+}
+
+// Disable вимикає 2FA. Для ролей з обов'язковою 2FA вимкнення заборонене
+func (s *twoFactorService) Disable(ctx context.Context, userID int64, code, ipAddress string) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.Role != nil && user.Role.MFARequired {
+		return ErrTwoFactorRequired
+	}
+
+	if err := s.VerifyCode(ctx, userID, code, ipAddress); err != nil {
+		return err
+	}
+
+	if err := s.twoFactorRepo.DeleteTOTP(ctx, userID); err != nil {
+		return err
+	}
+
+	s.logEvent(ctx, userID, "MFA_DISABLED", map[string]any{}, ipAddress)
+
+	return nil
+}
+
+// RegenerateRecoveryCodes видає новий набір кодів відновлення, попередні перестають діяти
+func (s *twoFactorService) RegenerateRecoveryCodes(ctx context.Context, userID int64, code, ipAddress string) ([]string, error) {
+	if err := s.VerifyCode(ctx, userID, code, ipAddress); err != nil {
+		return nil, err
+	}
+
+	codes, err := s.issueRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logEvent(ctx, userID, "MFA_RECOVERY_CODES_REGENERATED", map[string]any{}, ipAddress)
+
+	return codes, nil
+}
+
+// VerifyCode перевіряє TOTP код або одноразовий код відновлення
+func (s *twoFactorService) VerifyCode(ctx context.Context, userID int64, code, ipAddress string) error {
+	totp, err := s.twoFactorRepo.GetTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if totp == nil || totp.ConfirmedAt == nil {
+		return fmt.Errorf("two-factor authentication is not enabled")
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) == totpDigits {
+		return s.verifyTOTP(ctx, userID, totp.Secret, code)
+	}
+
+	used, err := s.twoFactorRepo.UseRecoveryCode(ctx, userID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidTwoFactorCode
+	}
+
+	left, err := s.twoFactorRepo.CountUnusedRecoveryCodes(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	s.logEvent(ctx, userID, "MFA_RECOVERY_CODE_USED", map[string]any{"recovery_codes_left": left}, ipAddress)
+
+	return nil
+}
+
+// verifyTOTP перевіряє TOTP код та не дозволяє використати його повторно
+func (s *twoFactorService) verifyTOTP(ctx context.Context, userID int64, secret, code string) error {
+	step, ok := validateTOTP(secret, code, time.Now())
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+
+	fresh, err := s.twoFactorRepo.UseTOTPStep(ctx, userID, step)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrInvalidTwoFactorCode
+	}
+
+	return nil
+}
+
+// issueRecoveryCodes генерує коди відновлення та зберігає їх хеші
+func (s *twoFactorService) issueRecoveryCodes(ctx context.Context, userID int64) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		hashes[i] = hashToken(normalizeRecoveryCode(code))
+	}
+
+	if err := s.twoFactorRepo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// logEvent записує подію в журнал аудиту. Помилка запису не перериває операцію
+func (s *twoFactorService) logEvent(ctx context.Context, userID int64, action string, details map[string]any, ipAddress string) {
+	if err := s.audit.LogSecurityEvent(ctx, &userID, action, details, ipAddress); err != nil {
+		log.Printf("Failed to write audit log: %v", err)
+	}
+}
+
+// generateRecoveryCode генерує код відновлення у форматі XXXXX-XXXXX
+func generateRecoveryCode() (string, error) {
+	// Відкидаємо байти, що дали б нерівномірний розподіл символів
+	limit := byte(256 - 256%len(recoveryCodeAlphabet))
+
+	code := make([]byte, 0, recoveryCodeLength+1)
+	buf := make([]byte, 1)
+	for len(code) < recoveryCodeLength+1 {
+		if len(code) == recoveryCodeLength/2 {
+			code = append(code, '-')
+			continue
+		}
+
+		if _, err := rand.Read(buf); err != nil {
+			return "", fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		if buf[0] >= limit {
+			continue
+		}
+
+		code = append(code, recoveryCodeAlphabet[int(buf[0])%len(recoveryCodeAlphabet)])
+	}
+
+	return string(code), nil
+}
+
+// normalizeRecoveryCode приводить код до канонічного вигляду: без дефісів і пробілів, у верхньому регістрі
+func normalizeRecoveryCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
@@ -0,0 +1,22 @@
+-- Міграція для серверного зберігання refresh токенів
+-- Токени зберігаються лише у вигляді SHA-256 хешу, family_id об'єднує всі
+-- токени, отримані в межах однієї сесії (login -> refresh -> refresh ...)
+CREATE TABLE refresh_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    family_id VARCHAR(64) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    revoke_reason VARCHAR(50),
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_refresh_tokens_family ON refresh_tokens(family_id);
+CREATE INDEX idx_refresh_tokens_user ON refresh_tokens(user_id, revoked_at);
+
+COMMENT ON TABLE refresh_tokens IS 'Refresh токени користувачів (ротація та відкликання)';
+COMMENT ON COLUMN refresh_tokens.token_hash IS 'SHA-256 хеш refresh токена';
+COMMENT ON COLUMN refresh_tokens.family_id IS 'Ідентифікатор сесії, спільний для всіх ротованих токенів';
+COMMENT ON COLUMN refresh_tokens.used_at IS 'Час обміну токена на новий (повторне використання = компрометація)';
@@ -0,0 +1,22 @@
+-- Міграція для відкликання access токенів до завершення їх терміну дії
+
+-- Окремі відкликані токени (за claim jti)
+CREATE TABLE revoked_tokens (
+    jti VARCHAR(64) PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    reason VARCHAR(50),
+    revoked_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Відкликання всіх токенів користувача, виданих до певного моменту
+CREATE TABLE user_token_revocations (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    revoked_before TIMESTAMPTZ NOT NULL,
+    reason VARCHAR(50)
+);
+
+CREATE INDEX idx_revoked_tokens_expires ON revoked_tokens(expires_at);
+
+COMMENT ON TABLE revoked_tokens IS 'Список відкликаних access токенів (denylist)';
+COMMENT ON TABLE user_token_revocations IS 'Токени користувача з iat <= revoked_before вважаються відкликаними';
@@ -0,0 +1,20 @@
+-- Міграція дозволів для адміністрування IoT-пристроїв
+
+INSERT INTO permissions (name, description) VALUES
+    ('devices:read', 'Перегляд IoT-пристроїв'),
+    ('devices:write', 'Реєстрація пристроїв, прив''язка до автобусів та ротація секретів')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p
+WHERE r.name IN ('admin', 'tech_admin') AND p.name IN ('devices:read', 'devices:write')
+ON CONFLICT DO NOTHING;
+
+-- Відкликання токенів пристрою при ротації секрету або деактивації
+CREATE TABLE device_token_revocations (
+    device_id INTEGER PRIMARY KEY REFERENCES devices(id) ON DELETE CASCADE,
+    revoked_before TIMESTAMPTZ NOT NULL,
+    reason VARCHAR(50)
+);
+
+COMMENT ON TABLE device_token_revocations IS 'Токени пристрою з iat <= revoked_before вважаються відкликаними';
@@ -0,0 +1,9 @@
+-- Міграція для журналювання дій IoT-пристроїв
+-- Раніше дії пристроїв записувались з від'ємним user_id, що порушувало зовнішній ключ,
+-- тому такі записи не потрапляли в журнал.
+
+ALTER TABLE audit_logs ADD COLUMN device_id INTEGER REFERENCES devices(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_audit_logs_device_time ON audit_logs(device_id, created_at);
+
+COMMENT ON COLUMN audit_logs.device_id IS 'Пристрій, що виконав дію (NULL для дій користувачів)';
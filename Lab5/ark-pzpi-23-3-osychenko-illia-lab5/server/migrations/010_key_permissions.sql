@@ -0,0 +1,10 @@
+-- Міграція дозволу на керування ключами підпису JWT
+
+INSERT INTO permissions (name, description) VALUES
+    ('system:keys', 'Перезавантаження ключів підпису токенів')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p
+WHERE r.name = 'tech_admin' AND p.name = 'system:keys'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,23 @@
+-- Міграція для захисту входу від перебору паролів
+
+-- Стан блокування облікового запису
+ALTER TABLE users ADD COLUMN failed_login_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN last_failed_login_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN locked_until TIMESTAMPTZ;
+
+-- Журнал спроб входу для обмеження за IP-адресою
+CREATE TABLE login_attempts (
+    id BIGSERIAL PRIMARY KEY,
+    email VARCHAR(255) NOT NULL,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    ip_address INET NOT NULL,
+    success BOOLEAN NOT NULL,
+    reason VARCHAR(50),
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_login_attempts_ip_time ON login_attempts(ip_address, created_at) WHERE success = false;
+CREATE INDEX idx_login_attempts_email_time ON login_attempts(email, created_at);
+
+COMMENT ON TABLE login_attempts IS 'Спроби входу користувачів для виявлення перебору паролів';
+COMMENT ON COLUMN users.locked_until IS 'Обліковий запис заблоковано до вказаного часу після серії невдалих спроб входу';
@@ -0,0 +1,38 @@
+-- Міграція для зміни та відновлення пароля
+
+-- Черга вихідних листів. Листи додаються в черзі разом з бізнес-операцією
+-- і відправляються фоновим процесом з повторними спробами
+CREATE TABLE email_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    recipient VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    body TEXT NOT NULL,
+    sensitive BOOLEAN NOT NULL DEFAULT FALSE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    sent_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_email_outbox_pending ON email_outbox(next_attempt_at) WHERE status = 'pending';
+
+-- Одноразові токени відновлення пароля (зберігається лише SHA-256 хеш)
+CREATE TABLE password_reset_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    requested_ip INET,
+    email_id BIGINT REFERENCES email_outbox(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_password_reset_tokens_user ON password_reset_tokens(user_id, created_at);
+
+COMMENT ON TABLE password_reset_tokens IS 'Одноразові токени відновлення пароля';
+COMMENT ON TABLE email_outbox IS 'Черга вихідних email повідомлень';
+COMMENT ON COLUMN email_outbox.sensitive IS 'Лист містить одноразовий токен; текст видаляється після відправлення або коли токен втрачає силу';
+COMMENT ON COLUMN password_reset_tokens.email_id IS 'Лист з посиланням на відновлення, що містить цей токен';
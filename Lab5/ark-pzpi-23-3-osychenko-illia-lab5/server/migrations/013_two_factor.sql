@@ -0,0 +1,26 @@
+-- Міграція для двофакторної автентифікації (TOTP, RFC 6238)
+
+-- Обов'язковість 2FA для ролі
+ALTER TABLE roles ADD COLUMN mfa_required BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- TOTP секрети користувачів. confirmed_at заповнюється після підтвердження першим кодом
+CREATE TABLE user_totp (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret VARCHAR(64) NOT NULL,
+    confirmed_at TIMESTAMPTZ,
+    last_used_step BIGINT,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Одноразові коди відновлення (зберігається лише SHA-256 хеш)
+CREATE TABLE user_recovery_codes (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, code_hash)
+);
+
+COMMENT ON COLUMN roles.mfa_required IS 'Користувачі ролі не можуть увійти без двофакторної автентифікації';
+COMMENT ON COLUMN user_totp.last_used_step IS 'Останній використаний 30-секундний інтервал, захищає від повторного використання коду';
@@ -0,0 +1,40 @@
+-- Міграція API ключів для інтеграцій між сервісами
+
+CREATE TABLE api_keys (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    key_prefix VARCHAR(16) NOT NULL,
+    key_hash VARCHAR(64) NOT NULL UNIQUE,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    expires_at TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    last_used_ip INET,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Дозволи ключа: явно обрана підмножина наявних дозволів
+CREATE TABLE api_key_permissions (
+    api_key_id INTEGER NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE,
+    permission_id INTEGER NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+    PRIMARY KEY (api_key_id, permission_id)
+);
+
+COMMENT ON COLUMN api_keys.key_prefix IS 'Початок ключа для впізнавання в списку, сам ключ зберігається лише як SHA-256 хеш';
+
+-- Запити з API ключем не мають user_id, тому дії фіксуються в журналі за ключем
+ALTER TABLE audit_logs ADD COLUMN api_key_id INTEGER REFERENCES api_keys(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_audit_logs_api_key_time ON audit_logs(api_key_id, created_at);
+
+COMMENT ON COLUMN audit_logs.api_key_id IS 'API-ключ, через який виконано дію (NULL для дій користувачів та пристроїв)';
+
+INSERT INTO permissions (name, description) VALUES
+    ('api_keys:read', 'Перегляд API ключів'),
+    ('api_keys:write', 'Створення, зміна та відкликання API ключів')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p
+WHERE r.name IN ('admin', 'tech_admin') AND p.name IN ('api_keys:read', 'api_keys:write')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,20 @@
+-- Міграція для обмеження доступу диспетчерів закріпленими маршрутами
+
+-- Користувачі ролі бачать та змінюють лише призначені їм маршрути
+ALTER TABLE roles ADD COLUMN route_scoped BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Призначення маршрутів користувачам
+CREATE TABLE user_route_assignments (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    route_id INTEGER NOT NULL REFERENCES routes(id) ON DELETE CASCADE,
+    assigned_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, route_id)
+);
+
+CREATE INDEX idx_user_route_assignments_route ON user_route_assignments(route_id);
+
+-- Диспетчери працюють лише з призначеними маршрутами
+UPDATE roles SET route_scoped = TRUE WHERE name = 'dispatcher';
+
+COMMENT ON COLUMN roles.route_scoped IS 'Доступ користувачів ролі до маршрутів, рейсів та аналітики обмежується user_route_assignments';
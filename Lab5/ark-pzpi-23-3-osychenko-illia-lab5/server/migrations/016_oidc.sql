@@ -0,0 +1,34 @@
+-- Міграція для входу через OpenID Connect (authorization code + PKCE)
+
+-- Незавершені входи: state зберігається як SHA-256 хеш. code_verifier генерує клієнт і передає
+-- лише при завершенні входу, тож код і state, підкинуті з чужого браузера, не приймаються
+CREATE TABLE oidc_login_states (
+    id SERIAL PRIMARY KEY,
+    state_hash VARCHAR(64) NOT NULL UNIQUE,
+    nonce VARCHAR(64) NOT NULL,
+    code_challenge VARCHAR(64) NOT NULL,
+    link_user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_oidc_login_states_expires ON oidc_login_states(expires_at);
+
+COMMENT ON COLUMN oidc_login_states.code_challenge IS 'PKCE code_challenge (S256) від клієнта, що почав вхід';
+COMMENT ON COLUMN oidc_login_states.link_user_id IS 'Користувач, що прив''язує обліковий запис провайдера (NULL для входу)';
+
+-- Зв'язок користувача з обліковим записом у провайдері ідентичності
+CREATE TABLE user_identities (
+    issuer VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email VARCHAR(255),
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    last_login_at TIMESTAMPTZ,
+    PRIMARY KEY (issuer, subject)
+);
+
+CREATE INDEX idx_user_identities_user ON user_identities(user_id);
+
+COMMENT ON TABLE user_identities IS 'Облікові записи провайдерів OIDC (iss + sub), прив''язані до користувачів';
+COMMENT ON COLUMN users.password_hash IS 'bcrypt хеш пароля; порожній для користувачів, створених при вході через OIDC';
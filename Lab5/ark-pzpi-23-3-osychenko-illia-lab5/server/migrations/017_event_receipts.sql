@@ -0,0 +1,22 @@
+-- Міграція для ідемпотентної синхронізації подій пасажирів
+
+-- Квитанції прийнятих подій. Таблиця passenger_events секціонована за timestamp,
+-- тому унікальність (пристрій, рейс, local_id) забезпечується окремою таблицею
+CREATE TABLE passenger_event_receipts (
+    device_id INTEGER NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    trip_id INTEGER NOT NULL REFERENCES trips(id) ON DELETE CASCADE,
+    device_local_id INTEGER NOT NULL,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (device_id, trip_id, device_local_id)
+);
+
+-- Квитанції для вже збережених подій: пристрій визначається за автобусом рейсу
+INSERT INTO passenger_event_receipts (device_id, trip_id, device_local_id)
+SELECT DISTINCT d.id, pe.trip_id, pe.device_local_id
+FROM passenger_events pe
+JOIN trips t ON t.id = pe.trip_id
+JOIN devices d ON d.bus_id = t.bus_id
+WHERE pe.device_local_id IS NOT NULL
+ON CONFLICT DO NOTHING;
+
+COMMENT ON TABLE passenger_event_receipts IS 'Події, прийняті від пристроїв; повторно надіслані події з тим самим local_id пропускаються';
@@ -0,0 +1,28 @@
+-- Міграція для перевірки та звірки подій пасажирів
+
+-- Кількість, надіслана пристроєм, якщо сервер виправив passenger_count_after за поточною кількістю рейсу
+ALTER TABLE passenger_events ADD COLUMN reported_count INTEGER;
+
+-- Події, відкладені для перевірки: кількість пасажирів стала б від'ємною або перевищила місткість автобуса
+CREATE TABLE passenger_event_quarantine (
+    id SERIAL PRIMARY KEY,
+    device_id INTEGER NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    trip_id INTEGER NOT NULL REFERENCES trips(id) ON DELETE CASCADE,
+    event_type VARCHAR(10) NOT NULL CHECK (event_type IN ('entry', 'exit')),
+    timestamp TIMESTAMPTZ NOT NULL,
+    latitude DECIMAL(10,8),
+    longitude DECIMAL(11,8),
+    passenger_count_after INTEGER NOT NULL,
+    running_count INTEGER NOT NULL,
+    device_local_id INTEGER NOT NULL,
+    reason VARCHAR(50) NOT NULL,
+    reviewed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    reviewed_at TIMESTAMPTZ,
+    review_note TEXT,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_passenger_event_quarantine_trip ON passenger_event_quarantine(trip_id, timestamp);
+
+COMMENT ON COLUMN passenger_events.reported_count IS 'passenger_count_after від пристрою, якщо він не збігся з поточною кількістю рейсу';
+COMMENT ON COLUMN passenger_event_quarantine.running_count IS 'Кількість пасажирів рейсу на сервері на момент події';
@@ -0,0 +1,23 @@
+-- Міграція для телеметрії IoT-пристроїв
+
+-- Час останнього heartbeat, щоб визначати стан пристрою без запиту до часового ряду
+ALTER TABLE devices ADD COLUMN last_heartbeat_at TIMESTAMPTZ;
+
+-- Показники, які пристрій надсилає разом з heartbeat
+CREATE TABLE device_heartbeats (
+    id BIGSERIAL PRIMARY KEY,
+    device_id INTEGER NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    firmware_version VARCHAR(20),
+    uptime_seconds BIGINT NOT NULL CHECK (uptime_seconds >= 0),
+    free_heap_bytes INTEGER CHECK (free_heap_bytes >= 0),
+    buffered_events INTEGER NOT NULL CHECK (buffered_events >= 0),
+    rssi INTEGER,
+    battery_percent INTEGER CHECK (battery_percent BETWEEN 0 AND 100),
+    received_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_device_heartbeats_device_time ON device_heartbeats(device_id, received_at DESC);
+
+COMMENT ON COLUMN device_heartbeats.free_heap_bytes IS 'Вільна пам''ять пристрою, байт; NULL, якщо пристрій її не надіслав';
+COMMENT ON COLUMN device_heartbeats.rssi IS 'Рівень сигналу WiFi, dBm';
+COMMENT ON COLUMN device_heartbeats.battery_percent IS 'Заряд батареї; NULL для пристроїв з живленням від бортової мережі';
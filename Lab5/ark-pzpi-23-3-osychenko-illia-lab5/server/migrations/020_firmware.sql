@@ -0,0 +1,36 @@
+-- Міграція для оновлення прошивки IoT-пристроїв по повітрю (OTA)
+
+-- Група пристрою для поетапного розгортання прошивки (наприклад, pilot або depot-1)
+ALTER TABLE devices ADD COLUMN device_group VARCHAR(50);
+
+CREATE INDEX idx_devices_group ON devices(device_group);
+
+-- Завантажені адміністратором прошивки. Файл зберігається в БД, тож потрапляє в резервні копії
+CREATE TABLE firmware_releases (
+    id SERIAL PRIMARY KEY,
+    version VARCHAR(20) NOT NULL UNIQUE,
+    checksum_sha256 CHAR(64) NOT NULL,
+    size_bytes INTEGER NOT NULL CHECK (size_bytes > 0),
+    data BYTEA NOT NULL,
+    notes TEXT,
+    uploaded_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Призначення цільової версії пристрою, групі або всім пристроям (device_id і device_group порожні)
+CREATE TABLE firmware_rollouts (
+    id SERIAL PRIMARY KEY,
+    firmware_id INTEGER NOT NULL REFERENCES firmware_releases(id),
+    device_id INTEGER REFERENCES devices(id) ON DELETE CASCADE,
+    device_group VARCHAR(50),
+    rollout_percent INTEGER NOT NULL DEFAULT 100 CHECK (rollout_percent BETWEEN 0 AND 100),
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    CHECK (device_id IS NULL OR device_group IS NULL)
+);
+
+CREATE INDEX idx_firmware_rollouts_active ON firmware_rollouts(is_active) WHERE is_active;
+
+COMMENT ON COLUMN firmware_rollouts.rollout_percent IS 'Частка пристроїв цілі, що отримують оновлення; вибір пристроїв стабільний при збільшенні частки';
@@ -0,0 +1,15 @@
+-- Міграція для перевірки рекомендацій цін від IoT-пристроїв
+
+-- Ціна, перерахована сервером за фактичною завантаженістю та часом відправлення рейсу,
+-- та ознака, що рекомендація пристрою розходиться з нею більше допустимого
+ALTER TABLE price_recommendations
+    ADD COLUMN device_id INTEGER REFERENCES devices(id) ON DELETE SET NULL,
+    ADD COLUMN server_price DECIMAL(10,2),
+    ADD COLUMN server_occupancy_rate DECIMAL(5,2),
+    ADD COLUMN is_flagged BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN divergence_reason VARCHAR(50);
+
+CREATE INDEX idx_price_recommendations_flagged ON price_recommendations(trip_id, created_at) WHERE is_flagged;
+
+COMMENT ON COLUMN price_recommendations.server_price IS 'Ціна, розрахована сервером для тих самих умов; NULL для рекомендацій до перевірки';
+COMMENT ON COLUMN price_recommendations.divergence_reason IS 'base_price_mismatch, occupancy_mismatch або price_mismatch';